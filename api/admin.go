@@ -0,0 +1,24 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdminToken refuses the requests which do not carry token as their bearer token. An empty
+// token refuses every request.
+func requireAdminToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			presented, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+			if !found || token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				response.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				WriteProblem(response, request, CodeUnauthorized, "missing or invalid admin token")
+				return
+			}
+
+			next.ServeHTTP(response, request)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+)
+
+// BackupMediaType is the media type of the backups: gzip compressed JSON lines.
+const BackupMediaType = "application/gzip"
+
+// DefaultMaxRestoreSize is the size in bytes of the largest backup accepted by the restore, unless
+// set with WithMaxRestoreSize.
+const DefaultMaxRestoreSize = 1 << 30
+
+type BackupSummary struct {
+	Devices    int `json:"devices"`
+	Signatures int `json:"signatures"`
+}
+
+// BackupStore streams a backup of every device, their private keys wrapped with the backup key.
+func (s *Server) BackupStore(response http.ResponseWriter, request *http.Request) {
+	filename := "backup-" + time.Now().UTC().Format("20060102T150405Z") + ".jsonl.gz"
+	w := &attachmentWriter{response: response, mediaType: BackupMediaType, filename: filename}
+	_, err := s.backup.Backup(request.Context(), w)
+	if err != nil && !w.started {
+		WriteError(response, request, err)
+		return
+	}
+	if err != nil {
+		// a truncated backup has no trailer: it is rejected when restored
+		logging.FromContext(request.Context()).ErrorContext(request.Context(), "backup aborted", slog.String("error", err.Error()))
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// RestoreStore restores a backup. The backup is spooled to a temporary file first, since it is
+// read twice: to be verified, then to be restored.
+func (s *Server) RestoreStore(response http.ResponseWriter, request *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || mediaType != BackupMediaType {
+		WriteError(response, request, invalidPayload(errors.New("expected a backup of media type "+BackupMediaType)))
+		return
+	}
+
+	file, err := os.CreateTemp("", "restore-*.jsonl.gz")
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	body := http.MaxBytesReader(response, request.Body, s.maxRestoreSize)
+	if _, err := io.Copy(file, body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteProblem(response, request, CodePayloadTooLarge, fmt.Sprintf("backups are limited to %v bytes", tooLarge.Limit))
+			return
+		}
+		WriteError(response, request, invalidPayload(err))
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	summary, err := s.backup.Restore(request.Context(), file)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, BackupSummary{
+		Devices:    summary.Devices,
+		Signatures: summary.Signatures,
+	})
+}
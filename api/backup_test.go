@@ -0,0 +1,110 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asAdmin returns header carrying the admin token.
+func asAdmin(header http.Header) http.Header {
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Authorization", "Bearer "+servicetest.AdminToken)
+	return header
+}
+
+func TestBackupRestoresIntoAnotherService(t *testing.T) {
+	backupKey := bytes.Repeat([]byte{1}, crypto.KeyEncryptionKeySize)
+	source := servicetest.New(t, servicetest.WithBackups(backupKey)).Handler()
+	for _, id := range []string{"some-id", "other-id"} {
+		created := do(t, source, http.MethodPut, "/api/v0/devices/"+id, `{"signature_alg": "ECC"}`, nil)
+		require.Equal(t, http.StatusCreated, created.Code)
+	}
+	signed := do(t, source, http.MethodPost, "/api/v0/devices/some-id/sign", `{"data_to_be_signed": "some-data"}`, nil)
+	require.Equal(t, http.StatusOK, signed.Code)
+
+	backedUp := do(t, source, http.MethodGet, "/api/v0/admin/backup", "", asAdmin(nil))
+	require.Equal(t, http.StatusOK, backedUp.Code, backedUp.Body.String())
+	assert.Equal(t, api.BackupMediaType, backedUp.Header().Get("Content-Type"))
+	assert.Contains(t, backedUp.Header().Get("Content-Disposition"), "attachment; filename=backup-")
+
+	destination := servicetest.New(t, servicetest.WithBackups(backupKey)).Handler()
+	restored := do(t, destination, http.MethodPost, "/api/v0/admin/restore", backedUp.Body.String(), asAdmin(http.Header{"Content-Type": {api.BackupMediaType}}))
+	require.Equal(t, http.StatusOK, restored.Code, restored.Body.String())
+	var summary struct {
+		Data api.BackupSummary `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(restored.Body.Bytes(), &summary))
+	assert.Equal(t, api.BackupSummary{Devices: 2, Signatures: 1}, summary.Data)
+
+	// the restored device signs on from where the backup left it
+	next := do(t, destination, http.MethodPost, "/api/v0/devices/some-id/sign", `{"data_to_be_signed": "some-data"}`, nil)
+	require.Equal(t, http.StatusOK, next.Code, next.Body.String())
+	assert.Contains(t, next.Body.String(), `"signed_data": "1_some-data_`)
+
+	again := do(t, destination, http.MethodPost, "/api/v0/admin/restore", backedUp.Body.String(), asAdmin(http.Header{"Content-Type": {api.BackupMediaType}}))
+	assert.Equal(t, http.StatusConflict, again.Code)
+}
+
+func TestRestoreRejectsBackupsOfOtherKeys(t *testing.T) {
+	source := servicetest.New(t, servicetest.WithBackups(bytes.Repeat([]byte{1}, crypto.KeyEncryptionKeySize))).Handler()
+	created := do(t, source, http.MethodPut, "/api/v0/devices/some-id", `{"signature_alg": "RSA"}`, nil)
+	require.Equal(t, http.StatusCreated, created.Code)
+	backedUp := do(t, source, http.MethodGet, "/api/v0/admin/backup", "", asAdmin(nil))
+	require.Equal(t, http.StatusOK, backedUp.Code)
+
+	destination := servicetest.New(t, servicetest.WithBackups(bytes.Repeat([]byte{2}, crypto.KeyEncryptionKeySize))).Handler()
+	restored := do(t, destination, http.MethodPost, "/api/v0/admin/restore", backedUp.Body.String(), asAdmin(http.Header{"Content-Type": {api.BackupMediaType}}))
+	assert.Equal(t, http.StatusBadRequest, restored.Code)
+	assert.Contains(t, restored.Body.String(), "private keys are wrapped with key")
+	assert.Equal(t, http.StatusNotFound, do(t, destination, http.MethodGet, "/api/v0/devices/some-id", "", nil).Code)
+}
+
+func TestAdminRoutesRequireTheAdminToken(t *testing.T) {
+	handler := servicetest.New(t, servicetest.WithBackups(bytes.Repeat([]byte{1}, crypto.KeyEncryptionKeySize))).Handler()
+
+	for _, authorization := range []string{"", "Bearer other-token", "Basic " + servicetest.AdminToken, servicetest.AdminToken} {
+		header := http.Header{}
+		if authorization != "" {
+			header.Set("Authorization", authorization)
+		}
+		backedUp := do(t, handler, http.MethodGet, "/api/v0/admin/backup", "", header)
+		assert.Equal(t, http.StatusUnauthorized, backedUp.Code, authorization)
+		assert.Equal(t, `Bearer realm="admin"`, backedUp.Header().Get("WWW-Authenticate"))
+		assert.Contains(t, backedUp.Body.String(), `"code": "unauthorized"`)
+
+		header.Set("Content-Type", api.BackupMediaType)
+		restored := do(t, handler, http.MethodPost, "/api/v0/admin/restore", "backup", header)
+		assert.Equal(t, http.StatusUnauthorized, restored.Code, authorization)
+	}
+
+	// without an admin token, the admin routes are served to nobody
+	services := servicetest.New(t, servicetest.WithBackups(bytes.Repeat([]byte{1}, crypto.KeyEncryptionKeySize)))
+	unconfigured := servicetest.Handler(services.Signature, api.WithBackups(services.Backup, ""))
+	assert.Equal(t, http.StatusUnauthorized, do(t, unconfigured, http.MethodGet, "/api/v0/admin/backup", "", http.Header{"Authorization": {"Bearer "}}).Code)
+}
+
+func TestRestoreRejectsTooLargeBackups(t *testing.T) {
+	backupKey := bytes.Repeat([]byte{1}, crypto.KeyEncryptionKeySize)
+	source := servicetest.New(t, servicetest.WithBackups(backupKey)).Handler()
+	created := do(t, source, http.MethodPut, "/api/v0/devices/some-id", `{"signature_alg": "ECC"}`, nil)
+	require.Equal(t, http.StatusCreated, created.Code)
+	backedUp := do(t, source, http.MethodGet, "/api/v0/admin/backup", "", asAdmin(nil))
+	require.Equal(t, http.StatusOK, backedUp.Code)
+
+	destination := servicetest.New(t, servicetest.WithBackups(backupKey)).Handler(api.WithMaxRestoreSize(int64(backedUp.Body.Len() - 1)))
+	restored := do(t, destination, http.MethodPost, "/api/v0/admin/restore", backedUp.Body.String(), asAdmin(http.Header{"Content-Type": {api.BackupMediaType}}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, restored.Code)
+	assert.Contains(t, restored.Body.String(), `"code": "payload_too_large"`)
+	assert.Equal(t, http.StatusNotFound, do(t, destination, http.MethodGet, "/api/v0/devices/some-id", "", nil).Code)
+}
@@ -2,25 +2,41 @@ package api
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
-	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
-	"github.com/go-playground/validator"
+	"github.com/google/uuid"
 )
 
+const devicesPath = "/api/v0/devices"
+
 type NewSignatureDevice struct {
 	SignatureAlg string `json:"signature_alg"`
 	Label string `json:"label"`
+	Metadata map[string]string `json:"metadata"`
+	Tags []string `json:"tags"`
 }
 
 type SignatureDevice struct {
 	ID string `json:"id"`
 	SignatureAlg string `json:"signature_alg"`
 	Label string `json:"label"`
+	Metadata map[string]string `json:"metadata"`
+	Tags []string `json:"tags"`
 	SignatureCounter int `json:"signature_counter"`
+	PublicKey string `json:"public_key"`
+	Status string `json:"status"`
+	KeyVersion int `json:"key_version"`
+}
+
+// UpdateSignatureDevice is a JSON merge patch of the user editable fields of a device.
+type UpdateSignatureDevice struct {
+	Label *string `json:"label"`
+	Metadata map[string]*string `json:"metadata"`
+	Tags []string `json:"tags"`
+	Status *string `json:"status"`
 }
 
 type SignatureReq struct {
@@ -32,42 +48,47 @@ type SignatureResp struct {
 	SignedData string `json:"signed_data"`
 }
 
-type APIError struct {
-	Message string `json:"message"`
+// CreateSigningDevice creates a device with the ID chosen by the client.
+func (s *Server) CreateSigningDevice(response http.ResponseWriter, request *http.Request) {
+	s.createSigningDevice(response, request, request.PathValue("id"))
 }
 
-func (s *Server) CreateSigningDevice(response http.ResponseWriter, request *http.Request) {
-	id := request.PathValue("id")
+// CreateSigningDeviceWithGeneratedID creates a device with an ID assigned by the server.
+func (s *Server) CreateSigningDeviceWithGeneratedID(response http.ResponseWriter, request *http.Request) {
+	s.createSigningDevice(response, request, uuid.NewString())
+}
 
+// createSigningDevice answers 201 when the device is created and 200 when an identical
+// device already exists, so that clients can safely retry; both point to the device location.
+func (s *Server) createSigningDevice(response http.ResponseWriter, request *http.Request, id string) {
 	var device NewSignatureDevice
-	err := json.NewDecoder(request.Body).Decode(&device)
-	if err != nil {
-		var ve validator.ValidationErrors
-		if errors.As(err, &ve) {
-			WriteAPIResponse(response, http.StatusBadRequest, APIError{
-				Message: fmt.Sprintf("invalid request payload: %v", ve.Error()),
-			})
-			return
-		}
-		WriteAPIResponse(response, http.StatusInternalServerError, APIError{
-			Message: "unexpected error",
-		})
+	if err := json.NewDecoder(request.Body).Decode(&device); err != nil {
+		WriteError(response, request, invalidPayload(err))
 		return
 	}
 
-	if err = s.signatureService.CreateSignatureDevice(request.Context(), signature.NewSignatureDevice{
+	signDevice, created, err := s.signatureService.CreateSignatureDevice(request.Context(), signature.NewSignatureDevice{
 		ID: id,
-		Tenant: "1", // we do not care about the tenant at this stage
+		Tenant: signature.DefaultTenant,
 		SignatureAlg: device.SignatureAlg,
 		Label: device.Label,
-	}); err != nil {
-		WriteAPIResponse(response, http.StatusBadRequest, APIError{
-			Message: fmt.Sprintf("error creating a signature device: %v", err), // we should handle that better
-		})
+		Metadata: device.Metadata,
+		Tags: device.Tags,
+	})
+	if err != nil {
+		WriteError(response, request, err)
+		return
 	}
-	
 
-	WriteAPIResponse(response, http.StatusOK, "OK") // TODO: we should return a more structured response with a link to the resource
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	response.Header().Set("Location", deviceLocation(signDevice.ID))
+	if signDevice.Version != "" {
+		response.Header().Set("ETag", etag(signDevice.Version))
+	}
+	WriteAPIResponse(response, status, toSignatureDevice(signDevice))
 }
 
 func (s *Server) GetSigningDevice(response http.ResponseWriter, request *http.Request) {
@@ -75,51 +96,122 @@ func (s *Server) GetSigningDevice(response http.ResponseWriter, request *http.Re
 
 	signDevice, err := s.signatureService.GetSignatureDevice(request.Context(), id)
 	if err != nil {
-		if errors.Is(store.ErrDeviceNotFound, err) {
-			WriteAPIResponse(response, http.StatusNotFound, APIError{
-				Message: "signature device not found",
-			})
-			return
+		WriteError(response, request, err)
+		return
+	}
+
+	response.Header().Set("ETag", etag(signDevice.Version))
+	WriteAPIResponse(response, http.StatusOK, toSignatureDevice(signDevice))
+}
+
+// ListSigningDevices lists the devices ordered by ID. They can be filtered by tags
+// (?tag=a&tag=b) and by metadata entries (?metadata[key]=value), all of which must match.
+func (s *Server) ListSigningDevices(response http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	filter := signature.ListFilter{
+		Tags: query["tag"],
+		Metadata: map[string]string{},
+	}
+	for param, values := range query {
+		if key, found := strings.CutPrefix(param, "metadata["); found && strings.HasSuffix(key, "]") && len(values) > 0 {
+			filter.Metadata[strings.TrimSuffix(key, "]")] = values[0]
 		}
+	}
 
-		WriteAPIResponse(response, http.StatusInternalServerError, APIError{
-			Message: fmt.Sprintf("error getting signature device: %v", err),
-		})
+	signDevices, err := s.signatureService.ListSignatureDevices(request.Context(), filter)
+	if err != nil {
+		WriteError(response, request, err)
 		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, SignatureDevice{
-		ID: signDevice.ID,
-		SignatureAlg: signDevice.SignatureAlg,
-		Label: signDevice.Label,
-		SignatureCounter: signDevice.SignatureCounter,
-	}) // TODO: we should return a more structured response with a link to the resource
+	devices := make([]SignatureDevice, 0, len(signDevices))
+	for _, signDevice := range signDevices {
+		devices = append(devices, toSignatureDevice(signDevice))
+	}
+	WriteAPIResponse(response, http.StatusOK, devices)
+}
+
+// UpdateSigningDevice applies a merge patch to the device, guarded by the If-Match header.
+func (s *Server) UpdateSigningDevice(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+
+	version, ok := ifMatchVersion(request)
+	if !ok {
+		WriteProblem(response, request, CodePreconditionRequired, "an If-Match header with the device ETag is required")
+		return
+	}
+
+	var update UpdateSignatureDevice
+	if err := json.NewDecoder(request.Body).Decode(&update); err != nil {
+		WriteError(response, request, invalidPayload(err))
+		return
+	}
+
+	signDevice, err := s.signatureService.UpdateSignatureDevice(request.Context(), id, signature.UpdateSignatureDevice{
+		Label: update.Label,
+		Metadata: update.Metadata,
+		Tags: update.Tags,
+		Status: update.Status,
+	}, version)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	response.Header().Set("ETag", etag(signDevice.Version))
+	WriteAPIResponse(response, http.StatusOK, toSignatureDevice(signDevice))
+}
+
+// RotateSigningDeviceKey replaces the key pair of the device, guarded by the If-Match header.
+func (s *Server) RotateSigningDeviceKey(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+
+	version, ok := ifMatchVersion(request)
+	if !ok {
+		WriteProblem(response, request, CodePreconditionRequired, "an If-Match header with the device ETag is required")
+		return
+	}
+
+	signDevice, err := s.signatureService.RotateSignatureDeviceKey(request.Context(), id, version)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	response.Header().Set("ETag", etag(signDevice.Version))
+	WriteAPIResponse(response, http.StatusOK, toSignatureDevice(signDevice))
+}
+
+// DeleteSigningDevice deletes the device, guarded by the If-Match header.
+func (s *Server) DeleteSigningDevice(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+
+	version, ok := ifMatchVersion(request)
+	if !ok {
+		WriteProblem(response, request, CodePreconditionRequired, "an If-Match header with the device ETag is required")
+		return
+	}
+
+	if err := s.signatureService.DeleteSignatureDevice(request.Context(), id, version); err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
 }
 
 func (s *Server) SignData(response http.ResponseWriter, request *http.Request) {
 	id := request.PathValue("id")
 
 	var signatureReq SignatureReq
-	err := json.NewDecoder(request.Body).Decode(&signatureReq)
-	if err != nil {
-		WriteAPIResponse(response, http.StatusBadRequest, APIError{
-			Message: "invalid request payload",
-		})
+	if err := json.NewDecoder(request.Body).Decode(&signatureReq); err != nil {
+		WriteError(response, request, invalidPayload(err))
 		return
 	}
 
 	signedData, err := s.signatureService.SignData(request.Context(), id, signatureReq.DataToBeSigned)
 	if err != nil {
-		if errors.Is(store.ErrDeviceNotFound, err) {
-			WriteAPIResponse(response, http.StatusNotFound, APIError{
-				Message: "signature device not found",
-			})
-			return
-		}
-
-		WriteAPIResponse(response, http.StatusInternalServerError, APIError{
-			Message: fmt.Sprintf("error signing the message: %v", err),
-		})
+		WriteError(response, request, err)
 		return
 	}
 
@@ -127,4 +219,32 @@ func (s *Server) SignData(response http.ResponseWriter, request *http.Request) {
 		Signature: signedData.Signature,
 		SignedData: signedData.SignedData,
 	})
+}
+
+func toSignatureDevice(signDevice signature.SignatureDevice) SignatureDevice {
+	// always render collections as JSON objects and arrays, never as null
+	metadata := signDevice.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	tags := signDevice.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return SignatureDevice{
+		ID: signDevice.ID,
+		SignatureAlg: signDevice.SignatureAlg,
+		Label: signDevice.Label,
+		Metadata: metadata,
+		Tags: tags,
+		SignatureCounter: signDevice.SignatureCounter,
+		PublicKey: string(signDevice.PublicKey),
+		Status: signDevice.Status,
+		KeyVersion: signDevice.KeyVersion,
+	}
+}
+
+func deviceLocation(id string) string {
+	return devicesPath + "/" + url.PathEscape(id)
 }
\ No newline at end of file
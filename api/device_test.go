@@ -1,3 +1,257 @@
 package api_test
 
-// TODO: add tests
\ No newline at end of file
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto/cryptotest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func do(t testing.TB, handler http.Handler, method string, path string, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func TestUpdateAndDeleteRequireMatchingETag(t *testing.T) {
+	handler := servicetest.New(t).Handler()
+
+	created := do(t, handler, http.MethodPut, "/api/v0/devices/some-id", `{"signature_alg": "ECC", "label": "some-label"}`, nil)
+	require.Equal(t, http.StatusCreated, created.Code)
+	assert.Equal(t, "/api/v0/devices/some-id", created.Header().Get("Location"))
+
+	got := do(t, handler, http.MethodGet, "/api/v0/devices/some-id", "", nil)
+	require.Equal(t, http.StatusOK, got.Code)
+	currentETag := got.Header().Get("ETag")
+	require.NotEmpty(t, currentETag)
+
+	missing := do(t, handler, http.MethodPatch, "/api/v0/devices/some-id", `{"label": "other-label"}`, nil)
+	assert.Equal(t, http.StatusPreconditionRequired, missing.Code)
+
+	stale := do(t, handler, http.MethodPatch, "/api/v0/devices/some-id", `{"label": "other-label"}`, http.Header{"If-Match": {`"stale"`}})
+	assert.Equal(t, http.StatusPreconditionFailed, stale.Code)
+	assert.Contains(t, stale.Body.String(), `"code": "version_mismatch"`)
+
+	patched := do(t, handler, http.MethodPatch, "/api/v0/devices/some-id", `{"label": "other-label", "metadata": {"store": "berlin", "register": null}}`, http.Header{"If-Match": {currentETag}})
+	require.Equal(t, http.StatusOK, patched.Code)
+	var response struct {
+		Data api.SignatureDevice `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(patched.Body.Bytes(), &response))
+	assert.Equal(t, "other-label", response.Data.Label)
+	assert.Equal(t, map[string]string{"store": "berlin"}, response.Data.Metadata)
+	assert.Equal(t, "ECC", response.Data.SignatureAlg)
+	assert.NotEqual(t, currentETag, patched.Header().Get("ETag"))
+
+	deletedWithOldETag := do(t, handler, http.MethodDelete, "/api/v0/devices/some-id", "", http.Header{"If-Match": {currentETag}})
+	assert.Equal(t, http.StatusPreconditionFailed, deletedWithOldETag.Code)
+
+	deleted := do(t, handler, http.MethodDelete, "/api/v0/devices/some-id", "", http.Header{"If-Match": {patched.Header().Get("ETag")}})
+	assert.Equal(t, http.StatusNoContent, deleted.Code)
+
+	gone := do(t, handler, http.MethodGet, "/api/v0/devices/some-id", "", nil)
+	assert.Equal(t, http.StatusNotFound, gone.Code)
+}
+
+func TestListDevicesFilteredByTagsAndMetadata(t *testing.T) {
+	handler := servicetest.New(t).Handler()
+
+	for _, body := range []string{
+		`{"signature_alg": "ECC", "metadata": {"store": "berlin", "register": "1"}, "tags": ["pos", "test"]}`,
+		`{"signature_alg": "ECC", "metadata": {"store": "berlin", "register": "2"}, "tags": ["pos"]}`,
+		`{"signature_alg": "ECC", "metadata": {"store": "munich", "register": "1"}, "tags": ["pos"]}`,
+	} {
+		require.Equal(t, http.StatusCreated, do(t, handler, http.MethodPost, "/api/v0/devices", body, nil).Code)
+	}
+
+	tests := []struct{
+		query string
+		expected int
+	}{
+		{query: "", expected: 3},
+		{query: "?tag=pos", expected: 3},
+		{query: "?tag=pos&tag=test", expected: 1},
+		{query: "?metadata[store]=berlin", expected: 2},
+		{query: "?metadata[store]=berlin&metadata[register]=2", expected: 1},
+		{query: "?metadata[store]=hamburg", expected: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			listed := do(t, handler, http.MethodGet, "/api/v0/devices"+tc.query, "", nil)
+			require.Equal(t, http.StatusOK, listed.Code)
+
+			var response struct {
+				Data []api.SignatureDevice `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(listed.Body.Bytes(), &response))
+			assert.Len(t, response.Data, tc.expected)
+			for i := 1; i < len(response.Data); i++ {
+				assert.Less(t, response.Data[i-1].ID, response.Data[i].ID)
+			}
+		})
+	}
+}
+
+func TestSuspendReactivateAndRotateKey(t *testing.T) {
+	handler := servicetest.New(t).Handler()
+
+	created := do(t, handler, http.MethodPut, "/api/v0/devices/some-id", `{"signature_alg": "ECC"}`, nil)
+	require.Equal(t, http.StatusCreated, created.Code)
+	var device struct {
+		Data api.SignatureDevice `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(created.Body.Bytes(), &device))
+	assert.Equal(t, "active", device.Data.Status)
+	assert.Equal(t, 1, device.Data.KeyVersion)
+
+	got := do(t, handler, http.MethodGet, "/api/v0/devices/some-id", "", nil)
+	require.Equal(t, http.StatusOK, got.Code)
+
+	suspended := do(t, handler, http.MethodPatch, "/api/v0/devices/some-id", `{"status": "suspended"}`, http.Header{"If-Match": {got.Header().Get("ETag")}})
+	require.Equal(t, http.StatusOK, suspended.Code)
+
+	refused := do(t, handler, http.MethodPost, "/api/v0/devices/some-id/sign", `{"data_to_be_signed": "some-data"}`, nil)
+	assert.Equal(t, http.StatusConflict, refused.Code)
+	assert.Contains(t, refused.Body.String(), `"code": "device_inactive"`)
+
+	reactivated := do(t, handler, http.MethodPatch, "/api/v0/devices/some-id", `{"status": "active"}`, http.Header{"If-Match": {suspended.Header().Get("ETag")}})
+	require.Equal(t, http.StatusOK, reactivated.Code)
+
+	missing := do(t, handler, http.MethodPost, "/api/v0/devices/some-id/rotate-key", "", nil)
+	assert.Equal(t, http.StatusPreconditionRequired, missing.Code)
+
+	rotated := do(t, handler, http.MethodPost, "/api/v0/devices/some-id/rotate-key", "", http.Header{"If-Match": {reactivated.Header().Get("ETag")}})
+	require.Equal(t, http.StatusOK, rotated.Code)
+	var rotatedDevice struct {
+		Data api.SignatureDevice `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rotated.Body.Bytes(), &rotatedDevice))
+	assert.Equal(t, 2, rotatedDevice.Data.KeyVersion)
+	assert.NotEqual(t, device.Data.PublicKey, rotatedDevice.Data.PublicKey)
+
+	signed := do(t, handler, http.MethodPost, "/api/v0/devices/some-id/sign", `{"data_to_be_signed": "some-data"}`, nil)
+	assert.Equal(t, http.StatusOK, signed.Code)
+}
+
+// harness serves the API over a real HTTP connection, backed by a signature.Service on the in-memory store.
+type harness struct {
+	t *testing.T
+	server *httptest.Server
+}
+
+func newHarness(t *testing.T) *harness {
+	server := httptest.NewServer(servicetest.New(t).Handler())
+	t.Cleanup(server.Close)
+
+	return &harness{t: t, server: server}
+}
+
+// request sends a JSON body, when not empty, and decodes the data of a successful response into data.
+func (h *harness) request(method string, path string, body string, expectedStatus int, data any) {
+	h.t.Helper()
+
+	request, err := http.NewRequest(method, h.server.URL+path, strings.NewReader(body))
+	require.NoError(h.t, err)
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := h.server.Client().Do(request)
+	require.NoError(h.t, err)
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	require.NoError(h.t, err)
+	require.Equal(h.t, expectedStatus, response.StatusCode, string(responseBody))
+	if data != nil {
+		require.NoError(h.t, json.Unmarshal(responseBody, &api.Response{Data: data}))
+	}
+}
+
+func (h *harness) createDevice(id string, signatureAlg string) api.SignatureDevice {
+	h.t.Helper()
+
+	var device api.SignatureDevice
+	h.request(http.MethodPut, "/api/v0/devices/"+id, fmt.Sprintf(`{"signature_alg": %q, "label": "harness"}`, signatureAlg), http.StatusCreated, &device)
+	return device
+}
+
+func (h *harness) getDevice(id string) api.SignatureDevice {
+	h.t.Helper()
+
+	var device api.SignatureDevice
+	h.request(http.MethodGet, "/api/v0/devices/"+id, "", http.StatusOK, &device)
+	return device
+}
+
+func (h *harness) sign(id string, data string) api.SignatureResp {
+	h.t.Helper()
+
+	var signature api.SignatureResp
+	h.request(http.MethodPost, "/api/v0/devices/"+id+"/sign", fmt.Sprintf(`{"data_to_be_signed": %q}`, data), http.StatusOK, &signature)
+	return signature
+}
+
+// verifySignature checks signatureBase64 over signedData against the PEM encoded public key of a device.
+func TestSigningSpecification(t *testing.T) {
+	for _, signatureAlg := range []string{"RSA", "ECC"} {
+		t.Run(signatureAlg, func(t *testing.T) {
+			h := newHarness(t)
+			id := "device-" + strings.ToLower(signatureAlg)
+
+			device := h.createDevice(id, signatureAlg)
+			assert.Equal(t, 0, device.SignatureCounter)
+
+			// the first signature chains from the encoded device ID, every following one from the previous signature
+			lastSignature := base64.StdEncoding.EncodeToString([]byte(id))
+			for counter, data := range []string{"first", "second with spaces", "third_with_underscores", "4", ""} {
+				signed := h.sign(id, data)
+
+				assert.Equal(t, fmt.Sprintf("%v_%v_%v", counter, data, lastSignature), signed.SignedData)
+				cryptotest.VerifySignature(t, signatureAlg, device.PublicKey, signed.SignedData, signed.Signature)
+				assert.Equal(t, counter+1, h.getDevice(id).SignatureCounter)
+
+				lastSignature = signed.Signature
+			}
+		})
+	}
+}
+
+func TestSignatureChainsAreIndependentPerDevice(t *testing.T) {
+	h := newHarness(t)
+	rsaDevice := h.createDevice("some-id", "RSA")
+	eccDevice := h.createDevice("other-id", "ECC")
+
+	first := h.sign("some-id", "data")
+	other := h.sign("other-id", "data")
+	second := h.sign("some-id", "data")
+
+	assert.Equal(t, "0_data_"+base64.StdEncoding.EncodeToString([]byte("other-id")), other.SignedData)
+	assert.Equal(t, "1_data_"+first.Signature, second.SignedData)
+	cryptotest.VerifySignature(t, "RSA", rsaDevice.PublicKey, second.SignedData, second.Signature)
+	cryptotest.VerifySignature(t, "ECC", eccDevice.PublicKey, other.SignedData, other.Signature)
+	assert.Equal(t, 2, h.getDevice("some-id").SignatureCounter)
+	assert.Equal(t, 1, h.getDevice("other-id").SignatureCounter)
+
+	h.request(http.MethodPost, "/api/v0/devices/unknown-id/sign", `{"data_to_be_signed": "data"}`, http.StatusNotFound, nil)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// etag derives a strong entity tag from a store version.
+func etag(version string) string {
+	return `"` + version + `"`
+}
+
+// ifMatchVersion extracts the store version from the If-Match header of request.
+// Only a single strong entity tag is accepted: weak tags and "*" cannot guard
+// against lost updates on a device.
+func ifMatchVersion(request *http.Request) (string, bool) {
+	value := strings.TrimSpace(request.Header.Get("If-Match"))
+	if len(value) < 2 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		return "", false
+	}
+
+	version := value[1 : len(value)-1]
+	if version == "" || strings.Contains(version, `"`) {
+		return "", false
+	}
+
+	return version, true
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/events"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+)
+
+// EventStreamMediaType is the media type of server-sent events streams.
+const EventStreamMediaType = "text/event-stream"
+
+// keepAliveInterval is how often an idle events stream gets a comment, so that proxies keep it open.
+const keepAliveInterval = 15 * time.Second
+
+type SignatureEvent struct {
+	DeviceID         string `json:"device_id"`
+	SignatureCounter int    `json:"signature_counter"`
+	Signature        string `json:"signature"`
+}
+
+// DeviceEvents streams the changes of a device as server-sent events. Clients reconnecting with
+// the Last-Event-ID header first get the retained events they missed, or a reset event carrying
+// the current device when some of them are lost. The stream ends once the device is deleted.
+func (s *Server) DeviceEvents(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+
+	var missed []events.Event
+	var received <-chan events.Event
+	var cancel func()
+	// an invalid Last-Event-ID is ignored and the stream starts from the next event
+	if lastID, err := strconv.ParseUint(request.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		missed, received, cancel = s.events.Resume(id, lastID)
+	} else {
+		received, cancel = s.events.Subscribe(id)
+	}
+	defer cancel()
+
+	// the device is read once subscribed, so that no change falls between the two
+	signDevice, err := s.signatureService.GetSignatureDevice(request.Context(), id)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+	if len(missed) > 0 && missed[0].Type == events.TypeReset {
+		missed[0].Data = signDevice
+	}
+
+	controller := http.NewResponseController(response)
+	response.Header().Set("Content-Type", EventStreamMediaType)
+	response.Header().Set("Cache-Control", "no-cache")
+	response.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	for _, event := range missed {
+		if !writeEvent(response, request, controller, event) {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(response, ": keep-alive\n\n")
+			if controller.Flush() != nil {
+				return
+			}
+		case event, open := <-received:
+			// a closed channel means the client could not keep up: it will resume with Last-Event-ID
+			if !open || !writeEvent(response, request, controller, event) {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes event to the stream and reports whether the stream should go on.
+func writeEvent(response http.ResponseWriter, request *http.Request, controller *http.ResponseController, event events.Event) bool {
+	data, err := json.Marshal(toEventData(event.Data))
+	if err != nil {
+		logging.FromContext(request.Context()).ErrorContext(request.Context(), "error encoding device event",
+			slog.String("error", err.Error()),
+			slog.Uint64("event_id", event.ID),
+		)
+		return false
+	}
+
+	fmt.Fprintf(response, "id: %v\nevent: %v\ndata: %s\n\n", event.ID, event.Type, data)
+	if controller.Flush() != nil {
+		return false
+	}
+
+	return event.Type != signature.EventDeviceDeleted
+}
+
+func toEventData(data any) any {
+	switch data := data.(type) {
+	case signature.SignatureDevice:
+		return toSignatureDevice(data)
+	case signature.SignatureCreated:
+		return SignatureEvent{
+			DeviceID:         data.DeviceID,
+			SignatureCounter: data.SignatureCounter,
+			Signature:        data.Signature,
+		}
+	default:
+		return data
+	}
+}
@@ -0,0 +1,142 @@
+package api_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/events"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sentEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+func send(t *testing.T, server *httptest.Server, method string, path string, body string) *http.Response {
+	t.Helper()
+
+	request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	response.Body.Close()
+
+	return response
+}
+
+func subscribe(t *testing.T, server *httptest.Server, path string, lastEventID string) *bufio.Reader {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	t.Cleanup(func() { response.Body.Close() })
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, api.EventStreamMediaType, response.Header.Get("Content-Type"))
+
+	return bufio.NewReader(response.Body)
+}
+
+func readEvent(t *testing.T, reader *bufio.Reader) sentEvent {
+	t.Helper()
+
+	var event sentEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestDeviceEventsStreamsChanges(t *testing.T) {
+	server := httptest.NewServer(servicetest.New(t, servicetest.WithEvents()).Handler())
+	t.Cleanup(server.Close)
+	require.Equal(t, http.StatusCreated, send(t, server, http.MethodPut, "/api/v0/devices/some-id", `{"signature_alg": "ECC"}`).StatusCode)
+
+	stream := subscribe(t, server, "/api/v0/devices/some-id/events", "")
+	require.Equal(t, http.StatusOK, send(t, server, http.MethodPost, "/api/v0/devices/some-id/sign", `{"data_to_be_signed": "some-data"}`).StatusCode)
+
+	event := readEvent(t, stream)
+	assert.Equal(t, "2", event.id)
+	assert.Equal(t, signature.EventSignatureCreated, event.event)
+	var signed api.SignatureEvent
+	require.NoError(t, json.Unmarshal([]byte(event.data), &signed))
+	assert.Equal(t, "some-id", signed.DeviceID)
+	assert.Equal(t, 1, signed.SignatureCounter)
+	assert.NotEmpty(t, signed.Signature)
+}
+
+func TestDeviceEventsResumeAfterLastEventID(t *testing.T) {
+	server := httptest.NewServer(servicetest.New(t, servicetest.WithEvents()).Handler())
+	t.Cleanup(server.Close)
+	require.Equal(t, http.StatusCreated, send(t, server, http.MethodPut, "/api/v0/devices/some-id", `{"signature_alg": "ECC"}`).StatusCode)
+	require.Equal(t, http.StatusCreated, send(t, server, http.MethodPut, "/api/v0/devices/other-id", `{"signature_alg": "ECC"}`).StatusCode)
+	require.Equal(t, http.StatusOK, send(t, server, http.MethodPost, "/api/v0/devices/some-id/sign", `{"data_to_be_signed": "some-data"}`).StatusCode)
+
+	stream := subscribe(t, server, "/api/v0/devices/some-id/events", "0")
+	created := readEvent(t, stream)
+	assert.Equal(t, sentEvent{id: "1", event: signature.EventDeviceCreated, data: created.data}, created)
+	var device api.SignatureDevice
+	require.NoError(t, json.Unmarshal([]byte(created.data), &device))
+	assert.Equal(t, "some-id", device.ID)
+	assert.Equal(t, "3", readEvent(t, stream).id)
+
+	stream = subscribe(t, server, "/api/v0/devices/some-id/events", "1")
+	assert.Equal(t, "3", readEvent(t, stream).id)
+}
+
+func TestDeviceEventsResetWhenMissedEventsAreEvicted(t *testing.T) {
+	server := httptest.NewServer(servicetest.New(t, servicetest.WithEvents()).Handler())
+	t.Cleanup(server.Close)
+	require.Equal(t, http.StatusCreated, send(t, server, http.MethodPut, "/api/v0/devices/some-id", `{"signature_alg": "ECC"}`).StatusCode)
+	for i := 0; i < 20; i++ {
+		require.Equal(t, http.StatusOK, send(t, server, http.MethodPost, "/api/v0/devices/some-id/sign", `{"data_to_be_signed": "some-data"}`).StatusCode)
+	}
+
+	stream := subscribe(t, server, "/api/v0/devices/some-id/events", "1")
+	reset := readEvent(t, stream)
+	assert.Equal(t, sentEvent{id: "21", event: events.TypeReset, data: reset.data}, reset)
+	var device api.SignatureDevice
+	require.NoError(t, json.Unmarshal([]byte(reset.data), &device))
+	assert.Equal(t, "some-id", device.ID)
+	assert.Equal(t, 20, device.SignatureCounter)
+
+	// the stream goes on from the reset
+	require.Equal(t, http.StatusOK, send(t, server, http.MethodPost, "/api/v0/devices/some-id/sign", `{"data_to_be_signed": "some-data"}`).StatusCode)
+	assert.Equal(t, "22", readEvent(t, stream).id)
+}
+
+func TestDeviceEventsOfMissingDevice(t *testing.T) {
+	server := httptest.NewServer(servicetest.New(t, servicetest.WithEvents()).Handler())
+	t.Cleanup(server.Close)
+
+	response := send(t, server, http.MethodGet, "/api/v0/devices/missing/events", "")
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+)
+
+// ExportMediaType is the media type of the audit exports.
+const ExportMediaType = "application/zip"
+
+type ExportKey struct {
+	PublicKey   string `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// ExportSigningDevice streams the audit export of a device: a zip archive of its bundle and of a
+// manifest signed by the export key.
+func (s *Server) ExportSigningDevice(response http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+
+	w := &attachmentWriter{response: response, mediaType: ExportMediaType, filename: id + ".zip"}
+	err := s.exporter.ExportDevice(request.Context(), id, w)
+	if err != nil && !w.started {
+		WriteError(response, request, err)
+		return
+	}
+	if err != nil {
+		// the status is sent already: aborting the response leaves the client with a truncated
+		// archive, which has no central directory and cannot be opened
+		logging.FromContext(request.Context()).ErrorContext(request.Context(), "export aborted", slog.String("device_id", id), slog.String("error", err.Error()))
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// GetExportKey returns the public key verifying the manifests of the audit exports.
+func (s *Server) GetExportKey(response http.ResponseWriter, request *http.Request) {
+	exportKey := s.exporter.ExportKey()
+	WriteAPIResponse(response, http.StatusOK, ExportKey{
+		PublicKey:   string(exportKey.PublicKey),
+		Fingerprint: exportKey.Fingerprint,
+	})
+}
+
+// attachmentWriter only sends the headers of a streamed file once its content starts, so that
+// producing the file can still fail with a problem response until then.
+type attachmentWriter struct {
+	response  http.ResponseWriter
+	mediaType string
+	filename  string
+	started   bool
+}
+
+func (w *attachmentWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.response.Header().Set("Content-Type", w.mediaType)
+		w.response.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": w.filename}))
+		w.response.WriteHeader(http.StatusOK)
+	}
+
+	return w.response.Write(p)
+}
@@ -0,0 +1,62 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/bundle"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportIsVerifiableOffline(t *testing.T) {
+	for _, signatureAlg := range []string{"RSA", "ECC"} {
+		t.Run(signatureAlg, func(t *testing.T) {
+			handler := servicetest.New(t, servicetest.WithExports()).Handler()
+			created := do(t, handler, http.MethodPut, "/api/v0/devices/some-id", fmt.Sprintf(`{"signature_alg": %q, "label": "some-label"}`, signatureAlg), nil)
+			require.Equal(t, http.StatusCreated, created.Code)
+			for i := 0; i < 5; i++ {
+				if i == 2 {
+					rotated := do(t, handler, http.MethodPost, "/api/v0/devices/some-id/rotate-key", "", http.Header{"If-Match": {do(t, handler, http.MethodGet, "/api/v0/devices/some-id", "", nil).Header().Get("ETag")}})
+					require.Equal(t, http.StatusOK, rotated.Code)
+				}
+				signed := do(t, handler, http.MethodPost, "/api/v0/devices/some-id/sign", fmt.Sprintf(`{"data_to_be_signed": "transaction_%v"}`, i), nil)
+				require.Equal(t, http.StatusOK, signed.Code)
+			}
+
+			exported := do(t, handler, http.MethodGet, "/api/v0/devices/some-id/export", "", nil)
+			require.Equal(t, http.StatusOK, exported.Code, exported.Body.String())
+			assert.Equal(t, api.ExportMediaType, exported.Header().Get("Content-Type"))
+			assert.Equal(t, `attachment; filename=some-id.zip`, exported.Header().Get("Content-Disposition"))
+
+			var exportKey struct {
+				Data api.ExportKey `json:"data"`
+			}
+			response := do(t, handler, http.MethodGet, "/api/v0/export-key", "", nil)
+			require.Equal(t, http.StatusOK, response.Code)
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &exportKey))
+
+			archived := exported.Body.Bytes()
+			report, err := bundle.VerifyArchive(bytes.NewReader(archived), int64(len(archived)), []byte(exportKey.Data.PublicKey))
+			require.NoError(t, err)
+			assert.True(t, report.Valid(), report.Findings)
+			assert.True(t, report.ManifestVerified)
+			assert.Equal(t, 5, report.Signatures)
+			assert.Equal(t, "some-id", report.DeviceID)
+		})
+	}
+}
+
+func TestExportOfUnknownDevice(t *testing.T) {
+	handler := servicetest.New(t, servicetest.WithExports()).Handler()
+
+	response := do(t, handler, http.MethodGet, "/api/v0/devices/missing/export", "", nil)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, api.ProblemMediaType, response.Header().Get("Content-Type"))
+	assert.Contains(t, response.Body.String(), `"code": "not_found"`)
+}
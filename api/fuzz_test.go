@@ -0,0 +1,68 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+)
+
+func FuzzCreateDeviceRequest(f *testing.F) {
+	f.Add(`{"signature_alg": "ECC", "label": "some-label"}`)
+	f.Add(`{"signature_alg": "RSA", "metadata": {"store": "berlin"}, "tags": ["pos"]}`)
+	f.Add(`{"signature_alg": "DSA"}`)
+	f.Add(`{"signature_alg": 1}`)
+	f.Add(`{"tags": [null]}`)
+	f.Add(`{`)
+	f.Add(``)
+
+	f.Fuzz(func(t *testing.T, body string) {
+		response := do(t, servicetest.New(t).Handler(), http.MethodPut, "/api/v0/devices/some-id", body, nil)
+		if response.Code >= http.StatusInternalServerError {
+			t.Fatalf("request body %q answered %v: %v", body, response.Code, response.Body)
+		}
+	})
+}
+
+func FuzzSignRequest(f *testing.F) {
+	f.Add(`{"data_to_be_signed": "some-data"}`)
+	f.Add(`{"data_to_be_signed": "a_b_c"}`)
+	f.Add(`{"data_to_be_signed": "\u0000"}`)
+	f.Add(`{"data_to_be_signed": []}`)
+	f.Add(`null`)
+	f.Add(``)
+
+	handler := servicetest.New(f).Handler()
+	if response := do(f, handler, http.MethodPut, "/api/v0/devices/some-id", `{"signature_alg": "ECC"}`, nil); response.Code != http.StatusCreated {
+		f.Fatalf("error creating device: %v", response.Body)
+	}
+
+	f.Fuzz(func(t *testing.T, body string) {
+		response := do(t, handler, http.MethodPost, "/api/v0/devices/some-id/sign", body, nil)
+		if response.Code >= http.StatusInternalServerError {
+			t.Fatalf("request body %q answered %v: %v", body, response.Code, response.Body)
+		}
+		if response.Code != http.StatusOK {
+			return
+		}
+
+		var request api.SignatureReq
+		if err := json.Unmarshal([]byte(body), &request); err != nil {
+			t.Fatalf("request body %q was signed, but cannot be decoded: %v", body, err)
+		}
+		var signed api.SignatureResp
+		if err := json.Unmarshal(response.Body.Bytes(), &api.Response{Data: &signed}); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		securedData, err := signature.ParseSecuredData(signed.SignedData)
+		if err != nil {
+			t.Fatalf("signed data %q cannot be parsed: %v", signed.SignedData, err)
+		}
+		if securedData.Data != request.DataToBeSigned {
+			t.Fatalf("signed data %q holds %q, expected %q", signed.SignedData, securedData.Data, request.DataToBeSigned)
+		}
+	})
+}
@@ -1,6 +1,11 @@
 package api
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+)
 
 type HealthResponse struct {
 	Status  string `json:"status"`
@@ -10,16 +15,46 @@ type HealthResponse struct {
 // Health evaluates the health of the service and writes a standardized response.
 func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodGet {
-		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
-			http.StatusText(http.StatusMethodNotAllowed),
-		})
+		methodNotAllowed(response, request)
 		return
 	}
 
+	report := s.health.Ready(request.Context())
 	health := HealthResponse{
-		Status:  "pass",
-		Version: "v0",
+		Status:  report.Status,
+		Version: report.Version,
 	}
 
-	WriteAPIResponse(response, http.StatusOK, health)
+	WriteAPIResponse(response, healthStatusCode(report.Status), health)
+}
+
+// Livez tells whether the process is alive. It does not check any dependency,
+// so that an unavailable backend does not get the service restarted.
+func (s *Server) Livez(response http.ResponseWriter, request *http.Request) {
+	writeHealthReport(response, s.health.Live())
+}
+
+// Readyz tells whether the service can serve traffic, running every registered dependency check.
+func (s *Server) Readyz(response http.ResponseWriter, request *http.Request) {
+	writeHealthReport(response, s.health.Ready(request.Context()))
+}
+
+func writeHealthReport(w http.ResponseWriter, report health.Report) {
+	bytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", health.MediaType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(healthStatusCode(report.Status))
+	w.Write(bytes)
+}
+
+func healthStatusCode(status string) int {
+	if status == health.StatusFail {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
 }
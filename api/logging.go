@@ -0,0 +1,55 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID, either provided by the client or generated by the server.
+const RequestIDHeader = "X-Request-ID"
+
+// requestLogger is a middleware assigning a request ID to every request, echoing it in the response
+// and putting a logger tagged with it in the request context. Once the request is served it
+// writes a structured access log entry.
+func requestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			start := time.Now()
+
+			requestID := logging.RequestID(request.Header.Get(RequestIDHeader))
+			response.Header().Set(RequestIDHeader, requestID)
+
+			requestLogger := logger.With(slog.String("request_id", requestID))
+			if spanCtx := trace.SpanContextFromContext(request.Context()); spanCtx.HasTraceID() {
+				requestLogger = requestLogger.With(slog.String("trace_id", spanCtx.TraceID().String()))
+			}
+
+			ww := middleware.NewWrapResponseWriter(response, request.ProtoMajor)
+			next.ServeHTTP(ww, request.WithContext(logging.NewContext(request.Context(), requestLogger)))
+
+			code := ww.Status()
+			if code == 0 {
+				code = http.StatusOK
+			}
+			route := ""
+			if routeCtx := chi.RouteContext(request.Context()); routeCtx != nil {
+				route = routeCtx.RoutePattern()
+			}
+			requestLogger.LogAttrs(request.Context(), slog.LevelInfo, "request served",
+				slog.String("method", request.Method),
+				slog.String("path", request.URL.Path),
+				slog.String("route", route),
+				slog.Int("status", code),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", request.RemoteAddr),
+			)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// MetricsCollector records HTTP request metrics and serves them.
+type MetricsCollector interface {
+	ObserveRequest(method string, route string, code int, duration time.Duration)
+	Handler() http.Handler
+}
+
+// instrument is a middleware reporting count and latency of every request to the collector,
+// labelled by route pattern rather than raw path to keep the label cardinality bounded.
+func instrument(collector MetricsCollector) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(response, request.ProtoMajor)
+
+			next.ServeHTTP(ww, request)
+
+			route := "unmatched"
+			if routeCtx := chi.RouteContext(request.Context()); routeCtx != nil && routeCtx.RoutePattern() != "" {
+				route = routeCtx.RoutePattern()
+			}
+			code := ww.Status()
+			if code == 0 {
+				code = http.StatusOK
+			}
+			collector.ObserveRequest(request.Method, route, code, time.Since(start))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// OpenAPIPath is where the OpenAPI document of the service is served.
+const OpenAPIPath = "/api/v0/openapi.json"
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+func init() {
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", openapi3filter.JSONBodyDecoder)
+}
+
+var (
+	openAPISpec   = mustLoadOpenAPISpec()
+	openAPIRouter = mustNewOpenAPIRouter(openAPISpec)
+)
+
+// OpenAPISpec returns the parsed OpenAPI document describing every route of the Server.
+func OpenAPISpec() *openapi3.T {
+	return openAPISpec
+}
+
+// OpenAPI serves the OpenAPI document of the service.
+func (s *Server) OpenAPI(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	response.Write(openAPIDocument)
+}
+
+// validateRequests is a middleware rejecting requests that do not match the OpenAPI document.
+// Requests to routes missing from the document are passed through for the router to handle.
+func validateRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		route, pathParams, err := openAPIRouter.FindRoute(request)
+		if err != nil {
+			next.ServeHTTP(response, request)
+			return
+		}
+
+		err = openapi3filter.ValidateRequest(request.Context(), &openapi3filter.RequestValidationInput{
+			Request:    request,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+				ExcludeRequestBody: binaryBody(route.Operation),
+			},
+		})
+		if err != nil {
+			WriteError(response, request, &signature.Error{Code: signature.CodeInvalidInput, Message: "invalid request", Err: err})
+			return
+		}
+
+		next.ServeHTTP(response, request)
+	})
+}
+
+// binaryBody reports whether the request body of operation is a file, which is streamed to the
+// handler rather than read whole to be validated.
+func binaryBody(operation *openapi3.Operation) bool {
+	if operation.RequestBody == nil || operation.RequestBody.Value == nil {
+		return false
+	}
+	for _, mediaType := range operation.RequestBody.Value.Content {
+		if mediaType.Schema == nil || mediaType.Schema.Value == nil || mediaType.Schema.Value.Format != "binary" {
+			return false
+		}
+	}
+	return true
+}
+
+func mustLoadOpenAPISpec() *openapi3.T {
+	spec, err := openapi3.NewLoader().LoadFromData(openAPIDocument)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded OpenAPI document: %v", err))
+	}
+	if err := spec.Validate(openapi3.NewLoader().Context); err != nil {
+		panic(fmt.Sprintf("invalid embedded OpenAPI document: %v", err))
+	}
+
+	return spec
+}
+
+func mustNewOpenAPIRouter(spec *openapi3.T) routers.Router {
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		panic(fmt.Sprintf("could not route embedded OpenAPI document: %v", err))
+	}
+
+	return router
+}
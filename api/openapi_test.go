@@ -0,0 +1,273 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/backup"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/webhook"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/events"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	openapi3filter.RegisterBodyDecoder("application/health+json", openapi3filter.JSONBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(api.ProblemMediaType, openapi3filter.JSONBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(api.ExportMediaType, openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(api.BackupMediaType, openapi3filter.FileBodyDecoder)
+}
+
+// serviceStub answers every call of the signature service with a valid device.
+var serviceStub = &servicetest.SignatureServiceStub{
+	CreateSignatureDeviceFn: func(ctx context.Context, newSignDev signature.NewSignatureDevice) (signature.SignatureDevice, bool, error) {
+		return signature.SignatureDevice{ID: newSignDev.ID, SignatureAlg: newSignDev.SignatureAlg, Label: newSignDev.Label, Status: "active", KeyVersion: 1}, true, nil
+	},
+	GetSignatureDeviceFn: func(ctx context.Context, id string) (signature.SignatureDevice, error) {
+		if id == "missing" {
+			return signature.SignatureDevice{}, signature.ErrNotFound
+		}
+		return signature.SignatureDevice{ID: id, SignatureAlg: "ECC", Label: "some-label", Status: "active", KeyVersion: 1, Version: "some-version"}, nil
+	},
+	UpdateSignatureDeviceFn: func(ctx context.Context, id string, update signature.UpdateSignatureDevice, version string) (signature.SignatureDevice, error) {
+		return signature.SignatureDevice{ID: id, SignatureAlg: "ECC", Label: *update.Label, Status: "active", KeyVersion: 1, Version: "some-new-version"}, nil
+	},
+	RotateSignatureDeviceKeyFn: func(ctx context.Context, id string, version string) (signature.SignatureDevice, error) {
+		return signature.SignatureDevice{ID: id, SignatureAlg: "ECC", Label: "some-label", Status: "active", KeyVersion: 2, Version: "some-new-version"}, nil
+	},
+	ListSignatureDevicesFn: func(ctx context.Context, filter signature.ListFilter) ([]signature.SignatureDevice, error) {
+		return []signature.SignatureDevice{
+			{ID: "some-id", SignatureAlg: "ECC", Metadata: map[string]string{"store": "berlin"}, Tags: []string{"pos"}, Status: "active", KeyVersion: 1},
+		}, nil
+	},
+	SignDataFn: func(ctx context.Context, id string, dataToSign string) (signature.Signature, error) {
+		return signature.Signature{Signature: "c2lnbmF0dXJl", SignedData: "0_" + dataToSign + "_c29tZS1pZA=="}, nil
+	},
+}
+
+type webhookServiceStub struct{}
+
+func (webhookServiceStub) CreateSubscription(ctx context.Context, newSubscription webhook.NewSubscription) (webhook.Subscription, error) {
+	return webhook.Subscription{ID: "some-id", URL: newSubscription.URL, EventTypes: newSubscription.EventTypes, Secret: "some-secret", CreatedAt: time.Now()}, nil
+}
+
+func (webhookServiceStub) GetSubscription(ctx context.Context, tenant string, id string) (webhook.Subscription, error) {
+	if id == "missing" {
+		return webhook.Subscription{}, signature.ErrNotFound
+	}
+	return webhook.Subscription{ID: id, URL: "https://example.com/hook", EventTypes: []string{}, CreatedAt: time.Now()}, nil
+}
+
+func (webhookServiceStub) ListSubscriptions(ctx context.Context, tenant string) ([]webhook.Subscription, error) {
+	return []webhook.Subscription{
+		{ID: "some-id", URL: "https://example.com/hook", EventTypes: []string{signature.EventSignatureCreated}, CreatedAt: time.Now()},
+	}, nil
+}
+
+func (webhookServiceStub) DeleteSubscription(ctx context.Context, tenant string, id string) error {
+	return nil
+}
+
+func (webhookServiceStub) ListDeadLetters(ctx context.Context, tenant string, id string) ([]webhook.DeadLetter, error) {
+	return []webhook.DeadLetter{
+		{EventID: "some-event-id", EventType: signature.EventSignatureCreated, DeviceID: "some-device-id", Attempts: 10, LastError: "unexpected status 500", CreatedAt: time.Now()},
+	}, nil
+}
+
+type exporterStub struct{}
+
+func (exporterStub) ExportDevice(ctx context.Context, id string, w io.Writer) error {
+	if id == "missing" {
+		return signature.ErrNotFound
+	}
+	_, err := w.Write([]byte("PK\x05\x06" + strings.Repeat("\x00", 18)))
+	return err
+}
+
+func (exporterStub) ExportKey() export.ExportKey {
+	return export.ExportKey{PublicKey: []byte("-----BEGIN PUBLIC KEY-----\n-----END PUBLIC KEY-----\n"), Fingerprint: "some-fingerprint"}
+}
+
+type backupStub struct{}
+
+func (backupStub) Backup(ctx context.Context, w io.Writer) (backup.Summary, error) {
+	_, err := w.Write([]byte("some backup"))
+	return backup.Summary{Devices: 1, Signatures: 2}, err
+}
+
+func (backupStub) Restore(ctx context.Context, r io.ReadSeeker) (backup.Summary, error) {
+	restored, err := io.ReadAll(r)
+	if err != nil {
+		return backup.Summary{}, err
+	}
+	if string(restored) == "conflicting backup" {
+		return backup.Summary{}, signature.ErrConflict
+	}
+	return backup.Summary{Devices: 1, Signatures: 2}, nil
+}
+
+func newTestHandler() http.Handler {
+	return servicetest.Handler(serviceStub,
+		api.WithMetrics(metrics.New(prometheus.NewRegistry())),
+		api.WithEvents(events.NewBus(servicetest.EventsHistorySize)),
+		api.WithWebhooks(webhookServiceStub{}),
+		api.WithExports(exporterStub{}),
+		api.WithBackups(backupStub{}, servicetest.AdminToken),
+	)
+}
+
+func TestRoutesMatchOpenAPISpec(t *testing.T) {
+	var routed []string
+	err := chi.Walk(newTestHandler().(chi.Routes), func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routed = append(routed, method+" "+route)
+		return nil
+	})
+	require.NoError(t, err)
+
+	var documented []string
+	for path, item := range api.OpenAPISpec().Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	sort.Strings(routed)
+	sort.Strings(documented)
+	assert.Equal(t, documented, routed, "the router and the OpenAPI document are out of sync")
+}
+
+func TestResponsesMatchOpenAPISpec(t *testing.T) {
+	tests := []struct{
+		method string
+		path string
+		body string
+		contentType string
+		ifMatch string
+		admin bool
+		status int
+	}{
+		{method: http.MethodGet, path: "/api/v0/openapi.json", status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v0/health", status: http.StatusOK},
+		{method: http.MethodGet, path: "/livez", status: http.StatusOK},
+		{method: http.MethodGet, path: "/readyz", status: http.StatusOK},
+		{method: http.MethodGet, path: "/metrics", status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v0/devices?tag=pos&metadata[store]=berlin", status: http.StatusOK},
+		{method: http.MethodPost, path: "/api/v0/devices", body: `{"signature_alg": "ECC", "metadata": {"store": "berlin"}, "tags": ["pos"]}`, status: http.StatusCreated},
+		{method: http.MethodPut, path: "/api/v0/devices/some-id", body: `{"signature_alg": "ECC", "label": "some-label"}`, status: http.StatusCreated},
+		{method: http.MethodGet, path: "/api/v0/devices/some-id", status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v0/devices/missing", status: http.StatusNotFound},
+		{method: http.MethodPatch, path: "/api/v0/devices/some-id", body: `{"label": "other-label"}`, ifMatch: `"some-version"`, status: http.StatusOK},
+		{method: http.MethodPatch, path: "/api/v0/devices/some-id", body: `{"label": "other-label"}`, status: http.StatusPreconditionRequired},
+		{method: http.MethodDelete, path: "/api/v0/devices/some-id", ifMatch: `"some-version"`, status: http.StatusNoContent},
+		{method: http.MethodPost, path: "/api/v0/devices/some-id/sign", body: `{"data_to_be_signed": "some-data"}`, status: http.StatusOK},
+		{method: http.MethodPost, path: "/api/v0/devices/some-id/rotate-key", ifMatch: `"some-version"`, status: http.StatusOK},
+		{method: http.MethodPost, path: "/api/v0/devices/some-id/rotate-key", status: http.StatusPreconditionRequired},
+		{method: http.MethodGet, path: "/api/v0/devices/some-id/export", status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v0/devices/missing/export", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/api/v0/export-key", status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v0/admin/backup", admin: true, status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v0/admin/backup", status: http.StatusUnauthorized},
+		{method: http.MethodPost, path: "/api/v0/admin/restore", body: "some backup", contentType: api.BackupMediaType, admin: true, status: http.StatusOK},
+		{method: http.MethodPost, path: "/api/v0/admin/restore", body: "conflicting backup", contentType: api.BackupMediaType, admin: true, status: http.StatusConflict},
+		{method: http.MethodPost, path: "/api/v0/admin/restore", body: `{}`, admin: true, status: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/api/v0/admin/restore", body: "some backup", contentType: api.BackupMediaType, status: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/api/v0/webhooks", status: http.StatusOK},
+		{method: http.MethodPost, path: "/api/v0/webhooks", body: `{"url": "https://example.com/hook", "event_types": ["signature.created"]}`, status: http.StatusCreated},
+		{method: http.MethodGet, path: "/api/v0/webhooks/some-id", status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v0/webhooks/missing", status: http.StatusNotFound},
+		{method: http.MethodDelete, path: "/api/v0/webhooks/some-id", status: http.StatusNoContent},
+		{method: http.MethodGet, path: "/api/v0/webhooks/some-id/dead-letters", status: http.StatusOK},
+	}
+
+	router, err := gorillamux.NewRouter(api.OpenAPISpec())
+	require.NoError(t, err)
+	handler := newTestHandler()
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				request.Header.Set("Content-Type", tc.contentType)
+			} else if tc.body != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+			if tc.ifMatch != "" {
+				request.Header.Set("If-Match", tc.ifMatch)
+			}
+			if tc.admin {
+				request.Header.Set("Authorization", "Bearer "+servicetest.AdminToken)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			require.Equal(t, tc.status, recorder.Code, recorder.Body.String())
+
+			validationRequest := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			route, pathParams, err := router.FindRoute(validationRequest)
+			require.NoError(t, err)
+			contentType := recorder.Header().Get("Content-Type")
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			header := http.Header{"Content-Type": []string{contentType}}
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{
+					Request: validationRequest,
+					PathParams: pathParams,
+					Route: route,
+				},
+				Status: recorder.Code,
+				Header: header,
+				Body: io.NopCloser(bytes.NewReader(recorder.Body.Bytes())),
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRequestsAreValidatedAgainstOpenAPISpec(t *testing.T) {
+	tests := []struct{
+		name string
+		method string
+		path string
+		body string
+	}{
+		{name: "unsupported algorithm", method: http.MethodPut, path: "/api/v0/devices/some-id", body: `{"signature_alg": "DSA"}`},
+		{name: "missing algorithm", method: http.MethodPut, path: "/api/v0/devices/some-id", body: `{"label": "some-label"}`},
+		{name: "too long tag", method: http.MethodPut, path: "/api/v0/devices/some-id", body: `{"signature_alg": "ECC", "tags": ["` + strings.Repeat("a", 65) + `"]}`},
+		{name: "duplicated tags", method: http.MethodPut, path: "/api/v0/devices/some-id", body: `{"signature_alg": "ECC", "tags": ["pos", "pos"]}`},
+		{name: "missing data to be signed", method: http.MethodPost, path: "/api/v0/devices/some-id/sign", body: `{}`},
+		{name: "data to be signed is not a string", method: http.MethodPost, path: "/api/v0/devices/some-id/sign", body: `{"data_to_be_signed": 42}`},
+		{name: "unknown status", method: http.MethodPatch, path: "/api/v0/devices/some-id", body: `{"status": "retired"}`},
+		{name: "missing webhook URL", method: http.MethodPost, path: "/api/v0/webhooks", body: `{"event_types": ["signature.created"]}`},
+		{name: "unknown webhook event type", method: http.MethodPost, path: "/api/v0/webhooks", body: `{"url": "https://example.com/hook", "event_types": ["device.exploded"]}`},
+	}
+
+	handler := newTestHandler()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			assert.Equal(t, api.ProblemMediaType, recorder.Header().Get("Content-Type"))
+			assert.Contains(t, recorder.Body.String(), `"code": "invalid_input"`)
+		})
+	}
+}
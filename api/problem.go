@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+)
+
+// ProblemMediaType is the content type of error responses (RFC 7807).
+const ProblemMediaType = "application/problem+json"
+
+// problemTypePrefix prefixes the error code to build the problem type URI.
+const problemTypePrefix = "urn:signing-service:problem:"
+
+// Error codes that have no domain counterpart.
+const (
+	CodeMethodNotAllowed     signature.Code = "method_not_allowed"
+	CodePreconditionRequired signature.Code = "precondition_required"
+	CodeUnauthorized         signature.Code = "unauthorized"
+	CodePayloadTooLarge      signature.Code = "payload_too_large"
+)
+
+// Problem is the RFC 7807 error response, extended with a stable error code and the request ID.
+type Problem struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance,omitempty"`
+	Code      signature.Code `json:"code"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+var problemStatus = map[signature.Code]int{
+	signature.CodeNotFound:             http.StatusNotFound,
+	signature.CodeInvalidInput:         http.StatusBadRequest,
+	signature.CodeConflict:             http.StatusConflict,
+	signature.CodeDeviceInactive:       http.StatusConflict,
+	signature.CodeUnsupportedAlgorithm: http.StatusUnprocessableEntity,
+	signature.CodeVersionMismatch:      http.StatusPreconditionFailed,
+	signature.CodeInternal:             http.StatusInternalServerError,
+	CodeMethodNotAllowed:               http.StatusMethodNotAllowed,
+	CodePreconditionRequired:           http.StatusPreconditionRequired,
+	CodeUnauthorized:                   http.StatusUnauthorized,
+	CodePayloadTooLarge:                http.StatusRequestEntityTooLarge,
+}
+
+// WriteError translates err into a problem response. Domain errors are mapped to their
+// HTTP status through their code, anything else is reported as an internal error without
+// exposing its details to the client.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var domainErr *signature.Error
+	if !errors.As(err, &domainErr) || domainErr.Code == signature.CodeInternal {
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "unexpected error", slog.String("error", err.Error()))
+		WriteProblem(w, r, signature.CodeInternal, "unexpected error")
+		return
+	}
+
+	WriteProblem(w, r, domainErr.Code, domainErr.Error())
+}
+
+// WriteProblem writes a problem response for the given error code.
+func WriteProblem(w http.ResponseWriter, r *http.Request, code signature.Code, detail string) {
+	status, found := problemStatus[code]
+	if !found {
+		status = http.StatusInternalServerError
+	}
+
+	problem := Problem{
+		Type:      problemTypePrefix + string(code),
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: w.Header().Get(RequestIDHeader),
+	}
+
+	bytes, err := json.MarshalIndent(problem, "", "  ")
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemMediaType)
+	w.WriteHeader(status)
+	w.Write(bytes)
+}
+
+// invalidPayload wraps a request decoding error into an invalid input domain error.
+func invalidPayload(err error) error {
+	return &signature.Error{Code: signature.CodeInvalidInput, Message: "invalid request payload", Err: err}
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	WriteProblem(w, r, signature.CodeNotFound, "no route matches the requested path")
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteProblem(w, r, CodeMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+}
@@ -0,0 +1,125 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainErrorsAreTranslatedToProblems(t *testing.T) {
+	tests := []struct{
+		name string
+		err error
+		status int
+		code signature.Code
+		detail string
+	}{
+		{
+			name: "not found",
+			err: fmt.Errorf("wrapped: %w", signature.ErrNotFound),
+			status: http.StatusNotFound,
+			code: signature.CodeNotFound,
+			detail: "signature device not found",
+		},
+		{
+			name: "conflict",
+			err: signature.ErrConflict,
+			status: http.StatusConflict,
+			code: signature.CodeConflict,
+		},
+		{
+			name: "device inactive",
+			err: signature.ErrDeviceInactive,
+			status: http.StatusConflict,
+			code: signature.CodeDeviceInactive,
+		},
+		{
+			name: "unsupported algorithm",
+			err: signature.ErrUnsupportedAlgorithm,
+			status: http.StatusUnprocessableEntity,
+			code: signature.CodeUnsupportedAlgorithm,
+		},
+		{
+			name: "internal errors do not leak details",
+			err: errors.New("connection refused by db-primary.internal"),
+			status: http.StatusInternalServerError,
+			code: signature.CodeInternal,
+			detail: "unexpected error",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := servicetest.Handler(&servicetest.SignatureServiceStub{Err: tc.err})
+			request := httptest.NewRequest(http.MethodPost, "/api/v0/devices/some-id/sign", strings.NewReader(`{"data_to_be_signed": "some-data"}`))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set(api.RequestIDHeader, "some-request-id")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tc.status, recorder.Code)
+			assert.Equal(t, api.ProblemMediaType, recorder.Header().Get("Content-Type"))
+			var problem api.Problem
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+			assert.Equal(t, tc.code, problem.Code)
+			assert.Equal(t, tc.status, problem.Status)
+			assert.Equal(t, "urn:signing-service:problem:"+string(tc.code), problem.Type)
+			assert.Equal(t, "/api/v0/devices/some-id/sign", problem.Instance)
+			assert.Equal(t, "some-request-id", problem.RequestID)
+			if tc.detail != "" {
+				assert.Equal(t, tc.detail, problem.Detail)
+			}
+		})
+	}
+}
+
+func TestPanicsAreLoggedAsInternalErrors(t *testing.T) {
+	var logs strings.Builder
+	handler := servicetest.Handler(&servicetest.SignatureServiceStub{
+		SignDataFn: func(ctx context.Context, id string, dataToSign string) (signature.Signature, error) {
+			panic("some panic")
+		},
+	}, api.WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	request := httptest.NewRequest(http.MethodPost, "/api/v0/devices/some-id/sign", strings.NewReader(`{"data_to_be_signed": "some-data"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(api.RequestIDHeader, "some-request-id")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "some-request-id", recorder.Header().Get(api.RequestIDHeader))
+	assert.Contains(t, logs.String(), `"msg":"request served","request_id":"some-request-id"`)
+	assert.Contains(t, logs.String(), `"status":500`)
+}
+
+func TestMalformedPayloadIsAnInvalidInput(t *testing.T) {
+	handler := servicetest.Handler(&servicetest.SignatureServiceStub{})
+	request := httptest.NewRequest(http.MethodPut, "/api/v0/devices/some-id", strings.NewReader(`{"signature_alg": `))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"code": "invalid_input"`)
+}
+
+func TestUnknownRouteIsAProblem(t *testing.T) {
+	handler := servicetest.Handler(&servicetest.SignatureServiceStub{})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v0/unknown", nil))
+
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, api.ProblemMediaType, recorder.Header().Get("Content-Type"))
+}
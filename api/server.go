@@ -1,10 +1,19 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/backup"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/export"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/webhook"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/events"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
@@ -14,40 +23,182 @@ type Response struct {
 	Data interface{} `json:"data"`
 }
 
-// ErrorResponse is the generic error API response container.
-type ErrorResponse struct {
-	Errors []string `json:"errors"`
-}
-
 // Server manages HTTP requests and dispatches them to the appropriate services.
 type Server struct {
 	listenAddress string
 	signatureService signature.SignatureDeviceService
+	metrics MetricsCollector
+	logger *slog.Logger
+	health *health.Registry
+	events *events.Bus
+	webhookService webhook.SubscriptionService
+	exporter export.DeviceExporter
+	backup backup.StoreBackup
+	adminToken string
+	maxRestoreSize int64
+}
+
+// ServerOption configures optional features of the Server.
+type ServerOption func(*Server)
+
+// WithMetrics instruments every route and exposes the collected metrics on /metrics.
+func WithMetrics(metrics MetricsCollector) ServerOption {
+	return func(s *Server) {
+		s.metrics = metrics
+	}
+}
+
+// WithLogger sets the logger used for access logs and handed down to the services.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithHealth sets the registry of dependency checks backing the health endpoints.
+func WithHealth(registry *health.Registry) ServerOption {
+	return func(s *Server) {
+		s.health = registry
+	}
+}
+
+// WithEvents exposes the changes of every device published on bus as server-sent events.
+func WithEvents(bus *events.Bus) ServerOption {
+	return func(s *Server) {
+		s.events = bus
+	}
+}
+
+// WithWebhooks exposes the management of the webhook subscriptions.
+func WithWebhooks(service webhook.SubscriptionService) ServerOption {
+	return func(s *Server) {
+		s.webhookService = service
+	}
+}
+
+// WithExports exposes the audit exports of the devices, and the key verifying them.
+func WithExports(exporter export.DeviceExporter) ServerOption {
+	return func(s *Server) {
+		s.exporter = exporter
+	}
+}
+
+// WithBackups exposes the backup and the restore of the whole store. These admin routes are only
+// served to requests carrying adminToken as their bearer token.
+func WithBackups(storeBackup backup.StoreBackup, adminToken string) ServerOption {
+	return func(s *Server) {
+		s.backup = storeBackup
+		s.adminToken = adminToken
+	}
+}
+
+// WithMaxRestoreSize sets the size in bytes of the largest backup accepted by the restore.
+func WithMaxRestoreSize(size int64) ServerOption {
+	return func(s *Server) {
+		s.maxRestoreSize = size
+	}
 }
 
 // NewServer is a factory to instantiate a new Server.
-func NewServer(listenAddress string, signatureService signature.SignatureDeviceService) *Server {
-	return &Server{
+func NewServer(listenAddress string, signatureService signature.SignatureDeviceService, opts ...ServerOption) *Server {
+	s := &Server{
 		listenAddress: listenAddress,
 		signatureService: signatureService,
+		logger: slog.Default(),
+		health: health.NewRegistry("", "v0", ""),
+		maxRestoreSize: DefaultMaxRestoreSize,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
+}
+
+// ShutdownTimeout bounds how long Run waits for the requests in flight once its context is done.
+// The event streams only end with their connections, which are closed when it runs out.
+const ShutdownTimeout = 10 * time.Second
+
+// Run serves on the listen address of the Server until ctx is done, then shuts it down gracefully.
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{Addr: s.listenAddress, Handler: s.Handler()}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
-// Run registers all HandlerFuncs for the existing HTTP routes and starts the Server.
-func (s *Server) Run() error {
+// Handler registers all HandlerFuncs for the existing HTTP routes and returns the resulting router.
+func (s *Server) Handler() http.Handler {
 	router := chi.NewRouter()
+	router.NotFound(notFound)
+	router.MethodNotAllowed(methodNotAllowed)
 
 	router.Use(
+		traced,
+		requestLogger(s.logger),
 		middleware.Recoverer,
-		middleware.Logger,
 	)
 
+	if s.metrics != nil {
+		router.Use(instrument(s.metrics))
+	}
+	router.Use(validateRequests)
+
+	if s.metrics != nil {
+		router.Method(http.MethodGet, "/metrics", s.metrics.Handler())
+	}
+	router.Get(OpenAPIPath, s.OpenAPI)
+	router.Get("/livez", s.Livez)
+	router.Get("/readyz", s.Readyz)
 	router.Get("/api/v0/health", s.Health)
+	router.Get("/api/v0/devices", s.ListSigningDevices)
+	router.Post("/api/v0/devices", s.CreateSigningDeviceWithGeneratedID)
 	router.Put("/api/v0/devices/{id}", s.CreateSigningDevice)
 	router.Get("/api/v0/devices/{id}", s.GetSigningDevice)
+	router.Patch("/api/v0/devices/{id}", s.UpdateSigningDevice)
+	router.Delete("/api/v0/devices/{id}", s.DeleteSigningDevice)
 	router.Post("/api/v0/devices/{id}/sign", s.SignData)
+	router.Post("/api/v0/devices/{id}/rotate-key", s.RotateSigningDeviceKey)
+	if s.events != nil {
+		router.Get("/api/v0/devices/{id}/events", s.DeviceEvents)
+	}
+	if s.exporter != nil {
+		router.Get("/api/v0/devices/{id}/export", s.ExportSigningDevice)
+		router.Get("/api/v0/export-key", s.GetExportKey)
+	}
+	if s.backup != nil {
+		router.Route("/api/v0/admin", func(admin chi.Router) {
+			admin.Use(requireAdminToken(s.adminToken))
+			admin.Get("/backup", s.BackupStore)
+			admin.Post("/restore", s.RestoreStore)
+		})
+	}
+	if s.webhookService != nil {
+		router.Get("/api/v0/webhooks", s.ListWebhookSubscriptions)
+		router.Post("/api/v0/webhooks", s.CreateWebhookSubscription)
+		router.Get("/api/v0/webhooks/{id}", s.GetWebhookSubscription)
+		router.Delete("/api/v0/webhooks/{id}", s.DeleteWebhookSubscription)
+		router.Get("/api/v0/webhooks/{id}/dead-letters", s.ListWebhookDeadLetters)
+	}
 
-	return http.ListenAndServe(s.listenAddress, router)
+	return router
 }
 
 // WriteInternalError writes a default internal error message as an HTTP response.
@@ -56,28 +207,9 @@ func WriteInternalError(w http.ResponseWriter) {
 	w.Write([]byte(http.StatusText(http.StatusInternalServerError)))
 }
 
-// WriteErrorResponse takes an HTTP status code and a slice of errors
-// and writes those as an HTTP error response in a structured format.
-func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
-	w.WriteHeader(code)
-
-	errorResponse := ErrorResponse{
-		Errors: errors,
-	}
-
-	bytes, err := json.Marshal(errorResponse)
-	if err != nil {
-		WriteInternalError(w)
-	}
-
-	w.Write(bytes)
-}
-
 // WriteAPIResponse takes an HTTP status code and a generic data struct
 // and writes those as an HTTP response in a structured format.
 func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
-	w.WriteHeader(code)
-
 	response := Response{
 		Data: data,
 	}
@@ -85,7 +217,10 @@ func WriteAPIResponse(w http.ResponseWriter, code int, data interface{}) {
 	bytes, err := json.MarshalIndent(response, "", "  ")
 	if err != nil {
 		WriteInternalError(w)
+		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	w.Write(bytes)
 }
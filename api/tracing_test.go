@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanRecorder installs a recording tracer provider once: the package tracers are only bound to
+// the first provider set.
+var spanRecorder = sync.OnceValue(func() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+})
+
+// serverSpan serves request with a traceparent header and returns the server span it ended.
+func serverSpan(t *testing.T, handler http.Handler, request *http.Request) sdktrace.ReadOnlySpan {
+	t.Helper()
+	recorder := spanRecorder()
+	traceID := trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	request.Header.Set("traceparent", "00-"+traceID.String()+"-00f067aa0ba902b7-01")
+
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() == traceID && attributeValue(span, "url.path") == request.URL.Path {
+			return span
+		}
+	}
+	require.FailNow(t, "no server span ended for "+request.URL.Path)
+	return nil
+}
+
+func attributeValue(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestRequestsAreTraced(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		path       string
+		spanName   string
+		route      string
+		statusCode string
+		status     codes.Code
+	}{
+		{
+			name:       "span is named after the route",
+			err:        signature.ErrNotFound,
+			path:       "/api/v0/devices/some-id",
+			spanName:   "GET /api/v0/devices/{id}",
+			route:      "/api/v0/devices/{id}",
+			statusCode: "404",
+			status:     codes.Unset,
+		},
+		{
+			name:       "server errors are errors",
+			err:        errors.New("some error"),
+			path:       "/api/v0/devices/other-id",
+			spanName:   "GET /api/v0/devices/{id}",
+			route:      "/api/v0/devices/{id}",
+			statusCode: "500",
+			status:     codes.Error,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := servicetest.Handler(&servicetest.SignatureServiceStub{Err: tc.err})
+			span := serverSpan(t, handler, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, tc.spanName, span.Name())
+			assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+			assert.True(t, span.Parent().IsRemote())
+			assert.Equal(t, http.MethodGet, attributeValue(span, "http.request.method"))
+			assert.Equal(t, tc.route, attributeValue(span, "http.route"))
+			assert.Equal(t, tc.statusCode, attributeValue(span, "http.response.status_code"))
+			assert.Equal(t, tc.status, span.Status().Code)
+		})
+	}
+}
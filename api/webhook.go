@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/webhook"
+)
+
+const webhooksPath = "/api/v0/webhooks"
+
+type NewWebhookSubscription struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+}
+
+type WebhookSubscription struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type DeadLetter struct {
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"`
+	DeviceID  string    `json:"device_id"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateWebhookSubscription subscribes a URL to the events of the tenant. The secret signing
+// the deliveries is only part of this response.
+func (s *Server) CreateWebhookSubscription(response http.ResponseWriter, request *http.Request) {
+	var newSubscription NewWebhookSubscription
+	if err := json.NewDecoder(request.Body).Decode(&newSubscription); err != nil {
+		WriteError(response, request, invalidPayload(err))
+		return
+	}
+
+	subscription, err := s.webhookService.CreateSubscription(request.Context(), webhook.NewSubscription{
+		Tenant:     signature.DefaultTenant,
+		URL:        newSubscription.URL,
+		EventTypes: newSubscription.EventTypes,
+		Secret:     newSubscription.Secret,
+	})
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	response.Header().Set("Location", webhooksPath+"/"+url.PathEscape(subscription.ID))
+	WriteAPIResponse(response, http.StatusCreated, toWebhookSubscription(subscription))
+}
+
+func (s *Server) GetWebhookSubscription(response http.ResponseWriter, request *http.Request) {
+	subscription, err := s.webhookService.GetSubscription(request.Context(), signature.DefaultTenant, request.PathValue("id"))
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, toWebhookSubscription(subscription))
+}
+
+func (s *Server) ListWebhookSubscriptions(response http.ResponseWriter, request *http.Request) {
+	subscriptions, err := s.webhookService.ListSubscriptions(request.Context(), signature.DefaultTenant)
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	result := make([]WebhookSubscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		result = append(result, toWebhookSubscription(subscription))
+	}
+	WriteAPIResponse(response, http.StatusOK, result)
+}
+
+func (s *Server) DeleteWebhookSubscription(response http.ResponseWriter, request *http.Request) {
+	if err := s.webhookService.DeleteSubscription(request.Context(), signature.DefaultTenant, request.PathValue("id")); err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeadLetters lists the events which could not be delivered to the subscription.
+func (s *Server) ListWebhookDeadLetters(response http.ResponseWriter, request *http.Request) {
+	deadLetters, err := s.webhookService.ListDeadLetters(request.Context(), signature.DefaultTenant, request.PathValue("id"))
+	if err != nil {
+		WriteError(response, request, err)
+		return
+	}
+
+	result := make([]DeadLetter, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		result = append(result, DeadLetter{
+			EventID:   deadLetter.EventID,
+			EventType: deadLetter.EventType,
+			DeviceID:  deadLetter.DeviceID,
+			Attempts:  deadLetter.Attempts,
+			LastError: deadLetter.LastError,
+			CreatedAt: deadLetter.CreatedAt,
+		})
+	}
+	WriteAPIResponse(response, http.StatusOK, result)
+}
+
+func toWebhookSubscription(subscription webhook.Subscription) WebhookSubscription {
+	return WebhookSubscription{
+		ID:         subscription.ID,
+		URL:        subscription.URL,
+		EventTypes: subscription.EventTypes,
+		Secret:     subscription.Secret,
+		CreatedAt:  subscription.CreatedAt,
+	}
+}
@@ -0,0 +1,85 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/webhook"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignaturesArePushedToWebhookSubscriptions(t *testing.T) {
+	received := make(chan webhook.Payload, 10)
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		if !webhook.Verify(secret, request.Header.Get(webhook.IDHeader), request.Header.Get(webhook.TimestampHeader), body, request.Header.Get(webhook.SignatureHeader)) {
+			response.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload webhook.Payload
+		json.Unmarshal(body, &payload)
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	memoryStore := inmemory.New()
+	handler := servicetest.New(t, servicetest.WithStore(memoryStore), servicetest.WithWebhooks()).Handler()
+
+	subscribed := do(t, handler, http.MethodPost, "/api/v0/webhooks", `{"url": "`+receiver.URL+`", "event_types": ["signature.created"]}`, nil)
+	require.Equal(t, http.StatusCreated, subscribed.Code)
+	var subscription struct {
+		Data api.WebhookSubscription `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(subscribed.Body.Bytes(), &subscription))
+	secret = subscription.Data.Secret
+	require.NotEmpty(t, secret)
+	assert.Equal(t, "/api/v0/webhooks/"+subscription.Data.ID, subscribed.Header().Get("Location"))
+
+	require.Equal(t, http.StatusCreated, do(t, handler, http.MethodPut, "/api/v0/devices/some-id", `{"signature_alg": "ECC"}`, nil).Code)
+	require.Equal(t, http.StatusOK, do(t, handler, http.MethodPost, "/api/v0/devices/some-id/sign", `{"data_to_be_signed": "some-data"}`, nil).Code)
+
+	require.NoError(t, webhook.NewDispatcher(memoryStore).Dispatch(context.Background()))
+	require.Len(t, received, 1)
+	assert.Equal(t, signature.EventSignatureCreated, (<-received).Type)
+
+	got := do(t, handler, http.MethodGet, "/api/v0/webhooks/"+subscription.Data.ID, "", nil)
+	require.Equal(t, http.StatusOK, got.Code)
+	assert.NotContains(t, got.Body.String(), secret)
+}
+
+func TestReadyzWarnsWhenTheWebhookOutboxFallsBehind(t *testing.T) {
+	memoryStore := inmemory.New()
+	// the dispatcher is an hour ahead, and has not run since the device was created
+	dispatcher := webhook.NewDispatcher(memoryStore, webhook.WithClock(func() time.Time { return time.Now().Add(time.Hour) }))
+	registry := health.NewRegistry("some-service", "v1", "")
+	registry.Register("webhooks:backlog", "component", health.CheckerFunc(dispatcher.CheckBacklog))
+	handler := servicetest.New(t, servicetest.WithStore(memoryStore)).Handler(api.WithHealth(registry))
+
+	var report health.Report
+	ready := do(t, handler, http.MethodGet, "/readyz", "", nil)
+	require.Equal(t, http.StatusOK, ready.Code)
+	require.NoError(t, json.Unmarshal(ready.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusPass, report.Status)
+
+	require.Equal(t, http.StatusCreated, do(t, handler, http.MethodPut, "/api/v0/devices/some-id", `{"signature_alg": "ECC"}`, nil).Code)
+
+	degraded := do(t, handler, http.MethodGet, "/readyz", "", nil)
+	assert.Equal(t, http.StatusOK, degraded.Code)
+	require.NoError(t, json.Unmarshal(degraded.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusWarn, report.Status)
+	require.Len(t, report.Checks["webhooks:backlog"], 1)
+	assert.Equal(t, health.StatusWarn, report.Checks["webhooks:backlog"][0].Status)
+	assert.Contains(t, report.Checks["webhooks:backlog"][0].Output, "oldest outbox event")
+}
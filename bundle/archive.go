@@ -0,0 +1,321 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	ManifestFile          = "manifest.json"
+	ManifestSignatureFile = "manifest.sig"
+)
+
+// Kinds of findings about an archive as a whole.
+const (
+	KindTamperedFile    = "tampered_file"
+	KindInvalidManifest = "invalid_manifest"
+)
+
+// Manifest lists the files of an archived bundle with their hashes. The archive also holds
+// manifest.sig: the base64 encoded signature of the SHA-256 hash of manifest.json, made with the
+// export key of the service. ECDSA signatures are ASN.1 DER encoded, RSA ones PKCS1 v1.5.
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	DeviceID      string    `json:"device_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	// ExportKey is the fingerprint of the public key signing the manifest, see Fingerprint
+	ExportKey string         `json:"export_key"`
+	Files     []ArchivedFile `json:"files"`
+}
+
+// ArchivedFile is a file of the archive, with its hex encoded SHA-256 hash.
+type ArchivedFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ManifestSigner signs the SHA-256 hash of a manifest.
+type ManifestSigner interface {
+	Sign(digest []byte) ([]byte, error)
+}
+
+// Fingerprint returns the hex encoded SHA-256 hash of the DER encoding of a PEM public key.
+func Fingerprint(publicKey []byte) (string, error) {
+	block, err := decodePublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(block)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ArchiveWriter streams a bundle into a zip archive: every file is hashed while it is written, so
+// that none of them has to be held in memory, and the manifest is written last.
+type ArchiveWriter struct {
+	zip      *zip.Writer
+	manifest Manifest
+	// file is the file being written, nil before the first one
+	file *archiveFile
+}
+
+type archiveFile struct {
+	w    io.Writer
+	name string
+	hash hash.Hash
+	size int64
+}
+
+func (f *archiveFile) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.hash.Write(p[:n])
+	f.size += int64(n)
+	return n, err
+}
+
+// NewArchiveWriter writes an archive to w, whose manifest starts as manifest.
+func NewArchiveWriter(w io.Writer, manifest Manifest) *ArchiveWriter {
+	manifest.FormatVersion = FormatVersion
+	manifest.Files = []ArchivedFile{}
+	return &ArchiveWriter{zip: zip.NewWriter(w), manifest: manifest}
+}
+
+// Create starts the next file of the archive, ending the previous one.
+func (a *ArchiveWriter) Create(name string) (io.Writer, error) {
+	a.endFile()
+	w, err := a.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.manifest.CreatedAt})
+	if err != nil {
+		return nil, fmt.Errorf("error creating %v: %w", name, err)
+	}
+	a.file = &archiveFile{w: w, name: name, hash: sha256.New()}
+
+	return a.file, nil
+}
+
+func (a *ArchiveWriter) endFile() {
+	if a.file == nil {
+		return
+	}
+	a.manifest.Files = append(a.manifest.Files, ArchivedFile{Name: a.file.name, Size: a.file.size, SHA256: hex.EncodeToString(a.file.hash.Sum(nil))})
+	a.file = nil
+}
+
+// Close writes the manifest and its signature by signer, and ends the archive. It does not close
+// the underlying writer.
+func (a *ArchiveWriter) Close(signer ManifestSigner) error {
+	a.endFile()
+
+	manifest, err := json.MarshalIndent(a.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+	digest := sha256.Sum256(manifest)
+	signature, err := signer.Sign(digest[:])
+	if err != nil {
+		return fmt.Errorf("error signing manifest: %w", err)
+	}
+
+	if err := a.writeFile(ManifestFile, manifest); err != nil {
+		return err
+	}
+	if err := a.writeFile(ManifestSignatureFile, []byte(base64.StdEncoding.EncodeToString(signature))); err != nil {
+		return err
+	}
+
+	return a.zip.Close()
+}
+
+// writeFile adds a file which is not listed in the manifest.
+func (a *ArchiveWriter) writeFile(name string, content []byte) error {
+	w, err := a.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.manifest.CreatedAt})
+	if err != nil {
+		return fmt.Errorf("error creating %v: %w", name, err)
+	}
+	if _, err := w.Write(content); err != nil {
+		return fmt.Errorf("error writing %v: %w", name, err)
+	}
+
+	return nil
+}
+
+// VerifyArchive verifies the bundle archived in r, and that its files match the manifest. The
+// signature of the manifest is checked with exportKey, a PEM public key, when it is not nil.
+func VerifyArchive(r io.ReaderAt, size int64, exportKey []byte) (Report, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return Report{}, fmt.Errorf("error reading archive: %w", err)
+	}
+	files := map[string]*zip.File{}
+	// a name may be repeated, so that extractors picking another entry than this check see other content
+	occurrences := map[string]int{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+		occurrences[file.Name]++
+	}
+
+	encodedManifest, err := readArchiveFile(files, ManifestFile)
+	if err != nil {
+		return Report{}, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(encodedManifest, &manifest); err != nil {
+		return Report{}, fmt.Errorf("error decoding %v: %w", ManifestFile, err)
+	}
+	if manifest.FormatVersion != FormatVersion {
+		return Report{}, fmt.Errorf("unsupported bundle format version %v", manifest.FormatVersion)
+	}
+
+	findings := []Finding{}
+	add := func(kind string, detail string, args ...any) {
+		findings = append(findings, Finding{Kind: kind, SignatureCounter: -1, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	for _, file := range archive.File {
+		if count := occurrences[file.Name]; count > 1 {
+			add(KindTamperedFile, "%v appears %v times in the archive", file.Name, count)
+			occurrences[file.Name] = 0
+		}
+	}
+
+	manifestVerified := false
+	if exportKey != nil {
+		signature, err := readArchiveFile(files, ManifestSignatureFile)
+		if err != nil {
+			return Report{}, err
+		}
+		if err := verifyManifest(encodedManifest, manifest, signature, exportKey); err != nil {
+			add(KindInvalidManifest, "%v", err)
+		} else {
+			manifestVerified = true
+		}
+	}
+
+	listed := map[string]bool{ManifestFile: true, ManifestSignatureFile: true}
+	for _, expected := range manifest.Files {
+		listed[expected.Name] = true
+		file, found := files[expected.Name]
+		if !found {
+			add(KindTamperedFile, "%v is listed in the manifest but missing", expected.Name)
+			continue
+		}
+		size, sum, err := hashArchiveFile(file)
+		if err != nil {
+			add(KindTamperedFile, "%v cannot be read: %v", expected.Name, err)
+			continue
+		}
+		if size != expected.Size || sum != expected.SHA256 {
+			add(KindTamperedFile, "%v does not match its hash in the manifest", expected.Name)
+		}
+	}
+	for _, file := range archive.File {
+		if !listed[file.Name] {
+			add(KindTamperedFile, "%v is not listed in the manifest", file.Name)
+		}
+	}
+
+	encodedDevice, err := readArchiveFile(files, DeviceFile)
+	if err != nil {
+		return Report{}, err
+	}
+	device, err := DecodeDevice(bytes.NewReader(encodedDevice))
+	if err != nil {
+		return Report{}, err
+	}
+	if device.ID != manifest.DeviceID {
+		add(KindInvalidManifest, "manifest is about device '%v', not '%v'", manifest.DeviceID, device.ID)
+	}
+	signatures, found := files[SignaturesFile]
+	if !found {
+		return Report{}, fmt.Errorf("archive has no %v", SignaturesFile)
+	}
+	records, err := signatures.Open()
+	if err != nil {
+		return Report{}, fmt.Errorf("error opening %v: %w", SignaturesFile, err)
+	}
+	defer records.Close()
+
+	report, err := Verify(device, records)
+	if err != nil {
+		return Report{}, err
+	}
+	report.Findings = append(findings, report.Findings...)
+	report.ManifestVerified = manifestVerified && len(findings) == 0
+
+	return report, nil
+}
+
+func readArchiveFile(files map[string]*zip.File, name string) ([]byte, error) {
+	file, found := files[name]
+	if !found {
+		return nil, fmt.Errorf("archive has no %v", name)
+	}
+	r, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v: %w", name, err)
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %v: %w", name, err)
+	}
+	return content, nil
+}
+
+func hashArchiveFile(file *zip.File) (int64, string, error) {
+	r, err := file.Open()
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyManifest checks the signature of the encoded manifest with the export key.
+func verifyManifest(encoded []byte, manifest Manifest, encodedSignature []byte, exportKey []byte) error {
+	der, err := decodePublicKey(exportKey)
+	if err != nil {
+		return fmt.Errorf("invalid export key: %w", err)
+	}
+	fingerprint := sha256.Sum256(der)
+	if manifest.ExportKey != hex.EncodeToString(fingerprint[:]) {
+		return fmt.Errorf("manifest is signed by export key %v, not by the given one", manifest.ExportKey)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return fmt.Errorf("invalid export key: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedSignature)))
+	if err != nil {
+		return errors.New("manifest signature is not base64 encoded")
+	}
+
+	verify, err := newKeyVerifyFunc(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid export key: %w", err)
+	}
+	digest := sha256.Sum256(encoded)
+	if !verify(digest[:], signature) {
+		return errors.New("manifest signature does not verify with the export key")
+	}
+
+	return nil
+}
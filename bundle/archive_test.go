@@ -0,0 +1,226 @@
+package bundle_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/bundle"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/keygen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newExportKey returns a PEM public key and a signer of its private key.
+func newExportKey(t *testing.T) ([]byte, crypto.Signer) {
+	t.Helper()
+
+	publicKey, privateKey, err := keygen.ECC()
+	require.NoError(t, err)
+	signer, err := crypto.ECCSignerFactory(privateKey)
+	require.NoError(t, err)
+	return publicKey, signer
+}
+
+func writeArchive(t *testing.T, device bundle.Device, records []bundle.Record, publicKey []byte, signer crypto.Signer) []byte {
+	t.Helper()
+
+	fingerprint, err := bundle.Fingerprint(publicKey)
+	require.NoError(t, err)
+	archived := &bytes.Buffer{}
+	archive := bundle.NewArchiveWriter(archived, bundle.Manifest{DeviceID: device.ID, CreatedAt: time.Now().UTC(), ExportKey: fingerprint})
+
+	w, err := archive.Create(bundle.DeviceFile)
+	require.NoError(t, err)
+	require.NoError(t, writeJSON(w, device))
+	w, err = archive.Create(bundle.SignaturesFile)
+	require.NoError(t, err)
+	_, err = w.Write(encodeRecords(t, records).Bytes())
+	require.NoError(t, err)
+	require.NoError(t, archive.Close(signer))
+
+	return archived.Bytes()
+}
+
+func writeJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// writeArchiveSignature signs the manifest of archived with signer.
+func writeArchiveSignature(t *testing.T, archived []byte, signer crypto.Signer) []byte {
+	t.Helper()
+
+	r, err := zip.NewReader(bytes.NewReader(archived), int64(len(archived)))
+	require.NoError(t, err)
+	file, err := r.Open(bundle.ManifestFile)
+	require.NoError(t, err)
+	defer file.Close()
+	manifest, err := io.ReadAll(file)
+	require.NoError(t, err)
+
+	digest := sha256.Sum256(manifest)
+	signature, err := signer.Sign(digest[:])
+	require.NoError(t, err)
+	return []byte(base64.StdEncoding.EncodeToString(signature))
+}
+
+// rewrite copies archived, replacing the content of the file name, or adding it when missing.
+// A nil content drops the file.
+func rewrite(t *testing.T, archived []byte, name string, content []byte) []byte {
+	t.Helper()
+
+	r, err := zip.NewReader(bytes.NewReader(archived), int64(len(archived)))
+	require.NoError(t, err)
+	rewritten := &bytes.Buffer{}
+	w := zip.NewWriter(rewritten)
+	replaced := false
+	for _, file := range r.File {
+		original, err := file.Open()
+		require.NoError(t, err)
+		copied, err := io.ReadAll(original)
+		require.NoError(t, err)
+		if file.Name == name {
+			replaced = true
+			if content == nil {
+				continue
+			}
+			copied = content
+		}
+		fw, err := w.Create(file.Name)
+		require.NoError(t, err)
+		_, err = fw.Write(copied)
+		require.NoError(t, err)
+	}
+	if !replaced {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	return rewritten.Bytes()
+}
+
+// duplicate copies archived, adding a second file called name with content.
+func duplicate(t *testing.T, archived []byte, name string, content []byte) []byte {
+	t.Helper()
+
+	r, err := zip.NewReader(bytes.NewReader(archived), int64(len(archived)))
+	require.NoError(t, err)
+	duplicated := &bytes.Buffer{}
+	w := zip.NewWriter(duplicated)
+	for _, file := range r.File {
+		require.NoError(t, w.Copy(file))
+	}
+	fw, err := w.Create(name)
+	require.NoError(t, err)
+	_, err = fw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return duplicated.Bytes()
+}
+
+func verifyArchive(t *testing.T, archived []byte, exportKey []byte) bundle.Report {
+	t.Helper()
+
+	report, err := bundle.VerifyArchive(bytes.NewReader(archived), int64(len(archived)), exportKey)
+	require.NoError(t, err)
+	return report
+}
+
+func TestVerifyArchive(t *testing.T) {
+	device, records := newBundle(t, "ECC")
+	publicKey, signer := newExportKey(t)
+	otherPublicKey, otherSigner := newExportKey(t)
+	archived := writeArchive(t, device, records, publicKey, signer)
+
+	valid := verifyArchive(t, archived, publicKey)
+	assert.True(t, valid.Valid(), valid.Findings)
+	assert.True(t, valid.ManifestVerified)
+	assert.Equal(t, 6, valid.Signatures)
+
+	unchecked := verifyArchive(t, archived, nil)
+	assert.True(t, unchecked.Valid(), unchecked.Findings)
+	assert.False(t, unchecked.ManifestVerified)
+
+	tamperedRecords := append([]bundle.Record{}, records...)
+	tamperedRecords[2].DataToBeSigned = "transaction_two"
+	tests := []struct {
+		name      string
+		archived  []byte
+		exportKey []byte
+		expected  []string
+	}{
+		{
+			name:      "other export key",
+			archived:  archived,
+			exportKey: otherPublicKey,
+			expected:  []string{"invalid_manifest@-1"},
+		},
+		{
+			name:      "manifest signed by another key",
+			archived:  rewrite(t, archived, bundle.ManifestSignatureFile, writeArchiveSignature(t, archived, otherSigner)),
+			exportKey: publicKey,
+			expected:  []string{"invalid_manifest@-1"},
+		},
+		{
+			name:      "tampered signatures",
+			archived:  rewrite(t, archived, bundle.SignaturesFile, encodeRecords(t, tamperedRecords).Bytes()),
+			exportKey: publicKey,
+			expected:  []string{"tampered_file@-1", "tampered_data@2"},
+		},
+		{
+			name:      "truncated signatures",
+			archived:  rewrite(t, archived, bundle.SignaturesFile, encodeRecords(t, records[:5]).Bytes()),
+			exportKey: nil,
+			expected:  []string{"tampered_file@-1", "gap@5"},
+		},
+		{
+			name:      "duplicated file",
+			archived:  duplicate(t, archived, bundle.SignaturesFile, encodeRecords(t, records).Bytes()),
+			exportKey: publicKey,
+			expected:  []string{"tampered_file@-1"},
+		},
+		{
+			name:      "unlisted file",
+			archived:  rewrite(t, archived, "notes.txt", []byte("trust me")),
+			exportKey: publicKey,
+			expected:  []string{"tampered_file@-1"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			report := verifyArchive(t, tc.archived, tc.exportKey)
+			assert.Equal(t, tc.expected, kinds(report))
+			assert.False(t, report.ManifestVerified)
+		})
+	}
+}
+
+func TestVerifyArchiveRejectsIncompleteArchives(t *testing.T) {
+	device, records := newBundle(t, "RSA")
+	publicKey, signer := newExportKey(t)
+	archived := writeArchive(t, device, records, publicKey, signer)
+
+	for _, name := range []string{bundle.ManifestFile, bundle.DeviceFile, bundle.SignaturesFile} {
+		incomplete := rewrite(t, archived, name, nil)
+		_, err := bundle.VerifyArchive(bytes.NewReader(incomplete), int64(len(incomplete)), nil)
+		assert.ErrorContains(t, err, "archive has no "+name)
+	}
+
+	unsigned := rewrite(t, archived, bundle.ManifestSignatureFile, nil)
+	_, err := bundle.VerifyArchive(bytes.NewReader(unsigned), int64(len(unsigned)), publicKey)
+	assert.ErrorContains(t, err, "archive has no "+bundle.ManifestSignatureFile)
+
+	_, err = bundle.VerifyArchive(bytes.NewReader([]byte("not a zip")), 9, nil)
+	assert.ErrorContains(t, err, "error reading archive")
+}
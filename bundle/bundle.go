@@ -0,0 +1,155 @@
+// Package bundle defines the device bundle, the self-contained record of the signatures of a
+// device, and verifies it without access to the service.
+//
+// A bundle is a directory holding two files:
+//
+//   - device.json: the device, the parameters of its signature algorithm, every public key it
+//     signed with, by key version, and how many signatures it made
+//   - signatures.jsonl: one signature record per line, in the order of the signature counters
+//
+// The audit export of the service archives a bundle as a zip file, together with a manifest of its
+// files signed by the export key of the service (see ArchiveWriter).
+//
+// The verification recomputes the chain the service builds when signing: the signed data of the
+// signature with counter n is "<n>_<data_to_be_signed>_<previous signature>", where the previous
+// signature of counter 0 is the base64 encoded device ID. It only relies on the bundle and the
+// standard library, not on the code of the service.
+package bundle
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// FormatVersion is the version of the bundle format described here.
+	FormatVersion = 1
+
+	DeviceFile     = "device.json"
+	SignaturesFile = "signatures.jsonl"
+
+	// SignedDataFormat documents how the signed data is built from a signature record.
+	SignedDataFormat = "<signature_counter>_<data_to_be_signed>_<last_signature_base64>"
+)
+
+// Device is the content of device.json. The fields after SignatureCounter describe the device at
+// the time of an export: they are informational, and not needed to verify the bundle.
+type Device struct {
+	FormatVersion int         `json:"format_version"`
+	ID            string      `json:"id"`
+	SignatureAlg  string      `json:"signature_alg"`
+	Parameters    Parameters  `json:"parameters"`
+	PublicKeys    []PublicKey `json:"public_keys"`
+	// SignatureCounter is how many signatures the device made, all of which the bundle must hold:
+	// it is required, so that signatures missing at the end are found too
+	SignatureCounter int `json:"signature_counter"`
+
+	Label    string            `json:"label,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Status   string            `json:"status,omitempty"`
+}
+
+// Parameters describe how the signatures of a device are computed.
+type Parameters struct {
+	// Scheme is RSASSA-PKCS1-v1_5 or ECDSA
+	Scheme string `json:"scheme"`
+	Hash   string `json:"hash"`
+	// Curve is the elliptic curve of ECDSA keys
+	Curve string `json:"curve,omitempty"`
+	// SignatureEncoding is PKCS1 for RSA signatures, ASN.1 DER for ECDSA signatures
+	SignatureEncoding string `json:"signature_encoding"`
+	SignedDataFormat  string `json:"signed_data_format"`
+}
+
+// PublicKey is a PEM encoded public key of a device, as returned by the API.
+type PublicKey struct {
+	KeyVersion int        `json:"key_version"`
+	PublicKey  string     `json:"public_key"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+}
+
+// Record is a line of signatures.jsonl.
+type Record struct {
+	SignatureCounter int    `json:"signature_counter"`
+	KeyVersion       int    `json:"key_version"`
+	DataToBeSigned   string `json:"data_to_be_signed"`
+	SignedData       string `json:"signed_data"`
+	// Signature is base64 encoded
+	Signature string     `json:"signature"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// ParametersFor returns the parameters the service signs with, for the signature algorithms it supports.
+func ParametersFor(signatureAlg string) (Parameters, error) {
+	switch signatureAlg {
+	case "RSA":
+		return Parameters{Scheme: "RSASSA-PKCS1-v1_5", Hash: "SHA-256", SignatureEncoding: "PKCS1", SignedDataFormat: SignedDataFormat}, nil
+	case "ECC":
+		return Parameters{Scheme: "ECDSA", Hash: "SHA-256", Curve: "P-384", SignatureEncoding: "ASN.1 DER", SignedDataFormat: SignedDataFormat}, nil
+	default:
+		return Parameters{}, fmt.Errorf("unsupported signature algorithm '%v'", signatureAlg)
+	}
+}
+
+// ReadDevice reads the device.json of the bundle in dir.
+func ReadDevice(dir string) (Device, error) {
+	file, err := os.Open(filepath.Join(dir, DeviceFile))
+	if err != nil {
+		return Device{}, err
+	}
+	defer file.Close()
+
+	return DecodeDevice(file)
+}
+
+// DecodeDevice decodes a device.json.
+func DecodeDevice(r io.Reader) (Device, error) {
+	encoded, err := io.ReadAll(r)
+	if err != nil {
+		return Device{}, fmt.Errorf("error reading %v: %w", DeviceFile, err)
+	}
+	var device Device
+	if err := json.Unmarshal(encoded, &device); err != nil {
+		return Device{}, fmt.Errorf("error decoding %v: %w", DeviceFile, err)
+	}
+	if device.FormatVersion != FormatVersion {
+		return Device{}, fmt.Errorf("unsupported bundle format version %v", device.FormatVersion)
+	}
+	// a missing signature counter must not pass for a device which never signed
+	var required struct {
+		SignatureCounter *int `json:"signature_counter"`
+	}
+	if err := json.Unmarshal(encoded, &required); err != nil {
+		return Device{}, fmt.Errorf("error decoding %v: %w", DeviceFile, err)
+	}
+	if required.SignatureCounter == nil || *required.SignatureCounter < 0 {
+		return Device{}, fmt.Errorf("%v lacks a valid signature_counter", DeviceFile)
+	}
+
+	return device, nil
+}
+
+// ScanRecords calls fn with every line of a signatures.jsonl, numbered from 1, without keeping
+// them in memory. A line which cannot be decoded is passed with its error.
+func ScanRecords(r io.Reader, fn func(line int, record Record, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		fn(line, record, err)
+	}
+
+	return scanner.Err()
+}
+
+// EncodeRecord writes record as a line of signatures.jsonl.
+func EncodeRecord(w io.Writer, record Record) error {
+	return json.NewEncoder(w).Encode(record)
+}
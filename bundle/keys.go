@@ -0,0 +1,48 @@
+package bundle
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// verifyFunc checks a signature of a SHA-256 digest.
+type verifyFunc func(digest []byte, signature []byte) bool
+
+func decodeSinglePEM(encoded []byte) (*pem.Block, error) {
+	block, rest := pem.Decode(encoded)
+	if block == nil || len(strings.TrimSpace(string(rest))) > 0 {
+		return nil, errors.New("expected a single PEM block")
+	}
+	return block, nil
+}
+
+// decodePublicKey returns the DER encoding of a PEM public key.
+func decodePublicKey(publicKey []byte) ([]byte, error) {
+	block, err := decodeSinglePEM(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return block.Bytes, nil
+}
+
+// newKeyVerifyFunc verifies with a parsed public key: ECDSA signatures are ASN.1 DER encoded, RSA
+// ones PKCS1 v1.5.
+func newKeyVerifyFunc(publicKey any) (verifyFunc, error) {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return func(digest []byte, signature []byte) bool {
+			return ecdsa.VerifyASN1(key, digest, signature)
+		}, nil
+	case *rsa.PublicKey:
+		return func(digest []byte, signature []byte) bool {
+			return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) == nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
@@ -0,0 +1,277 @@
+package bundle
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kinds of findings.
+const (
+	KindMalformed        = "malformed"
+	KindGap              = "gap"
+	KindReordered        = "reordered"
+	KindDuplicate        = "duplicate"
+	KindTamperedData     = "tampered_data"
+	KindBrokenChain      = "broken_chain"
+	KindUnknownKey       = "unknown_key"
+	KindInvalidSignature = "invalid_signature"
+)
+
+// Finding is a problem found in a bundle. Line is 0 for findings about the bundle as a whole.
+type Finding struct {
+	Kind             string `json:"kind"`
+	Line             int    `json:"line,omitempty"`
+	SignatureCounter int    `json:"signature_counter"`
+	Detail           string `json:"detail"`
+}
+
+// Report is the outcome of verifying a bundle: it is valid when there are no findings.
+type Report struct {
+	DeviceID   string    `json:"device_id"`
+	Signatures int       `json:"signatures"`
+	Findings   []Finding `json:"findings"`
+	// ManifestVerified is set once the files of an archive are found to match its manifest, and
+	// the manifest signed by the export key
+	ManifestVerified bool `json:"manifest_verified,omitempty"`
+}
+
+func (r Report) Valid() bool {
+	return len(r.Findings) == 0
+}
+
+type signatureHash [sha256.Size]byte
+
+func hashSignature(signature string) signatureHash {
+	return sha256.Sum256([]byte(signature))
+}
+
+// Verifier checks the records of a bundle one after the other. Records may be out of order: the
+// link between two signatures is checked once both have been seen.
+type Verifier struct {
+	device   Device
+	verifyFn map[int]verifyFunc
+	report   Report
+	// signatures are the hashes of the signatures seen, by counter
+	signatures map[int]signatureHash
+	// pending are the previous signatures claimed by the records whose predecessor was not seen yet,
+	// by the counter of that predecessor
+	pending map[int]pendingLink
+	// previous is the counter of the last record, highest the highest counter so far
+	previous int
+	highest  int
+}
+
+type pendingLink struct {
+	line     int
+	previous signatureHash
+}
+
+// NewVerifier checks the parameters and public keys of device, to verify its records with.
+func NewVerifier(device Device) (*Verifier, error) {
+	expected, err := ParametersFor(device.SignatureAlg)
+	if err != nil {
+		return nil, err
+	}
+	if device.Parameters != expected {
+		return nil, fmt.Errorf("unsupported parameters %+v for algorithm '%v'", device.Parameters, device.SignatureAlg)
+	}
+
+	v := &Verifier{
+		device:     device,
+		verifyFn:   map[int]verifyFunc{},
+		report:     Report{DeviceID: device.ID, Findings: []Finding{}},
+		signatures: map[int]signatureHash{},
+		pending:    map[int]pendingLink{},
+		previous:   -1,
+		highest:    -1,
+	}
+	for _, publicKey := range device.PublicKeys {
+		verifyFn, err := newVerifyFn(device.Parameters, []byte(publicKey.PublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("public key version %v: %w", publicKey.KeyVersion, err)
+		}
+		v.verifyFn[publicKey.KeyVersion] = verifyFn
+	}
+
+	return v, nil
+}
+
+// newVerifyFn decodes a PEM public key, which must match parameters.
+func newVerifyFn(parameters Parameters, encoded []byte) (verifyFunc, error) {
+	der, err := decodePublicKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parameters.Scheme {
+	case "RSASSA-PKCS1-v1_5":
+		key, err := x509.ParsePKCS1PublicKey(der)
+		if err != nil {
+			return nil, err
+		}
+		return newKeyVerifyFunc(key)
+	case "ECDSA":
+		parsed, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(*ecdsa.PublicKey)
+		if !ok || key.Curve.Params().Name != parameters.Curve {
+			return nil, fmt.Errorf("expected a %v ECDSA key", parameters.Curve)
+		}
+		return newKeyVerifyFunc(key)
+	default:
+		return nil, fmt.Errorf("unsupported scheme '%v'", parameters.Scheme)
+	}
+}
+
+func (v *Verifier) add(kind string, line int, counter int, detail string, args ...any) {
+	v.report.Findings = append(v.report.Findings, Finding{Kind: kind, Line: line, SignatureCounter: counter, Detail: fmt.Sprintf(detail, args...)})
+}
+
+// Malformed records a line of signatures.jsonl which could not be decoded.
+func (v *Verifier) Malformed(line int, err error) {
+	v.add(KindMalformed, line, -1, "%v", err)
+}
+
+// Verify checks a record, found on line of signatures.jsonl.
+func (v *Verifier) Verify(line int, record Record) {
+	v.report.Signatures++
+	counter := record.SignatureCounter
+
+	if counter < 0 {
+		v.add(KindMalformed, line, counter, "negative signature counter")
+		return
+	}
+	if _, seen := v.signatures[counter]; seen {
+		v.add(KindDuplicate, line, counter, "signature counter %v appears more than once", counter)
+		return
+	}
+	if counter < v.previous {
+		v.add(KindReordered, line, counter, "signature counter %v follows %v", counter, v.previous)
+	}
+	v.previous = counter
+	v.highest = max(v.highest, counter)
+
+	// the signed data must be recomputable from the counter and the data
+	prefix := fmt.Sprintf("%d_%s_", counter, record.DataToBeSigned)
+	previous, found := strings.CutPrefix(record.SignedData, prefix)
+	if !found {
+		v.add(KindTamperedData, line, counter, "signed data does not match the signature counter and the data to be signed")
+	}
+
+	if verifyFn, found := v.verifyFn[record.KeyVersion]; !found {
+		v.add(KindUnknownKey, line, counter, "no public key with version %v", record.KeyVersion)
+	} else if signature, err := base64.StdEncoding.DecodeString(record.Signature); err != nil {
+		v.add(KindInvalidSignature, line, counter, "signature is not base64 encoded")
+	} else {
+		digest := sha256.Sum256([]byte(record.SignedData))
+		if !verifyFn(digest[:], signature) {
+			v.add(KindInvalidSignature, line, counter, "signature does not verify with public key version %v", record.KeyVersion)
+		}
+	}
+
+	v.signatures[counter] = hashSignature(record.Signature)
+	if found {
+		v.link(line, counter, hashSignature(previous))
+	}
+	if next, found := v.pending[counter]; found {
+		delete(v.pending, counter)
+		v.link(next.line, counter+1, next.previous)
+	}
+}
+
+// link checks that the signature with counter chains from the previous signature.
+func (v *Verifier) link(line int, counter int, previous signatureHash) {
+	if counter == 0 {
+		if previous != hashSignature(base64.StdEncoding.EncodeToString([]byte(v.device.ID))) {
+			v.add(KindBrokenChain, line, counter, "first signature does not chain from the device ID")
+		}
+		return
+	}
+
+	expected, seen := v.signatures[counter-1]
+	if !seen {
+		v.pending[counter-1] = pendingLink{line: line, previous: previous}
+		return
+	}
+	if previous != expected {
+		v.add(KindBrokenChain, line, counter, "signed data does not end with signature %v", counter-1)
+	}
+}
+
+// Report returns the findings, once every record has been verified: the missing signature
+// counters are reported as gaps, up to the signature counter of the device.
+func (v *Verifier) Report() Report {
+	report := v.report
+	report.Findings = append([]Finding{}, v.report.Findings...)
+
+	last := max(v.highest, v.device.SignatureCounter-1)
+	// start is the first counter of a run of missing ones, -1 outside of such a run
+	start := -1
+	for counter := 0; counter <= last+1; counter++ {
+		_, seen := v.signatures[counter]
+		if !seen && counter <= last {
+			if start < 0 {
+				start = counter
+			}
+			continue
+		}
+		if start >= 0 {
+			detail := fmt.Sprintf("signature counters %v to %v are missing", start, counter-1)
+			if start == counter-1 {
+				detail = fmt.Sprintf("signature counter %v is missing", start)
+			}
+			report.Findings = append(report.Findings, Finding{Kind: KindGap, SignatureCounter: start, Detail: detail})
+			start = -1
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].SignatureCounter < report.Findings[j].SignatureCounter
+	})
+	return report
+}
+
+// VerifyDir verifies the bundle in dir.
+func VerifyDir(dir string) (Report, error) {
+	device, err := ReadDevice(dir)
+	if err != nil {
+		return Report{}, err
+	}
+	file, err := os.Open(filepath.Join(dir, SignaturesFile))
+	if err != nil {
+		return Report{}, err
+	}
+	defer file.Close()
+
+	return Verify(device, file)
+}
+
+// Verify verifies device against the signature records read from signatures.
+func Verify(device Device, signatures io.Reader) (Report, error) {
+	verifier, err := NewVerifier(device)
+	if err != nil {
+		return Report{}, err
+	}
+	err = ScanRecords(signatures, func(line int, record Record, err error) {
+		if err != nil {
+			verifier.Malformed(line, err)
+			return
+		}
+		verifier.Verify(line, record)
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("error reading %v: %w", SignaturesFile, err)
+	}
+
+	return verifier.Report(), nil
+}
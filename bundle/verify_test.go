@@ -0,0 +1,245 @@
+package bundle_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/bundle"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBundle signs six transactions with a new device, rotating its key after three of them.
+func newBundle(t *testing.T, signatureAlg string) (bundle.Device, []bundle.Record) {
+	t.Helper()
+	ctx := logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	service := servicetest.New(t).Signature
+	created, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: signatureAlg})
+	require.NoError(t, err)
+	parameters, err := bundle.ParametersFor(signatureAlg)
+	require.NoError(t, err)
+	device := bundle.Device{
+		FormatVersion: bundle.FormatVersion,
+		ID:            created.ID,
+		SignatureAlg:  signatureAlg,
+		Parameters:    parameters,
+		PublicKeys:    []bundle.PublicKey{{KeyVersion: 1, PublicKey: string(created.PublicKey)}},
+	}
+
+	records := []bundle.Record{}
+	for i := 0; i < 6; i++ {
+		if i == 3 {
+			current, err := service.GetSignatureDevice(ctx, created.ID)
+			require.NoError(t, err)
+			rotated, err := service.RotateSignatureDeviceKey(ctx, created.ID, current.Version)
+			require.NoError(t, err)
+			device.PublicKeys = append(device.PublicKeys, bundle.PublicKey{KeyVersion: rotated.KeyVersion, PublicKey: string(rotated.PublicKey)})
+		}
+
+		data := fmt.Sprintf("transaction_%v", i)
+		signed, err := service.SignData(ctx, created.ID, data)
+		require.NoError(t, err)
+		current, err := service.GetSignatureDevice(ctx, created.ID)
+		require.NoError(t, err)
+		records = append(records, bundle.Record{
+			SignatureCounter: i,
+			KeyVersion:       current.KeyVersion,
+			DataToBeSigned:   data,
+			SignedData:       signed.SignedData,
+			Signature:        signed.Signature,
+		})
+	}
+
+	device.SignatureCounter = len(records)
+
+	return device, records
+}
+
+func encodeRecords(t *testing.T, records []bundle.Record) *bytes.Buffer {
+	t.Helper()
+
+	encoded := &bytes.Buffer{}
+	for _, record := range records {
+		require.NoError(t, bundle.EncodeRecord(encoded, record))
+	}
+	return encoded
+}
+
+func kinds(report bundle.Report) []string {
+	found := []string{}
+	for _, finding := range report.Findings {
+		found = append(found, fmt.Sprintf("%v@%v", finding.Kind, finding.SignatureCounter))
+	}
+	return found
+}
+
+func TestVerifyFindsEveryKindOfProblem(t *testing.T) {
+	for _, signatureAlg := range []string{"RSA", "ECC"} {
+		t.Run(signatureAlg, func(t *testing.T) {
+			device, records := newBundle(t, signatureAlg)
+
+			// change returns a copy of the records, modified by fn
+			change := func(fn func(records []bundle.Record) []bundle.Record) []bundle.Record {
+				return fn(append([]bundle.Record{}, records...))
+			}
+			tests := []struct {
+				name     string
+				records  []bundle.Record
+				expected []string
+			}{
+				{name: "valid", records: records, expected: []string{}},
+				{
+					name:     "gap",
+					records:  change(func(r []bundle.Record) []bundle.Record { return append(r[:1], r[3:]...) }),
+					expected: []string{"gap@1"},
+				},
+				{
+					name:     "missing head and tail",
+					records:  records[2:4],
+					expected: []string{"gap@0", "gap@4"},
+				},
+				{
+					name:     "truncated tail",
+					records:  records[:4],
+					expected: []string{"gap@4"},
+				},
+				{
+					name: "reordered",
+					records: change(func(r []bundle.Record) []bundle.Record {
+						r[1], r[2] = r[2], r[1]
+						return r
+					}),
+					expected: []string{"reordered@1"},
+				},
+				{
+					name:     "duplicate",
+					records:  change(func(r []bundle.Record) []bundle.Record { return append(r, r[4]) }),
+					expected: []string{"duplicate@4"},
+				},
+				{
+					name: "tampered data",
+					records: change(func(r []bundle.Record) []bundle.Record {
+						r[2].DataToBeSigned = "transaction_two"
+						return r
+					}),
+					expected: []string{"tampered_data@2"},
+				},
+				{
+					name: "tampered signed data",
+					records: change(func(r []bundle.Record) []bundle.Record {
+						r[2].DataToBeSigned = "transaction_two"
+						r[2].SignedData = strings.Replace(r[2].SignedData, "transaction_2", "transaction_two", 1)
+						return r
+					}),
+					expected: []string{"invalid_signature@2"},
+				},
+				{
+					name: "forged signature",
+					records: change(func(r []bundle.Record) []bundle.Record {
+						r[4].Signature = r[3].Signature
+						return r
+					}),
+					expected: []string{"invalid_signature@4", "broken_chain@5"},
+				},
+				{
+					name: "renumbered",
+					records: change(func(r []bundle.Record) []bundle.Record {
+						r[5].SignatureCounter = 6
+						return r
+					}),
+					expected: []string{"gap@5", "tampered_data@6"},
+				},
+				{
+					name: "wrong key version",
+					records: change(func(r []bundle.Record) []bundle.Record {
+						r[1].KeyVersion = 2
+						r[2].KeyVersion = 7
+						return r
+					}),
+					expected: []string{"invalid_signature@1", "unknown_key@2"},
+				},
+			}
+
+			for _, tc := range tests {
+				t.Run(tc.name, func(t *testing.T) {
+					report, err := bundle.Verify(device, encodeRecords(t, tc.records))
+					require.NoError(t, err)
+					assert.Equal(t, tc.expected, kinds(report))
+					assert.Equal(t, len(tc.expected) == 0, report.Valid())
+				})
+			}
+		})
+	}
+}
+
+func TestVerifyChecksTheFirstLinkAgainstTheDeviceID(t *testing.T) {
+	device, records := newBundle(t, "ECC")
+	device.ID = "other-id"
+
+	report, err := bundle.Verify(device, encodeRecords(t, records))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"broken_chain@0"}, kinds(report))
+}
+
+func TestVerifyReportsMalformedLines(t *testing.T) {
+	device, records := newBundle(t, "ECC")
+	encoded := encodeRecords(t, records[:2])
+	encoded.WriteString("{not json\n")
+	encoded.Write(encodeRecords(t, records[2:]).Bytes())
+
+	report, err := bundle.Verify(device, encoded)
+	require.NoError(t, err)
+	require.Len(t, report.Findings, 1)
+	assert.Equal(t, bundle.KindMalformed, report.Findings[0].Kind)
+	assert.Equal(t, 3, report.Findings[0].Line)
+	assert.Equal(t, 6, report.Signatures)
+}
+
+func TestVerifyRejectsUnsupportedBundles(t *testing.T) {
+	device, _ := newBundle(t, "ECC")
+
+	otherParameters := device
+	otherParameters.Parameters.Hash = "SHA-1"
+	_, err := bundle.NewVerifier(otherParameters)
+	assert.ErrorContains(t, err, "unsupported parameters")
+
+	rsaDevice, _ := newBundle(t, "RSA")
+	otherKey := device
+	otherKey.PublicKeys = rsaDevice.PublicKeys
+	_, err = bundle.NewVerifier(otherKey)
+	assert.ErrorContains(t, err, "public key version 1")
+}
+
+func TestVerifyDir(t *testing.T) {
+	device, records := newBundle(t, "RSA")
+	dir := t.TempDir()
+	encodedDevice := fmt.Sprintf(`{"format_version": 1, "id": %q, "signature_alg": "RSA", "parameters": {"scheme": "RSASSA-PKCS1-v1_5", "hash": "SHA-256", "signature_encoding": "PKCS1", "signed_data_format": %q}, "public_keys": [{"key_version": 1, "public_key": %q}, {"key_version": 2, "public_key": %q}], "signature_counter": 6}`,
+		device.ID, bundle.SignedDataFormat, device.PublicKeys[0].PublicKey, device.PublicKeys[1].PublicKey)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, bundle.DeviceFile), []byte(encodedDevice), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, bundle.SignaturesFile), encodeRecords(t, records).Bytes(), 0o600))
+
+	report, err := bundle.VerifyDir(dir)
+	require.NoError(t, err)
+	assert.True(t, report.Valid(), report.Findings)
+	assert.Equal(t, 6, report.Signatures)
+
+	withoutCounter := strings.Replace(encodedDevice, `, "signature_counter": 6`, "", 1)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, bundle.DeviceFile), []byte(withoutCounter), 0o600))
+	_, err = bundle.VerifyDir(dir)
+	assert.EqualError(t, err, "device.json lacks a valid signature_counter")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, bundle.DeviceFile), []byte(`{"format_version": 2}`), 0o600))
+	_, err = bundle.VerifyDir(dir)
+	assert.EqualError(t, err, "unsupported bundle format version 2")
+}
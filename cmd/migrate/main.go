@@ -0,0 +1,82 @@
+// Command migrate copies the signature devices of a file store into another one, with their
+// public keys and signature history, and prints a report of the migration as JSON. Neither store
+// may be in use by the service meanwhile: to migrate while the service runs, set STORE_MIGRATE_TO
+// instead.
+//
+//	go run ./cmd/migrate -from /var/lib/signing-service -to /var/lib/signing-service-new
+//	go run ./cmd/migrate -from /var/lib/signing-service -to /var/lib/signing-service-new -verify
+//
+// A migration can be run again: only what the destination store lacks is copied. With -verify,
+// every device is then compared between both stores, and the signature chains the destination
+// store holds are verified. It exits with status 1 when any device failed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/backup"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/filelog"
+)
+
+// report is what the command prints.
+type report struct {
+	Migration    backup.MigrationReport     `json:"migration"`
+	Verification *backup.VerificationReport `json:"verification,omitempty"`
+}
+
+func main() {
+	from := flag.String("from", "", "directory of the store to migrate from")
+	to := flag.String("to", "", "directory of the store to migrate to, created when missing")
+	verify := flag.Bool("verify", false, "compare both stores once migrated")
+	flag.Parse()
+	if *from == "" || *to == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *from == *to {
+		log.Fatal("cannot migrate a store into itself")
+	}
+
+	source, err := filelog.Open(*from)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer source.Close()
+	destination, err := filelog.Open(*to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer destination.Close()
+
+	ctx := context.Background()
+	migrator := backup.NewMigrator(source, destination, crypto.VerifierFactories())
+	migration, err := migrator.Migrate(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	result := report{Migration: migration}
+	failed := len(migration.Failures) > 0
+	if *verify {
+		verification, err := migrator.Verify(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		result.Verification = &verification
+		failed = failed || len(verification.Failures) > 0
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatal(err)
+	}
+	if failed {
+		// the deferred closes are skipped: both stores are synced after every write
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,144 @@
+// Command replay rebuilds the signature devices from a store journal, as written by the
+// service when STORE_JOURNAL is set, and prints them as JSON without their key material.
+//
+//	go run ./cmd/replay -journal journal.jsonl
+//	go run ./cmd/replay -journal journal.jsonl -verify
+//
+// With -verify, the devices are projected twice: once from the last snapshot of every device and
+// only the events after it, and once from all the events alone. Any difference between both is
+// reported, and the command exits with status 1.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+)
+
+// device is a projected device, without its keys.
+type device struct {
+	ID               string            `json:"id"`
+	Tenant           string            `json:"tenant"`
+	SignatureAlg     string            `json:"signature_alg"`
+	Label            string            `json:"label"`
+	Metadata         map[string]string `json:"metadata"`
+	Tags             []string          `json:"tags"`
+	SignatureCounter int               `json:"signature_counter"`
+	Status           string            `json:"status"`
+	KeyVersion       int               `json:"key_version"`
+	Version          string            `json:"version"`
+}
+
+func main() {
+	journalPath := flag.String("journal", "", "path of the store journal, read from stdin when empty")
+	verify := flag.Bool("verify", false, "check that the snapshots match a replay of all the events")
+	flag.Parse()
+
+	var journal io.Reader = os.Stdin
+	if *journalPath != "" {
+		file, err := os.Open(*journalPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		journal = file
+	}
+
+	fromSnapshots, fromEvents, err := project(journal)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *verify {
+		if err := compare(fromSnapshots, fromEvents); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	devices := []device{}
+	for _, sigDevice := range fromSnapshots {
+		devices = append(devices, device{
+			ID:               sigDevice.ID,
+			Tenant:           sigDevice.Tenant,
+			SignatureAlg:     sigDevice.SignatureAlg,
+			Label:            sigDevice.Label,
+			Metadata:         sigDevice.Metadata,
+			Tags:             sigDevice.Tags,
+			SignatureCounter: sigDevice.SignatureCounter,
+			Status:           sigDevice.Status,
+			KeyVersion:       sigDevice.KeyVersion,
+			Version:          sigDevice.Version,
+		})
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(devices); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// project rebuilds the devices of the journal twice: once from the last snapshot of every device
+// and only the events after it, and once from all the events alone. Snapshots follow the events
+// they cover in the journal, so the events of a device are held back until its next snapshot.
+func project(journal io.Reader) ([]store.SignatureDevice, []store.SignatureDevice, error) {
+	fromEvents := store.NewProjection()
+	snapshots := map[string]store.DeviceSnapshot{}
+	// pending are the events of every device after its last snapshot
+	pending := map[string][]store.DeviceEvent{}
+	err := store.ReadJournal(journal, func(entry store.JournalEntry) error {
+		if snapshot := entry.Snapshot; snapshot != nil {
+			snapshots[snapshot.DeviceID] = *snapshot
+			events := []store.DeviceEvent{}
+			for _, event := range pending[snapshot.DeviceID] {
+				if event.Sequence > snapshot.Sequence {
+					events = append(events, event)
+				}
+			}
+			pending[snapshot.DeviceID] = events
+			return nil
+		}
+		if event := entry.Event; event != nil {
+			pending[event.DeviceID] = append(pending[event.DeviceID], *event)
+			return fromEvents.Apply(*event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fromSnapshots := store.NewProjection()
+	for _, snapshot := range snapshots {
+		fromSnapshots.ApplySnapshot(snapshot)
+	}
+	for _, events := range pending {
+		for _, event := range events {
+			if err := fromSnapshots.Apply(event); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return fromSnapshots.Devices(), fromEvents.Devices(), nil
+}
+
+// compare reports the first device whose state differs between the two projections.
+func compare(fromSnapshots []store.SignatureDevice, fromEvents []store.SignatureDevice) error {
+	if len(fromSnapshots) != len(fromEvents) {
+		return fmt.Errorf("snapshots project %v devices, events project %v", len(fromSnapshots), len(fromEvents))
+	}
+	for i := range fromSnapshots {
+		if !reflect.DeepEqual(fromSnapshots[i], fromEvents[i]) {
+			return fmt.Errorf("device '%v' differs between its snapshot and its events", fromSnapshots[i].ID)
+		}
+	}
+
+	return nil
+}
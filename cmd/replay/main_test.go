@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newJournal returns the journal of a device which signed 6 times, snapshotted every 2 events: its
+// last event follows its last snapshot.
+func newJournal(t *testing.T) []store.JournalEntry {
+	t.Helper()
+	ctx := context.Background()
+
+	journal := &bytes.Buffer{}
+	s := inmemory.New(inmemory.WithJournal(journal), inmemory.WithSnapshotInterval(2))
+	require.NoError(t, s.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "some-id", SignatureAlg: "ECC", PublicKey: []byte("public"), PrivateKey: []byte("private")}))
+	for counter := 1; counter <= 6; counter++ {
+		require.NoError(t, s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: counter, LastSignature: "signature-" + strconv.Itoa(counter), Version: strconv.Itoa(counter)}))
+	}
+
+	entries := []store.JournalEntry{}
+	require.NoError(t, store.ReadJournal(journal, func(entry store.JournalEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	return entries
+}
+
+func encode(t *testing.T, entries []store.JournalEntry) *bytes.Buffer {
+	t.Helper()
+
+	journal := &bytes.Buffer{}
+	encoder := json.NewEncoder(journal)
+	for _, entry := range entries {
+		require.NoError(t, encoder.Encode(entry))
+	}
+	return journal
+}
+
+func TestSnapshotsMatchTheEvents(t *testing.T) {
+	fromSnapshots, fromEvents, err := project(encode(t, newJournal(t)))
+	require.NoError(t, err)
+	require.Len(t, fromSnapshots, 1)
+	assert.Equal(t, 6, fromSnapshots[0].SignatureCounter)
+	assert.NoError(t, compare(fromSnapshots, fromEvents))
+}
+
+func TestWrongSnapshotIsReported(t *testing.T) {
+	entries := newJournal(t)
+	tampered := false
+	for _, entry := range entries {
+		if entry.Snapshot != nil {
+			entry.Snapshot.Device.Label = "tampered"
+			tampered = true
+		}
+	}
+	require.True(t, tampered)
+
+	fromSnapshots, fromEvents, err := project(encode(t, entries))
+	require.NoError(t, err)
+	assert.ErrorContains(t, compare(fromSnapshots, fromEvents), "device 'some-id' differs between its snapshot and its events")
+}
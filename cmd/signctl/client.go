@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+)
+
+// client calls the REST API of the signing service.
+type client struct {
+	baseURL string
+	// token is sent as a bearer token, for gateways authenticating the requests in front of the service
+	token      string
+	httpClient *http.Client
+}
+
+// do sends body as JSON, when not nil, and decodes the data of a successful response into data.
+// Failed requests are reported with the problem details of the response.
+func (c *client) do(ctx context.Context, method string, path string, body any, data any) error {
+	var requestBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(encoded)
+	}
+
+	request, err := c.newRequest(ctx, method, path, requestBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		return problemError(method, path, response.Status, responseBody)
+	}
+
+	if data == nil {
+		return nil
+	}
+	if err := json.Unmarshal(responseBody, &api.Response{Data: data}); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// download writes the body of a successful response to w, for the routes serving files. It is not
+// bounded by the timeout of the requests, but by ctx only: files may take long to transfer.
+func (c *client) download(ctx context.Context, path string, w io.Writer) error {
+	request, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.stream(request, func(response *http.Response) error {
+		if _, err := io.Copy(w, response.Body); err != nil {
+			return fmt.Errorf("error reading response: %w", err)
+		}
+		return nil
+	})
+}
+
+// upload sends body as it is, with the given media type, and decodes the data of a successful
+// response into data. Like download, it is bounded by ctx only.
+func (c *client) upload(ctx context.Context, method string, path string, mediaType string, body io.Reader, data any) error {
+	request, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", mediaType)
+
+	return c.stream(request, func(response *http.Response) error {
+		if err := json.NewDecoder(response.Body).Decode(&api.Response{Data: data}); err != nil {
+			return fmt.Errorf("error decoding response: %w", err)
+		}
+		return nil
+	})
+}
+
+func (c *client) stream(request *http.Request, fn func(response *http.Response) error) error {
+	httpClient := *c.httpClient
+	httpClient.Timeout = 0
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		responseBody, err := io.ReadAll(response.Body)
+		if err != nil {
+			return fmt.Errorf("error reading response: %w", err)
+		}
+		return problemError(request.Method, request.URL.Path, response.Status, responseBody)
+	}
+	return fn(response)
+}
+
+func (c *client) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.baseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return request, nil
+}
+
+// problemError reports a failed request with the problem details of its response.
+func problemError(method string, path string, status string, body []byte) error {
+	var problem api.Problem
+	if err := json.Unmarshal(body, &problem); err != nil || problem.Title == "" {
+		return fmt.Errorf("%v %v: %v", method, path, status)
+	}
+	if problem.Detail != "" {
+		return fmt.Errorf("%v %v: %v (%v): %v", method, path, problem.Title, problem.Code, problem.Detail)
+	}
+	return fmt.Errorf("%v %v: %v (%v)", method, path, problem.Title, problem.Code)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+)
+
+const (
+	devicesPath = "/api/v0/devices"
+	backupPath  = "/api/v0/admin/backup"
+	restorePath = "/api/v0/admin/restore"
+)
+
+// errInvalidChain fails verify, once the reason has been printed.
+var errInvalidChain = errors.New("invalid signature chain")
+
+// stringList is a flag which can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// keyValues is a flag of KEY=VALUE pairs which can be repeated.
+type keyValues map[string]string
+
+func (kv keyValues) String() string {
+	pairs := []string{}
+	for key, value := range kv {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (kv keyValues) Set(value string) error {
+	key, val, found := strings.Cut(value, "=")
+	if !found || key == "" {
+		return fmt.Errorf("expected KEY=VALUE, got '%v'", value)
+	}
+	kv[key] = val
+	return nil
+}
+
+// parseFlags parses the arguments of a command, followed by the positional arguments named by
+// positional. Names in brackets are optional.
+func parseFlags(flags *flag.FlagSet, args []string, positional ...string) error {
+	flags.Usage = func() {
+		usage := "usage: signctl " + flags.Name()
+		flags.VisitAll(func(f *flag.Flag) {
+			usage += " [-" + f.Name + "]"
+		})
+		for _, name := range positional {
+			usage += " " + name
+		}
+		fmt.Fprintln(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	required := 0
+	for _, name := range positional {
+		if !strings.HasPrefix(name, "[") {
+			required++
+		}
+	}
+	if flags.NArg() < required || flags.NArg() > len(positional) {
+		return fmt.Errorf("%v expects the arguments '%v', got %v argument(s)", flags.Name(), strings.Join(positional, " "), flags.NArg())
+	}
+
+	return nil
+}
+
+func createDevice(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	id := flags.String("id", "", "device ID, generated by the service when empty")
+	alg := flags.String("alg", "", "signature algorithm: ECC or RSA")
+	label := flags.String("label", "", "label of the device")
+	tags := stringList{}
+	flags.Var(&tags, "tag", "tag of the device, repeatable")
+	metadata := keyValues{}
+	flags.Var(metadata, "metadata", "KEY=VALUE metadata entry of the device, repeatable")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	body := api.NewSignatureDevice{
+		SignatureAlg: *alg,
+		Label:        *label,
+		Metadata:     metadata,
+		Tags:         tags,
+	}
+	var device api.SignatureDevice
+	var err error
+	if *id == "" {
+		err = env.client.do(ctx, http.MethodPost, devicesPath, body, &device)
+	} else {
+		err = env.client.do(ctx, http.MethodPut, devicesPath+"/"+url.PathEscape(*id), body, &device)
+	}
+	if err != nil {
+		return err
+	}
+
+	return env.output.device(env.stdout, device)
+}
+
+func listDevices(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	tags := stringList{}
+	flags.Var(&tags, "tag", "only list devices with this tag, repeatable")
+	metadata := keyValues{}
+	flags.Var(metadata, "metadata", "only list devices with this KEY=VALUE metadata entry, repeatable")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+	for key, value := range metadata {
+		query.Set("metadata["+key+"]", value)
+	}
+	path := devicesPath
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	devices := []api.SignatureDevice{}
+	if err := env.client.do(ctx, http.MethodGet, path, nil, &devices); err != nil {
+		return err
+	}
+
+	return env.output.devices(env.stdout, devices)
+}
+
+func getDevice(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	if err := parseFlags(flags, args, "ID"); err != nil {
+		return err
+	}
+
+	var device api.SignatureDevice
+	if err := env.client.do(ctx, http.MethodGet, devicesPath+"/"+url.PathEscape(flags.Arg(0)), nil, &device); err != nil {
+		return err
+	}
+
+	return env.output.device(env.stdout, device)
+}
+
+func signData(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	path := flags.String("file", "", "file holding the data to be signed, stdin when empty")
+	if err := parseFlags(flags, args, "ID"); err != nil {
+		return err
+	}
+
+	data, err := readInput(env.stdin, *path)
+	if err != nil {
+		return err
+	}
+
+	var signed api.SignatureResp
+	err = env.client.do(ctx, http.MethodPost, devicesPath+"/"+url.PathEscape(flags.Arg(0))+"/sign", api.SignatureReq{DataToBeSigned: string(data)}, &signed)
+	if err != nil {
+		return err
+	}
+
+	return env.output.signature(env.stdout, signed)
+}
+
+func publicKey(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("public-key", flag.ContinueOnError)
+	if err := parseFlags(flags, args, "ID"); err != nil {
+		return err
+	}
+
+	var device api.SignatureDevice
+	if err := env.client.do(ctx, http.MethodGet, devicesPath+"/"+url.PathEscape(flags.Arg(0)), nil, &device); err != nil {
+		return err
+	}
+
+	// the PEM is printed as it is, whatever the output format, to be saved for offline verification
+	_, err := io.WriteString(env.stdout, device.PublicKey)
+	return err
+}
+
+func verifyChain(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	publicKeyPath := flags.String("public-key", "", "file holding the PEM encoded public key of the device")
+	deviceID := flags.String("device", "", "ID of the device, which the first signature chains from")
+	if err := parseFlags(flags, args, "[SIGNATURES]"); err != nil {
+		return err
+	}
+	if *publicKeyPath == "" || *deviceID == "" {
+		return errors.New("verify expects -public-key and -device")
+	}
+
+	encodedKey, err := os.ReadFile(*publicKeyPath)
+	if err != nil {
+		return err
+	}
+	verifier, err := newVerifier(encodedKey)
+	if err != nil {
+		return err
+	}
+	signatures, err := readSignatures(env.stdin, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	result := verification{Device: *deviceID, Signatures: len(signatures), Valid: true}
+	if err := signature.VerifyChain(*deviceID, verifier, signatures); err != nil {
+		result.Valid = false
+		result.Error = err.Error()
+	}
+	if err := env.output.verification(env.stdout, result); err != nil {
+		return err
+	}
+
+	if !result.Valid {
+		return errInvalidChain
+	}
+	return nil
+}
+
+func backupStore(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	path := flags.String("file", "", "file to write the backup to, stdout when empty")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *path == "" {
+		return env.client.download(ctx, backupPath, env.stdout)
+	}
+	file, err := os.Create(*path)
+	if err != nil {
+		return err
+	}
+	err = env.client.download(ctx, backupPath, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// a partial backup cannot be restored: it is not left behind
+		os.Remove(*path)
+		return err
+	}
+
+	return nil
+}
+
+func restoreStore(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	if err := parseFlags(flags, args, "[BACKUP]"); err != nil {
+		return err
+	}
+
+	in := env.stdin
+	if flags.NArg() > 0 {
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	var summary api.BackupSummary
+	if err := env.client.upload(ctx, http.MethodPost, restorePath, api.BackupMediaType, in, &summary); err != nil {
+		return err
+	}
+
+	return env.output.restored(env.stdout, summary)
+}
+
+// newVerifier tells the algorithm of the public key from its PEM block type.
+func newVerifier(publicKey []byte) (crypto.Verifier, error) {
+	verifier, err := crypto.ECCVerifierFactory(publicKey)
+	var pemTypeErr *crypto.PEMTypeError
+	if errors.As(err, &pemTypeErr) {
+		verifier, err = crypto.RSAVerifierFactory(publicKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decoding public key: %w", err)
+	}
+
+	return verifier, nil
+}
+
+// readInput reads the file at path, or in when path is empty.
+func readInput(in io.Reader, path string) ([]byte, error) {
+	if path == "" {
+		return io.ReadAll(in)
+	}
+	return os.ReadFile(path)
+}
+
+// readSignatures reads the JSON lines printed by sign, from the file at path or in.
+func readSignatures(in io.Reader, path string) ([]signature.Signature, error) {
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	signatures := []signature.Signature{}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var signed api.SignatureResp
+		if err := json.Unmarshal(scanner.Bytes(), &signed); err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		signatures = append(signatures, signature.Signature{
+			Signature:  signed.Signature,
+			SignedData: signed.SignedData,
+		})
+	}
+
+	return signatures, scanner.Err()
+}
@@ -0,0 +1,130 @@
+// Command signctl operates the signing service through its REST API.
+//
+//	signctl [-url URL] [-token TOKEN] [-o table|json] COMMAND [ARGUMENTS]
+//
+// Commands:
+//
+//	create -alg ECC|RSA [-id ID] [-label LABEL] [-tag TAG]... [-metadata KEY=VALUE]...
+//	list [-tag TAG]... [-metadata KEY=VALUE]...
+//	get ID
+//	sign [-file PATH] ID
+//	public-key ID
+//	verify -public-key PATH -device ID [SIGNATURES]
+//	backup [-file PATH]
+//	restore [BACKUP]
+//
+// sign signs the content of PATH, or stdin, as it is: a trailing newline is signed too. Its JSON
+// output is a single line, so that the signatures of a device can be collected into a file:
+//
+//	signctl -o json sign -file receipt.txt some-device >> signatures.jsonl
+//	signctl public-key some-device > some-device.pem
+//	signctl verify -public-key some-device.pem -device some-device signatures.jsonl
+//
+// verify works offline: it checks that the signatures, read from SIGNATURES or stdin in the order
+// they were made, are valid for the public key and chain from each other.
+//
+// backup writes a backup of every device to PATH, or stdout, and restore restores one read from
+// BACKUP, or stdin, into the service. The service must have backups enabled, and the token must be
+// its admin token:
+//
+//	signctl backup -file store.jsonl.gz
+//	signctl -url http://new-host:8080 restore store.jsonl.gz
+//
+// The base URL and the token default to SIGNCTL_URL and SIGNCTL_TOKEN. The token is sent as a
+// bearer token, for gateways authenticating the requests in front of the service.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	defaultURL     = "http://localhost:8080"
+	requestTimeout = 30 * time.Second
+)
+
+// command runs a subcommand with the arguments following its name.
+type command func(ctx context.Context, env *environment, args []string) error
+
+var commands = map[string]command{
+	"create":     createDevice,
+	"list":       listDevices,
+	"get":        getDevice,
+	"sign":       signData,
+	"public-key": publicKey,
+	"verify":     verifyChain,
+	"backup":     backupStore,
+	"restore":    restoreStore,
+}
+
+// environment is what the commands run with.
+type environment struct {
+	client *client
+	output output
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "signctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("signctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	baseURL := flags.String("url", getEnv("SIGNCTL_URL", defaultURL), "base URL of the signing service")
+	token := flags.String("token", os.Getenv("SIGNCTL_TOKEN"), "bearer token sent with every request")
+	format := flags.String("o", "table", "output format: table or json")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: signctl [-url URL] [-token TOKEN] [-o table|json] create|list|get|sign|public-key|verify|backup|restore [ARGUMENTS]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	out, found := outputs[*format]
+	if !found {
+		return fmt.Errorf("unknown output format '%v'", *format)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+	cmd, found := commands[flags.Arg(0)]
+	if !found {
+		return fmt.Errorf("unknown command '%v'", flags.Arg(0))
+	}
+
+	env := &environment{
+		client: &client{
+			baseURL:    *baseURL,
+			token:      *token,
+			httpClient: &http.Client{Timeout: requestTimeout},
+		},
+		output: out,
+		stdin:  stdin,
+		stdout: stdout,
+	}
+	return cmd(ctx, env, flags.Args()[1:])
+}
+
+// getEnv returns the value of the environment variable key, or fallback when it is unset.
+func getEnv(key string, fallback string) string {
+	if value, found := os.LookupEnv(key); found {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer serves the API of an in-memory service, recording the Authorization headers it receives.
+func newServer(t *testing.T, authorizations *[]string) *httptest.Server {
+	handler := servicetest.New(t).Handler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*authorizations = append(*authorizations, r.Header.Get("Authorization"))
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newBackupServer serves the API of an in-memory service with backups enabled, for the token signctl sends.
+func newBackupServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(servicetest.New(t, servicetest.WithBackups(bytes.Repeat([]byte{1}, crypto.KeyEncryptionKeySize))).Handler())
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// signctl runs the command line args against server, with stdin as input.
+func signctl(t *testing.T, server *httptest.Server, stdin string, args ...string) (string, error) {
+	t.Helper()
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	err := run(context.Background(), append([]string{"-url", server.URL, "-token", servicetest.AdminToken}, args...), strings.NewReader(stdin), stdout, stderr)
+	return stdout.String(), err
+}
+
+func TestDeviceCommands(t *testing.T) {
+	authorizations := []string{}
+	server := newServer(t, &authorizations)
+
+	out, err := signctl(t, server, "", "-o", "json", "create", "-id", "some-id", "-alg", "ECC", "-label", "till 1", "-tag", "pos", "-tag", "berlin", "-metadata", "store=mitte")
+	require.NoError(t, err)
+	var device api.SignatureDevice
+	require.NoError(t, json.Unmarshal([]byte(out), &device))
+	assert.Equal(t, "some-id", device.ID)
+	assert.Equal(t, []string{"pos", "berlin"}, device.Tags)
+	assert.Equal(t, map[string]string{"store": "mitte"}, device.Metadata)
+
+	out, err = signctl(t, server, "", "create", "-alg", "RSA")
+	require.NoError(t, err)
+	assert.Contains(t, out, "RSA")
+
+	out, err = signctl(t, server, "", "list", "-tag", "pos", "-metadata", "store=mitte")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.Regexp(t, `^ID\s+ALGORITHM\s+STATUS`, lines[0])
+	assert.Regexp(t, `^some-id\s+ECC\s+active\s+0\s+1\s+till 1\s+pos,berlin\s+store=mitte$`, lines[1])
+
+	out, err = signctl(t, server, "", "-o", "json", "list")
+	require.NoError(t, err)
+	devices := []api.SignatureDevice{}
+	require.NoError(t, json.Unmarshal([]byte(out), &devices))
+	assert.Len(t, devices, 2)
+
+	// a list of a single device is a list all the same
+	out, err = signctl(t, server, "", "-o", "json", "list", "-tag", "pos")
+	require.NoError(t, err)
+	devices = []api.SignatureDevice{}
+	require.NoError(t, json.Unmarshal([]byte(out), &devices))
+	require.Len(t, devices, 1)
+	assert.Equal(t, "some-id", devices[0].ID)
+
+	out, err = signctl(t, server, "", "get", "some-id")
+	require.NoError(t, err)
+	assert.Contains(t, out, "some-id")
+
+	_, err = signctl(t, server, "", "get", "unknown")
+	assert.ErrorContains(t, err, "Not Found (not_found)")
+	_, err = signctl(t, server, "", "create", "-alg", "DSA")
+	assert.ErrorContains(t, err, "(invalid_input)")
+
+	for _, authorization := range authorizations {
+		assert.Equal(t, "Bearer "+servicetest.AdminToken, authorization)
+	}
+}
+
+func TestSignAndVerifyOffline(t *testing.T) {
+	server := newServer(t, &[]string{})
+	dir := t.TempDir()
+
+	for _, alg := range []string{"ECC", "RSA"} {
+		t.Run(alg, func(t *testing.T) {
+			id := "device-" + alg
+			_, err := signctl(t, server, "", "create", "-id", id, "-alg", alg)
+			require.NoError(t, err)
+
+			receipt := filepath.Join(dir, id+".txt")
+			require.NoError(t, os.WriteFile(receipt, []byte("receipt_1\n"), 0o600))
+			signatures := ""
+			out, err := signctl(t, server, "", "-o", "json", "sign", "-file", receipt, id)
+			require.NoError(t, err)
+			signatures += out
+			for _, data := range []string{"from stdin", "", "another_one"} {
+				out, err := signctl(t, server, data, "-o", "json", "sign", id)
+				require.NoError(t, err)
+				signatures += out
+			}
+			assert.Equal(t, 4, strings.Count(signatures, "\n"))
+			assert.Contains(t, signatures, `"signed_data":"0_receipt_1\n_`)
+
+			out, err = signctl(t, server, "", "sign", id)
+			require.NoError(t, err)
+			assert.Regexp(t, `SIGNED DATA\s+4__`, out)
+
+			publicKey, err := signctl(t, server, "", "public-key", id)
+			require.NoError(t, err)
+			keyPath := filepath.Join(dir, id+".pem")
+			require.NoError(t, os.WriteFile(keyPath, []byte(publicKey), 0o600))
+
+			// offline: the server is not involved anymore
+			signaturesPath := filepath.Join(dir, id+".jsonl")
+			require.NoError(t, os.WriteFile(signaturesPath, []byte(signatures), 0o600))
+			out, err = signctl(t, server, "", "verify", "-public-key", keyPath, "-device", id, signaturesPath)
+			require.NoError(t, err)
+			assert.Equal(t, "OK: 4 signature(s) of device '"+id+"' are valid and chained\n", out)
+
+			lines := strings.SplitAfter(signatures, "\n")
+			out, err = signctl(t, server, lines[0]+lines[2], "-o", "json", "verify", "-public-key", keyPath, "-device", id)
+			assert.ErrorIs(t, err, errInvalidChain)
+			var result verification
+			require.NoError(t, json.Unmarshal([]byte(out), &result))
+			assert.False(t, result.Valid)
+			assert.Equal(t, "signature 1: signature counter 2 does not follow 0", result.Error)
+
+			_, err = signctl(t, server, signatures, "verify", "-public-key", keyPath, "-device", "other-id")
+			assert.ErrorIs(t, err, errInvalidChain)
+		})
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	source := newBackupServer(t)
+	_, err := signctl(t, source, "", "create", "-id", "some-id", "-alg", "ECC")
+	require.NoError(t, err)
+	_, err = signctl(t, source, "receipt", "sign", "some-id")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "store.jsonl.gz")
+	out, err := signctl(t, source, "", "backup", "-file", path)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	backedUp, err := os.ReadFile(path)
+	require.NoError(t, err)
+	toStdout, err := signctl(t, source, "", "backup")
+	require.NoError(t, err)
+	assert.Equal(t, backedUp[:2], []byte(toStdout)[:2], "gzip magic number")
+
+	destination := newBackupServer(t)
+	out, err = signctl(t, destination, "", "restore", path)
+	require.NoError(t, err)
+	assert.Equal(t, "Restored 1 device(s) with 1 signature(s)\n", out)
+	out, err = signctl(t, destination, "", "-o", "json", "get", "some-id")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"signature_counter":1`)
+
+	_, err = signctl(t, destination, string(backedUp), "restore")
+	assert.ErrorContains(t, err, "POST /api/v0/admin/restore: Conflict (conflict)")
+
+	// backups are disabled on this one
+	_, err = signctl(t, newServer(t, &[]string{}), "", "backup", "-file", path)
+	assert.ErrorContains(t, err, "GET /api/v0/admin/backup: Not Found")
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestUsageErrors(t *testing.T) {
+	server := newServer(t, &[]string{})
+
+	_, err := signctl(t, server, "", "unknown")
+	assert.EqualError(t, err, "unknown command 'unknown'")
+	_, err = signctl(t, server, "", "-o", "yaml", "list")
+	assert.EqualError(t, err, "unknown output format 'yaml'")
+	_, err = signctl(t, server, "", "get")
+	assert.EqualError(t, err, "get expects the arguments 'ID', got 0 argument(s)")
+	_, err = signctl(t, server, "", "create", "-metadata", "no-value")
+	assert.ErrorContains(t, err, "expected KEY=VALUE")
+	_, err = signctl(t, server, "", "verify", "-device", "some-id")
+	assert.EqualError(t, err, "verify expects -public-key and -device")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+)
+
+// verification is the result of verifying a chain of signatures offline.
+type verification struct {
+	Device     string `json:"device_id"`
+	Signatures int    `json:"signatures"`
+	Valid      bool   `json:"valid"`
+	Error      string `json:"error,omitempty"`
+}
+
+// output renders the results of the commands.
+type output interface {
+	device(w io.Writer, device api.SignatureDevice) error
+	// devices renders a list, even of a single device
+	devices(w io.Writer, devices []api.SignatureDevice) error
+	signature(w io.Writer, signed api.SignatureResp) error
+	verification(w io.Writer, result verification) error
+	restored(w io.Writer, summary api.BackupSummary) error
+}
+
+var outputs = map[string]output{
+	"table": tableOutput{},
+	"json":  jsonOutput{},
+}
+
+// jsonOutput prints a single line of JSON per result.
+type jsonOutput struct{}
+
+func (jsonOutput) device(w io.Writer, device api.SignatureDevice) error {
+	return json.NewEncoder(w).Encode(device)
+}
+
+func (jsonOutput) devices(w io.Writer, devices []api.SignatureDevice) error {
+	return json.NewEncoder(w).Encode(devices)
+}
+
+func (jsonOutput) signature(w io.Writer, signed api.SignatureResp) error {
+	return json.NewEncoder(w).Encode(signed)
+}
+
+func (jsonOutput) verification(w io.Writer, result verification) error {
+	return json.NewEncoder(w).Encode(result)
+}
+
+func (jsonOutput) restored(w io.Writer, summary api.BackupSummary) error {
+	return json.NewEncoder(w).Encode(summary)
+}
+
+// tableOutput prints aligned columns, leaving out the public keys.
+type tableOutput struct{}
+
+func (t tableOutput) device(w io.Writer, device api.SignatureDevice) error {
+	return t.devices(w, []api.SignatureDevice{device})
+}
+
+func (tableOutput) devices(w io.Writer, devices []api.SignatureDevice) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tALGORITHM\tSTATUS\tCOUNTER\tKEY VERSION\tLABEL\tTAGS\tMETADATA")
+	for _, device := range devices {
+		metadata := []string{}
+		for key, value := range device.Metadata {
+			metadata = append(metadata, key+"="+value)
+		}
+		sort.Strings(metadata)
+		fmt.Fprintf(table, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", device.ID, device.SignatureAlg, device.Status, device.SignatureCounter, device.KeyVersion, device.Label, strings.Join(device.Tags, ","), strings.Join(metadata, ","))
+	}
+
+	return table.Flush()
+}
+
+func (tableOutput) signature(w io.Writer, signed api.SignatureResp) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "SIGNATURE\t%v\n", signed.Signature)
+	fmt.Fprintf(table, "SIGNED DATA\t%v\n", signed.SignedData)
+
+	return table.Flush()
+}
+
+func (tableOutput) verification(w io.Writer, result verification) error {
+	if !result.Valid {
+		_, err := fmt.Fprintf(w, "INVALID: %v signature(s) of device '%v': %v\n", result.Signatures, result.Device, result.Error)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "OK: %v signature(s) of device '%v' are valid and chained\n", result.Signatures, result.Device)
+	return err
+}
+
+func (tableOutput) restored(w io.Writer, summary api.BackupSummary) error {
+	_, err := fmt.Fprintf(w, "Restored %v device(s) with %v signature(s)\n", summary.Devices, summary.Signatures)
+	return err
+}
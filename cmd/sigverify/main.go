@@ -0,0 +1,106 @@
+// Command sigverify verifies a device bundle offline, without access to the signing service.
+//
+//	go run ./cmd/sigverify path/to/bundle
+//	go run ./cmd/sigverify -json path/to/bundle
+//	go run ./cmd/sigverify -export-key export-key.pem path/to/export.zip
+//
+// It recomputes the signature chain of the device from the bundle alone, and reports every gap in
+// the signature counters, reordered or duplicate counters, signature which does not verify, and
+// signed data which does not match its record or does not chain from the previous signature. It
+// exits with status 1 when it finds anything.
+//
+// The bundle is either a directory or an audit export of the service. The files of an export are
+// checked against its manifest, and the manifest against the export key of the service when
+// -export-key is given, as returned by GET /api/v0/export-key.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/bundle"
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	exportKeyPath := flag.String("export-key", "", "PEM `file` of the export key verifying the manifest of an export")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: sigverify [-json] [-export-key FILE] BUNDLE")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var exportKey []byte
+	if *exportKeyPath != "" {
+		var err error
+		if exportKey, err = os.ReadFile(*exportKeyPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	report, err := verify(flag.Arg(0), exportKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		for _, finding := range report.Findings {
+			location := fmt.Sprintf("line %v", finding.Line)
+			switch {
+			case finding.Line == 0 && finding.SignatureCounter < 0:
+				location = "archive"
+			case finding.Line == 0:
+				location = fmt.Sprintf("signature %v", finding.SignatureCounter)
+			case finding.SignatureCounter >= 0:
+				location += fmt.Sprintf(", signature %v", finding.SignatureCounter)
+			}
+			fmt.Printf("%v: %v: %v\n", location, finding.Kind, finding.Detail)
+		}
+		if report.Valid() {
+			fmt.Printf("OK: %v signature(s) of device '%v' verified\n", report.Signatures, report.DeviceID)
+			if report.ManifestVerified {
+				fmt.Println("OK: manifest signed by the export key")
+			}
+		} else {
+			fmt.Printf("FAILED: %v finding(s) in %v signature(s) of device '%v'\n", len(report.Findings), report.Signatures, report.DeviceID)
+		}
+	}
+
+	if !report.Valid() {
+		os.Exit(1)
+	}
+}
+
+// verify verifies the bundle at path, a directory or an export archive.
+func verify(path string, exportKey []byte) (bundle.Report, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return bundle.Report{}, err
+	}
+	if info.IsDir() {
+		if exportKey != nil {
+			return bundle.Report{}, fmt.Errorf("%v is a directory: only the manifest of an export can be verified with the export key", path)
+		}
+		return bundle.VerifyDir(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return bundle.Report{}, err
+	}
+	defer file.Close()
+
+	return bundle.VerifyArchive(file, info.Size(), exportKey)
+}
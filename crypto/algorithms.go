@@ -0,0 +1,17 @@
+package crypto
+
+// SignerFactories returns the signer factories of the algorithms the service supports.
+func SignerFactories() map[string]SignerFactory {
+	return map[string]SignerFactory{
+		"RSA": RSASignerFactory,
+		"ECC": ECCSignerFactory,
+	}
+}
+
+// VerifierFactories returns the verifier factories of the algorithms the service supports.
+func VerifierFactories() map[string]VerifierFactory {
+	return map[string]VerifierFactory{
+		"RSA": RSAVerifierFactory,
+		"ECC": ECCVerifierFactory,
+	}
+}
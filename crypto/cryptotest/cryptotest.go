@@ -0,0 +1,46 @@
+// Package cryptotest verifies the signatures of devices in tests with the standard library alone,
+// so that they do not depend on the verifiers of the crypto package. It also signs deterministically
+// (RFC 6979), for the known answer tests.
+package cryptotest
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// VerifySignature asserts that signatureBase64 is a signature of signedData by the PEM encoded
+// public key of a device of signatureAlg, as returned by the API, and tells whether it is.
+func VerifySignature(t testing.TB, signatureAlg string, publicKeyPEM string, signedData string, signatureBase64 string, msgAndArgs ...any) bool {
+	t.Helper()
+
+	signature, err := base64.StdEncoding.DecodeString(signatureBase64)
+	require.NoError(t, err, msgAndArgs...)
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	require.NotNil(t, block, "public key is not PEM encoded")
+	digest := sha256.Sum256([]byte(signedData))
+
+	switch signatureAlg {
+	case "RSA":
+		publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		require.NoError(t, err)
+		return assert.NoError(t, rsa.VerifyPKCS1v15(publicKey, stdcrypto.SHA256, digest[:], signature), msgAndArgs...)
+	case "ECC":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		require.NoError(t, err)
+		publicKey, ok := parsed.(*ecdsa.PublicKey)
+		require.True(t, ok, "public key is not an ECDSA key")
+		return assert.True(t, ecdsa.VerifyASN1(publicKey, digest[:], signature), msgAndArgs...)
+	default:
+		t.Fatalf("unknown algorithm %v", signatureAlg)
+		return false
+	}
+}
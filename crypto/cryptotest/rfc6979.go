@@ -0,0 +1,137 @@
+package cryptotest
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+)
+
+// DeterministicECCSigner signs with the nonce derived from the key and the data as described by
+// RFC 6979, instead of drawing it at random: signing the same data twice gives the same signature.
+// Its arithmetic on the private key and the nonce is not constant time, so it is meant for
+// reproducing known answers in tests only, never for the service.
+type DeterministicECCSigner struct {
+	KeyPair *crypto.ECCKeyPair
+}
+
+func (s *DeterministicECCSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
+	return signDeterministic(s.KeyPair.Private, dataToBeSigned)
+}
+
+// DeterministicECCSignerFactory creates deterministic ECC signers, whose signatures can be compared
+// byte for byte against known answers.
+func DeterministicECCSignerFactory(privateKey []byte) (crypto.Signer, error) {
+	marshaler := crypto.NewECCMarshaler()
+	keyPair, err := marshaler.Decode(privateKey)
+	if err != nil {
+		return &DeterministicECCSigner{}, err
+	}
+
+	return &DeterministicECCSigner{
+		KeyPair: keyPair,
+	}, nil
+}
+
+// ecdhCurves are used for the scalar base multiplications of the deterministic signatures.
+var ecdhCurves = map[elliptic.Curve]ecdh.Curve{
+	elliptic.P256(): ecdh.P256(),
+	elliptic.P384(): ecdh.P384(),
+	elliptic.P521(): ecdh.P521(),
+}
+
+// signDeterministic signs digest, a SHA-256 hash, with the nonce derived from the private key and
+// digest as described by RFC 6979, using HMAC-SHA-256. The same key and digest always give the same
+// ASN.1 encoded signature.
+func signDeterministic(privateKey *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	curve, found := ecdhCurves[privateKey.Curve]
+	if !found {
+		return nil, fmt.Errorf("unsupported curve '%v'", privateKey.Curve.Params().Name)
+	}
+	n := privateKey.Curve.Params().N
+	qlen := n.BitLen()
+	rlen := (qlen + 7) / 8
+
+	// bits2int keeps the leftmost qlen bits of b
+	bits2int := func(b []byte) *big.Int {
+		i := new(big.Int).SetBytes(b)
+		if excess := len(b)*8 - qlen; excess > 0 {
+			i.Rsh(i, uint(excess))
+		}
+		return i
+	}
+	int2octets := func(i *big.Int) []byte {
+		return i.FillBytes(make([]byte, rlen))
+	}
+
+	e := bits2int(digest)
+	x := int2octets(privateKey.D)
+	h := int2octets(new(big.Int).Mod(e, n))
+
+	mac := func(key []byte, parts ...[]byte) []byte {
+		m := hmac.New(sha256.New, key)
+		for _, part := range parts {
+			m.Write(part)
+		}
+		return m.Sum(nil)
+	}
+	v := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 0x01
+	}
+	k := make([]byte, sha256.Size)
+	k = mac(k, v, []byte{0x00}, x, h)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, x, h)
+	v = mac(k, v)
+
+	for {
+		t := []byte{}
+		for len(t) < rlen {
+			v = mac(k, v)
+			t = append(t, v...)
+		}
+
+		if nonce := bits2int(t); nonce.Sign() > 0 && nonce.Cmp(n) < 0 {
+			r, s, err := signWithNonce(curve, n, privateKey.D, e, nonce, int2octets(nonce))
+			if err != nil {
+				return nil, err
+			}
+			if r.Sign() > 0 && s.Sign() > 0 {
+				return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+			}
+		}
+
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+}
+
+// signWithNonce computes r = x(nonce * G) mod n and s = (e + r * d) / nonce mod n.
+func signWithNonce(curve ecdh.Curve, n *big.Int, d *big.Int, e *big.Int, nonce *big.Int, encodedNonce []byte) (*big.Int, *big.Int, error) {
+	point, err := curve.NewPrivateKey(encodedNonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the uncompressed point is 0x04 followed by the x and y coordinates
+	encodedPoint := point.PublicKey().Bytes()
+	if len(encodedPoint) == 0 || encodedPoint[0] != 0x04 {
+		return nil, nil, errors.New("unexpected point encoding")
+	}
+	r := new(big.Int).SetBytes(encodedPoint[1 : 1+(len(encodedPoint)-1)/2])
+	r.Mod(r, n)
+
+	s := new(big.Int).Mul(r, d)
+	s.Add(s, e)
+	s.Mul(s, new(big.Int).ModInverse(nonce, n))
+	s.Mod(s, n)
+
+	return r, s, nil
+}
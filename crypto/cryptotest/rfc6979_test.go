@@ -0,0 +1,118 @@
+package cryptotest_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto/cryptotest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/keygen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fromHex(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	i, ok := new(big.Int).SetString(s, 16)
+	require.True(t, ok)
+	return i
+}
+
+// TestDeterministicSignaturesMatchRFC6979 checks the signatures of RFC 6979, appendix A.2.5 and A.2.6, with SHA-256,
+// and a message making the nonce generation loop.
+func TestDeterministicSignaturesMatchRFC6979(t *testing.T) {
+	tests := []struct {
+		curve   elliptic.Curve
+		d       string
+		message string
+		r       string
+		s       string
+	}{
+		{
+			// not from RFC 6979: the first nonce derived for this message is out of range
+			curve:   elliptic.P256(),
+			d:       "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+			message: "wv[vnX",
+			r:       "EFD9073B652E76DA1B5A019C0E4A2E3FA529B035A6ABB91EF67F0ED7A1F21234",
+			s:       "3DB4706C9D9F4A4FE13BB5E08EF0FAB53A57DBAB2061C83A35FA411C68D2BA33",
+		},
+		{
+			curve:   elliptic.P256(),
+			d:       "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+			message: "sample",
+			r:       "EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			s:       "F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		},
+		{
+			curve:   elliptic.P256(),
+			d:       "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+			message: "test",
+			r:       "F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			s:       "019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+		},
+		{
+			curve:   elliptic.P384(),
+			d:       "6B9D3DAD2E1B8C1C05B19875B6659F4DE23C3B667BF297BA9AA47740787137D896D5724E4C70A825F872C9EA60D2EDF5",
+			message: "sample",
+			r:       "21B13D1E013C7FA1392D03C5F99AF8B30C570C6F98D4EA8E354B63A21D3DAA33BDE1E888E63355D92FA2B3C36D8FB2CD",
+			s:       "F3AA443FB107745BF4BD77CB3891674632068A10CA67E3D45DB2266FA7D1FEEBEFDC63ECCD1AC42EC0CB8668A4FA0AB0",
+		},
+		{
+			curve:   elliptic.P384(),
+			d:       "6B9D3DAD2E1B8C1C05B19875B6659F4DE23C3B667BF297BA9AA47740787137D896D5724E4C70A825F872C9EA60D2EDF5",
+			message: "test",
+			r:       "6D6DEFAC9AB64DABAFE36C6BF510352A4CC27001263638E5B16D9BB51D451559F918EEDAF2293BE5B475CC8F0188636B",
+			s:       "2D46F3BECBCC523D5F1A1256BF0C9B024D879BA9E838144C8BA6BAEB4B53B47D51AB373F9845C0514EEFB14024787265",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.curve.Params().Name+"/"+tc.message, func(t *testing.T) {
+			privateKey := &ecdsa.PrivateKey{D: fromHex(t, tc.d)}
+			privateKey.Curve = tc.curve
+			privateKey.X, privateKey.Y = tc.curve.ScalarBaseMult(privateKey.D.Bytes())
+			der, err := x509.MarshalECPrivateKey(privateKey)
+			require.NoError(t, err)
+
+			signer, err := cryptotest.DeterministicECCSignerFactory(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE_KEY", Bytes: der}))
+			require.NoError(t, err)
+			digest := sha256.Sum256([]byte(tc.message))
+			signature, err := signer.Sign(digest[:])
+			require.NoError(t, err)
+
+			var decoded struct{ R, S *big.Int }
+			_, err = asn1.Unmarshal(signature, &decoded)
+			require.NoError(t, err)
+			assert.Equal(t, fromHex(t, tc.r), decoded.R)
+			assert.Equal(t, fromHex(t, tc.s), decoded.S)
+			assert.True(t, ecdsa.VerifyASN1(&privateKey.PublicKey, digest[:], signature))
+		})
+	}
+}
+
+func TestDeterministicSignaturesAreReproducible(t *testing.T) {
+	_, eccPrivateKey, err := keygen.ECC()
+	require.NoError(t, err)
+	signer, err := cryptotest.DeterministicECCSignerFactory(eccPrivateKey)
+	require.NoError(t, err)
+	randomized, err := crypto.ECCSignerFactory(eccPrivateKey)
+	require.NoError(t, err)
+
+	digest := sha256.Sum256([]byte("0_some-data_ZGV2aWNl"))
+	first, err := signer.Sign(digest[:])
+	require.NoError(t, err)
+	second, err := signer.Sign(digest[:])
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	third, err := randomized.Sign(digest[:])
+	require.NoError(t, err)
+	assert.NotEqual(t, first, third)
+}
@@ -34,12 +34,12 @@ func (m ECCMarshaler) Encode(keyPair ECCKeyPair) ([]byte, []byte, error) {
 	}
 
 	encodedPrivate := pem.EncodeToMemory(&pem.Block{
-		Type:  "PRIVATE_KEY",
+		Type:  eccPrivateKeyType,
 		Bytes: privateKeyBytes,
 	})
 
 	encodedPublic := pem.EncodeToMemory(&pem.Block{
-		Type:  "PUBLIC_KEY",
+		Type:  eccPublicKeyType,
 		Bytes: publicKeyBytes,
 	})
 
@@ -47,12 +47,16 @@ func (m ECCMarshaler) Encode(keyPair ECCKeyPair) ([]byte, []byte, error) {
 }
 
 // Decode assembles an ECCKeyPair from an encoded private key.
+// Anything but a single ECC private key PEM block is rejected with a typed error.
 func (m ECCMarshaler) Decode(privateKeyBytes []byte) (*ECCKeyPair, error) {
-	block, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	der, err := decodePrivateKeyPEM(privateKeyBytes, "ECC", eccPrivateKeyType)
 	if err != nil {
 		return nil, err
 	}
+	privateKey, err := x509.ParseECPrivateKey(der)
+	if err != nil {
+		return nil, keyParseError(der, "ECC", err)
+	}
 
 	return &ECCKeyPair{
 		Private: privateKey,
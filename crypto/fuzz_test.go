@@ -0,0 +1,82 @@
+package crypto_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+)
+
+// seedKeys adds valid, truncated and mixed up keys to the corpus of f.
+func seedKeys(f *testing.F) {
+	rsaPrivateKey, eccPrivateKey := generateKeys(f)
+	for _, key := range [][]byte{rsaPrivateKey, eccPrivateKey} {
+		f.Add(key)
+		f.Add(key[:len(key)/2])
+		f.Add(append(append([]byte{}, key...), key...))
+	}
+	f.Add([]byte("-----BEGIN RSA_PRIVATE_KEY-----\n-----END RSA_PRIVATE_KEY-----\n"))
+	f.Add([]byte("-----BEGIN PRIVATE_KEY-----\nMAA=\n-----END PRIVATE_KEY-----\n"))
+	f.Add([]byte{})
+}
+
+func FuzzRSAMarshalerUnmarshal(f *testing.F) {
+	seedKeys(f)
+	marshaler := crypto.NewRSAMarshaler()
+
+	f.Fuzz(func(t *testing.T, encoded []byte) {
+		keyPair, err := marshaler.Unmarshal(encoded)
+		if err != nil {
+			return
+		}
+
+		_, reencoded, err := marshaler.Marshal(*keyPair)
+		if err != nil {
+			t.Fatalf("decoded key cannot be encoded again: %v", err)
+		}
+		if _, err := marshaler.Unmarshal(reencoded); err != nil {
+			t.Fatalf("encoded key cannot be decoded again: %v", err)
+		}
+	})
+}
+
+func FuzzECCMarshalerDecode(f *testing.F) {
+	seedKeys(f)
+	marshaler := crypto.NewECCMarshaler()
+
+	f.Fuzz(func(t *testing.T, encoded []byte) {
+		keyPair, err := marshaler.Decode(encoded)
+		if err != nil {
+			return
+		}
+
+		_, reencoded, err := marshaler.Encode(*keyPair)
+		if err != nil {
+			t.Fatalf("decoded key cannot be encoded again: %v", err)
+		}
+		if _, err := marshaler.Decode(reencoded); err != nil {
+			t.Fatalf("encoded key cannot be decoded again: %v", err)
+		}
+	})
+}
+
+func FuzzSignerFactories(f *testing.F) {
+	seedKeys(f)
+	factories := map[string]crypto.SignerFactory{
+		"RSA": crypto.RSASignerFactory,
+		"ECC": crypto.ECCSignerFactory,
+	}
+	digest := sha256.Sum256([]byte("0_data_ZGV2aWNl"))
+
+	f.Fuzz(func(t *testing.T, encoded []byte) {
+		for algorithm, factory := range factories {
+			signer, err := factory(encoded)
+			if err != nil {
+				continue
+			}
+			if _, err := signer.Sign(digest[:]); err != nil {
+				t.Fatalf("%v signer built from an accepted key cannot sign: %v", algorithm, err)
+			}
+		}
+	})
+}
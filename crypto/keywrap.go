@@ -0,0 +1,73 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// KeyEncryptionKeySize is the size of the keys wrapping private keys: AES-256.
+const KeyEncryptionKeySize = 32
+
+// ErrUnwrap is returned when a wrapped key cannot be decrypted: it was wrapped with another key
+// encryption key or for another purpose, or it was tampered with.
+var ErrUnwrap = errors.New("wrapped key cannot be decrypted")
+
+// KeyWrapper encrypts private keys with a key encryption key (AES-256-GCM), so that they never
+// leave the service in the clear.
+type KeyWrapper struct {
+	aead cipher.AEAD
+	id   string
+}
+
+func NewKeyWrapper(keyEncryptionKey []byte) (*KeyWrapper, error) {
+	if len(keyEncryptionKey) != KeyEncryptionKeySize {
+		return nil, fmt.Errorf("key encryption key must be %v bytes long, got %v", KeyEncryptionKeySize, len(keyEncryptionKey))
+	}
+	block, err := aes.NewCipher(keyEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ID tells which key wrapped a key without revealing anything about it
+	sum := sha256.Sum256(append([]byte("key-wrapper-id:"), keyEncryptionKey...))
+	return &KeyWrapper{aead: aead, id: hex.EncodeToString(sum[:8])}, nil
+}
+
+// ID identifies the key encryption key.
+func (w *KeyWrapper) ID() string {
+	return w.id
+}
+
+// Wrap encrypts privateKey, bound to additionalData: unwrapping it takes the same additional data.
+// The result is the random nonce followed by the ciphertext.
+func (w *KeyWrapper) Wrap(privateKey []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, w.aead.NonceSize(), w.aead.NonceSize()+len(privateKey)+w.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	return w.aead.Seal(nonce, nonce, privateKey, additionalData), nil
+}
+
+// Unwrap decrypts a key returned by Wrap with the same additional data.
+func (w *KeyWrapper) Unwrap(wrapped []byte, additionalData []byte) ([]byte, error) {
+	if len(wrapped) < w.aead.NonceSize() {
+		return nil, ErrUnwrap
+	}
+	nonce, ciphertext := wrapped[:w.aead.NonceSize()], wrapped[w.aead.NonceSize():]
+	privateKey, err := w.aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrUnwrap
+	}
+
+	return privateKey, nil
+}
@@ -0,0 +1,52 @@
+package crypto_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyWrapperRoundTrip(t *testing.T) {
+	wrapper, err := crypto.NewKeyWrapper(bytes.Repeat([]byte{1}, crypto.KeyEncryptionKeySize))
+	require.NoError(t, err)
+
+	wrapped, err := wrapper.Wrap([]byte("some private key"), []byte("some-device/1"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(wrapped), "some private key")
+
+	privateKey, err := wrapper.Unwrap(wrapped, []byte("some-device/1"))
+	require.NoError(t, err)
+	assert.Equal(t, "some private key", string(privateKey))
+
+	again, err := wrapper.Wrap([]byte("some private key"), []byte("some-device/1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, wrapped, again, "nonces must be random")
+}
+
+func TestKeyWrapperRejectsOtherKeysAndData(t *testing.T) {
+	wrapper, err := crypto.NewKeyWrapper(bytes.Repeat([]byte{1}, crypto.KeyEncryptionKeySize))
+	require.NoError(t, err)
+	other, err := crypto.NewKeyWrapper(bytes.Repeat([]byte{2}, crypto.KeyEncryptionKeySize))
+	require.NoError(t, err)
+	assert.NotEqual(t, wrapper.ID(), other.ID())
+
+	wrapped, err := wrapper.Wrap([]byte("some private key"), []byte("some-device/1"))
+	require.NoError(t, err)
+	tampered := bytes.Clone(wrapped)
+	tampered[len(tampered)-1] ^= 1
+
+	_, err = other.Unwrap(wrapped, []byte("some-device/1"))
+	assert.ErrorIs(t, err, crypto.ErrUnwrap)
+	_, err = wrapper.Unwrap(wrapped, []byte("other-device/1"))
+	assert.ErrorIs(t, err, crypto.ErrUnwrap)
+	_, err = wrapper.Unwrap(tampered, []byte("some-device/1"))
+	assert.ErrorIs(t, err, crypto.ErrUnwrap)
+	_, err = wrapper.Unwrap(wrapped[:4], []byte("some-device/1"))
+	assert.ErrorIs(t, err, crypto.ErrUnwrap)
+
+	_, err = crypto.NewKeyWrapper([]byte("short"))
+	assert.Error(t, err)
+}
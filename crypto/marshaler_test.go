@@ -0,0 +1,104 @@
+package crypto_test
+
+import (
+	"encoding/pem"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/keygen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateKeys(t testing.TB) (rsaPrivateKey []byte, eccPrivateKey []byte) {
+	t.Helper()
+
+	_, rsaPrivateKey, err := keygen.RSA()
+	require.NoError(t, err)
+	_, eccPrivateKey, err = keygen.ECC()
+	require.NoError(t, err)
+	return rsaPrivateKey, eccPrivateKey
+}
+
+// relabel returns the PEM block of encoded with another type.
+func relabel(t testing.TB, encoded []byte, blockType string) []byte {
+	t.Helper()
+
+	block, _ := pem.Decode(encoded)
+	require.NotNil(t, block)
+	block.Type = blockType
+	return pem.EncodeToMemory(block)
+}
+
+func TestDecodersRejectInvalidKeysWithTypedErrors(t *testing.T) {
+	rsaPrivateKey, eccPrivateKey := generateKeys(t)
+	rsaMarshaler := crypto.NewRSAMarshaler()
+	eccMarshaler := crypto.NewECCMarshaler()
+	decoders := map[string]func([]byte) error{
+		"RSA": func(encoded []byte) error {
+			_, err := rsaMarshaler.Unmarshal(encoded)
+			return err
+		},
+		"ECC": func(encoded []byte) error {
+			_, err := eccMarshaler.Decode(encoded)
+			return err
+		},
+	}
+
+	tests := []struct {
+		name              string
+		algorithm         string
+		encoded           []byte
+		expectedErr       error
+		expectedPEMType   *crypto.PEMTypeError
+		expectedAlgorithm *crypto.KeyAlgorithmError
+	}{
+		{name: "empty", algorithm: "RSA", encoded: nil, expectedErr: crypto.ErrNoPEMBlock},
+		{name: "garbage", algorithm: "ECC", encoded: []byte("not a key"), expectedErr: crypto.ErrNoPEMBlock},
+		{name: "trailing data", algorithm: "RSA", encoded: append(append([]byte{}, rsaPrivateKey...), "trailing"...), expectedErr: crypto.ErrTrailingData},
+		{name: "two blocks", algorithm: "ECC", encoded: append(append([]byte{}, eccPrivateKey...), eccPrivateKey...), expectedErr: crypto.ErrTrailingData},
+		{name: "wrong PEM type", algorithm: "RSA", encoded: relabel(t, rsaPrivateKey, "CERTIFICATE"), expectedPEMType: &crypto.PEMTypeError{Expected: "RSA_PRIVATE_KEY", Actual: "CERTIFICATE"}},
+		{name: "ECC key given to RSA", algorithm: "RSA", encoded: eccPrivateKey, expectedAlgorithm: &crypto.KeyAlgorithmError{Expected: "RSA", Actual: "ECC"}},
+		{name: "RSA key given to ECC", algorithm: "ECC", encoded: rsaPrivateKey, expectedAlgorithm: &crypto.KeyAlgorithmError{Expected: "ECC", Actual: "RSA"}},
+		{name: "RSA key labelled as ECC", algorithm: "ECC", encoded: relabel(t, rsaPrivateKey, "PRIVATE_KEY"), expectedAlgorithm: &crypto.KeyAlgorithmError{Expected: "ECC", Actual: "RSA"}},
+		{name: "ECC key labelled as RSA", algorithm: "RSA", encoded: relabel(t, eccPrivateKey, "RSA_PRIVATE_KEY"), expectedAlgorithm: &crypto.KeyAlgorithmError{Expected: "RSA", Actual: "ECC"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := decoders[tc.algorithm](tc.encoded)
+			require.Error(t, err)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			}
+			if tc.expectedPEMType != nil {
+				var pemTypeErr *crypto.PEMTypeError
+				require.ErrorAs(t, err, &pemTypeErr)
+				assert.Equal(t, tc.expectedPEMType, pemTypeErr)
+			}
+			if tc.expectedAlgorithm != nil {
+				var algorithmErr *crypto.KeyAlgorithmError
+				require.ErrorAs(t, err, &algorithmErr)
+				assert.Equal(t, tc.expectedAlgorithm, algorithmErr)
+			}
+		})
+	}
+}
+
+func TestDecodersAcceptTheirOwnEncoding(t *testing.T) {
+	rsaPrivateKey, eccPrivateKey := generateKeys(t)
+	rsaMarshaler := crypto.NewRSAMarshaler()
+	eccMarshaler := crypto.NewECCMarshaler()
+
+	rsaKeyPair, err := rsaMarshaler.Unmarshal(rsaPrivateKey)
+	require.NoError(t, err)
+	_, reencoded, err := rsaMarshaler.Marshal(*rsaKeyPair)
+	require.NoError(t, err)
+	assert.Equal(t, rsaPrivateKey, reencoded)
+
+	eccKeyPair, err := eccMarshaler.Decode(eccPrivateKey)
+	require.NoError(t, err)
+	_, reencoded, err = eccMarshaler.Encode(*eccKeyPair)
+	require.NoError(t, err)
+	assert.Equal(t, eccPrivateKey, reencoded)
+}
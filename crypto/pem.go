@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// PEM block types of the encoded keys.
+const (
+	rsaPrivateKeyType = "RSA_PRIVATE_KEY"
+	rsaPublicKeyType  = "RSA_PUBLIC_KEY"
+	eccPrivateKeyType = "PRIVATE_KEY"
+	eccPublicKeyType  = "PUBLIC_KEY"
+)
+
+var (
+	// ErrNoPEMBlock is returned when an encoded key holds no PEM block at all.
+	ErrNoPEMBlock = errors.New("no PEM block found")
+	// ErrTrailingData is returned when an encoded key holds more than a single PEM block.
+	ErrTrailingData = errors.New("trailing data after the PEM block")
+)
+
+// PEMTypeError is returned when a PEM block is not of the expected type.
+type PEMTypeError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *PEMTypeError) Error() string {
+	return fmt.Sprintf("unexpected PEM block type '%v', expected '%v'", e.Actual, e.Expected)
+}
+
+// KeyAlgorithmError is returned when a key of another algorithm is given to a marshaler.
+type KeyAlgorithmError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *KeyAlgorithmError) Error() string {
+	return fmt.Sprintf("unexpected %v key, expected an %v key", e.Actual, e.Expected)
+}
+
+// decodePEM returns the single PEM block of encoded.
+func decodePEM(encoded []byte) (*pem.Block, error) {
+	block, rest := pem.Decode(encoded)
+	if block == nil {
+		return nil, ErrNoPEMBlock
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, ErrTrailingData
+	}
+
+	return block, nil
+}
+
+// decodePublicKeyPEM returns the content of the single PEM block of encoded, of type blockType.
+func decodePublicKeyPEM(encoded []byte, blockType string) ([]byte, error) {
+	block, err := decodePEM(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != blockType {
+		return nil, &PEMTypeError{Expected: blockType, Actual: block.Type}
+	}
+
+	return block.Bytes, nil
+}
+
+// decodePrivateKeyPEM returns the content of the single PEM block of encoded, which must hold a
+// private key of the algorithm expected, encoded in a block of type blockType.
+func decodePrivateKeyPEM(encoded []byte, expected string, blockType string) ([]byte, error) {
+	block, err := decodePEM(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != blockType {
+		if actual := privateKeyAlgorithm(block); actual != "" && actual != expected {
+			return nil, &KeyAlgorithmError{Expected: expected, Actual: actual}
+		}
+		return nil, &PEMTypeError{Expected: blockType, Actual: block.Type}
+	}
+
+	return block.Bytes, nil
+}
+
+// privateKeyAlgorithm tells the algorithm of the private key held by block, if it can be parsed.
+func privateKeyAlgorithm(block *pem.Block) string {
+	if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return "RSA"
+	}
+	if _, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return "ECC"
+	}
+
+	return ""
+}
+
+// keyParseError wraps the error of parsing a private key of algorithm expected, telling when the
+// key is of another algorithm.
+func keyParseError(der []byte, expected string, err error) error {
+	if actual := privateKeyAlgorithm(&pem.Block{Bytes: der}); actual != "" && actual != expected {
+		return &KeyAlgorithmError{Expected: expected, Actual: actual}
+	}
+
+	return fmt.Errorf("error parsing %v private key: %w", expected, err)
+}
@@ -27,12 +27,12 @@ func (m *RSAMarshaler) Marshal(keyPair RSAKeyPair) ([]byte, []byte, error) {
 	publicKeyBytes := x509.MarshalPKCS1PublicKey(keyPair.Public)
 
 	encodedPrivate := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA_PRIVATE_KEY",
+		Type:  rsaPrivateKeyType,
 		Bytes: privateKeyBytes,
 	})
 
 	encodePublic := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA_PUBLIC_KEY",
+		Type:  rsaPublicKeyType,
 		Bytes: publicKeyBytes,
 	})
 
@@ -40,12 +40,16 @@ func (m *RSAMarshaler) Marshal(keyPair RSAKeyPair) ([]byte, []byte, error) {
 }
 
 // Unmarshal takes an encoded RSA private key and transforms it into a rsa.PrivateKey.
+// Anything but a single RSA private key PEM block is rejected with a typed error.
 func (m *RSAMarshaler) Unmarshal(privateKeyBytes []byte) (*RSAKeyPair, error) {
-	block, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	der, err := decodePrivateKeyPEM(privateKeyBytes, "RSA", rsaPrivateKeyType)
 	if err != nil {
 		return nil, err
 	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return nil, keyParseError(der, "RSA", err)
+	}
 
 	return &RSAKeyPair{
 		Private: privateKey,
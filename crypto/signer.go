@@ -50,4 +50,4 @@ func ECCSignerFactory(privateKey []byte) (Signer, error) {
 	return &ECCSigner{
 		KeyPair: keyPair,
 	}, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,77 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidSignature is returned when a signature does not match the data and the public key.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Verifier checks signatures made by the Signer of the same algorithm.
+type Verifier interface {
+	Verify(dataToBeSigned []byte, signature []byte) error
+}
+
+// VerifierFactory creates a Verifier from a PEM encoded public key, as returned for the devices.
+type VerifierFactory func(publicKey []byte) (Verifier, error)
+
+type RSAVerifier struct {
+	PublicKey *rsa.PublicKey
+}
+
+func (v *RSAVerifier) Verify(dataToBeSigned []byte, signature []byte) error {
+	if err := rsa.VerifyPKCS1v15(v.PublicKey, crypto.SHA256, dataToBeSigned, signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func RSAVerifierFactory(publicKey []byte) (Verifier, error) {
+	der, err := decodePublicKeyPEM(publicKey, rsaPublicKeyType)
+	if err != nil {
+		return &RSAVerifier{}, err
+	}
+	key, err := x509.ParsePKCS1PublicKey(der)
+	if err != nil {
+		return &RSAVerifier{}, fmt.Errorf("error parsing RSA public key: %w", err)
+	}
+
+	return &RSAVerifier{
+		PublicKey: key,
+	}, nil
+}
+
+type ECCVerifier struct {
+	PublicKey *ecdsa.PublicKey
+}
+
+func (v *ECCVerifier) Verify(dataToBeSigned []byte, signature []byte) error {
+	if !ecdsa.VerifyASN1(v.PublicKey, dataToBeSigned, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func ECCVerifierFactory(publicKey []byte) (Verifier, error) {
+	der, err := decodePublicKeyPEM(publicKey, eccPublicKeyType)
+	if err != nil {
+		return &ECCVerifier{}, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return &ECCVerifier{}, fmt.Errorf("error parsing ECC public key: %w", err)
+	}
+	eccKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return &ECCVerifier{}, &KeyAlgorithmError{Expected: "ECC", Actual: fmt.Sprintf("%T", key)}
+	}
+
+	return &ECCVerifier{
+		PublicKey: eccKey,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package crypto_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto/cryptotest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/keygen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifiersCheckSignaturesOfTheirSigners(t *testing.T) {
+	tests := []struct {
+		algorithm       string
+		generate        func() ([]byte, []byte, error)
+		signerFactory   crypto.SignerFactory
+		verifierFactory crypto.VerifierFactory
+	}{
+		{algorithm: "RSA", generate: keygen.RSA, signerFactory: crypto.RSASignerFactory, verifierFactory: crypto.RSAVerifierFactory},
+		{algorithm: "ECC", generate: keygen.ECC, signerFactory: crypto.ECCSignerFactory, verifierFactory: crypto.ECCVerifierFactory},
+		{algorithm: "ECC deterministic", generate: keygen.ECC, signerFactory: cryptotest.DeterministicECCSignerFactory, verifierFactory: crypto.ECCVerifierFactory},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			publicKey, privateKey, err := tc.generate()
+			require.NoError(t, err)
+			signer, err := tc.signerFactory(privateKey)
+			require.NoError(t, err)
+			verifier, err := tc.verifierFactory(publicKey)
+			require.NoError(t, err)
+
+			digest := sha256.Sum256([]byte("0_some-data_ZGV2aWNl"))
+			signature, err := signer.Sign(digest[:])
+			require.NoError(t, err)
+			assert.NoError(t, verifier.Verify(digest[:], signature))
+
+			other := sha256.Sum256([]byte("0_other-data_ZGV2aWNl"))
+			assert.ErrorIs(t, verifier.Verify(other[:], signature), crypto.ErrInvalidSignature)
+			signature[len(signature)-1] ^= 0xff
+			assert.ErrorIs(t, verifier.Verify(digest[:], signature), crypto.ErrInvalidSignature)
+		})
+	}
+}
+
+func TestVerifierFactoriesRejectOtherKeys(t *testing.T) {
+	rsaPublicKey, _, err := keygen.RSA()
+	require.NoError(t, err)
+	eccPublicKey, _, err := keygen.ECC()
+	require.NoError(t, err)
+
+	var pemTypeErr *crypto.PEMTypeError
+	_, err = crypto.RSAVerifierFactory(eccPublicKey)
+	assert.ErrorAs(t, err, &pemTypeErr)
+	_, err = crypto.ECCVerifierFactory(rsaPublicKey)
+	assert.ErrorAs(t, err, &pemTypeErr)
+	_, err = crypto.ECCVerifierFactory([]byte("not a key"))
+	assert.ErrorIs(t, err, crypto.ErrNoPEMBlock)
+}
@@ -0,0 +1,204 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+const (
+	Format        = "signing-service-backup"
+	FormatVersion = 1
+	KeyWrapping   = "AES-256-GCM"
+)
+
+// Entry is a line of a backup: exactly one of its fields is set. A backup is a gzip compressed
+// JSON lines document made of a header, the devices ordered by ID each followed by its public keys
+// and signatures, and a trailer.
+type Entry struct {
+	Header    *Header    `json:"header,omitempty"`
+	Device    *Device    `json:"device,omitempty"`
+	PublicKey *PublicKey `json:"public_key,omitempty"`
+	Signature *Signature `json:"signature,omitempty"`
+	Trailer   *Trailer   `json:"trailer,omitempty"`
+}
+
+type Header struct {
+	Format        string    `json:"format"`
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	KeyWrapping   string    `json:"key_wrapping"`
+	// WrappingKeyID identifies the key encryption key wrapping the private keys, see crypto.KeyWrapper
+	WrappingKeyID string `json:"wrapping_key_id"`
+}
+
+// Device is the state of a device when it was backed up.
+type Device struct {
+	ID               string            `json:"id"`
+	Tenant           string            `json:"tenant,omitempty"`
+	SignatureAlg     string            `json:"signature_alg"`
+	Label            string            `json:"label,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	Status           string            `json:"status"`
+	SignatureCounter int               `json:"signature_counter"`
+	LastSignature    string            `json:"last_signature"`
+	KeyVersion       int               `json:"key_version"`
+	PublicKey        string            `json:"public_key"`
+	// WrappedPrivateKey is the private key of the current key version, wrapped with the device ID
+	// and the key version as additional data, see wrappingData
+	WrappedPrivateKey []byte `json:"wrapped_private_key"`
+}
+
+type PublicKey struct {
+	KeyVersion int       `json:"key_version"`
+	PublicKey  string    `json:"public_key"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Signature struct {
+	SignatureCounter int       `json:"signature_counter"`
+	KeyVersion       int       `json:"key_version"`
+	SignedData       string    `json:"signed_data"`
+	Signature        string    `json:"signature"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Trailer ends a backup. SHA256 is the hex encoded hash of every line before the trailer, as they
+// are before compression.
+type Trailer struct {
+	Devices    int    `json:"devices"`
+	Signatures int    `json:"signatures"`
+	SHA256     string `json:"sha256"`
+}
+
+// wrappingData binds a wrapped private key to its device and key version, so that it cannot be
+// moved to another device.
+func wrappingData(id string, keyVersion int) []byte {
+	return []byte(fmt.Sprintf("%v/%v", id, keyVersion))
+}
+
+// writer writes the lines of a backup, hashing them for the trailer.
+type writer struct {
+	w       *bufio.Writer
+	hash    hash.Hash
+	trailer Trailer
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{w: bufio.NewWriter(w), hash: sha256.New()}
+}
+
+func (w *writer) write(entry Entry) error {
+	line, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+	w.hash.Write(line)
+	if _, err := w.w.Write(line); err != nil {
+		return fmt.Errorf("error writing backup: %w", err)
+	}
+
+	switch {
+	case entry.Device != nil:
+		w.trailer.Devices++
+	case entry.Signature != nil:
+		w.trailer.Signatures++
+	}
+	return nil
+}
+
+// close writes the trailer and flushes the lines.
+func (w *writer) close() (Trailer, error) {
+	trailer := w.trailer
+	trailer.SHA256 = hex.EncodeToString(w.hash.Sum(nil))
+	line, err := encodeEntry(Entry{Trailer: &trailer})
+	if err != nil {
+		return Trailer{}, err
+	}
+	if _, err := w.w.Write(line); err != nil {
+		return Trailer{}, fmt.Errorf("error writing backup: %w", err)
+	}
+	if err := w.w.Flush(); err != nil {
+		return Trailer{}, fmt.Errorf("error writing backup: %w", err)
+	}
+
+	return trailer, nil
+}
+
+func encodeEntry(entry Entry) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(entry); err != nil {
+		return nil, fmt.Errorf("error encoding backup entry: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// reader reads the lines of a backup one at a time, hashing them to check the trailer.
+type reader struct {
+	r    *bufio.Reader
+	hash hash.Hash
+	line int
+	// next is the entry read ahead by peek, nil when there is none
+	next *Entry
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{r: bufio.NewReader(r), hash: sha256.New()}
+}
+
+// peek returns the next entry without consuming it. The end of the backup is an error: a complete
+// backup ends with its trailer.
+func (r *reader) peek() (*Entry, error) {
+	if r.next != nil {
+		return r.next, nil
+	}
+
+	line, err := r.r.ReadBytes('\n')
+	if errors.Is(err, io.EOF) && len(line) == 0 {
+		return nil, errors.New("backup ends without a trailer")
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error reading backup: %w", err)
+	}
+	r.line++
+
+	var entry Entry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return nil, fmt.Errorf("line %v: %w", r.line, err)
+	}
+	set := 0
+	for _, field := range []bool{entry.Header != nil, entry.Device != nil, entry.PublicKey != nil, entry.Signature != nil, entry.Trailer != nil} {
+		if field {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("line %v: expected a single header, device, public key, signature or trailer", r.line)
+	}
+	if entry.Trailer == nil {
+		r.hash.Write(line)
+	}
+
+	r.next = &entry
+	return r.next, nil
+}
+
+// take consumes the entry returned by peek.
+func (r *reader) take() {
+	r.next = nil
+}
+
+// sum returns the hash of the lines read before the trailer.
+func (r *reader) sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
@@ -0,0 +1,254 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+)
+
+// DeviceHistory is a device with everything needed to rebuild it in a store: its public keys and
+// its signatures, whichever store or backup they are read from.
+type DeviceHistory struct {
+	// Device is the state the device is rebuilt to, with its private key in the clear
+	Device     store.SignatureDevice
+	PublicKeys []store.PublicKeyRecord
+	// ScanSignatures calls fn with the signatures of the device ordered by signature counter,
+	// and stops at the first error fn returns.
+	ScanSignatures func(fn func(store.SignatureRecord) error) error
+}
+
+// VerifyHistory checks that history is complete and consistent before it is replayed: the public
+// keys have the versions 1 to the current one, the signatures chain from the device ID to its last
+// signature without any gap, and each of them verifies with the public key it claims. It returns
+// how many signatures there are.
+func VerifyHistory(verifiers map[string]crypto.VerifierFactory, history DeviceHistory) (int, error) {
+	device := history.Device
+	verifierFactory, found := verifiers[device.SignatureAlg]
+	if !found {
+		return 0, fmt.Errorf("device '%v': unsupported algorithm '%v'", device.ID, device.SignatureAlg)
+	}
+	if device.KeyVersion < 1 || len(history.PublicKeys) != device.KeyVersion {
+		return 0, fmt.Errorf("device '%v': expected %v public key(s), got %v", device.ID, device.KeyVersion, len(history.PublicKeys))
+	}
+	keyVerifiers := map[int]crypto.Verifier{}
+	for i, publicKey := range history.PublicKeys {
+		if publicKey.KeyVersion != i+1 {
+			return 0, fmt.Errorf("device '%v': expected public key version %v, got %v", device.ID, i+1, publicKey.KeyVersion)
+		}
+		verifier, err := verifierFactory(publicKey.PublicKey)
+		if err != nil {
+			return 0, fmt.Errorf("device '%v': public key version %v: %w", device.ID, publicKey.KeyVersion, err)
+		}
+		keyVerifiers[publicKey.KeyVersion] = verifier
+	}
+	if !bytes.Equal(history.PublicKeys[len(history.PublicKeys)-1].PublicKey, device.PublicKey) {
+		return 0, fmt.Errorf("device '%v': public key version %v is not the public key of the device", device.ID, device.KeyVersion)
+	}
+
+	chain := signature.NewChainVerifier(device.ID)
+	count := 0
+	keyVersion := 1
+	lastSignature := base64.StdEncoding.EncodeToString([]byte(device.ID))
+	err := history.ScanSignatures(func(record store.SignatureRecord) error {
+		if record.SignatureCounter != count {
+			return fmt.Errorf("expected signature counter %v, got %v", count, record.SignatureCounter)
+		}
+		if record.KeyVersion < keyVersion || record.KeyVersion > device.KeyVersion {
+			return fmt.Errorf("signature %v: unexpected key version %v", record.SignatureCounter, record.KeyVersion)
+		}
+		keyVersion = record.KeyVersion
+		if err := chain.Verify(keyVerifiers[record.KeyVersion], signature.Signature{Signature: record.Signature, SignedData: record.SignedData}); err != nil {
+			return err
+		}
+		count++
+		lastSignature = record.Signature
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("device '%v': %w", device.ID, err)
+	}
+	if count != device.SignatureCounter || lastSignature != device.LastSignature {
+		return 0, fmt.Errorf("device '%v': %v signature(s) do not lead to signature counter %v and its last signature", device.ID, count, device.SignatureCounter)
+	}
+
+	return count, nil
+}
+
+// ErrDiverged is returned when the device held by a store is not an earlier state of the history
+// replayed into it.
+var ErrDiverged = errors.New("signature device diverged from its history")
+
+// Replay rebuilds a device verified with VerifyHistory in s, which must not hold it yet: it is
+// created with its first public key, then brought up to date by Sync.
+func Replay(ctx context.Context, s store.Store, history DeviceHistory) error {
+	if err := s.CreateSignatureDevice(ctx, initialState(history)); err != nil {
+		return err
+	}
+	_, err := Sync(ctx, s, history)
+	return err
+}
+
+// initialState is the device of history as it was created, with its first public key.
+func initialState(history DeviceHistory) store.SignatureDevice {
+	initial := history.Device.Clone()
+	initial.CreatedAt = history.PublicKeys[0].CreatedAt
+	initial.SignatureCounter = 0
+	initial.LastSignature = base64.StdEncoding.EncodeToString([]byte(initial.ID))
+	initial.KeyVersion = 1
+	initial.PublicKey = history.PublicKeys[0].PublicKey
+	initial.PrivateKey = nil
+	if history.Device.KeyVersion == 1 {
+		initial.PrivateKey = history.Device.PrivateKey
+	}
+	initial.Version = ""
+	return initial
+}
+
+// syncBatchSize bounds how many signatures Sync appends to a store in a single write.
+const syncBatchSize = 256
+
+// Sync brings the device of a history verified with VerifyHistory up to date in s, and returns how
+// many signatures it wrote. The device is created when s does not hold it yet; otherwise the state
+// s holds must be an earlier state of the history, which Sync continues from. Key rotations and
+// signatures are written in the order they happened, so that s records the same history, followed
+// by the details of the device; the signatures made between two rotations are appended in batches. The public keys and signatures keep the times of the history, and no
+// outbox events are written: syncing is no change of the device.
+func Sync(ctx context.Context, s store.Store, history DeviceHistory) (int, error) {
+	final := history.Device
+	current, err := s.GetSignatureDevice(ctx, final.ID)
+	if errors.Is(err, store.ErrDeviceNotFound) {
+		err = s.CreateSignatureDevice(ctx, initialState(history))
+		if err == nil {
+			current, err = s.GetSignatureDevice(ctx, final.ID)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if current.SignatureAlg != final.SignatureAlg || current.KeyVersion > final.KeyVersion || current.SignatureCounter > final.SignatureCounter ||
+		!bytes.Equal(current.PublicKey, history.PublicKeys[current.KeyVersion-1].PublicKey) {
+		return 0, ErrDiverged
+	}
+	if current.SignatureCounter == 0 && current.LastSignature != base64.StdEncoding.EncodeToString([]byte(final.ID)) {
+		return 0, ErrDiverged
+	}
+
+	// the private keys of the previous key versions are not kept: only the current one is synced
+	privateKey := func(keyVersion int) []byte {
+		if keyVersion == final.KeyVersion {
+			return final.PrivateKey
+		}
+		return nil
+	}
+	rotateTo := func(keyVersion int) error {
+		for current.KeyVersion < keyVersion {
+			err := s.RotateSignatureDeviceKey(ctx, final.ID, store.RotateSignatureDeviceKey{
+				PublicKey:  history.PublicKeys[current.KeyVersion].PublicKey,
+				PrivateKey: privateKey(current.KeyVersion + 1),
+				RotatedAt:  history.PublicKeys[current.KeyVersion].CreatedAt,
+				Version:    current.Version,
+			})
+			if err != nil {
+				return err
+			}
+			if current, err = s.GetSignatureDevice(ctx, final.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// the signatures are appended in batches, each made with a single key version
+	written := 0
+	batch := []store.UpdateSignatureDevice{}
+	batchKeyVersion := current.KeyVersion
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.AppendSignatures(ctx, final.ID, batch, current.Version); err != nil {
+			return err
+		}
+		written += len(batch)
+		batch = batch[:0]
+		var err error
+		current, err = s.GetSignatureDevice(ctx, final.ID)
+		return err
+	}
+	err = history.ScanSignatures(func(record store.SignatureRecord) error {
+		if record.SignatureCounter < current.SignatureCounter {
+			if record.SignatureCounter == current.SignatureCounter-1 && record.Signature != current.LastSignature {
+				return ErrDiverged
+			}
+			return nil
+		}
+		if record.KeyVersion < batchKeyVersion {
+			return ErrDiverged
+		}
+		if record.KeyVersion != batchKeyVersion || len(batch) == syncBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := rotateTo(record.KeyVersion); err != nil {
+				return err
+			}
+			batchKeyVersion = record.KeyVersion
+		}
+		batch = append(batch, store.UpdateSignatureDevice{
+			SignatureCounter: record.SignatureCounter + 1,
+			LastSignature:    record.Signature,
+			SignedData:       record.SignedData,
+			SignedAt:         record.CreatedAt,
+		})
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return written, err
+	}
+	if err := rotateTo(final.KeyVersion); err != nil {
+		return written, err
+	}
+	if err := syncDetails(ctx, s, current, final); err != nil {
+		return written, err
+	}
+
+	if current.SignatureCounter != final.SignatureCounter || current.LastSignature != final.LastSignature || current.KeyVersion != final.KeyVersion {
+		return written, errors.New("synced device does not match its history")
+	}
+	return written, nil
+}
+
+// syncDetails updates the user editable fields of current which differ from final.
+func syncDetails(ctx context.Context, s store.Store, current store.SignatureDevice, final store.SignatureDevice) error {
+	if current.Label == final.Label && maps.Equal(current.Metadata, final.Metadata) && slices.Equal(current.Tags, final.Tags) && current.Status == final.Status {
+		return nil
+	}
+
+	// nil collections would be left untouched: empty ones clear them
+	metadata := final.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	tags := final.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return s.UpdateSignatureDeviceDetails(ctx, final.ID, store.UpdateSignatureDeviceDetails{
+		Label:    &final.Label,
+		Metadata: metadata,
+		Tags:     tags,
+		Status:   &final.Status,
+		Version:  current.Version,
+	})
+}
@@ -0,0 +1,316 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+)
+
+// MigrationReport tells what a migration copied, and which devices it could not.
+type MigrationReport struct {
+	// Devices is how many devices the source store holds
+	Devices int `json:"devices"`
+	// Created is how many of them the destination store did not hold yet
+	Created int `json:"created"`
+	// Deleted is how many devices were deleted from the destination store, since they were deleted
+	// from the source store during the migration
+	Deleted    int             `json:"deleted"`
+	Signatures int             `json:"signatures"`
+	Failures   []DeviceFailure `json:"failures"`
+}
+
+// VerificationReport tells how many devices and signatures match between the source and the
+// destination stores, and which devices do not.
+type VerificationReport struct {
+	Devices    int             `json:"devices"`
+	Signatures int             `json:"signatures"`
+	Failures   []DeviceFailure `json:"failures"`
+}
+
+// DeviceFailure is a device a migration failed on.
+type DeviceFailure struct {
+	DeviceID string `json:"device_id"`
+	Error    string `json:"error"`
+}
+
+// Migrator copies the devices of a store to another one, with their public keys and signatures,
+// whichever implementations both are.
+//
+// A migration can be run again and again: it only writes what the destination store lacks, see
+// Sync. Devices are migrated one at a time, and a device which fails is reported without stopping
+// the migration of the others.
+type Migrator struct {
+	source      store.Store
+	destination store.Store
+	verifiers   map[string]crypto.VerifierFactory
+	lockDevice  func(id string) (unlock func())
+}
+
+type MigratorOption func(*Migrator)
+
+// WithDeviceLock migrates the devices while the source store is written to, the writes being
+// mirrored to the destination store as dualwrite.Store does: each device is copied without
+// holding lock, then caught up with the writes made meanwhile while holding it.
+func WithDeviceLock(lock func(id string) (unlock func())) MigratorOption {
+	return func(m *Migrator) {
+		m.lockDevice = lock
+	}
+}
+
+// NewMigrator returns a Migrator from source to destination, verifying the history of every
+// device with the verifier of its algorithm before it is written.
+func NewMigrator(source store.Store, destination store.Store, verifiers map[string]crypto.VerifierFactory, opts ...MigratorOption) *Migrator {
+	m := &Migrator{
+		source:      source,
+		destination: destination,
+		verifiers:   verifiers,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Migrate brings every device of the source store up to date in the destination store. It only
+// fails when the devices cannot be listed, or ctx is done: the devices which fail are in the report.
+func (m *Migrator) Migrate(ctx context.Context) (MigrationReport, error) {
+	devices, err := m.source.ListSignatureDevices(ctx, store.ListFilter{})
+	if err != nil {
+		return MigrationReport{}, fmt.Errorf("error listing signature devices: %w", err)
+	}
+
+	report := MigrationReport{Devices: len(devices), Failures: []DeviceFailure{}}
+	for _, device := range devices {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := m.migrateDevice(ctx, device.ID, &report); err != nil {
+			report.Failures = append(report.Failures, DeviceFailure{DeviceID: device.ID, Error: err.Error()})
+		}
+	}
+
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "store migrated",
+		slog.String("event", "store.migrated"),
+		slog.Int("devices", report.Devices),
+		slog.Int("created", report.Created),
+		slog.Int("deleted", report.Deleted),
+		slog.Int("signatures", report.Signatures),
+		slog.Int("failures", len(report.Failures)),
+	)
+
+	return report, nil
+}
+
+func (m *Migrator) migrateDevice(ctx context.Context, id string, report *MigrationReport) error {
+	_, err := m.destination.GetSignatureDevice(ctx, id)
+	created := errors.Is(err, store.ErrDeviceNotFound)
+	if err != nil && !created {
+		return err
+	}
+
+	if m.lockDevice != nil {
+		// the writes mirrored meanwhile make the copy fail or fall behind: the catch-up completes it
+		written, _, _ := m.syncDevice(ctx, id)
+		report.Signatures += written
+		unlock := m.lockDevice(id)
+		defer unlock()
+	}
+
+	written, deleted, err := m.syncDevice(ctx, id)
+	report.Signatures += written
+	if err != nil {
+		return err
+	}
+	switch {
+	case deleted:
+		report.Deleted++
+	case created:
+		report.Created++
+	}
+	return nil
+}
+
+// syncDevice brings the device up to date in the destination store, or deletes it there when it
+// was deleted from the source store since it was listed.
+func (m *Migrator) syncDevice(ctx context.Context, id string) (written int, deleted bool, err error) {
+	device, err := m.source.GetSignatureDevice(ctx, id)
+	if errors.Is(err, store.ErrDeviceNotFound) {
+		deleted, err := m.deleteDevice(ctx, id)
+		return 0, deleted, err
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	history, err := deviceHistory(ctx, m.source, device)
+	if err != nil {
+		return 0, false, err
+	}
+	if _, err := VerifyHistory(m.verifiers, history); err != nil {
+		return 0, false, err
+	}
+	written, err = Sync(ctx, m.destination, history)
+	return written, false, err
+}
+
+func (m *Migrator) deleteDevice(ctx context.Context, id string) (bool, error) {
+	device, err := m.destination.GetSignatureDevice(ctx, id)
+	if errors.Is(err, store.ErrDeviceNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, m.destination.DeleteSignatureDevice(ctx, id, device.Version)
+}
+
+// Verify compares every device of the source store with the destination store, and verifies the
+// chain of signatures the destination store holds. Devices held by the destination store only are
+// reported as well. It only fails when the devices cannot be listed, or ctx is done.
+func (m *Migrator) Verify(ctx context.Context) (VerificationReport, error) {
+	devices, err := m.source.ListSignatureDevices(ctx, store.ListFilter{})
+	if err != nil {
+		return VerificationReport{}, fmt.Errorf("error listing signature devices: %w", err)
+	}
+	migrated, err := m.destination.ListSignatureDevices(ctx, store.ListFilter{})
+	if err != nil {
+		return VerificationReport{}, fmt.Errorf("error listing migrated signature devices: %w", err)
+	}
+
+	report := VerificationReport{Failures: []DeviceFailure{}}
+	inSource := map[string]bool{}
+	for _, device := range devices {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		inSource[device.ID] = true
+		signatures, err := m.verifyDevice(ctx, device.ID)
+		if errors.Is(err, errDeletedFromSource) {
+			continue
+		}
+		if err != nil {
+			report.Failures = append(report.Failures, DeviceFailure{DeviceID: device.ID, Error: err.Error()})
+			continue
+		}
+		report.Devices++
+		report.Signatures += signatures
+	}
+	for _, device := range migrated {
+		if !inSource[device.ID] {
+			report.Failures = append(report.Failures, DeviceFailure{DeviceID: device.ID, Error: "not held by the source store"})
+		}
+	}
+
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "store migration verified",
+		slog.String("event", "store.migration_verified"),
+		slog.Int("devices", report.Devices),
+		slog.Int("signatures", report.Signatures),
+		slog.Int("failures", len(report.Failures)),
+	)
+
+	return report, nil
+}
+
+var errDeletedFromSource = errors.New("deleted from the source store")
+
+// verifyDevice compares the device in both stores, and returns how many signatures it has.
+func (m *Migrator) verifyDevice(ctx context.Context, id string) (int, error) {
+	if m.lockDevice != nil {
+		unlock := m.lockDevice(id)
+		defer unlock()
+	}
+
+	device, err := m.source.GetSignatureDevice(ctx, id)
+	if errors.Is(err, store.ErrDeviceNotFound) {
+		return 0, errDeletedFromSource
+	}
+	if err != nil {
+		return 0, err
+	}
+	migrated, err := m.destination.GetSignatureDevice(ctx, id)
+	if errors.Is(err, store.ErrDeviceNotFound) {
+		return 0, errors.New("not migrated")
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := compareDevices(device, migrated); err != nil {
+		return 0, err
+	}
+
+	publicKeys, err := m.source.ListPublicKeys(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	history, err := deviceHistory(ctx, m.destination, migrated)
+	if err != nil {
+		return 0, err
+	}
+	if len(publicKeys) != len(history.PublicKeys) {
+		return 0, fmt.Errorf("%v public key(s) migrated, expected %v", len(history.PublicKeys), len(publicKeys))
+	}
+	for i := range publicKeys {
+		if !bytes.Equal(publicKeys[i].PublicKey, history.PublicKeys[i].PublicKey) {
+			return 0, fmt.Errorf("public key version %v differs", publicKeys[i].KeyVersion)
+		}
+	}
+	// the chain of the destination store leads to the last signature of the source store
+	return VerifyHistory(m.verifiers, history)
+}
+
+// compareDevices reports the first field of the device differing between both stores.
+func compareDevices(device store.SignatureDevice, migrated store.SignatureDevice) error {
+	switch {
+	case device.Tenant != migrated.Tenant:
+		return errors.New("tenant differs")
+	case device.SignatureAlg != migrated.SignatureAlg:
+		return errors.New("signature algorithm differs")
+	case device.SignatureCounter != migrated.SignatureCounter:
+		return fmt.Errorf("signature counter is %v, expected %v", migrated.SignatureCounter, device.SignatureCounter)
+	case device.LastSignature != migrated.LastSignature:
+		return errors.New("last signature differs")
+	case device.KeyVersion != migrated.KeyVersion:
+		return fmt.Errorf("key version is %v, expected %v", migrated.KeyVersion, device.KeyVersion)
+	case !bytes.Equal(device.PublicKey, migrated.PublicKey) || !bytes.Equal(device.PrivateKey, migrated.PrivateKey):
+		return errors.New("keys differ")
+	case device.Label != migrated.Label || !maps.Equal(device.Metadata, migrated.Metadata) || !slices.Equal(device.Tags, migrated.Tags) || device.Status != migrated.Status:
+		return errors.New("details differ")
+	}
+	return nil
+}
+
+// deviceHistory returns the history of device as s holds it: the keys rotated and the signatures
+// made since device was read are left out.
+func deviceHistory(ctx context.Context, s store.Store, device store.SignatureDevice) (DeviceHistory, error) {
+	publicKeys, err := s.ListPublicKeys(ctx, device.ID)
+	if err != nil {
+		return DeviceHistory{}, err
+	}
+	for i, publicKey := range publicKeys {
+		if publicKey.KeyVersion > device.KeyVersion {
+			publicKeys = publicKeys[:i]
+			break
+		}
+	}
+
+	return DeviceHistory{
+		Device:     device,
+		PublicKeys: publicKeys,
+		ScanSignatures: func(fn func(store.SignatureRecord) error) error {
+			return s.ScanSignatures(ctx, device.ID, func(record store.SignatureRecord) error {
+				if record.SignatureCounter >= device.SignatureCounter {
+					return nil
+				}
+				return fn(record)
+			})
+		},
+	}, nil
+}
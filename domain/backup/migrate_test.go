@@ -0,0 +1,140 @@
+package backup_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/backup"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/dualwrite"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/filelog"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signatureDevice(id string, algorithm string) signature.NewSignatureDevice {
+	return signature.NewSignatureDevice{ID: id, Tenant: "some-tenant", SignatureAlg: algorithm}
+}
+
+func TestMigrateCopiesTheDevicesWithTheirHistory(t *testing.T) {
+	ctx := context.Background()
+	source := inmemory.New()
+	populate(t, source)
+	destination, err := filelog.Open(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { destination.Close() })
+	migrator := backup.NewMigrator(source, destination, verifiers)
+
+	report, err := migrator.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, backup.MigrationReport{Devices: 2, Created: 2, Signatures: 5, Failures: []backup.DeviceFailure{}}, report)
+
+	devices, publicKeys, signatures := contents(t, source)
+	migratedDevices, migratedPublicKeys, migratedSignatures := contents(t, destination)
+	assert.Equal(t, devices, migratedDevices)
+	assert.Equal(t, publicKeys, migratedPublicKeys)
+	assert.Equal(t, signatures, migratedSignatures)
+
+	verification, err := migrator.Verify(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, backup.VerificationReport{Devices: 2, Signatures: 5, Failures: []backup.DeviceFailure{}}, verification)
+
+	// a migration run again copies what was signed since
+	_, err = servicetest.New(t, servicetest.WithStore(source)).Signature.SignData(ctx, "device-b", "receipt")
+	require.NoError(t, err)
+	report, err = migrator.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, backup.MigrationReport{Devices: 2, Signatures: 1, Failures: []backup.DeviceFailure{}}, report)
+}
+
+func TestMigrateReportsDivergedDevices(t *testing.T) {
+	ctx := context.Background()
+	source := inmemory.New()
+	populate(t, source)
+	destination := inmemory.New()
+	// a device of the same ID, with other keys
+	_, _, err := servicetest.New(t, servicetest.WithStore(destination)).Signature.CreateSignatureDevice(ctx, signatureDevice("device-a", "ECC"))
+	require.NoError(t, err)
+	_, _, err = servicetest.New(t, servicetest.WithStore(destination)).Signature.CreateSignatureDevice(ctx, signatureDevice("device-c", "ECC"))
+	require.NoError(t, err)
+	migrator := backup.NewMigrator(source, destination, verifiers)
+
+	report, err := migrator.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Created)
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, "device-a", report.Failures[0].DeviceID)
+	assert.Contains(t, report.Failures[0].Error, backup.ErrDiverged.Error())
+
+	verification, err := migrator.Verify(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, verification.Devices)
+	failed := []string{}
+	for _, failure := range verification.Failures {
+		failed = append(failed, failure.DeviceID)
+	}
+	assert.Equal(t, []string{"device-a", "device-c"}, failed)
+}
+
+func TestMigrateWhileTheDevicesAreWrittenTo(t *testing.T) {
+	ctx := context.Background()
+	source := inmemory.New()
+	populate(t, source)
+	destination := inmemory.New()
+	dual := dualwrite.New(source, destination)
+	service := servicetest.New(t, servicetest.WithStore(dual)).Signature
+	_, _, err := service.CreateSignatureDevice(ctx, signatureDevice("device-c", "ECC"))
+	require.NoError(t, err)
+	migrator := backup.NewMigrator(source, destination, verifiers, backup.WithDeviceLock(dual.LockDevice))
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"device-b", "device-c"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				_, err := service.SignData(ctx, id, "receipt")
+				assert.NoError(t, err)
+			}
+		}(id)
+	}
+	report, err := migrator.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, report.Failures)
+	wg.Wait()
+
+	// every write after the migration of a device is mirrored
+	_, _, err = service.CreateSignatureDevice(ctx, signatureDevice("device-d", "RSA"))
+	require.NoError(t, err)
+	_, err = service.SignData(ctx, "device-d", "receipt")
+	require.NoError(t, err)
+
+	verification, err := migrator.Verify(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, backup.VerificationReport{Devices: 4, Signatures: 46, Failures: []backup.DeviceFailure{}}, verification)
+	devices, _, signatures := contents(t, source)
+	migratedDevices, _, migratedSignatures := contents(t, destination)
+	assert.Equal(t, devices, migratedDevices)
+	assert.Equal(t, signatures, migratedSignatures)
+}
+
+func TestMigrateStopsOnceCancelled(t *testing.T) {
+	source := inmemory.New()
+	populate(t, source)
+	destination := inmemory.New()
+	migrator := backup.NewMigrator(source, destination, verifiers)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := migrator.Migrate(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = migrator.Verify(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	migrated, err := destination.ListSignatureDevices(context.Background(), store.ListFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, migrated)
+}
@@ -0,0 +1,449 @@
+// Package backup moves the whole content of a store: every device with its private key wrapped
+// by a key encryption key, its public keys and its signatures, written to a versioned and
+// checksummed archive which can be restored into any store.Store.
+//
+// A backup is read and written one line at a time, so that neither holds the signatures in
+// memory. Restoring verifies the whole backup before writing anything, then replays every device
+// into the store, see Replay.
+//
+// The same histories move the devices from a store straight into another one, see Migrator.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+)
+
+type StoreBackup interface {
+	// Backup writes a backup of every device to w. It fails before writing anything when the
+	// devices cannot be listed.
+	Backup(ctx context.Context, w io.Writer) (Summary, error)
+	// Restore restores the backup read from r, which is read twice: once to verify the backup as a
+	// whole, then to restore its devices, none of which may exist yet.
+	Restore(ctx context.Context, r io.ReadSeeker) (Summary, error)
+}
+
+// Summary tells how much a backup holds.
+type Summary struct {
+	Devices    int
+	Signatures int
+}
+
+// Metrics receives the number of signature devices by algorithm once a restore changed them.
+type Metrics interface {
+	SetDevices(devices map[string]int)
+}
+
+type Service struct {
+	store     store.Store
+	wrapper   *crypto.KeyWrapper
+	verifiers map[string]crypto.VerifierFactory
+	metrics   Metrics
+}
+
+type Option func(*Service)
+
+// WithMetrics recounts the devices into metrics after every restore, which writes them without
+// going through the signature service.
+func WithMetrics(metrics Metrics) Option {
+	return func(s *Service) {
+		s.metrics = metrics
+	}
+}
+
+// New returns a Service wrapping the private keys with wrapper, and verifying the signatures of
+// the restored devices with the verifier of their algorithm.
+func New(store store.Store, wrapper *crypto.KeyWrapper, verifiers map[string]crypto.VerifierFactory, opts ...Option) *Service {
+	s := &Service{
+		store:     store,
+		wrapper:   wrapper,
+		verifiers: verifiers,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// CountDevices returns the number of devices s holds by algorithm.
+func CountDevices(ctx context.Context, s store.Store) (map[string]int, error) {
+	devices, err := s.ListSignatureDevices(ctx, store.ListFilter{})
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, device := range devices {
+		counts[device.SignatureAlg]++
+	}
+	return counts, nil
+}
+
+func (s *Service) Backup(ctx context.Context, w io.Writer) (Summary, error) {
+	devices, err := s.store.ListSignatureDevices(ctx, store.ListFilter{})
+	if err != nil {
+		return Summary{}, fmt.Errorf("error listing signature devices: %w", err)
+	}
+
+	compressed := gzip.NewWriter(w)
+	backup := newWriter(compressed)
+	err = backup.write(Entry{Header: &Header{
+		Format:        Format,
+		FormatVersion: FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		KeyWrapping:   KeyWrapping,
+		WrappingKeyID: s.wrapper.ID(),
+	}})
+	if err != nil {
+		return Summary{}, err
+	}
+	for _, device := range devices {
+		if err := s.backupDevice(ctx, backup, device); err != nil {
+			return Summary{}, err
+		}
+	}
+	trailer, err := backup.close()
+	if err != nil {
+		return Summary{}, err
+	}
+	if err := compressed.Close(); err != nil {
+		return Summary{}, fmt.Errorf("error writing backup: %w", err)
+	}
+
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "store backed up",
+		slog.String("event", "store.backed_up"),
+		slog.Int("devices", trailer.Devices),
+		slog.Int("signatures", trailer.Signatures),
+		slog.String("wrapping_key_id", s.wrapper.ID()),
+	)
+
+	return Summary{Devices: trailer.Devices, Signatures: trailer.Signatures}, nil
+}
+
+// backupDevice writes device as it was listed: the keys rotated and the signatures made since are
+// left out, so that the backup is consistent.
+func (s *Service) backupDevice(ctx context.Context, backup *writer, device store.SignatureDevice) error {
+	publicKeys, err := s.store.ListPublicKeys(ctx, device.ID)
+	if errors.Is(err, store.ErrDeviceNotFound) {
+		// deleted since it was listed
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error listing public keys of device '%v': %w", device.ID, err)
+	}
+	wrappedPrivateKey, err := s.wrapper.Wrap(device.PrivateKey, wrappingData(device.ID, device.KeyVersion))
+	if err != nil {
+		return fmt.Errorf("error wrapping private key of device '%v': %w", device.ID, err)
+	}
+
+	err = backup.write(Entry{Device: &Device{
+		ID:                device.ID,
+		Tenant:            device.Tenant,
+		SignatureAlg:      device.SignatureAlg,
+		Label:             device.Label,
+		Metadata:          device.Metadata,
+		Tags:              device.Tags,
+		Status:            device.Status,
+		SignatureCounter:  device.SignatureCounter,
+		LastSignature:     device.LastSignature,
+		KeyVersion:        device.KeyVersion,
+		PublicKey:         string(device.PublicKey),
+		WrappedPrivateKey: wrappedPrivateKey,
+	}})
+	if err != nil {
+		return err
+	}
+	for _, publicKey := range publicKeys {
+		if publicKey.KeyVersion > device.KeyVersion {
+			break
+		}
+		err := backup.write(Entry{PublicKey: &PublicKey{
+			KeyVersion: publicKey.KeyVersion,
+			PublicKey:  string(publicKey.PublicKey),
+			CreatedAt:  publicKey.CreatedAt,
+		}})
+		if err != nil {
+			return err
+		}
+	}
+
+	written := 0
+	err = s.store.ScanSignatures(ctx, device.ID, func(record store.SignatureRecord) error {
+		if record.SignatureCounter >= device.SignatureCounter {
+			return nil
+		}
+		written++
+		return backup.write(Entry{Signature: &Signature{
+			SignatureCounter: record.SignatureCounter,
+			KeyVersion:       record.KeyVersion,
+			SignedData:       record.SignedData,
+			Signature:        record.Signature,
+			CreatedAt:        record.CreatedAt,
+		}})
+	})
+	if err != nil {
+		return fmt.Errorf("error writing signatures of device '%v': %w", device.ID, err)
+	}
+	if written != device.SignatureCounter {
+		return fmt.Errorf("device '%v' has %v signature(s) in its history, expected %v", device.ID, written, device.SignatureCounter)
+	}
+
+	return nil
+}
+
+func (s *Service) Restore(ctx context.Context, r io.ReadSeeker) (Summary, error) {
+	// first pass: nothing is written unless the whole backup is valid
+	summary, err := s.readBackup(r, func(history DeviceHistory) error {
+		if _, err := VerifyHistory(s.verifiers, history); err != nil {
+			return err
+		}
+		_, err := s.store.GetSignatureDevice(ctx, history.Device.ID)
+		if err == nil {
+			return &signature.Error{Code: signature.CodeConflict, Message: fmt.Sprintf("signature device '%v' already exists", history.Device.ID)}
+		}
+		if !errors.Is(err, store.ErrDeviceNotFound) {
+			return &signature.Error{Code: signature.CodeInternal, Message: "error getting signature device", Err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return Summary{}, invalidBackup(err)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Summary{}, fmt.Errorf("error reading backup: %w", err)
+	}
+	restored := []string{}
+	_, err = s.readBackup(r, func(history DeviceHistory) error {
+		err := Replay(ctx, s.store, history)
+		// a device created meanwhile by someone else is not rolled back
+		if !errors.Is(err, store.ErrDeviceExists) {
+			restored = append(restored, history.Device.ID)
+		}
+		return err
+	})
+	if err != nil {
+		s.rollback(ctx, restored)
+		s.recountDevices(ctx)
+		return Summary{}, fromStoreError(err, "error restoring backup")
+	}
+	s.recountDevices(ctx)
+
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "store restored",
+		slog.String("event", "store.restored"),
+		slog.Int("devices", summary.Devices),
+		slog.Int("signatures", summary.Signatures),
+		slog.String("wrapping_key_id", s.wrapper.ID()),
+	)
+
+	return summary, nil
+}
+
+// recountDevices hands the devices the store holds to the metrics, when there are any.
+func (s *Service) recountDevices(ctx context.Context) {
+	if s.metrics == nil {
+		return
+	}
+	counts, err := CountDevices(ctx, s.store)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "error counting signature devices", slog.String("error", err.Error()))
+		return
+	}
+	s.metrics.SetDevices(counts)
+}
+
+// rollback deletes the devices restored before a restore failed, so that it can be retried.
+func (s *Service) rollback(ctx context.Context, ids []string) {
+	logger := logging.FromContext(ctx)
+	for _, id := range ids {
+		device, err := s.store.GetSignatureDevice(ctx, id)
+		if errors.Is(err, store.ErrDeviceNotFound) {
+			continue
+		}
+		if err == nil {
+			err = s.store.DeleteSignatureDevice(ctx, id, device.Version)
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "error rolling back restored device", slog.String("device_id", id), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// readBackup reads the backup in r, calling fn with the history of every device in turn. The
+// signatures of a history can only be scanned during the call. The backup is checked against its
+// trailer once it is read entirely.
+func (s *Service) readBackup(r io.Reader, fn func(DeviceHistory) error) (Summary, error) {
+	decompressed, err := gzip.NewReader(r)
+	if err != nil {
+		return Summary{}, fmt.Errorf("error reading backup: %w", err)
+	}
+	defer decompressed.Close()
+	backup := newReader(decompressed)
+
+	entry, err := backup.peek()
+	if err != nil {
+		return Summary{}, err
+	}
+	header := entry.Header
+	switch {
+	case header == nil || header.Format != Format:
+		return Summary{}, errors.New("not a backup of the signing service")
+	case header.FormatVersion != FormatVersion:
+		return Summary{}, fmt.Errorf("unsupported backup format version %v", header.FormatVersion)
+	case header.KeyWrapping != KeyWrapping:
+		return Summary{}, fmt.Errorf("unsupported key wrapping '%v'", header.KeyWrapping)
+	case header.WrappingKeyID != s.wrapper.ID():
+		return Summary{}, fmt.Errorf("private keys are wrapped with key %v, not with the backup key %v", header.WrappingKeyID, s.wrapper.ID())
+	}
+	backup.take()
+
+	summary := Summary{}
+	previousID := ""
+	for {
+		entry, err := backup.peek()
+		if err != nil {
+			return Summary{}, err
+		}
+		if entry.Trailer != nil {
+			break
+		}
+		if entry.Device == nil {
+			return Summary{}, fmt.Errorf("line %v: expected a device", backup.line)
+		}
+		if summary.Devices > 0 && entry.Device.ID <= previousID {
+			return Summary{}, fmt.Errorf("line %v: device '%v' is out of order", backup.line, entry.Device.ID)
+		}
+		previousID = entry.Device.ID
+
+		signatures, err := s.readDevice(backup, fn)
+		if err != nil {
+			return Summary{}, err
+		}
+		summary.Devices++
+		summary.Signatures += signatures
+	}
+
+	trailer := backup.next.Trailer
+	if trailer.SHA256 != backup.sum() {
+		return Summary{}, errors.New("backup does not match its checksum")
+	}
+	if trailer.Devices != summary.Devices || trailer.Signatures != summary.Signatures {
+		return Summary{}, fmt.Errorf("backup holds %v device(s) and %v signature(s), its trailer %v and %v", summary.Devices, summary.Signatures, trailer.Devices, trailer.Signatures)
+	}
+	return summary, nil
+}
+
+// readDevice reads the device the backup is at, with its public keys and signatures, and returns
+// how many signatures it has.
+func (s *Service) readDevice(backup *reader, fn func(DeviceHistory) error) (int, error) {
+	entry, _ := backup.peek()
+	device := entry.Device
+	backup.take()
+
+	privateKey, err := s.wrapper.Unwrap(device.WrappedPrivateKey, wrappingData(device.ID, device.KeyVersion))
+	if err != nil {
+		return 0, fmt.Errorf("device '%v': %w", device.ID, err)
+	}
+	history := DeviceHistory{
+		Device: store.SignatureDevice{
+			ID:               device.ID,
+			Tenant:           device.Tenant,
+			SignatureAlg:     device.SignatureAlg,
+			Label:            device.Label,
+			Metadata:         device.Metadata,
+			Tags:             device.Tags,
+			PublicKey:        []byte(device.PublicKey),
+			PrivateKey:       privateKey,
+			SignatureCounter: device.SignatureCounter,
+			LastSignature:    device.LastSignature,
+			Status:           device.Status,
+			KeyVersion:       device.KeyVersion,
+		},
+		PublicKeys: []store.PublicKeyRecord{},
+	}
+	for {
+		entry, err := backup.peek()
+		if err != nil {
+			return 0, err
+		}
+		if entry.PublicKey == nil {
+			break
+		}
+		backup.take()
+		history.PublicKeys = append(history.PublicKeys, store.PublicKeyRecord{
+			DeviceID:   device.ID,
+			KeyVersion: entry.PublicKey.KeyVersion,
+			PublicKey:  []byte(entry.PublicKey.PublicKey),
+			CreatedAt:  entry.PublicKey.CreatedAt,
+		})
+	}
+
+	signatures := 0
+	scanned := false
+	scan := func(fn func(store.SignatureRecord) error) error {
+		if scanned {
+			return errors.New("signatures of a backup can only be scanned once")
+		}
+		scanned = true
+		for {
+			entry, err := backup.peek()
+			if err != nil {
+				return err
+			}
+			if entry.Signature == nil {
+				return nil
+			}
+			backup.take()
+			signatures++
+			err = fn(store.SignatureRecord{
+				DeviceID:         device.ID,
+				SignatureCounter: entry.Signature.SignatureCounter,
+				KeyVersion:       entry.Signature.KeyVersion,
+				SignedData:       entry.Signature.SignedData,
+				Signature:        entry.Signature.Signature,
+				CreatedAt:        entry.Signature.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	history.ScanSignatures = scan
+
+	if err := fn(history); err != nil {
+		return 0, err
+	}
+	// the signatures fn did not scan are skipped
+	if !scanned {
+		if err := scan(func(store.SignatureRecord) error { return nil }); err != nil {
+			return 0, err
+		}
+	}
+	return signatures, nil
+}
+
+// invalidBackup turns the errors of reading and verifying a backup into invalid input errors.
+func invalidBackup(err error) error {
+	var domainErr *signature.Error
+	if errors.As(err, &domainErr) {
+		return err
+	}
+	return &signature.Error{Code: signature.CodeInvalidInput, Message: "invalid backup", Err: err}
+}
+
+func fromStoreError(err error, message string) error {
+	if errors.Is(err, store.ErrDeviceExists) || errors.Is(err, store.ErrVersionConflict) {
+		return &signature.Error{Code: signature.CodeConflict, Message: "signature device changed during the restore", Err: err}
+	}
+
+	return fmt.Errorf("%v: %w", message, err)
+}
@@ -0,0 +1,409 @@
+package backup_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/backup"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/filelog"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var verifiers = map[string]crypto.VerifierFactory{
+	"RSA": crypto.RSAVerifierFactory,
+	"ECC": crypto.ECCVerifierFactory,
+}
+
+func newWrapper(t *testing.T, fill byte) *crypto.KeyWrapper {
+	t.Helper()
+
+	wrapper, err := crypto.NewKeyWrapper(bytes.Repeat([]byte{fill}, crypto.KeyEncryptionKeySize))
+	require.NoError(t, err)
+	return wrapper
+}
+
+// populate creates a suspended ECC device which signed with two keys, and an RSA device which
+// never signed.
+func populate(t *testing.T, s store.Store) {
+	t.Helper()
+	ctx := context.Background()
+	service := servicetest.New(t, servicetest.WithStore(s)).Signature
+
+	_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "device-a", Tenant: "some-tenant", SignatureAlg: "ECC", Label: "till 1", Metadata: map[string]string{"store": "mitte"}, Tags: []string{"pos"}})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := service.SignData(ctx, "device-a", "receipt")
+		require.NoError(t, err)
+	}
+	device, err := service.GetSignatureDevice(ctx, "device-a")
+	require.NoError(t, err)
+	device, err = service.RotateSignatureDeviceKey(ctx, "device-a", device.Version)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err := service.SignData(ctx, "device-a", "receipt")
+		require.NoError(t, err)
+	}
+	device, err = service.GetSignatureDevice(ctx, "device-a")
+	require.NoError(t, err)
+	suspended := store.StatusSuspended
+	_, err = service.UpdateSignatureDevice(ctx, "device-a", signature.UpdateSignatureDevice{Status: &suspended}, device.Version)
+	require.NoError(t, err)
+
+	_, _, err = service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "device-b", Tenant: "some-tenant", SignatureAlg: "RSA"})
+	require.NoError(t, err)
+}
+
+func backUp(t *testing.T, s store.Store, wrapper *crypto.KeyWrapper) []byte {
+	t.Helper()
+
+	backedUp := &bytes.Buffer{}
+	summary, err := backup.New(s, wrapper, verifiers).Backup(context.Background(), backedUp)
+	require.NoError(t, err)
+	assert.Equal(t, backup.Summary{Devices: 2, Signatures: 5}, summary)
+	return backedUp.Bytes()
+}
+
+// contents returns everything a store holds about its devices, but the versions.
+func contents(t *testing.T, s store.Store) ([]store.SignatureDevice, []store.PublicKeyRecord, []store.SignatureRecord) {
+	t.Helper()
+	ctx := context.Background()
+
+	devices, err := s.ListSignatureDevices(ctx, store.ListFilter{})
+	require.NoError(t, err)
+	publicKeys := []store.PublicKeyRecord{}
+	signatures := []store.SignatureRecord{}
+	for i := range devices {
+		devices[i].Version = ""
+		keys, err := s.ListPublicKeys(ctx, devices[i].ID)
+		require.NoError(t, err)
+		publicKeys = append(publicKeys, keys...)
+		err = s.ScanSignatures(ctx, devices[i].ID, func(record store.SignatureRecord) error {
+			signatures = append(signatures, record)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	return devices, publicKeys, signatures
+}
+
+func TestRestoreRebuildsTheDevicesWithTheirHistory(t *testing.T) {
+	destinations := map[string]func(t *testing.T) store.Store{
+		"inmemory": func(t *testing.T) store.Store { return inmemory.New() },
+		"filelog": func(t *testing.T) store.Store {
+			fileStore, err := filelog.Open(t.TempDir())
+			require.NoError(t, err)
+			t.Cleanup(func() { fileStore.Close() })
+			return fileStore
+		},
+	}
+
+	for name, newStore := range destinations {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			wrapper := newWrapper(t, 1)
+			source := inmemory.New()
+			populate(t, source)
+			backedUp := backUp(t, source, wrapper)
+			assert.NotContains(t, decompress(t, backedUp), "PRIVATE")
+
+			destination := newStore(t)
+			summary, err := backup.New(destination, wrapper, verifiers).Restore(ctx, bytes.NewReader(backedUp))
+			require.NoError(t, err)
+			assert.Equal(t, backup.Summary{Devices: 2, Signatures: 5}, summary)
+
+			expectedDevices, expectedKeys, expectedSignatures := contents(t, source)
+			devices, publicKeys, signatures := contents(t, destination)
+			assert.Equal(t, expectedDevices, devices)
+			assert.Equal(t, expectedKeys, publicKeys)
+			assert.Equal(t, expectedSignatures, signatures)
+
+			// the restored device carries on with its chain
+			service := servicetest.New(t, servicetest.WithStore(destination)).Signature
+			device, err := service.GetSignatureDevice(ctx, "device-a")
+			require.NoError(t, err)
+			active := store.StatusActive
+			_, err = service.UpdateSignatureDevice(ctx, "device-a", signature.UpdateSignatureDevice{Status: &active}, device.Version)
+			require.NoError(t, err)
+			signed, err := service.SignData(ctx, "device-a", "receipt")
+			require.NoError(t, err)
+			assert.Equal(t, "5_receipt_"+expectedDevices[0].LastSignature, signed.SignedData)
+			verifier, err := crypto.ECCVerifierFactory(expectedDevices[0].PublicKey)
+			require.NoError(t, err)
+			assert.NoError(t, signature.NewChainVerifier("device-a").Verify(verifier, signed))
+		})
+	}
+}
+
+func decompress(t *testing.T, backedUp []byte) string {
+	t.Helper()
+
+	r, err := gzip.NewReader(bytes.NewReader(backedUp))
+	require.NoError(t, err)
+	lines := &strings.Builder{}
+	_, err = bufio.NewReader(r).WriteTo(lines)
+	require.NoError(t, err)
+	return lines.String()
+}
+
+// rewrite changes the entries of a backup, and recomputes its checksum when fix is set.
+func rewrite(t *testing.T, backedUp []byte, fix bool, fn func(entries []backup.Entry) []backup.Entry) []byte {
+	t.Helper()
+
+	entries := []backup.Entry{}
+	for _, line := range strings.Split(strings.TrimSpace(decompress(t, backedUp)), "\n") {
+		var entry backup.Entry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	checksum := entries[len(entries)-1].Trailer.SHA256
+	entries = fn(entries)
+
+	rewritten := &bytes.Buffer{}
+	w := gzip.NewWriter(rewritten)
+	hash := sha256.New()
+	for _, entry := range entries {
+		if entry.Trailer != nil {
+			trailer := *entry.Trailer
+			trailer.SHA256 = checksum
+			if fix {
+				trailer.SHA256 = hex.EncodeToString(hash.Sum(nil))
+			}
+			entry.Trailer = &trailer
+		}
+		line, err := json.Marshal(entry)
+		require.NoError(t, err)
+		line = append(line, '\n')
+		if entry.Trailer == nil {
+			hash.Write(line)
+		}
+		_, err = w.Write(line)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return rewritten.Bytes()
+}
+
+func TestRestoreRejectsInvalidBackupsWithoutWriting(t *testing.T) {
+	wrapper := newWrapper(t, 1)
+	source := inmemory.New()
+	populate(t, source)
+	backedUp := backUp(t, source, wrapper)
+
+	signatureAt := func(entries []backup.Entry, counter int) *backup.Signature {
+		for _, entry := range entries {
+			if entry.Signature != nil && entry.Signature.SignatureCounter == counter {
+				return entry.Signature
+			}
+		}
+		t.Fatalf("no signature %v", counter)
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		backup  []byte
+		wrapper *crypto.KeyWrapper
+		errMsg  string
+	}{
+		{
+			name:   "not gzip compressed",
+			backup: []byte("not a backup, but plain text"),
+			errMsg: "gzip",
+		},
+		{
+			name:    "other wrapping key",
+			backup:  backedUp,
+			wrapper: newWrapper(t, 2),
+			errMsg:  "private keys are wrapped with key",
+		},
+		{
+			name: "unsupported format version",
+			backup: rewrite(t, backedUp, true, func(entries []backup.Entry) []backup.Entry {
+				entries[0].Header.FormatVersion = 2
+				return entries
+			}),
+			errMsg: "unsupported backup format version 2",
+		},
+		{
+			name: "tampered without fixing the checksum",
+			backup: rewrite(t, backedUp, false, func(entries []backup.Entry) []backup.Entry {
+				entries[1].Device.Label = "tampered"
+				return entries
+			}),
+			errMsg: "backup does not match its checksum",
+		},
+		{
+			name: "truncated",
+			backup: rewrite(t, backedUp, true, func(entries []backup.Entry) []backup.Entry {
+				return entries[:len(entries)-1]
+			}),
+			errMsg: "backup ends without a trailer",
+		},
+		{
+			name: "missing signature",
+			backup: rewrite(t, backedUp, true, func(entries []backup.Entry) []backup.Entry {
+				return append(entries[:5], entries[6:]...)
+			}),
+			errMsg: "expected signature counter 1, got 2",
+		},
+		{
+			name: "forged signed data",
+			backup: rewrite(t, backedUp, true, func(entries []backup.Entry) []backup.Entry {
+				signed := signatureAt(entries, 3)
+				signed.SignedData = strings.Replace(signed.SignedData, "receipt", "forged", 1)
+				return entries
+			}),
+			errMsg: "signature does not verify",
+		},
+		{
+			name: "private key moved to another device",
+			backup: rewrite(t, backedUp, true, func(entries []backup.Entry) []backup.Entry {
+				entries[len(entries)-3].Device.WrappedPrivateKey = entries[1].Device.WrappedPrivateKey
+				return entries
+			}),
+			errMsg: "wrapped key cannot be decrypted",
+		},
+		{
+			name: "wrong trailer counts",
+			backup: rewrite(t, backedUp, true, func(entries []backup.Entry) []backup.Entry {
+				entries[len(entries)-1].Trailer.Signatures++
+				return entries
+			}),
+			errMsg: "its trailer 2 and 6",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			wrapper := wrapper
+			if tc.wrapper != nil {
+				wrapper = tc.wrapper
+			}
+			destination := inmemory.New()
+
+			_, err := backup.New(destination, wrapper, verifiers).Restore(context.Background(), bytes.NewReader(tc.backup))
+			assert.ErrorIs(t, err, signature.ErrInvalidInput)
+			assert.ErrorContains(t, err, tc.errMsg)
+			devices, err := destination.ListSignatureDevices(context.Background(), store.ListFilter{})
+			require.NoError(t, err)
+			assert.Empty(t, devices)
+		})
+	}
+}
+
+func TestRestoreOfExistingDeviceConflicts(t *testing.T) {
+	wrapper := newWrapper(t, 1)
+	source := inmemory.New()
+	populate(t, source)
+	backedUp := backUp(t, source, wrapper)
+
+	destination := inmemory.New()
+	_, _, err := servicetest.New(t, servicetest.WithStore(destination)).Signature.CreateSignatureDevice(context.Background(), signature.NewSignatureDevice{ID: "device-b", Tenant: "some-tenant", SignatureAlg: "ECC"})
+	require.NoError(t, err)
+
+	_, err = backup.New(destination, wrapper, verifiers).Restore(context.Background(), bytes.NewReader(backedUp))
+	assert.ErrorIs(t, err, signature.ErrConflict)
+	_, err = destination.GetSignatureDevice(context.Background(), "device-a")
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+}
+
+// failingStore fails to create the device with the given ID.
+type failingStore struct {
+	*inmemory.InMemoryStore
+	id string
+}
+
+func (s failingStore) CreateSignatureDevice(ctx context.Context, sigDevice store.SignatureDevice, outbox ...store.OutboxEvent) error {
+	if sigDevice.ID == s.id {
+		return assert.AnError
+	}
+	return s.InMemoryStore.CreateSignatureDevice(ctx, sigDevice, outbox...)
+}
+
+func TestFailedRestoreRollsBack(t *testing.T) {
+	wrapper := newWrapper(t, 1)
+	source := inmemory.New()
+	populate(t, source)
+	backedUp := backUp(t, source, wrapper)
+
+	destination := failingStore{InMemoryStore: inmemory.New(), id: "device-b"}
+	_, err := backup.New(destination, wrapper, verifiers).Restore(context.Background(), bytes.NewReader(backedUp))
+	assert.ErrorIs(t, err, assert.AnError)
+
+	devices, err := destination.ListSignatureDevices(context.Background(), store.ListFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+}
+
+// devicesGauge records the last devices it was set to.
+type devicesGauge struct {
+	devices map[string]int
+}
+
+func (g *devicesGauge) SetDevices(devices map[string]int) {
+	g.devices = devices
+}
+
+func TestRestoreRecountsTheDevices(t *testing.T) {
+	wrapper := newWrapper(t, 1)
+	source := inmemory.New()
+	populate(t, source)
+	backedUp := backUp(t, source, wrapper)
+
+	gauge := &devicesGauge{}
+	_, err := backup.New(inmemory.New(), wrapper, verifiers, backup.WithMetrics(gauge)).Restore(context.Background(), bytes.NewReader(backedUp))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"ECC": 1, "RSA": 1}, gauge.devices)
+
+	// a rolled back restore recounts the devices left
+	gauge = &devicesGauge{devices: map[string]int{"ECC": 1}}
+	destination := failingStore{InMemoryStore: inmemory.New(), id: "device-b"}
+	_, err = backup.New(destination, wrapper, verifiers, backup.WithMetrics(gauge)).Restore(context.Background(), bytes.NewReader(backedUp))
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, map[string]int{}, gauge.devices)
+}
+
+// countingStore counts the writes of signatures.
+type countingStore struct {
+	*inmemory.InMemoryStore
+	updates int
+	appends int
+}
+
+func (s *countingStore) UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox ...store.OutboxEvent) error {
+	s.updates++
+	return s.InMemoryStore.UpdateSignatureDevice(ctx, id, updateSignDevice, outbox...)
+}
+
+func (s *countingStore) AppendSignatures(ctx context.Context, id string, signatures []store.UpdateSignatureDevice, version string) error {
+	s.appends++
+	return s.InMemoryStore.AppendSignatures(ctx, id, signatures, version)
+}
+
+func TestRestoreAppendsTheSignaturesOfEveryKeyAtOnce(t *testing.T) {
+	wrapper := newWrapper(t, 1)
+	source := inmemory.New()
+	populate(t, source)
+	backedUp := backUp(t, source, wrapper)
+
+	destination := &countingStore{InMemoryStore: inmemory.New()}
+	_, err := backup.New(destination, wrapper, verifiers).Restore(context.Background(), bytes.NewReader(backedUp))
+	require.NoError(t, err)
+	// device-a signed 3 times with its first key and twice with its second one
+	assert.Equal(t, 0, destination.updates)
+	assert.Equal(t, 2, destination.appends)
+}
@@ -0,0 +1,215 @@
+// Package export writes the audit export of a signature device: its bundle (see package bundle),
+// archived as a zip file together with a manifest signed by the export key of the service.
+//
+// The signatures are streamed from the store into the archive one by one, so that exporting a long
+// history does not load it into memory.
+package export
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/bundle"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+)
+
+type DeviceExporter interface {
+	// ExportDevice writes the audit export of the device to w. It fails before writing anything
+	// when the device cannot be exported.
+	ExportDevice(ctx context.Context, id string, w io.Writer) error
+	// ExportKey returns the export key verifying the manifests.
+	ExportKey() ExportKey
+}
+
+// ExportKey is the public part of the export key of the service.
+type ExportKey struct {
+	// PublicKey is PEM encoded
+	PublicKey []byte
+	// Fingerprint identifies the key in the manifests, see bundle.Fingerprint
+	Fingerprint string
+}
+
+type Service struct {
+	store     store.Store
+	signer    crypto.Signer
+	verifier  crypto.Verifier
+	exportKey ExportKey
+}
+
+// New returns a Service signing the manifests with privateKey, a PEM encoded ECC private key.
+func New(store store.Store, privateKey []byte) (*Service, error) {
+	marshaler := crypto.NewECCMarshaler()
+	keyPair, err := marshaler.Decode(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding export key: %w", err)
+	}
+	publicKey, _, err := marshaler.Encode(*keyPair)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding export key: %w", err)
+	}
+	fingerprint, err := bundle.Fingerprint(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding export key: %w", err)
+	}
+	verifier, err := crypto.ECCVerifierFactory(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding export key: %w", err)
+	}
+
+	return &Service{
+		store:     store,
+		signer:    &crypto.ECCSigner{KeyPair: keyPair},
+		verifier:  verifier,
+		exportKey: ExportKey{PublicKey: publicKey, Fingerprint: fingerprint},
+	}, nil
+}
+
+func (s *Service) ExportKey() ExportKey {
+	return s.exportKey
+}
+
+// CheckKey is a health check of the export key: it signs a probe with it and verifies the signature
+// against the public key the manifests are checked with.
+func (s *Service) CheckKey(ctx context.Context) error {
+	digest := sha256.Sum256([]byte("export key check"))
+	signed, err := s.signer.Sign(digest[:])
+	if err != nil {
+		return fmt.Errorf("error signing with export key: %w", err)
+	}
+	if err := s.verifier.Verify(digest[:], signed); err != nil {
+		return fmt.Errorf("error verifying with export key: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) ExportDevice(ctx context.Context, id string, w io.Writer) error {
+	signDevice, err := s.store.GetSignatureDevice(ctx, id)
+	if err != nil {
+		return fromStoreError(err, "error getting signature device")
+	}
+	parameters, err := bundle.ParametersFor(signDevice.SignatureAlg)
+	if err != nil {
+		return &signature.Error{Code: signature.CodeUnsupportedAlgorithm, Message: "signature device cannot be exported", Err: err}
+	}
+	publicKeys, err := s.store.ListPublicKeys(ctx, id)
+	if err != nil {
+		return fromStoreError(err, "error listing public keys")
+	}
+
+	device := bundle.Device{
+		FormatVersion:    bundle.FormatVersion,
+		ID:               signDevice.ID,
+		SignatureAlg:     signDevice.SignatureAlg,
+		Parameters:       parameters,
+		PublicKeys:       []bundle.PublicKey{},
+		Label:            signDevice.Label,
+		Metadata:         signDevice.Metadata,
+		Tags:             signDevice.Tags,
+		Status:           signDevice.Status,
+		SignatureCounter: signDevice.SignatureCounter,
+	}
+	for _, publicKey := range publicKeys {
+		device.PublicKeys = append(device.PublicKeys, bundle.PublicKey{
+			KeyVersion: publicKey.KeyVersion,
+			PublicKey:  string(publicKey.PublicKey),
+			CreatedAt:  &publicKey.CreatedAt,
+		})
+	}
+
+	archive := bundle.NewArchiveWriter(w, bundle.Manifest{
+		DeviceID:  id,
+		CreatedAt: time.Now().UTC(),
+		ExportKey: s.exportKey.Fingerprint,
+	})
+	if err := writeDevice(archive, device); err != nil {
+		return err
+	}
+	// signatures made since the device was read are left out, so that the archive is consistent
+	signatures, err := writeSignatures(ctx, archive, s.store, id, signDevice.SignatureCounter)
+	if err != nil {
+		return err
+	}
+	if err := archive.Close(s.signer); err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "signature device exported",
+		slog.String("event", "device.exported"),
+		slog.String("device_id", id),
+		slog.Int("signatures", signatures),
+		slog.String("export_key", s.exportKey.Fingerprint),
+	)
+
+	return nil
+}
+
+func writeDevice(archive *bundle.ArchiveWriter, device bundle.Device) error {
+	w, err := archive.Create(bundle.DeviceFile)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(device); err != nil {
+		return fmt.Errorf("error writing %v: %w", bundle.DeviceFile, err)
+	}
+
+	return nil
+}
+
+// writeSignatures writes the signatures with a counter below count, and returns how many there are.
+func writeSignatures(ctx context.Context, archive *bundle.ArchiveWriter, s store.Store, id string, count int) (int, error) {
+	w, err := archive.Create(bundle.SignaturesFile)
+	if err != nil {
+		return 0, err
+	}
+	buffered := bufio.NewWriter(w)
+
+	written := 0
+	err = s.ScanSignatures(ctx, id, func(record store.SignatureRecord) error {
+		if record.SignatureCounter >= count {
+			return nil
+		}
+		// signatures recorded without their signed data are exported as they are: they do not verify
+		var dataToBeSigned string
+		if securedData, err := signature.ParseSecuredData(record.SignedData); err == nil {
+			dataToBeSigned = securedData.Data
+		}
+		written++
+		return bundle.EncodeRecord(buffered, bundle.Record{
+			SignatureCounter: record.SignatureCounter,
+			KeyVersion:       record.KeyVersion,
+			DataToBeSigned:   dataToBeSigned,
+			SignedData:       record.SignedData,
+			Signature:        record.Signature,
+			CreatedAt:        &record.CreatedAt,
+		})
+	})
+	if err != nil {
+		return 0, fromStoreError(err, fmt.Sprintf("error writing %v", bundle.SignaturesFile))
+	}
+	if err := buffered.Flush(); err != nil {
+		return 0, fmt.Errorf("error writing %v: %w", bundle.SignaturesFile, err)
+	}
+
+	return written, nil
+}
+
+func fromStoreError(err error, message string) error {
+	if errors.Is(err, store.ErrDeviceNotFound) {
+		return &signature.Error{Code: signature.CodeNotFound, Message: "signature device not found", Err: err}
+	}
+
+	return fmt.Errorf("%v: %w", message, err)
+}
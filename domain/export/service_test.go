@@ -0,0 +1,87 @@
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/bundle"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/keygen"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/storestub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRejectsInvalidExportKeys(t *testing.T) {
+	_, rsaKey, err := keygen.RSA()
+	require.NoError(t, err)
+
+	for name, privateKey := range map[string][]byte{"empty": nil, "RSA": rsaKey, "public key": []byte("-----BEGIN PUBLIC KEY-----\n-----END PUBLIC KEY-----\n")} {
+		t.Run(name, func(t *testing.T) {
+			_, err := export.New(storestub.New(), privateKey)
+			assert.ErrorContains(t, err, "error decoding export key")
+		})
+	}
+}
+
+func TestExportKeyFingerprintMatchesPublicKey(t *testing.T) {
+	exportKey := servicetest.New(t, servicetest.WithStore(storestub.New()), servicetest.WithExports()).Exporter.ExportKey()
+
+	fingerprint, err := bundle.Fingerprint(exportKey.PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint, exportKey.Fingerprint)
+}
+
+func TestCheckKeyPasses(t *testing.T) {
+	assert.NoError(t, servicetest.New(t, servicetest.WithStore(storestub.New()), servicetest.WithExports()).Exporter.CheckKey(context.Background()))
+}
+
+func TestExportOfUnknownDeviceWritesNothing(t *testing.T) {
+	s := storestub.New()
+	s.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{}, store.ErrDeviceNotFound
+	}
+
+	exported := &bytes.Buffer{}
+	err := servicetest.New(t, servicetest.WithStore(s), servicetest.WithExports()).Exporter.ExportDevice(context.Background(), "some-id", exported)
+	assert.ErrorIs(t, err, signature.ErrNotFound)
+	assert.Zero(t, exported.Len())
+}
+
+func TestExportLeavesOutSignaturesMadeDuringTheExport(t *testing.T) {
+	publicKey, _, err := keygen.ECC()
+	require.NoError(t, err)
+	s := storestub.New()
+	s.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{ID: id, SignatureAlg: "ECC", SignatureCounter: 2, PublicKey: publicKey, KeyVersion: 1}, nil
+	}
+	s.ListPublicKeysFn = func(ctx context.Context, id string) ([]store.PublicKeyRecord, error) {
+		return []store.PublicKeyRecord{{DeviceID: id, KeyVersion: 1, PublicKey: publicKey}}, nil
+	}
+	s.ScanSignaturesFn = func(ctx context.Context, id string, fn func(store.SignatureRecord) error) error {
+		for counter := 0; counter < 3; counter++ {
+			signature := fmt.Sprintf("signature-%v", counter)
+			if err := fn(store.SignatureRecord{DeviceID: id, SignatureCounter: counter, KeyVersion: 1, SignedData: fmt.Sprintf("%v_data_previous", counter), Signature: signature}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	service := servicetest.New(t, servicetest.WithStore(s), servicetest.WithExports()).Exporter
+	exported := &bytes.Buffer{}
+	require.NoError(t, service.ExportDevice(context.Background(), "some-id", exported))
+
+	report, err := bundle.VerifyArchive(bytes.NewReader(exported.Bytes()), int64(exported.Len()), service.ExportKey().PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Signatures)
+	// the stubbed signatures are not valid, but the manifest is
+	for _, finding := range report.Findings {
+		assert.NotContains(t, []string{bundle.KindTamperedFile, bundle.KindInvalidManifest, bundle.KindTamperedData}, finding.Kind, finding.Detail)
+	}
+}
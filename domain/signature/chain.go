@@ -0,0 +1,89 @@
+package signature
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+)
+
+// ChainError tells which signature of a chain failed verification, and why.
+type ChainError struct {
+	Index  int
+	Reason string
+	Err    error
+}
+
+func (e *ChainError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("signature %v: %v", e.Index, e.Reason)
+	}
+	return fmt.Sprintf("signature %v: %v: %v", e.Index, e.Reason, e.Err)
+}
+
+func (e *ChainError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyChain checks offline that signatures, in the order they were made by the device deviceID,
+// are valid for the public key of verifier and form a chain: the counters follow each other, and
+// every signed data ends with the previous signature. A chain starting at counter 0 must start from
+// the encoded device ID; a chain starting later is checked from its first signature on.
+func VerifyChain(deviceID string, verifier crypto.Verifier, signatures []Signature) error {
+	chain := NewChainVerifier(deviceID)
+	for _, signature := range signatures {
+		if err := chain.Verify(verifier, signature); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ChainVerifier checks a chain of signatures as VerifyChain does, one signature at a time, so that
+// long chains do not have to be held in memory. Each signature is checked with its own verifier, for
+// chains spanning key rotations.
+type ChainVerifier struct {
+	deviceID          string
+	index             int
+	previous          *SecuredData
+	previousSignature string
+}
+
+func NewChainVerifier(deviceID string) *ChainVerifier {
+	return &ChainVerifier{deviceID: deviceID}
+}
+
+// Verify checks the next signature of the chain. Once it failed, the chain is not checked any further.
+func (c *ChainVerifier) Verify(verifier crypto.Verifier, signature Signature) error {
+	i := c.index
+	c.index++
+
+	securedData, err := ParseSecuredData(signature.SignedData)
+	if err != nil {
+		return &ChainError{Index: i, Reason: "invalid signed data", Err: err}
+	}
+
+	switch {
+	case c.previous != nil && securedData.SignatureCounter != c.previous.SignatureCounter+1:
+		return &ChainError{Index: i, Reason: fmt.Sprintf("signature counter %v does not follow %v", securedData.SignatureCounter, c.previous.SignatureCounter)}
+	case c.previous != nil && securedData.LastSignature != c.previousSignature:
+		return &ChainError{Index: i, Reason: "signed data does not chain from the previous signature"}
+	case c.previous == nil && securedData.SignatureCounter == 0 && securedData.LastSignature != base64.StdEncoding.EncodeToString([]byte(c.deviceID)):
+		return &ChainError{Index: i, Reason: fmt.Sprintf("first signature does not chain from the device ID '%v'", c.deviceID)}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return &ChainError{Index: i, Reason: "signature is not base64 encoded", Err: err}
+	}
+	digest := sha256.Sum256([]byte(signature.SignedData))
+	if err := verifier.Verify(digest[:], decoded); err != nil {
+		return &ChainError{Index: i, Reason: "signature does not verify", Err: err}
+	}
+
+	c.previous = &securedData
+	c.previousSignature = signature.Signature
+	return nil
+}
@@ -0,0 +1,82 @@
+package signature_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/keygen"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signChain signs n transactions with a new ECC device, and returns its signatures and verifier.
+func signChain(t *testing.T, id string, n int) ([]signature.Signature, crypto.Verifier) {
+	t.Helper()
+	ctx := context.Background()
+
+	service := signature.New(inmemory.New(), map[string]signature.KeyGenerator{
+		"ECC": keygen.ECC,
+	}, map[string]crypto.SignerFactory{
+		"ECC": crypto.ECCSignerFactory,
+	})
+	device, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: id, Tenant: "some-tenant", SignatureAlg: "ECC"})
+	require.NoError(t, err)
+
+	signatures := []signature.Signature{}
+	for i := 0; i < n; i++ {
+		signed, err := service.SignData(ctx, id, fmt.Sprintf("transaction_%v", i))
+		require.NoError(t, err)
+		signatures = append(signatures, signed)
+	}
+	verifier, err := crypto.ECCVerifierFactory(device.PublicKey)
+	require.NoError(t, err)
+
+	return signatures, verifier
+}
+
+func TestVerifyChain(t *testing.T) {
+	signatures, verifier := signChain(t, "some-id", 5)
+	_, otherVerifier := signChain(t, "other-id", 1)
+
+	reordered := append([]signature.Signature{}, signatures...)
+	reordered[1], reordered[2] = reordered[2], reordered[1]
+	tampered := append([]signature.Signature{}, signatures...)
+	tampered[3].SignedData = "3_other-data_" + signatures[2].Signature
+
+	tests := []struct {
+		name       string
+		deviceID   string
+		verifier   crypto.Verifier
+		signatures []signature.Signature
+		index      int
+		reason     string
+	}{
+		{name: "complete chain", deviceID: "some-id", verifier: verifier, signatures: signatures, index: -1},
+		{name: "chain starting later", deviceID: "some-id", verifier: verifier, signatures: signatures[2:], index: -1},
+		{name: "empty chain", deviceID: "some-id", verifier: verifier, signatures: nil, index: -1},
+		{name: "other device ID", deviceID: "other-id", verifier: verifier, signatures: signatures, index: 0, reason: "first signature does not chain from the device ID 'other-id'"},
+		{name: "gap", deviceID: "some-id", verifier: verifier, signatures: append(append([]signature.Signature{}, signatures[:2]...), signatures[3:]...), index: 2, reason: "signature counter 3 does not follow 1"},
+		{name: "reordered", deviceID: "some-id", verifier: verifier, signatures: reordered, index: 1, reason: "signature counter 2 does not follow 0"},
+		{name: "tampered data", deviceID: "some-id", verifier: verifier, signatures: tampered, index: 3, reason: "signature does not verify"},
+		{name: "other key", deviceID: "some-id", verifier: otherVerifier, signatures: signatures, index: 0, reason: "signature does not verify"},
+		{name: "invalid signed data", deviceID: "some-id", verifier: verifier, signatures: []signature.Signature{{SignedData: "garbage"}}, index: 0, reason: "invalid signed data"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := signature.VerifyChain(tc.deviceID, tc.verifier, tc.signatures)
+			if tc.index < 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var chainErr *signature.ChainError
+			require.ErrorAs(t, err, &chainErr)
+			assert.Equal(t, tc.index, chainErr.Index)
+			assert.Equal(t, tc.reason, chainErr.Reason)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package signature
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Code is a stable identifier of a class of domain errors, meant for clients to switch on.
+type Code string
+
+const (
+	CodeNotFound             Code = "not_found"
+	CodeInvalidInput         Code = "invalid_input"
+	CodeConflict             Code = "conflict"
+	CodeDeviceInactive       Code = "device_inactive"
+	CodeUnsupportedAlgorithm Code = "unsupported_algorithm"
+	CodeVersionMismatch      Code = "version_mismatch"
+	CodeInternal             Code = "internal"
+)
+
+// Sentinel errors to be matched with errors.Is: any *Error with the same Code matches them.
+var (
+	ErrNotFound             = &Error{Code: CodeNotFound, Message: "signature device not found"}
+	ErrInvalidInput         = &Error{Code: CodeInvalidInput, Message: "invalid input"}
+	ErrConflict             = &Error{Code: CodeConflict, Message: "conflicting signature device state"}
+	ErrDeviceInactive       = &Error{Code: CodeDeviceInactive, Message: "signature device is not active"}
+	ErrUnsupportedAlgorithm = &Error{Code: CodeUnsupportedAlgorithm, Message: "unsupported signature algorithm"}
+	ErrVersionMismatch      = &Error{Code: CodeVersionMismatch, Message: "signature device version does not match"}
+)
+
+// Error is the error type returned by the signature domain.
+type Error struct {
+	Code    Code
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%v: %v", e.Message, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is a domain error with the same Code.
+func (e *Error) Is(target error) bool {
+	var domainErr *Error
+	if !errors.As(target, &domainErr) {
+		return false
+	}
+	return domainErr.Code == e.Code
+}
+
+func newError(code Code, message string, err error) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// ErrorCode returns the Code of the domain error wrapped by err, or CodeInternal if there is none.
+func ErrorCode(err error) Code {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr.Code
+	}
+	return CodeInternal
+}
@@ -0,0 +1,65 @@
+package signature
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// Types of the events published by the Service. They match the event field of the audit log entries.
+const (
+	EventDeviceCreated    = "device.created"
+	EventDeviceUpdated    = "device.updated"
+	EventDeviceDeleted    = "device.deleted"
+	EventDeviceKeyRotated = "device.key_rotated"
+	EventSignatureCreated = "signature.created"
+)
+
+// Publisher receives the changes of signature devices once they are persisted. The data of device
+// events is the SignatureDevice after the change, while signature events carry a SignatureCreated.
+// The changes of a device are published in the order they were written. Implementations must be
+// safe for concurrent use and must not block.
+type Publisher interface {
+	Publish(deviceID string, eventType string, data any)
+}
+
+// SignatureCreated describes a signature in the events stream. The signed data is left out,
+// since it may carry customer payload.
+type SignatureCreated struct {
+	DeviceID         string
+	SignatureCounter int
+	Signature        string
+}
+
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(string, string, any) {}
+
+// commitLockStripes is how many locks the devices share to publish their changes in order.
+const commitLockStripes = 64
+
+// commitLocks serialize, per device, the write of a change with the publication of its event.
+type commitLocks [commitLockStripes]sync.Mutex
+
+func (l *commitLocks) lock(deviceID string) (unlock func()) {
+	hash := fnv.New32a()
+	hash.Write([]byte(deviceID))
+	lock := &l[hash.Sum32()%commitLockStripes]
+	lock.Lock()
+	return lock.Unlock
+}
+
+// commit applies write, a change of the device with the given ID, and publishes the event data
+// write returns when it succeeds, both under the commit lock of the device. A later change of the
+// device is computed from the state write left, so it is written, and published, once the lock is
+// released: concurrent changes cannot overtake each other in the events stream.
+func (s *Service) commit(deviceID string, eventType string, write func() (any, error)) error {
+	unlock := s.commitLocks.lock(deviceID)
+	defer unlock()
+
+	data, err := write()
+	if err != nil {
+		return err
+	}
+	s.publisher.Publish(deviceID, eventType, data)
+	return nil
+}
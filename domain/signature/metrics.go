@@ -0,0 +1,32 @@
+package signature
+
+import "time"
+
+// Metrics receives instrumentation events emitted by the Service.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// DeviceCreated is called once a signature device has been persisted.
+	DeviceCreated(signatureAlg string)
+	// DeviceDeleted is called once a signature device has been deleted.
+	DeviceDeleted(signatureAlg string)
+	// KeyPairGenerated is called after a key pair generation attempt.
+	KeyPairGenerated(signatureAlg string, duration time.Duration)
+	// SignatureCreated is called once a signature has been persisted.
+	SignatureCreated(signatureAlg string)
+	// SignConflict is called every time SignData hits an optimistic lock conflict.
+	SignConflict(signatureAlg string)
+	// SignRetries is called with the number of retries a SignData call needed.
+	SignRetries(signatureAlg string, retries int)
+	// SignerCacheLookup is called every time SignData looks up a parsed signer, telling whether it was cached.
+	SignerCacheLookup(signatureAlg string, hit bool)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) DeviceCreated(string)                   {}
+func (noopMetrics) DeviceDeleted(string)                   {}
+func (noopMetrics) KeyPairGenerated(string, time.Duration) {}
+func (noopMetrics) SignatureCreated(string)                {}
+func (noopMetrics) SignConflict(string)                    {}
+func (noopMetrics) SignRetries(string, int)                {}
+func (noopMetrics) SignerCacheLookup(string, bool)         {}
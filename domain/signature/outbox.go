@@ -0,0 +1,63 @@
+package signature
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/google/uuid"
+)
+
+// outboxDevice is the payload of the device outbox events. It never carries key material
+// other than the public key.
+type outboxDevice struct {
+	ID               string            `json:"id"`
+	SignatureAlg     string            `json:"signature_alg"`
+	Label            string            `json:"label"`
+	Metadata         map[string]string `json:"metadata"`
+	Tags             []string          `json:"tags"`
+	SignatureCounter int               `json:"signature_counter"`
+	PublicKey        string            `json:"public_key"`
+	Status           string            `json:"status"`
+	KeyVersion       int               `json:"key_version"`
+}
+
+// outboxSignature is the payload of the signature outbox events. Unlike the in-process events,
+// it carries the signed data: webhooks are delivered to the tenant owning it, which needs it
+// to archive the signature.
+type outboxSignature struct {
+	DeviceID         string `json:"device_id"`
+	SignatureCounter int    `json:"signature_counter"`
+	Signature        string `json:"signature"`
+	SignedData       string `json:"signed_data"`
+}
+
+func deviceOutboxEvent(eventType string, signDevice store.SignatureDevice) (store.OutboxEvent, error) {
+	return newOutboxEvent(signDevice.Tenant, eventType, signDevice.ID, outboxDevice{
+		ID:               signDevice.ID,
+		SignatureAlg:     signDevice.SignatureAlg,
+		Label:            signDevice.Label,
+		Metadata:         signDevice.Metadata,
+		Tags:             signDevice.Tags,
+		SignatureCounter: signDevice.SignatureCounter,
+		PublicKey:        string(signDevice.PublicKey),
+		Status:           signDevice.Status,
+		KeyVersion:       signDevice.KeyVersion,
+	})
+}
+
+func newOutboxEvent(tenant string, eventType string, deviceID string, payload any) (store.OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return store.OutboxEvent{}, err
+	}
+
+	return store.OutboxEvent{
+		ID:        uuid.NewString(),
+		Tenant:    tenant,
+		Type:      eventType,
+		DeviceID:  deviceID,
+		Payload:   data,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
@@ -0,0 +1,49 @@
+package signature
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SecuredData is what a signature is computed over: <signature_counter>_<data_to_be_signed>_<last_signature_base64>.
+type SecuredData struct {
+	SignatureCounter int
+	Data             string
+	// LastSignature is base64 encoded, the encoded device ID for the first signature of a device
+	LastSignature string
+}
+
+func (d SecuredData) String() string {
+	return fmt.Sprintf("%v_%v_%v", d.SignatureCounter, d.Data, d.LastSignature)
+}
+
+// ParseSecuredData splits signed data back into its parts. The data itself may contain underscores:
+// the counter ends at the first one and the last signature, which base64 never contains, starts
+// after the last one.
+func ParseSecuredData(signedData string) (SecuredData, error) {
+	counter, rest, found := strings.Cut(signedData, "_")
+	if !found {
+		return SecuredData{}, newError(CodeInvalidInput, "signed data has no signature counter", nil)
+	}
+	last := strings.LastIndex(rest, "_")
+	if last < 0 {
+		return SecuredData{}, newError(CodeInvalidInput, "signed data has no last signature", nil)
+	}
+
+	signatureCounter, err := strconv.Atoi(counter)
+	if err != nil || signatureCounter < 0 || strconv.Itoa(signatureCounter) != counter {
+		return SecuredData{}, newError(CodeInvalidInput, fmt.Sprintf("invalid signature counter '%v'", counter), nil)
+	}
+	lastSignature := rest[last+1:]
+	if _, err := base64.StdEncoding.DecodeString(lastSignature); err != nil || lastSignature == "" {
+		return SecuredData{}, newError(CodeInvalidInput, "last signature is not base64 encoded", err)
+	}
+
+	return SecuredData{
+		SignatureCounter: signatureCounter,
+		Data:             rest[:last],
+		LastSignature:    lastSignature,
+	}, nil
+}
@@ -0,0 +1,97 @@
+package signature_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSecuredData(t *testing.T) {
+	tests := []struct {
+		name       string
+		signedData string
+		expected   signature.SecuredData
+		errMsg     string
+	}{
+		{
+			name:       "first signature",
+			signedData: "0_some-data_ZGV2aWNlLTE=",
+			expected:   signature.SecuredData{SignatureCounter: 0, Data: "some-data", LastSignature: "ZGV2aWNlLTE="},
+		},
+		{
+			name:       "data with underscores",
+			signedData: "12_a_b__c_c2lnbmF0dXJl",
+			expected:   signature.SecuredData{SignatureCounter: 12, Data: "a_b__c", LastSignature: "c2lnbmF0dXJl"},
+		},
+		{
+			name:       "empty data",
+			signedData: "3__c2lnbmF0dXJl",
+			expected:   signature.SecuredData{SignatureCounter: 3, Data: "", LastSignature: "c2lnbmF0dXJl"},
+		},
+		{name: "no separator", signedData: "0", errMsg: "signed data has no signature counter"},
+		{name: "no last signature", signedData: "0_data", errMsg: "signed data has no last signature"},
+		{name: "negative counter", signedData: "-1_data_c2lnbmF0dXJl", errMsg: "invalid signature counter '-1'"},
+		{name: "padded counter", signedData: "01_data_c2lnbmF0dXJl", errMsg: "invalid signature counter '01'"},
+		{name: "empty last signature", signedData: "0_data_", errMsg: "last signature is not base64 encoded"},
+		{name: "invalid last signature", signedData: "0_data_not-base64", errMsg: "last signature is not base64 encoded"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			securedData, err := signature.ParseSecuredData(tc.signedData)
+			if tc.errMsg != "" {
+				assert.ErrorIs(t, err, signature.ErrInvalidInput)
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, securedData)
+			assert.Equal(t, tc.signedData, securedData.String())
+		})
+	}
+}
+
+func FuzzParseSecuredData(f *testing.F) {
+	f.Add("0_some-data_ZGV2aWNlLTE=")
+	f.Add("12_a_b__c_c2lnbmF0dXJl")
+	f.Add("0__")
+	f.Add("_")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, signedData string) {
+		securedData, err := signature.ParseSecuredData(signedData)
+		if err != nil {
+			return
+		}
+		if securedData.String() != signedData {
+			t.Fatalf("parsed %q into %+v, which formats as %q", signedData, securedData, securedData.String())
+		}
+	})
+}
+
+func FuzzSecuredDataRoundTrip(f *testing.F) {
+	f.Add(0, "some-data", []byte("device-1"))
+	f.Add(42, "a_b_c", []byte{0xff, 0x00})
+
+	f.Fuzz(func(t *testing.T, signatureCounter int, data string, lastSignature []byte) {
+		if signatureCounter < 0 || len(lastSignature) == 0 {
+			t.Skip()
+		}
+		securedData := signature.SecuredData{
+			SignatureCounter: signatureCounter,
+			Data:             data,
+			LastSignature:    base64.StdEncoding.EncodeToString(lastSignature),
+		}
+
+		parsed, err := signature.ParseSecuredData(securedData.String())
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", securedData.String(), err)
+		}
+		if parsed != securedData {
+			t.Fatalf("parsed %+v, expected %+v", parsed, securedData)
+		}
+	})
+}
@@ -4,16 +4,47 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
 	"github.com/go-playground/validator"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature")
+
+// DefaultTenant is the tenant every request acts on, until requests get authenticated.
+const DefaultTenant = "1"
+
+// maxSignAttempts bounds how many times SignData retries after an optimistic lock conflict, which
+// only a write from outside the service causes.
+const maxSignAttempts = 10
+
 type SignatureDeviceService interface {
-	CreateSignatureDevice(ctx context.Context, newSignDev NewSignatureDevice) error
+	// CreateSignatureDevice creates a device and reports whether it was created by this call:
+	// creating again a device identical to an existing one is an idempotent replay returning
+	// the existing device, while any difference is a conflict.
+	CreateSignatureDevice(ctx context.Context, newSignDev NewSignatureDevice) (SignatureDevice, bool, error)
 	GetSignatureDevice(ctx context.Context, id string) (SignatureDevice, error)
+	// UpdateSignatureDevice changes the user editable fields of the device, provided it is still at version.
+	UpdateSignatureDevice(ctx context.Context, id string, update UpdateSignatureDevice, version string) (SignatureDevice, error)
+	// RotateSignatureDeviceKey replaces the key pair of the device, provided it is still at version.
+	// The signature counter and the chain of signatures carry on.
+	RotateSignatureDeviceKey(ctx context.Context, id string, version string) (SignatureDevice, error)
+	// DeleteSignatureDevice deletes the device, provided it is still at version.
+	DeleteSignatureDevice(ctx context.Context, id string, version string) error
+	// ListSignatureDevices returns the devices matching filter, ordered by ID.
+	ListSignatureDevices(ctx context.Context, filter ListFilter) ([]SignatureDevice, error)
 	SignData(ctx context.Context, id string, dataToSign string) (Signature, error)
 }
 
@@ -24,13 +55,40 @@ type NewSignatureDevice struct {
 	Tenant string `validate:"required"`
 	SignatureAlg string `validate:"required,oneof=ECC RSA"`
 	Label string
+	Metadata map[string]string `validate:"max=16,dive,keys,min=1,max=64,endkeys,max=256"`
+	Tags []string `validate:"max=16,unique,dive,min=1,max=64"`
 }
 
 type SignatureDevice struct {
 	ID string // are these unique or should we have our own IDs?
 	SignatureAlg string
 	Label string
+	Metadata map[string]string
+	Tags []string
 	SignatureCounter int
+	PublicKey []byte
+	Status string
+	// KeyVersion identifies the key pair of the device, incremented by every key rotation.
+	KeyVersion int
+	Version string
+}
+
+// ListFilter selects the devices carrying all the given tags and metadata entries.
+type ListFilter struct {
+	Tags []string
+	Metadata map[string]string
+}
+
+// UpdateSignatureDevice holds the fields a client may change; nil fields are left untouched.
+// The signature counter is deliberately absent: it is only modified by signing.
+type UpdateSignatureDevice struct {
+	Label *string
+	// Metadata is merged into the existing entries: a nil value removes the entry.
+	Metadata map[string]*string
+	// Tags replace the existing tags when not nil.
+	Tags []string
+	// Status suspends the device or reactivates it: suspended devices cannot sign.
+	Status *string
 }
 
 type Signature struct {
@@ -42,97 +100,573 @@ type Service struct {
 	store store.Store
 	keyGenerators map[string]KeyGenerator
 	signers map[string]crypto.SignerFactory // TODO: should be on the same structure with key generators in order to prevent misalignment
+	metrics Metrics
+	publisher Publisher
+	signerCache *signerCache // nil when disabled
+	commitLocks commitLocks
+}
+
+// Option configures optional collaborators of the Service.
+type Option func(*Service)
+
+// WithPublisher makes the Service publish the changes of signature devices to publisher.
+func WithPublisher(publisher Publisher) Option {
+	return func(s *Service) {
+		s.publisher = publisher
+	}
 }
 
-func (s *Service) CreateSignatureDevice(ctx context.Context, newSignDev NewSignatureDevice) error {
+// WithSignerCacheSize bounds how many parsed signers the Service keeps, instead of decoding the
+// private key of a device for every signature. Zero disables the cache.
+func WithSignerCacheSize(size int) Option {
+	return func(s *Service) {
+		s.signerCache = nil
+		if size > 0 {
+			s.signerCache = newSignerCache(size)
+		}
+	}
+}
+
+// WithMetrics makes the Service report instrumentation events to metrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(s *Service) {
+		s.metrics = metrics
+	}
+}
+
+func (s *Service) CreateSignatureDevice(ctx context.Context, newSignDev NewSignatureDevice) (_ SignatureDevice, created bool, err error) {
+	ctx, span := tracer.Start(ctx, "signature.CreateSignatureDevice", trace.WithAttributes(
+		attribute.String("device.id", newSignDev.ID),
+		attribute.String("device.signature_alg", newSignDev.SignatureAlg),
+	))
+	defer func() { endSpan(span, err) }()
+
 	validate := validator.New()
 	if err := validate.Struct(newSignDev); err != nil {
-		return err
+		return SignatureDevice{}, false, newError(CodeInvalidInput, "invalid signature device", err)
+	}
+
+	// a replayed request gets the device it created, without generating keys it would throw away
+	existing, err := s.store.GetSignatureDevice(ctx, newSignDev.ID)
+	if err == nil {
+		device, err := replayCreation(existing, newSignDev)
+		return device, false, err
+	}
+	if !errors.Is(err, store.ErrDeviceNotFound) {
+		return SignatureDevice{}, false, fromStoreError(err, "error getting existing signature device")
 	}
 
 	var publicKey []byte
 	var privateKey []byte
-	var err error
 	if keyGenerator, found := s.keyGenerators[newSignDev.SignatureAlg]; found {
-		publicKey, privateKey, err = keyGenerator()
+		publicKey, privateKey, err = s.generateKeyPair(ctx, newSignDev.SignatureAlg, keyGenerator)
 		if err != nil {
-			return fmt.Errorf("error while generating a new key pair: %w", err)
+			return SignatureDevice{}, false, fmt.Errorf("error while generating a new key pair: %w", err)
 		}
 	} else {
-		return fmt.Errorf("missing key pair generator for algorithm '%v'", newSignDev.SignatureAlg)
+		return SignatureDevice{}, false, newError(CodeUnsupportedAlgorithm, fmt.Sprintf("missing key pair generator for algorithm '%v'", newSignDev.SignatureAlg), nil)
 	}
 
-	err = s.store.CreateSignatureDevice(ctx, store.SignatureDevice{
+	signDevice := store.SignatureDevice{
 		ID: newSignDev.ID,
 		Tenant: newSignDev.Tenant,
 		SignatureAlg: newSignDev.SignatureAlg,
 		Label: newSignDev.Label,
+		Metadata: newSignDev.Metadata,
+		Tags: newSignDev.Tags,
 		PublicKey: publicKey,
 		PrivateKey: privateKey,
 		SignatureCounter: 0,
 		LastSignature: base64.StdEncoding.EncodeToString([]byte(newSignDev.ID)),
+		Status: store.StatusActive,
+		KeyVersion: 1,
+	}
+	outboxEvent, err := deviceOutboxEvent(EventDeviceCreated, signDevice)
+	if err != nil {
+		return SignatureDevice{}, false, fmt.Errorf("error creating outbox event: %w", err)
+	}
+	err = s.commit(newSignDev.ID, EventDeviceCreated, func() (any, error) {
+		return toSignatureDevice(signDevice), s.store.CreateSignatureDevice(ctx, signDevice, outboxEvent)
 	})
+	if errors.Is(err, store.ErrDeviceExists) {
+		// created concurrently since the lookup
+		existing, err := s.store.GetSignatureDevice(ctx, newSignDev.ID)
+		if err != nil {
+			return SignatureDevice{}, false, fromStoreError(err, "error getting existing signature device")
+		}
+		device, err := replayCreation(existing, newSignDev)
+		return device, false, err
+	}
 	if err != nil {
-		return fmt.Errorf("error creating signature device: %w", err) // should be as domain error rather than store error
+		return SignatureDevice{}, false, fromStoreError(err, "error creating signature device")
 	}
+	s.metrics.DeviceCreated(newSignDev.SignatureAlg)
+	// audit entry: never add key material here
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "signature device created",
+		slog.String("event", "device.created"),
+		slog.String("device_id", newSignDev.ID),
+		slog.String("tenant", newSignDev.Tenant),
+		slog.String("signature_alg", newSignDev.SignatureAlg),
+		slog.String("label", newSignDev.Label),
+	)
 
-	return nil
+	return toSignatureDevice(signDevice), true, nil
+}
+
+// replayCreation returns the existing device when it matches the creation request, a conflict otherwise.
+func replayCreation(existing store.SignatureDevice, newSignDev NewSignatureDevice) (SignatureDevice, error) {
+	if existing.Tenant != newSignDev.Tenant || existing.SignatureAlg != newSignDev.SignatureAlg || existing.Label != newSignDev.Label ||
+		!maps.Equal(existing.Metadata, newSignDev.Metadata) || !slices.Equal(sortedTags(existing.Tags), sortedTags(newSignDev.Tags)) {
+		return SignatureDevice{}, newError(CodeConflict, fmt.Sprintf("a different signature device with id '%v' already exists", newSignDev.ID), store.ErrDeviceExists)
+	}
+
+	return toSignatureDevice(existing), nil
+}
+
+// sortedTags returns a sorted copy of tags, which are a set.
+func sortedTags(tags []string) []string {
+	sorted := slices.Clone(tags)
+	slices.Sort(sorted)
+	return sorted
+}
+
+func (s *Service) generateKeyPair(ctx context.Context, signatureAlg string, keyGenerator KeyGenerator) ([]byte, []byte, error) {
+	_, span := tracer.Start(ctx, "keygen.Generate", trace.WithAttributes(attribute.String("device.signature_alg", signatureAlg)))
+	start := time.Now()
+	publicKey, privateKey, err := keyGenerator()
+	s.metrics.KeyPairGenerated(signatureAlg, time.Since(start))
+	endSpan(span, err)
+
+	return publicKey, privateKey, err
 }
 
 func (s *Service) GetSignatureDevice(ctx context.Context, id string) (SignatureDevice, error) {
 	signDevice, err := s.store.GetSignatureDevice(ctx, id)
 	if err != nil {
-		return SignatureDevice{}, err // should be as domain error rather than store error
+		return SignatureDevice{}, fromStoreError(err, "error getting signature device")
+	}
+
+	return toSignatureDevice(signDevice), nil
+}
+
+func (s *Service) UpdateSignatureDevice(ctx context.Context, id string, update UpdateSignatureDevice, version string) (_ SignatureDevice, err error) {
+	ctx, span := tracer.Start(ctx, "signature.UpdateSignatureDevice", trace.WithAttributes(attribute.String("device.id", id)))
+	defer func() { endSpan(span, err) }()
+
+	current, err := s.store.GetSignatureDevice(ctx, id)
+	if err != nil {
+		return SignatureDevice{}, fromStoreError(err, "error getting signature device")
+	}
+	if current.Version != version {
+		return SignatureDevice{}, newError(CodeVersionMismatch, "signature device version does not match", nil)
+	}
+
+	updated := current.Clone()
+	if update.Label != nil {
+		updated.Label = *update.Label
+	}
+	updated.Metadata = mergeMetadata(current.Metadata, update.Metadata)
+	if update.Tags != nil {
+		updated.Tags = update.Tags
+	}
+	if update.Status != nil {
+		updated.Status = *update.Status
+	}
+	validate := validator.New()
+	// the patched collections are held to the limits of a new device
+	if err := validate.StructPartial(NewSignatureDevice{Metadata: updated.Metadata, Tags: updated.Tags}, "Metadata", "Tags"); err != nil {
+		return SignatureDevice{}, newError(CodeInvalidInput, "invalid signature device", err)
+	}
+	// devices created before the status was introduced have none, until one is set
+	if update.Status != nil {
+		if err := validate.Var(*update.Status, "oneof=active suspended"); err != nil {
+			return SignatureDevice{}, newError(CodeInvalidInput, "invalid signature device status", err)
+		}
+	}
+
+	outboxEvent, err := deviceOutboxEvent(EventDeviceUpdated, updated)
+	if err != nil {
+		return SignatureDevice{}, fmt.Errorf("error creating outbox event: %w", err)
+	}
+
+	// only the changed fields are sent, so that the device history records what the update was about
+	updateDetails := store.UpdateSignatureDeviceDetails{
+		Label: update.Label,
+		Status: update.Status,
+		Version: version,
+	}
+	if update.Metadata != nil {
+		updateDetails.Metadata = updated.Metadata
+	}
+	if update.Tags != nil {
+		updateDetails.Tags = updated.Tags
+	}
+	var signDevice store.SignatureDevice
+	err = s.commit(id, EventDeviceUpdated, func() (any, error) {
+		if err := s.store.UpdateSignatureDeviceDetails(ctx, id, updateDetails, outboxEvent); err != nil {
+			return nil, err
+		}
+		signDevice, err = s.store.GetSignatureDevice(ctx, id)
+		if err != nil {
+			return nil, fromStoreError(err, "error getting signature device")
+		}
+		return toSignatureDevice(signDevice), nil
+	})
+	if errors.Is(err, store.ErrVersionConflict) {
+		return SignatureDevice{}, newError(CodeVersionMismatch, "signature device version does not match", err)
+	}
+	if err != nil {
+		return SignatureDevice{}, fromStoreError(err, "error updating signature device")
+	}
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "signature device updated",
+		slog.String("event", "device.updated"),
+		slog.String("device_id", id),
+		slog.String("label", signDevice.Label),
+		slog.String("status", signDevice.Status),
+	)
+
+	return toSignatureDevice(signDevice), nil
+}
+
+func (s *Service) RotateSignatureDeviceKey(ctx context.Context, id string, version string) (_ SignatureDevice, err error) {
+	ctx, span := tracer.Start(ctx, "signature.RotateSignatureDeviceKey", trace.WithAttributes(attribute.String("device.id", id)))
+	defer func() { endSpan(span, err) }()
+
+	current, err := s.store.GetSignatureDevice(ctx, id)
+	if err != nil {
+		return SignatureDevice{}, fromStoreError(err, "error getting signature device")
+	}
+	if current.Version != version {
+		return SignatureDevice{}, newError(CodeVersionMismatch, "signature device version does not match", nil)
+	}
+
+	keyGenerator, found := s.keyGenerators[current.SignatureAlg]
+	if !found {
+		return SignatureDevice{}, newError(CodeUnsupportedAlgorithm, fmt.Sprintf("missing key pair generator for algorithm '%v'", current.SignatureAlg), nil)
+	}
+	publicKey, privateKey, err := s.generateKeyPair(ctx, current.SignatureAlg, keyGenerator)
+	if err != nil {
+		return SignatureDevice{}, fmt.Errorf("error while generating a new key pair: %w", err)
+	}
+
+	rotated := current.Clone()
+	rotated.PublicKey = publicKey
+	rotated.KeyVersion++
+	outboxEvent, err := deviceOutboxEvent(EventDeviceKeyRotated, rotated)
+	if err != nil {
+		return SignatureDevice{}, fmt.Errorf("error creating outbox event: %w", err)
+	}
+
+	var signDevice store.SignatureDevice
+	err = s.commit(id, EventDeviceKeyRotated, func() (any, error) {
+		err := s.store.RotateSignatureDeviceKey(ctx, id, store.RotateSignatureDeviceKey{
+			PublicKey: publicKey,
+			PrivateKey: privateKey,
+			Version: version,
+		}, outboxEvent)
+		if err != nil {
+			return nil, err
+		}
+		s.invalidateSigner(current)
+		signDevice, err = s.store.GetSignatureDevice(ctx, id)
+		if err != nil {
+			return nil, fromStoreError(err, "error getting signature device")
+		}
+		return toSignatureDevice(signDevice), nil
+	})
+	if errors.Is(err, store.ErrVersionConflict) {
+		return SignatureDevice{}, newError(CodeVersionMismatch, "signature device version does not match", err)
+	}
+	if err != nil {
+		return SignatureDevice{}, fromStoreError(err, "error rotating signature device key")
+	}
+	// audit entry: never add key material here
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "signature device key rotated",
+		slog.String("event", "device.key_rotated"),
+		slog.String("device_id", id),
+		slog.String("signature_alg", signDevice.SignatureAlg),
+		slog.Int("key_version", signDevice.KeyVersion),
+	)
+
+	return toSignatureDevice(signDevice), nil
+}
+
+// mergeMetadata applies patch to a copy of metadata following JSON merge patch semantics.
+func mergeMetadata(metadata map[string]string, patch map[string]*string) map[string]string {
+	merged := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = *value
+	}
+
+	return merged
+}
+
+func (s *Service) ListSignatureDevices(ctx context.Context, filter ListFilter) (_ []SignatureDevice, err error) {
+	ctx, span := tracer.Start(ctx, "signature.ListSignatureDevices")
+	defer func() { endSpan(span, err) }()
+
+	signDevices, err := s.store.ListSignatureDevices(ctx, store.ListFilter{
+		Tags: filter.Tags,
+		Metadata: filter.Metadata,
+	})
+	if err != nil {
+		return nil, fromStoreError(err, "error listing signature devices")
+	}
+
+	devices := make([]SignatureDevice, 0, len(signDevices))
+	for _, signDevice := range signDevices {
+		devices = append(devices, toSignatureDevice(signDevice))
+	}
+
+	return devices, nil
+}
+
+func (s *Service) DeleteSignatureDevice(ctx context.Context, id string, version string) (err error) {
+	ctx, span := tracer.Start(ctx, "signature.DeleteSignatureDevice", trace.WithAttributes(attribute.String("device.id", id)))
+	defer func() { endSpan(span, err) }()
+
+	signDevice, err := s.store.GetSignatureDevice(ctx, id)
+	if err != nil {
+		return fromStoreError(err, "error getting signature device")
 	}
 
+	outboxEvent, err := deviceOutboxEvent(EventDeviceDeleted, signDevice)
+	if err != nil {
+		return fmt.Errorf("error creating outbox event: %w", err)
+	}
+
+	err = s.commit(id, EventDeviceDeleted, func() (any, error) {
+		return toSignatureDevice(signDevice), s.store.DeleteSignatureDevice(ctx, id, version, outboxEvent)
+	})
+	if errors.Is(err, store.ErrVersionConflict) {
+		return newError(CodeVersionMismatch, "signature device version does not match", err)
+	}
+	if err != nil {
+		return fromStoreError(err, "error deleting signature device")
+	}
+	s.invalidateSigner(signDevice)
+	s.metrics.DeviceDeleted(signDevice.SignatureAlg)
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "signature device deleted",
+		slog.String("event", "device.deleted"),
+		slog.String("device_id", id),
+		slog.String("signature_alg", signDevice.SignatureAlg),
+		slog.Int("signature_counter", signDevice.SignatureCounter),
+	)
+
+	return nil
+}
+
+func toSignatureDevice(signDevice store.SignatureDevice) SignatureDevice {
 	return SignatureDevice{
 		ID: signDevice.ID,
 		SignatureAlg: signDevice.SignatureAlg,
 		Label: signDevice.Label,
-		SignatureCounter: 0,
-	}, nil
+		Metadata: signDevice.Metadata,
+		Tags: signDevice.Tags,
+		SignatureCounter: signDevice.SignatureCounter,
+		PublicKey: signDevice.PublicKey,
+		Status: signDevice.Status,
+		KeyVersion: signDevice.KeyVersion,
+		Version: signDevice.Version,
+	}
+}
+
+// SignData signs dataToSign with the device identified by id. Concurrent signatures on the
+// same device are serialized by the commit lock of the device, which is held from reading the
+// device to writing the signature. A write from outside the service, such as another instance
+// sharing the store, fails the store optimistic lock instead: the device is then read again and
+// the signature is recomputed on top of the new counter.
+func (s *Service) SignData(ctx context.Context, id string, dataToSign string) (_ Signature, err error) {
+	ctx, span := tracer.Start(ctx, "signature.SignData", trace.WithAttributes(attribute.String("device.id", id)))
+	defer func() { endSpan(span, err) }()
+
+	for attempt := 0; attempt < maxSignAttempts; attempt++ {
+		signature, signatureAlg, err := s.signData(ctx, id, dataToSign)
+		if errors.Is(err, store.ErrVersionConflict) {
+			logging.FromContext(ctx).DebugContext(ctx, "optimistic lock conflict while signing", slog.String("device_id", id), slog.Int("attempt", attempt))
+			span.AddEvent("optimistic lock conflict", trace.WithAttributes(attribute.Int("attempt", attempt)))
+			s.metrics.SignConflict(signatureAlg)
+			continue
+		}
+		if err != nil {
+			return Signature{}, err
+		}
+
+		span.SetAttributes(attribute.String("device.signature_alg", signatureAlg), attribute.Int("sign.retries", attempt))
+		s.metrics.SignatureCreated(signatureAlg)
+		s.metrics.SignRetries(signatureAlg, attempt)
+		return signature, nil
+	}
+
+	return Signature{}, newError(CodeConflict, fmt.Sprintf("error signing data: giving up after %v concurrent updates", maxSignAttempts), store.ErrVersionConflict)
+}
+
+// signer returns the signer of the current key pair of signDevice, only parsing its private key
+// when it is not cached.
+func (s *Service) signer(ctx context.Context, signDevice store.SignatureDevice, signerFactory crypto.SignerFactory) (crypto.Signer, error) {
+	key := signerKey{deviceID: signDevice.ID, keyVersion: signDevice.KeyVersion}
+	if s.signerCache != nil {
+		if signer, found := s.signerCache.get(key, signDevice.PrivateKey); found {
+			s.metrics.SignerCacheLookup(signDevice.SignatureAlg, true)
+			return signer, nil
+		}
+		s.metrics.SignerCacheLookup(signDevice.SignatureAlg, false)
+	}
+
+	_, factorySpan := tracer.Start(ctx, "crypto.SignerFactory")
+	signer, err := signerFactory(signDevice.PrivateKey)
+	endSpan(factorySpan, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.signerCache != nil {
+		s.signerCache.add(key, signDevice.PrivateKey, signer)
+	}
+	return signer, nil
 }
 
-func (s *Service) SignData(ctx context.Context, id string, dataToSign string) (Signature, error) {
+// invalidateSigner drops the cached signer of the key pair signDevice had, once it got rotated or deleted.
+func (s *Service) invalidateSigner(signDevice store.SignatureDevice) {
+	if s.signerCache != nil {
+		s.signerCache.invalidate(signerKey{deviceID: signDevice.ID, keyVersion: signDevice.KeyVersion})
+	}
+}
+
+// signData reads the device, signs with it and writes the signature under the commit lock of the
+// device, so that the signatures of the service never conflict with each other.
+func (s *Service) signData(ctx context.Context, id string, dataToSign string) (signed Signature, signatureAlg string, err error) {
+	err = s.commit(id, EventSignatureCreated, func() (any, error) {
+		var created SignatureCreated
+		signed, signatureAlg, created, err = s.sign(ctx, id, dataToSign)
+		return created, err
+	})
+	return signed, signatureAlg, err
+}
+
+// sign signs dataToSign with the current state of the device, which the caller holds the commit
+// lock of.
+func (s *Service) sign(ctx context.Context, id string, dataToSign string) (Signature, string, SignatureCreated, error) {
 	signDevice, err := s.store.GetSignatureDevice(ctx, id)
 	if err != nil {
-		return Signature{}, fmt.Errorf("error getting signature: %w", err)
+		return Signature{}, "", SignatureCreated{}, fromStoreError(err, "error getting signature device")
+	}
+
+	if signDevice.Status == store.StatusSuspended {
+		return Signature{}, signDevice.SignatureAlg, SignatureCreated{}, newError(CodeDeviceInactive, "signature device is suspended", nil)
 	}
 
 	signerFactory, found := s.signers[signDevice.SignatureAlg]
 	if !found {
-		return Signature{}, fmt.Errorf("missing signer factory for algorithm '%v'", signDevice.SignatureAlg)
+		return Signature{}, signDevice.SignatureAlg, SignatureCreated{}, newError(CodeUnsupportedAlgorithm, fmt.Sprintf("missing signer factory for algorithm '%v'", signDevice.SignatureAlg), nil)
 	}
 
-	signer, err := signerFactory(signDevice.PrivateKey)
+	signer, err := s.signer(ctx, signDevice, signerFactory)
 	if err != nil {
-		return Signature{}, fmt.Errorf("error creating signer for algorithm '%v': %w", signDevice.SignatureAlg, err)
+		return Signature{}, signDevice.SignatureAlg, SignatureCreated{}, fmt.Errorf("error creating signer for algorithm '%v': %w", signDevice.SignatureAlg, err)
 	}
 
-	dataToBeSigned := fmt.Sprintf("%v_%v_%v", signDevice.SignatureCounter, dataToSign, base64.StdEncoding.EncodeToString([]byte(signDevice.LastSignature)))
+	// LastSignature is kept base64 encoded, starting with the encoded device ID
+	dataToBeSigned := SecuredData{
+		SignatureCounter: signDevice.SignatureCounter,
+		Data: dataToSign,
+		LastSignature: signDevice.LastSignature,
+	}.String()
 	dataToBeSignedHashed := sha256.Sum256([]byte(dataToBeSigned))
+	_, signSpan := tracer.Start(ctx, "crypto.Sign")
 	signature, err := signer.Sign(dataToBeSignedHashed[:])
+	endSpan(signSpan, err)
 	if err != nil {
-		return Signature{}, fmt.Errorf("error signing data: %w", err)
+		return Signature{}, signDevice.SignatureAlg, SignatureCreated{}, fmt.Errorf("error signing data: %w", err)
 	}
 
 	signatureBase64 := base64.StdEncoding.EncodeToString(signature)
-	s.store.UpdateSignatureDevice(ctx, id, store.UpdateSignatureDevice{
+	outboxEvent, err := newOutboxEvent(signDevice.Tenant, EventSignatureCreated, id, outboxSignature{
+		DeviceID: id,
+		SignatureCounter: signDevice.SignatureCounter + 1,
+		Signature: signatureBase64,
+		SignedData: dataToBeSigned,
+	})
+	if err != nil {
+		return Signature{}, signDevice.SignatureAlg, SignatureCreated{}, fmt.Errorf("error creating outbox event: %w", err)
+	}
+
+	// the outbox event is persisted with the counter: no signature goes unannounced, nor is announced without having happened
+	err = s.store.UpdateSignatureDevice(ctx, id, store.UpdateSignatureDevice{
 		SignatureCounter: signDevice.SignatureCounter + 1,
 		LastSignature: signatureBase64,
+		SignedData: dataToBeSigned,
 		Version: signDevice.Version,
-	})
+	}, outboxEvent)
+	if errors.Is(err, store.ErrVersionConflict) {
+		return Signature{}, signDevice.SignatureAlg, SignatureCreated{}, err
+	}
+	if err != nil {
+		return Signature{}, signDevice.SignatureAlg, SignatureCreated{}, fromStoreError(err, "error updating signature device")
+	}
+
+	// audit entry: the signed data may carry customer payload, so only its hash is logged
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "signature created",
+		slog.String("event", "signature.created"),
+		slog.String("device_id", id),
+		slog.Int("signature_counter", signDevice.SignatureCounter),
+		slog.String("signature_alg", signDevice.SignatureAlg),
+		slog.String("signed_data_sha256", base64.StdEncoding.EncodeToString(dataToBeSignedHashed[:])),
+		slog.String("signature", signatureBase64),
+	)
 
 	return Signature{
 		Signature: signatureBase64,
 		SignedData: dataToBeSigned,
+	}, signDevice.SignatureAlg, SignatureCreated{
+		DeviceID: id,
+		SignatureCounter: signDevice.SignatureCounter + 1,
+		Signature: signatureBase64,
 	}, nil
 }
 
-func New(store store.Store, keyGenerators map[string]KeyGenerator, signers map[string]crypto.SignerFactory) *Service {
-	return &Service{
+// fromStoreError translates store errors into domain errors. Errors without a
+// domain meaning are wrapped as they are and reported as internal errors.
+func fromStoreError(err error, message string) error {
+	switch {
+	case errors.Is(err, store.ErrDeviceNotFound):
+		return newError(CodeNotFound, "signature device not found", err)
+	case errors.Is(err, store.ErrDeviceExists):
+		return newError(CodeConflict, "signature device already exists", err)
+	case errors.Is(err, store.ErrVersionConflict):
+		return newError(CodeConflict, "signature device was modified concurrently", err)
+	default:
+		return fmt.Errorf("%v: %w", message, err)
+	}
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func New(store store.Store, keyGenerators map[string]KeyGenerator, signers map[string]crypto.SignerFactory, opts ...Option) *Service {
+	s := &Service{
 		store: store,
 		keyGenerators: keyGenerators,
 		signers: signers,
+		metrics: noopMetrics{},
+		publisher: noopPublisher{},
+		signerCache: newSignerCache(DefaultSignerCacheSize),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
\ No newline at end of file
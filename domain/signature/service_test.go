@@ -1,15 +1,28 @@
 package signature_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
+	"log/slog"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/storestub"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestCreateSignatureDeviceValidationErrors(t *testing.T) {
@@ -58,6 +71,47 @@ func TestCreateSignatureDeviceValidationErrors(t *testing.T) {
 			},
 			errMsg: "Field validation for 'Tenant' failed on the 'required' tag",
 		},
+		{
+			name: "metadata and tags are optional",
+			newSignatureDevice: signature.NewSignatureDevice{
+				ID: "some-id",
+				Tenant: "some-tenant",
+				SignatureAlg: "RSA",
+				Metadata: map[string]string{"store": "berlin"},
+				Tags: []string{"pos"},
+			},
+			errMsg: "",
+		},
+		{
+			name: "signature device with too many tags",
+			newSignatureDevice: signature.NewSignatureDevice{
+				ID: "some-id",
+				Tenant: "some-tenant",
+				SignatureAlg: "RSA",
+				Tags: []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15", "16", "17"},
+			},
+			errMsg: "Field validation for 'Tags' failed on the 'max' tag",
+		},
+		{
+			name: "signature device with too long metadata value",
+			newSignatureDevice: signature.NewSignatureDevice{
+				ID: "some-id",
+				Tenant: "some-tenant",
+				SignatureAlg: "RSA",
+				Metadata: map[string]string{"store": strings.Repeat("a", 257)},
+			},
+			errMsg: "Field validation for 'Metadata[store]' failed on the 'max' tag",
+		},
+		{
+			name: "signature device with empty metadata key",
+			newSignatureDevice: signature.NewSignatureDevice{
+				ID: "some-id",
+				Tenant: "some-tenant",
+				SignatureAlg: "RSA",
+				Metadata: map[string]string{"": "berlin"},
+			},
+			errMsg: "failed on the 'min' tag",
+		},
 		{
 			name: "signature device with unsupported signing algorithm",
 			newSignatureDevice: signature.NewSignatureDevice{
@@ -71,7 +125,10 @@ func TestCreateSignatureDeviceValidationErrors(t *testing.T) {
 	}
 
 	storeStub := storestub.New()
-	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice) error {
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{}, store.ErrDeviceNotFound
+	}
+	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice, outbox []store.OutboxEvent) error {
 		return nil
 	}
 	service := signature.New(storeStub, map[string]signature.KeyGenerator{
@@ -80,7 +137,7 @@ func TestCreateSignatureDeviceValidationErrors(t *testing.T) {
 	}, map[string]crypto.SignerFactory{})
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			err := service.CreateSignatureDevice(context.Background(), tc.newSignatureDevice)
+			_, _, err := service.CreateSignatureDevice(context.Background(), tc.newSignatureDevice)
 			if tc.errMsg != "" {
 				assert.NotNil(t, err)
 				assert.Contains(t, err.Error(), tc.errMsg)
@@ -104,7 +161,10 @@ func TestHappyPath(t *testing.T) {
 	privateKey := []byte{4,5,6}
 
 	storeStub := storestub.New()
-	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice) error {
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{}, store.ErrDeviceNotFound
+	}
+	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice, outbox []store.OutboxEvent) error {
 		assert.Equal(t, newSignatureDevice.ID, sigDevice.ID)
 		assert.Equal(t, newSignatureDevice.Tenant, sigDevice.Tenant)
 		assert.Equal(t, newSignatureDevice.SignatureAlg, sigDevice.SignatureAlg)
@@ -118,7 +178,7 @@ func TestHappyPath(t *testing.T) {
 		"RSA": func() ([]byte, []byte, error) {return publicKey, privateKey, nil},
 	}, map[string]crypto.SignerFactory{})
 
-	err := service.CreateSignatureDevice(ctx, newSignatureDevice)
+	_, _, err := service.CreateSignatureDevice(ctx, newSignatureDevice)
 	assert.NoError(t, err)
 }
 
@@ -133,14 +193,17 @@ func TestReturnErrorOnSignatureError(t *testing.T) {
 	}
 
 	storeStub := storestub.New()
-	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice) error {
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{}, store.ErrDeviceNotFound
+	}
+	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice, outbox []store.OutboxEvent) error {
 		return nil
 	}
 	service := signature.New(storeStub, map[string]signature.KeyGenerator{
 		"RSA": func() ([]byte, []byte, error) {return nil, nil, errors.New("some error")},
 	}, map[string]crypto.SignerFactory{})
 
-	err := service.CreateSignatureDevice(ctx, newSignatureDevice)
+	_, _, err := service.CreateSignatureDevice(ctx, newSignatureDevice)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "error while generating a new key pair")
 }
@@ -156,14 +219,624 @@ func TestReturnErrorOnMissingKeyPairGeneratorFunction(t *testing.T) {
 	}
 
 	storeStub := storestub.New()
-	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice) error {
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{}, store.ErrDeviceNotFound
+	}
+	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice, outbox []store.OutboxEvent) error {
 		return nil
 	}
 	service := signature.New(storeStub, map[string]signature.KeyGenerator{}, map[string]crypto.SignerFactory{})
 
-	err := service.CreateSignatureDevice(ctx, newSignatureDevice)
+	_, _, err := service.CreateSignatureDevice(ctx, newSignatureDevice)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "missing key pair generator for algorithm 'RSA'")
 }
 
-// TODO: add tests for GetSignatureDevice
\ No newline at end of file
+type signerStub struct{}
+
+func (signerStub) Sign(dataToBeSigned []byte) ([]byte, error) {
+	return []byte("signature"), nil
+}
+
+type metricsStub struct {
+	conflicts int
+	signatures int
+	retries []int
+	cacheHits int
+}
+
+func (m *metricsStub) DeviceCreated(signatureAlg string) {}
+func (m *metricsStub) DeviceDeleted(signatureAlg string) {}
+func (m *metricsStub) KeyPairGenerated(signatureAlg string, duration time.Duration) {}
+func (m *metricsStub) SignatureCreated(signatureAlg string) { m.signatures++ }
+func (m *metricsStub) SignConflict(signatureAlg string) { m.conflicts++ }
+func (m *metricsStub) SignRetries(signatureAlg string, retries int) { m.retries = append(m.retries, retries) }
+func (m *metricsStub) SignerCacheLookup(signatureAlg string, hit bool) {
+	if hit {
+		m.cacheHits++
+	}
+}
+
+func TestSignDataRetriesOnVersionConflict(t *testing.T) {
+	ctx := context.Background()
+
+	counter := 0
+	storeStub := storestub.New()
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{
+			ID: id,
+			SignatureAlg: "RSA",
+			SignatureCounter: counter,
+			LastSignature: "bGFzdA==",
+		}, nil
+	}
+	storeStub.UpdateSignatureDeviceFn = func(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox []store.OutboxEvent) error {
+		// a concurrent signature wins the first race
+		if counter == 0 {
+			counter++
+			return store.ErrVersionConflict
+		}
+		assert.Equal(t, 2, updateSignDevice.SignatureCounter)
+		return nil
+	}
+	metrics := &metricsStub{}
+	service := signature.New(storeStub, map[string]signature.KeyGenerator{}, map[string]crypto.SignerFactory{
+		"RSA": func(privateKey []byte) (crypto.Signer, error) {return signerStub{}, nil},
+	}, signature.WithMetrics(metrics))
+
+	signed, err := service.SignData(ctx, "some-id", "some-data")
+	assert.NoError(t, err)
+	assert.Contains(t, signed.SignedData, "1_some-data_")
+	assert.Equal(t, 1, metrics.conflicts)
+	assert.Equal(t, 1, metrics.signatures)
+	assert.Equal(t, []int{1}, metrics.retries)
+}
+
+// slowSignerStub takes long enough to sign for concurrent signatures to read the same counter.
+type slowSignerStub struct{}
+
+func (slowSignerStub) Sign(dataToBeSigned []byte) ([]byte, error) {
+	time.Sleep(time.Millisecond)
+	return []byte("signature"), nil
+}
+
+func TestConcurrentSignaturesDoNotConflict(t *testing.T) {
+	ctx := context.Background()
+
+	memoryStore := inmemory.New()
+	service := signature.New(memoryStore, map[string]signature.KeyGenerator{
+		"RSA": func() ([]byte, []byte, error) {return []byte{1,2,3}, []byte{4,5,6}, nil},
+	}, map[string]crypto.SignerFactory{
+		"RSA": func(privateKey []byte) (crypto.Signer, error) {return slowSignerStub{}, nil},
+	})
+	_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "RSA"})
+	assert.NoError(t, err)
+
+	// far more signatures than retries: none may give up
+	const signatures = 100
+	var wg sync.WaitGroup
+	for i := 0; i < signatures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.SignData(ctx, "some-id", "some-data")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	device, err := service.GetSignatureDevice(ctx, "some-id")
+	assert.NoError(t, err)
+	assert.Equal(t, signatures, device.SignatureCounter)
+}
+
+func TestSignDataGivesUpOnPersistentVersionConflict(t *testing.T) {
+	ctx := context.Background()
+
+	storeStub := storestub.New()
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{ID: id, SignatureAlg: "RSA"}, nil
+	}
+	storeStub.UpdateSignatureDeviceFn = func(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox []store.OutboxEvent) error {
+		return store.ErrVersionConflict
+	}
+	service := signature.New(storeStub, map[string]signature.KeyGenerator{}, map[string]crypto.SignerFactory{
+		"RSA": func(privateKey []byte) (crypto.Signer, error) {return signerStub{}, nil},
+	})
+
+	_, err := service.SignData(ctx, "some-id", "some-data")
+	assert.ErrorIs(t, err, store.ErrVersionConflict)
+}
+
+func TestAuditLogDoesNotLeakKeyMaterial(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logging.NewContext(context.Background(), slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	privateKey := []byte("some-private-key")
+	var created store.SignatureDevice
+	storeStub := storestub.New()
+	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice, outbox []store.OutboxEvent) error {
+		created = sigDevice
+		return nil
+	}
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		if created.ID == "" {
+			return store.SignatureDevice{}, store.ErrDeviceNotFound
+		}
+		return created, nil
+	}
+	storeStub.UpdateSignatureDeviceFn = func(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox []store.OutboxEvent) error {
+		return nil
+	}
+	service := signature.New(storeStub, map[string]signature.KeyGenerator{
+		"RSA": func() ([]byte, []byte, error) {return []byte("some-public-key"), privateKey, nil},
+	}, map[string]crypto.SignerFactory{
+		"RSA": func(privateKey []byte) (crypto.Signer, error) {return signerStub{}, nil},
+	})
+
+	_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{
+		ID: "some-id",
+		Tenant: "some-tenant",
+		SignatureAlg: "RSA",
+	})
+	assert.NoError(t, err)
+	_, err = service.SignData(ctx, "some-id", "some-data")
+	assert.NoError(t, err)
+
+	logs := buf.String()
+	assert.Contains(t, logs, `"event":"device.created"`)
+	assert.Contains(t, logs, `"event":"signature.created"`)
+	assert.Contains(t, logs, `"device_id":"some-id"`)
+	assert.Contains(t, logs, `"signature_counter":0`)
+	assert.NotContains(t, logs, string(privateKey))
+	assert.NotContains(t, logs, base64.StdEncoding.EncodeToString(privateKey))
+	assert.NotContains(t, logs, "some-data")
+}
+
+func TestServiceReturnsDomainErrors(t *testing.T) {
+	ctx := context.Background()
+
+	storeStub := storestub.New()
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{}, store.ErrDeviceNotFound
+	}
+	service := signature.New(storeStub, map[string]signature.KeyGenerator{}, map[string]crypto.SignerFactory{})
+
+	_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{Tenant: "some-tenant", SignatureAlg: "RSA"})
+	assert.ErrorIs(t, err, signature.ErrInvalidInput)
+
+	_, _, err = service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "RSA"})
+	assert.ErrorIs(t, err, signature.ErrUnsupportedAlgorithm)
+
+	_, err = service.GetSignatureDevice(ctx, "some-id")
+	assert.ErrorIs(t, err, signature.ErrNotFound)
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+
+	_, err = service.SignData(ctx, "some-id", "some-data")
+	assert.ErrorIs(t, err, signature.ErrNotFound)
+	assert.Equal(t, signature.CodeNotFound, signature.ErrorCode(err))
+
+	assert.Equal(t, signature.CodeInternal, signature.ErrorCode(errors.New("some error")))
+}
+
+func TestCreateSignatureDeviceOnExistingID(t *testing.T) {
+	existing := store.SignatureDevice{
+		ID: "some-id",
+		Tenant: "some-tenant",
+		SignatureAlg: "RSA",
+		Label: "some-label",
+		Tags: []string{"some-tag", "other-tag"},
+		SignatureCounter: 3,
+	}
+
+	tests := []struct{
+		name string
+		label string
+		tags []string
+		expectedErr error
+	}{
+		{
+			name: "identical request is replayed",
+			label: "some-label",
+			tags: []string{"some-tag", "other-tag"},
+		},
+		{
+			name: "tags in another order are replayed",
+			label: "some-label",
+			tags: []string{"other-tag", "some-tag"},
+		},
+		{
+			name: "different request is a conflict",
+			label: "other-label",
+			tags: []string{"some-tag", "other-tag"},
+			expectedErr: signature.ErrConflict,
+		},
+		{
+			name: "different tags are a conflict",
+			label: "some-label",
+			tags: []string{"some-tag"},
+			expectedErr: signature.ErrConflict,
+		},
+	}
+
+	storeStub := storestub.New()
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return existing, nil
+	}
+	service := signature.New(storeStub, map[string]signature.KeyGenerator{
+		"RSA": func() ([]byte, []byte, error) {
+			t.Error("keys generated for an existing device")
+			return []byte{}, []byte{}, nil
+		},
+	}, map[string]crypto.SignerFactory{})
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			device, created, err := service.CreateSignatureDevice(context.Background(), signature.NewSignatureDevice{
+				ID: "some-id",
+				Tenant: "some-tenant",
+				SignatureAlg: "RSA",
+				Label: tc.label,
+				Tags: tc.tags,
+			})
+			assert.False(t, created)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 3, device.SignatureCounter)
+		})
+	}
+}
+
+func TestCreateSignatureDeviceCreatedConcurrently(t *testing.T) {
+	existing := store.SignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "RSA"}
+
+	lookups := 0
+	storeStub := storestub.New()
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		lookups++
+		if lookups == 1 {
+			return store.SignatureDevice{}, store.ErrDeviceNotFound
+		}
+		return existing, nil
+	}
+	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice, outbox []store.OutboxEvent) error {
+		return store.ErrDeviceExists
+	}
+	service := signature.New(storeStub, map[string]signature.KeyGenerator{
+		"RSA": func() ([]byte, []byte, error) {return []byte{}, []byte{}, nil},
+	}, map[string]crypto.SignerFactory{})
+
+	device, created, err := service.CreateSignatureDevice(context.Background(), signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "RSA"})
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "some-id", device.ID)
+}
+
+func TestUpdateSignatureDeviceMergesMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	storeStub := storestub.New()
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{
+			ID: id,
+			Label: "some-label",
+			Metadata: map[string]string{"store": "berlin", "register": "1"},
+			Tags: []string{"pos"},
+			Version: "some-version",
+		}, nil
+	}
+	var updated store.UpdateSignatureDeviceDetails
+	storeStub.UpdateSignatureDeviceDetailsFn = func(ctx context.Context, id string, updateDetails store.UpdateSignatureDeviceDetails, outbox []store.OutboxEvent) error {
+		updated = updateDetails
+		return nil
+	}
+	service := signature.New(storeStub, map[string]signature.KeyGenerator{}, map[string]crypto.SignerFactory{})
+
+	munich := "munich"
+	_, err := service.UpdateSignatureDevice(ctx, "some-id", signature.UpdateSignatureDevice{
+		Metadata: map[string]*string{"store": &munich, "register": nil},
+	}, "some-version")
+	assert.NoError(t, err)
+	assert.Nil(t, updated.Label)
+	assert.Equal(t, map[string]string{"store": "munich"}, updated.Metadata)
+	assert.Nil(t, updated.Tags)
+	assert.Equal(t, "some-version", updated.Version)
+
+	_, err = service.UpdateSignatureDevice(ctx, "some-id", signature.UpdateSignatureDevice{
+		Tags: []string{"pos", "pos"},
+	}, "some-version")
+	assert.ErrorIs(t, err, signature.ErrInvalidInput)
+	assert.ErrorContains(t, err, "Field validation for 'Tags' failed on the 'unique' tag")
+
+	status := "retired"
+	_, err = service.UpdateSignatureDevice(ctx, "some-id", signature.UpdateSignatureDevice{
+		Status: &status,
+	}, "some-version")
+	assert.ErrorIs(t, err, signature.ErrInvalidInput)
+
+	// the device has no status yet, which does not allow clearing it
+	empty := ""
+	_, err = service.UpdateSignatureDevice(ctx, "some-id", signature.UpdateSignatureDevice{
+		Status: &empty,
+	}, "some-version")
+	assert.ErrorIs(t, err, signature.ErrInvalidInput)
+	assert.ErrorContains(t, err, "failed on the 'oneof' tag")
+
+	_, err = service.UpdateSignatureDevice(ctx, "some-id", signature.UpdateSignatureDevice{}, "stale-version")
+	assert.ErrorIs(t, err, signature.ErrVersionMismatch)
+}
+
+type publishedEvent struct {
+	deviceID string
+	eventType string
+	data any
+}
+
+type publisherStub struct {
+	mu sync.Mutex
+	events []publishedEvent
+}
+
+func (p *publisherStub) Publish(deviceID string, eventType string, data any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, publishedEvent{deviceID: deviceID, eventType: eventType, data: data})
+}
+
+func TestServicePublishesDeviceChanges(t *testing.T) {
+	ctx := context.Background()
+
+	created := false
+	storeStub := storestub.New()
+	storeStub.CreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice, outbox []store.OutboxEvent) error {
+		created = true
+		return nil
+	}
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		if !created {
+			return store.SignatureDevice{}, store.ErrDeviceNotFound
+		}
+		return store.SignatureDevice{ID: id, SignatureAlg: "RSA", SignatureCounter: 4, LastSignature: "bGFzdA==", Version: "some-version"}, nil
+	}
+	storeStub.UpdateSignatureDeviceFn = func(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox []store.OutboxEvent) error {
+		return nil
+	}
+	publisher := &publisherStub{}
+	service := signature.New(storeStub, map[string]signature.KeyGenerator{
+		"RSA": func() ([]byte, []byte, error) {return []byte{1,2,3}, []byte{4,5,6}, nil},
+	}, map[string]crypto.SignerFactory{
+		"RSA": func(privateKey []byte) (crypto.Signer, error) {return signerStub{}, nil},
+	}, signature.WithPublisher(publisher))
+
+	_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "RSA"})
+	assert.NoError(t, err)
+	signed, err := service.SignData(ctx, "some-id", "some-data")
+	assert.NoError(t, err)
+
+	assert.Len(t, publisher.events, 2)
+	assert.Equal(t, "some-id", publisher.events[0].deviceID)
+	assert.Equal(t, signature.EventDeviceCreated, publisher.events[0].eventType)
+	assert.Equal(t, publishedEvent{
+		deviceID: "some-id",
+		eventType: signature.EventSignatureCreated,
+		data: signature.SignatureCreated{DeviceID: "some-id", SignatureCounter: 5, Signature: signed.Signature},
+	}, publisher.events[1])
+}
+
+// pausingStore holds the write of the first signature, once applied, until release is closed.
+type pausingStore struct {
+	*inmemory.InMemoryStore
+	written chan struct{}
+	release chan struct{}
+}
+
+func (s *pausingStore) UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox ...store.OutboxEvent) error {
+	if err := s.InMemoryStore.UpdateSignatureDevice(ctx, id, updateSignDevice, outbox...); err != nil {
+		return err
+	}
+	if updateSignDevice.SignatureCounter == 1 {
+		close(s.written)
+		<-s.release
+	}
+	return nil
+}
+
+func TestServicePublishesSignaturesInCounterOrder(t *testing.T) {
+	ctx := context.Background()
+
+	pausing := &pausingStore{InMemoryStore: inmemory.New(), written: make(chan struct{}), release: make(chan struct{})}
+	publisher := &publisherStub{}
+	service := signature.New(pausing, map[string]signature.KeyGenerator{
+		"RSA": func() ([]byte, []byte, error) {return []byte{1,2,3}, []byte{4,5,6}, nil},
+	}, map[string]crypto.SignerFactory{
+		"RSA": func(privateKey []byte) (crypto.Signer, error) {return signerStub{}, nil},
+	}, signature.WithPublisher(publisher))
+	_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "RSA"})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := service.SignData(ctx, "some-id", "first")
+		assert.NoError(t, err)
+	}()
+	<-pausing.written
+	go func() {
+		defer wg.Done()
+		_, err := service.SignData(ctx, "some-id", "second")
+		assert.NoError(t, err)
+	}()
+	// the second signature reads the counter of the first one, which is not published yet
+	time.Sleep(50 * time.Millisecond)
+	close(pausing.release)
+	wg.Wait()
+
+	counters := []int{}
+	for _, event := range publisher.events {
+		if created, ok := event.data.(signature.SignatureCreated); ok {
+			counters = append(counters, created.SignatureCounter)
+		}
+	}
+	assert.Equal(t, []int{1, 2}, counters)
+}
+
+func TestGetSignatureDevice(t *testing.T) {
+	ctx := context.Background()
+
+	keyPairs := [][]byte{{1,2,3}, {7,8,9}}
+	service := signature.New(inmemory.New(), map[string]signature.KeyGenerator{
+		"RSA": func() ([]byte, []byte, error) {
+			publicKey := keyPairs[0]
+			keyPairs = keyPairs[1:]
+			return publicKey, []byte{4,5,6}, nil
+		},
+	}, map[string]crypto.SignerFactory{})
+
+	_, err := service.GetSignatureDevice(ctx, "some-id")
+	assert.ErrorIs(t, err, signature.ErrNotFound)
+
+	_, _, err = service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "RSA", Label: "some-label"})
+	assert.NoError(t, err)
+	device, err := service.GetSignatureDevice(ctx, "some-id")
+	assert.NoError(t, err)
+	assert.Equal(t, signature.SignatureDevice{
+		ID: "some-id",
+		SignatureAlg: "RSA",
+		Label: "some-label",
+		PublicKey: []byte{1,2,3},
+		Status: store.StatusActive,
+		KeyVersion: 1,
+		Version: "1",
+	}, device)
+
+	rotated, err := service.RotateSignatureDeviceKey(ctx, "some-id", device.Version)
+	assert.NoError(t, err)
+	device, err = service.GetSignatureDevice(ctx, "some-id")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, device.KeyVersion)
+	assert.Equal(t, []byte{7,8,9}, device.PublicKey)
+	assert.Equal(t, rotated.Version, device.Version)
+}
+
+func TestRotateSignatureDeviceKey(t *testing.T) {
+	ctx := context.Background()
+
+	current := store.SignatureDevice{
+		ID: "some-id",
+		SignatureAlg: "RSA",
+		PublicKey: []byte{1,2,3},
+		PrivateKey: []byte{4,5,6},
+		Status: store.StatusActive,
+		KeyVersion: 1,
+		Version: "some-version",
+	}
+	storeStub := storestub.New()
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return current, nil
+	}
+	storeStub.RotateSignatureDeviceKeyFn = func(ctx context.Context, id string, rotateKey store.RotateSignatureDeviceKey, outbox []store.OutboxEvent) error {
+		assert.Equal(t, []byte{7,8,9}, rotateKey.PublicKey)
+		assert.Equal(t, []byte{10,11,12}, rotateKey.PrivateKey)
+		assert.Equal(t, "some-version", rotateKey.Version)
+		assert.Len(t, outbox, 1)
+		assert.Equal(t, signature.EventDeviceKeyRotated, outbox[0].Type)
+
+		current.PublicKey = rotateKey.PublicKey
+		current.PrivateKey = rotateKey.PrivateKey
+		current.KeyVersion++
+		current.Version = "other-version"
+		return nil
+	}
+	service := signature.New(storeStub, map[string]signature.KeyGenerator{
+		"RSA": func() ([]byte, []byte, error) {return []byte{7,8,9}, []byte{10,11,12}, nil},
+	}, map[string]crypto.SignerFactory{})
+
+	_, err := service.RotateSignatureDeviceKey(ctx, "some-id", "stale-version")
+	assert.ErrorIs(t, err, signature.ErrVersionMismatch)
+
+	device, err := service.RotateSignatureDeviceKey(ctx, "some-id", "some-version")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, device.KeyVersion)
+	assert.Equal(t, []byte{7,8,9}, device.PublicKey)
+	assert.Equal(t, "other-version", device.Version)
+}
+
+func TestSuspendedDeviceCannotSign(t *testing.T) {
+	ctx := context.Background()
+
+	storeStub := storestub.New()
+	storeStub.GetSignatureDeviceFn = func(ctx context.Context, id string) (store.SignatureDevice, error) {
+		return store.SignatureDevice{ID: id, SignatureAlg: "RSA", Status: store.StatusSuspended, Version: "some-version"}, nil
+	}
+	service := signature.New(storeStub, map[string]signature.KeyGenerator{}, map[string]crypto.SignerFactory{
+		"RSA": crypto.RSASignerFactory,
+	})
+
+	_, err := service.SignData(ctx, "some-id", "some-data")
+	assert.ErrorIs(t, err, signature.ErrDeviceInactive)
+}
+
+// spanRecorder installs a recording tracer provider once: the package tracer is only bound to the
+// first provider set.
+var spanRecorder = sync.OnceValue(func() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+})
+
+func TestServiceCallsAreTraced(t *testing.T) {
+	recorder := spanRecorder()
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+
+	service := signature.New(inmemory.New(), map[string]signature.KeyGenerator{
+		"RSA": func() ([]byte, []byte, error) {return []byte{1,2,3}, []byte{4,5,6}, nil},
+	}, map[string]crypto.SignerFactory{
+		"RSA": func(privateKey []byte) (crypto.Signer, error) {return signerStub{}, nil},
+	})
+	_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "RSA"})
+	assert.NoError(t, err)
+	_, err = service.SignData(ctx, "some-id", "some-data")
+	assert.NoError(t, err)
+	_, err = service.SignData(ctx, "missing-id", "some-data")
+	assert.ErrorIs(t, err, signature.ErrNotFound)
+	parent.End()
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() == parent.SpanContext().TraceID() {
+			spans[span.Name()] = append(spans[span.Name()], span)
+		}
+	}
+
+	created := spans["signature.CreateSignatureDevice"]
+	if assert.Len(t, created, 1) {
+		assert.Equal(t, parent.SpanContext().SpanID(), created[0].Parent().SpanID())
+		assert.Contains(t, created[0].Attributes(), attribute.String("device.id", "some-id"))
+		assert.Contains(t, created[0].Attributes(), attribute.String("device.signature_alg", "RSA"))
+		assert.Equal(t, codes.Unset, created[0].Status().Code)
+	}
+	if assert.Len(t, spans["keygen.Generate"], 1) {
+		assert.Equal(t, created[0].SpanContext().SpanID(), spans["keygen.Generate"][0].Parent().SpanID())
+	}
+
+	signed := spans["signature.SignData"]
+	if assert.Len(t, signed, 2) {
+		assert.Contains(t, signed[0].Attributes(), attribute.String("device.id", "some-id"))
+		assert.Contains(t, signed[0].Attributes(), attribute.String("device.signature_alg", "RSA"))
+		assert.Contains(t, signed[0].Attributes(), attribute.Int("sign.retries", 0))
+		assert.Equal(t, codes.Unset, signed[0].Status().Code)
+
+		assert.Contains(t, signed[1].Attributes(), attribute.String("device.id", "missing-id"))
+		assert.Equal(t, codes.Error, signed[1].Status().Code)
+		if assert.Len(t, signed[1].Events(), 1) {
+			assert.Equal(t, "exception", signed[1].Events()[0].Name)
+		}
+	}
+	if assert.Len(t, spans["crypto.Sign"], 1) {
+		assert.Equal(t, signed[0].SpanContext().SpanID(), spans["crypto.Sign"][0].Parent().SpanID())
+	}
+}
@@ -0,0 +1,96 @@
+package signature
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+)
+
+// DefaultSignerCacheSize is how many parsed signers the Service keeps by default.
+const DefaultSignerCacheSize = 1024
+
+// signerKey identifies the key pair of a device: rotating the key increments its version.
+type signerKey struct {
+	deviceID   string
+	keyVersion int
+}
+
+type cachedSigner struct {
+	key signerKey
+	// privateKey is the PEM the signer was parsed from, compared on every hit: a device deleted and
+	// created again with the same ID starts over at key version 1 with another key
+	privateKey []byte
+	signer     crypto.Signer
+}
+
+// signerCache is a least recently used cache of the signers parsed from the private keys of the
+// devices, bounded to size entries. Cached signers are shared by concurrent signatures.
+type signerCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[signerKey]*list.Element
+	// order holds the entries, most recently used first
+	order *list.List
+}
+
+func newSignerCache(size int) *signerCache {
+	return &signerCache{
+		size:    size,
+		entries: map[signerKey]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// get returns the signer of the key pair, provided it was parsed from privateKey.
+func (c *signerCache) get(key signerKey, privateKey []byte) (crypto.Signer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := element.Value.(*cachedSigner)
+	if !bytes.Equal(entry.privateKey, privateKey) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.signer, true
+}
+
+// add caches signer, evicting the least recently used entry when the cache is full.
+func (c *signerCache) add(key signerKey, privateKey []byte, signer crypto.Signer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, found := c.entries[key]; found {
+		c.remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&cachedSigner{
+		key:        key,
+		privateKey: bytes.Clone(privateKey),
+		signer:     signer,
+	})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// invalidate drops the signer of the key pair, once it got rotated or its device deleted.
+func (c *signerCache) invalidate(key signerKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, found := c.entries[key]; found {
+		c.remove(element)
+	}
+}
+
+func (c *signerCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cachedSigner).key)
+}
@@ -0,0 +1,172 @@
+package signature_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/keygen"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFactory wraps factory, counting how many private keys it parsed.
+func countingFactory(factory crypto.SignerFactory, calls *int) crypto.SignerFactory {
+	return func(privateKey []byte) (crypto.Signer, error) {
+		*calls++
+		return factory(privateKey)
+	}
+}
+
+func newCachingService(calls *int, opts ...signature.Option) *signature.Service {
+	return signature.New(inmemory.New(), map[string]signature.KeyGenerator{
+		"ECC": keygen.ECC,
+	}, map[string]crypto.SignerFactory{
+		"ECC": countingFactory(crypto.ECCSignerFactory, calls),
+	}, opts...)
+}
+
+func TestSignerIsParsedOncePerKeyPair(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	metrics := &metricsStub{}
+	service := newCachingService(&calls, signature.WithMetrics(metrics))
+
+	device, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "ECC"})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := service.SignData(ctx, "some-id", "some-data")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 2, metrics.cacheHits)
+
+	device, err = service.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	device, err = service.RotateSignatureDeviceKey(ctx, "some-id", device.Version)
+	require.NoError(t, err)
+	_, err = service.SignData(ctx, "some-id", "some-data")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// the device created again under the same ID starts over at key version 1, with another key
+	device, err = service.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	require.NoError(t, service.DeleteSignatureDevice(ctx, "some-id", device.Version))
+	_, _, err = service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "ECC"})
+	require.NoError(t, err)
+	_, err = service.SignData(ctx, "some-id", "some-data")
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestSignerCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	service := newCachingService(&calls, signature.WithSignerCacheSize(2))
+
+	for _, id := range []string{"a", "b", "c"} {
+		_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: id, Tenant: "some-tenant", SignatureAlg: "ECC"})
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		id            string
+		expectedCalls int
+	}{
+		{id: "a", expectedCalls: 1},
+		{id: "b", expectedCalls: 2},
+		{id: "a", expectedCalls: 2},
+		{id: "c", expectedCalls: 3}, // evicts b
+		{id: "a", expectedCalls: 3},
+		{id: "b", expectedCalls: 4}, // evicts c
+	}
+
+	for i, tc := range tests {
+		_, err := service.SignData(ctx, tc.id, "some-data")
+		require.NoError(t, err)
+		assert.Equal(t, tc.expectedCalls, calls, "signature %v with device %v", i, tc.id)
+	}
+}
+
+func TestSignerCacheCanBeDisabled(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	service := newCachingService(&calls, signature.WithSignerCacheSize(0))
+
+	_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: "ECC"})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := service.SignData(ctx, "some-id", "some-data")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, calls)
+}
+
+// rsaKeyGenerator generates RSA key pairs of the given size, as the production ones should be.
+func rsaKeyGenerator(bits int) signature.KeyGenerator {
+	return func() ([]byte, []byte, error) {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, nil, err
+		}
+		marshaler := crypto.NewRSAMarshaler()
+		return marshaler.Marshal(crypto.RSAKeyPair{Public: &key.PublicKey, Private: key})
+	}
+}
+
+func BenchmarkSignData(b *testing.B) {
+	algorithms := []struct {
+		name          string
+		signatureAlg  string
+		keyGenerator  signature.KeyGenerator
+		signerFactory crypto.SignerFactory
+	}{
+		{name: "RSA-4096", signatureAlg: "RSA", keyGenerator: rsaKeyGenerator(4096), signerFactory: crypto.RSASignerFactory},
+		{name: "ECC-P384", signatureAlg: "ECC", keyGenerator: keygen.ECC, signerFactory: crypto.ECCSignerFactory},
+	}
+
+	for _, algorithm := range algorithms {
+		for _, cacheSize := range []int{0, signature.DefaultSignerCacheSize} {
+			b.Run(fmt.Sprintf("%v/cache=%v", algorithm.name, cacheSize), func(b *testing.B) {
+				// audit entries would dominate the measurements
+				ctx := logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+				service := signature.New(inmemory.New(), map[string]signature.KeyGenerator{
+					algorithm.signatureAlg: algorithm.keyGenerator,
+				}, map[string]crypto.SignerFactory{
+					algorithm.signatureAlg: algorithm.signerFactory,
+				}, signature.WithSignerCacheSize(cacheSize))
+				_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{ID: "some-id", Tenant: "some-tenant", SignatureAlg: algorithm.signatureAlg})
+				require.NoError(b, err)
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := service.SignData(ctx, "some-id", "some-data"); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkSignerFactory measures the parsing saved by every cache hit.
+func BenchmarkSignerFactory(b *testing.B) {
+	_, privateKey, err := rsaKeyGenerator(4096)()
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := crypto.RSASignerFactory(privateKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
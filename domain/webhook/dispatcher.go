@@ -0,0 +1,302 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/google/uuid"
+)
+
+// Headers of the webhook deliveries. Webhook-ID is the event ID, the same across retries,
+// so that receivers can drop duplicates.
+const (
+	IDHeader        = "Webhook-ID"
+	TimestampHeader = "Webhook-Timestamp"
+	SignatureHeader = "Webhook-Signature"
+)
+
+// batchSize bounds the outbox events and deliveries handled by a single Dispatch.
+const batchSize = 100
+
+// DefaultMaxBacklogAge is how old the oldest outbox event may get before CheckBacklog warns.
+const DefaultMaxBacklogAge = 5 * time.Minute
+
+// Payload is the body of the webhook deliveries.
+type Payload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Dispatcher moves the outbox events to the deliveries of the matching subscriptions and delivers them,
+// retrying with an exponential backoff. Deliveries still failing after the maximum number of attempts
+// are dead-lettered. Delivery is at least once.
+type Dispatcher struct {
+	store          store.WebhookStore
+	client         *http.Client
+	now            func() time.Time
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxAttempts    int
+	maxBacklogAge  time.Duration
+}
+
+// DispatcherOption configures optional features of the Dispatcher.
+type DispatcherOption func(*Dispatcher)
+
+// WithHTTPClient sets the client performing the deliveries.
+func WithHTTPClient(client *http.Client) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithBackoff sets the delay before the first retry, doubled at every further retry up to max.
+func WithBackoff(initial time.Duration, max time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.initialBackoff = initial
+		d.maxBackoff = max
+	}
+}
+
+// WithMaxAttempts sets how many times a delivery is attempted before being dead-lettered.
+func WithMaxAttempts(maxAttempts int) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.maxAttempts = maxAttempts
+	}
+}
+
+// WithMaxBacklogAge sets how old the oldest outbox event may get before CheckBacklog warns.
+func WithMaxBacklogAge(maxAge time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.maxBacklogAge = maxAge
+	}
+}
+
+// WithClock sets the source of the current time.
+func WithClock(now func() time.Time) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.now = now
+	}
+}
+
+func NewDispatcher(store store.WebhookStore, opts ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
+		store:          store,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		now:            time.Now,
+		initialBackoff: 10 * time.Second,
+		maxBackoff:     time.Hour,
+		maxAttempts:    10,
+		maxBacklogAge:  DefaultMaxBacklogAge,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// Run dispatches every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Dispatch(ctx); err != nil {
+				logging.FromContext(ctx).ErrorContext(ctx, "error dispatching webhooks", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// Dispatch fans the pending outbox events out to the subscriptions, then attempts the due deliveries.
+// A delivery which fails does not hold back the others: the errors are returned once all were attempted.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	if err := d.fanOut(ctx); err != nil {
+		return err
+	}
+
+	deliveries, err := d.store.ListDueWebhookDeliveries(ctx, d.now(), batchSize)
+	if err != nil {
+		return fmt.Errorf("error listing due webhook deliveries: %w", err)
+	}
+	var errs []error
+	for _, delivery := range deliveries {
+		if err := d.attempt(ctx, delivery); err != nil {
+			errs = append(errs, fmt.Errorf("error attempting webhook delivery '%v': %w", delivery.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// CheckBacklog is a health check of the outbox: it warns once the oldest event waiting to be fanned
+// out is older than the maximum backlog age, as the dispatcher is then stuck or falling behind.
+func (d *Dispatcher) CheckBacklog(ctx context.Context) error {
+	events, err := d.store.ListOutboxEvents(ctx, 1)
+	if err != nil {
+		return fmt.Errorf("error listing outbox events: %w", err)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	if age := d.now().Sub(events[0].CreatedAt); age > d.maxBacklogAge {
+		return &health.Warning{Err: fmt.Errorf("oldest outbox event is %v old", age.Round(time.Second))}
+	}
+	return nil
+}
+
+func (d *Dispatcher) fanOut(ctx context.Context) error {
+	events, err := d.store.ListOutboxEvents(ctx, batchSize)
+	if err != nil {
+		return fmt.Errorf("error listing outbox events: %w", err)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	subscriptions := map[string][]store.WebhookSubscription{}
+	outboxIDs := make([]string, 0, len(events))
+	deliveries := []store.WebhookDelivery{}
+	for _, event := range events {
+		tenantSubscriptions, found := subscriptions[event.Tenant]
+		if !found {
+			tenantSubscriptions, err = d.store.ListWebhookSubscriptions(ctx, event.Tenant)
+			if err != nil {
+				return fmt.Errorf("error listing webhook subscriptions: %w", err)
+			}
+			subscriptions[event.Tenant] = tenantSubscriptions
+		}
+
+		for _, subscription := range tenantSubscriptions {
+			if len(subscription.EventTypes) > 0 && !slices.Contains(subscription.EventTypes, event.Type) {
+				continue
+			}
+			deliveries = append(deliveries, store.WebhookDelivery{
+				ID:             uuid.NewString(),
+				SubscriptionID: subscription.ID,
+				Event:          event,
+				NextAttemptAt:  d.now(),
+			})
+		}
+		outboxIDs = append(outboxIDs, event.ID)
+	}
+
+	if err := d.store.EnqueueWebhookDeliveries(ctx, outboxIDs, deliveries); err != nil {
+		return fmt.Errorf("error enqueueing webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery store.WebhookDelivery) error {
+	subscription, err := d.store.GetWebhookSubscription(ctx, delivery.Event.Tenant, delivery.SubscriptionID)
+	if errors.Is(err, store.ErrSubscriptionNotFound) {
+		return d.store.DeleteWebhookDelivery(ctx, delivery.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("error getting webhook subscription: %w", err)
+	}
+
+	err = d.send(ctx, subscription, delivery.Event)
+	if err == nil {
+		return d.store.DeleteWebhookDelivery(ctx, delivery.ID)
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.maxAttempts {
+		delivery.Dead = true
+	} else {
+		delivery.NextAttemptAt = d.now().Add(d.backoff(delivery.Attempts))
+	}
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelWarn, "webhook delivery failed",
+		slog.String("subscription_id", subscription.ID),
+		slog.String("event_id", delivery.Event.ID),
+		slog.Int("attempts", delivery.Attempts),
+		slog.Bool("dead", delivery.Dead),
+		slog.String("error", delivery.LastError),
+	)
+
+	return d.store.UpdateWebhookDelivery(ctx, delivery)
+}
+
+// backoff returns the delay before the next attempt of a delivery which failed attempts times.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.initialBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, d.maxBackoff)
+}
+
+func (d *Dispatcher) send(ctx context.Context, subscription store.WebhookSubscription, event store.OutboxEvent) error {
+	body, err := json.Marshal(Payload{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      event.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(IDHeader, event.ID)
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, Sign(subscription.Secret, event.ID, timestamp, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %v", response.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the Webhook-Signature header of a delivery: the hex encoded HMAC-SHA256,
+// keyed with the subscription secret, of the event ID, the timestamp and the body joined by dots.
+func Sign(secret string, id string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the valid Webhook-Signature of a delivery. Receivers
+// should also reject timestamps too far from their clock, to prevent replays.
+func Verify(secret string, id string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, id, timestamp, body)), []byte(signature))
+}
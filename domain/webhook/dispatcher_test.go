@@ -0,0 +1,255 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/webhook"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/keygen"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tenant = "some-tenant"
+
+type delivery struct {
+	header http.Header
+	body []byte
+}
+
+// receiver is a webhook endpoint answering with the given statuses in turn, then with the last one.
+type receiver struct {
+	mu sync.Mutex
+	statuses []int
+	deliveries []delivery
+}
+
+func (r *receiver) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	body, _ := io.ReadAll(request.Body)
+	r.deliveries = append(r.deliveries, delivery{header: request.Header.Clone(), body: body})
+	status := r.statuses[0]
+	if len(r.statuses) > 1 {
+		r.statuses = r.statuses[1:]
+	}
+	response.WriteHeader(status)
+}
+
+func (r *receiver) received() []delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]delivery{}, r.deliveries...)
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func setup(t *testing.T, statuses ...int) (*signature.Service, *webhook.Service, *webhook.Dispatcher, *receiver, *httptest.Server, *clock) {
+	t.Helper()
+
+	memoryStore := inmemory.New()
+	signatureService := signature.New(memoryStore, map[string]signature.KeyGenerator{
+		"ECC": keygen.ECC,
+	}, map[string]crypto.SignerFactory{
+		"ECC": crypto.ECCSignerFactory,
+	})
+	clock := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	dispatcher := webhook.NewDispatcher(memoryStore,
+		webhook.WithClock(clock.Now),
+		webhook.WithBackoff(time.Second, 4*time.Second),
+		webhook.WithMaxAttempts(4),
+	)
+	receiver := &receiver{statuses: statuses}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	return signatureService, webhook.New(memoryStore), dispatcher, receiver, server, clock
+}
+
+func createDevice(t *testing.T, service *signature.Service, id string) {
+	t.Helper()
+
+	_, _, err := service.CreateSignatureDevice(context.Background(), signature.NewSignatureDevice{ID: id, Tenant: tenant, SignatureAlg: "ECC"})
+	require.NoError(t, err)
+}
+
+func TestDispatchDeliversSignedPayloads(t *testing.T) {
+	ctx := context.Background()
+	signatureService, webhookService, dispatcher, receiver, server, _ := setup(t, http.StatusOK)
+
+	subscription, err := webhookService.CreateSubscription(ctx, webhook.NewSubscription{
+		Tenant: tenant,
+		URL: server.URL,
+		EventTypes: []string{signature.EventSignatureCreated},
+	})
+	require.NoError(t, err)
+	createDevice(t, signatureService, "some-id")
+	signed, err := signatureService.SignData(ctx, "some-id", "some-data")
+	require.NoError(t, err)
+
+	require.NoError(t, dispatcher.Dispatch(ctx))
+
+	received := receiver.received()
+	require.Len(t, received, 1)
+	header := received[0].header
+	assert.True(t, webhook.Verify(subscription.Secret, header.Get(webhook.IDHeader), header.Get(webhook.TimestampHeader), received[0].body, header.Get(webhook.SignatureHeader)))
+	assert.False(t, webhook.Verify("other-secret", header.Get(webhook.IDHeader), header.Get(webhook.TimestampHeader), received[0].body, header.Get(webhook.SignatureHeader)))
+
+	var payload webhook.Payload
+	require.NoError(t, json.Unmarshal(received[0].body, &payload))
+	assert.Equal(t, header.Get(webhook.IDHeader), payload.ID)
+	assert.Equal(t, signature.EventSignatureCreated, payload.Type)
+	var data map[string]any
+	require.NoError(t, json.Unmarshal(payload.Data, &data))
+	assert.Equal(t, map[string]any{
+		"device_id": "some-id",
+		"signature_counter": float64(1),
+		"signature": signed.Signature,
+		"signed_data": signed.SignedData,
+	}, data)
+
+	// the outbox is drained: nothing is delivered twice
+	require.NoError(t, dispatcher.Dispatch(ctx))
+	assert.Len(t, receiver.received(), 1)
+}
+
+func TestDispatchOnlyDeliversToSubscriptionsOfTheTenant(t *testing.T) {
+	ctx := context.Background()
+	signatureService, webhookService, dispatcher, receiver, server, _ := setup(t, http.StatusOK)
+
+	_, err := webhookService.CreateSubscription(ctx, webhook.NewSubscription{Tenant: "other-tenant", URL: server.URL})
+	require.NoError(t, err)
+	createDevice(t, signatureService, "some-id")
+
+	require.NoError(t, dispatcher.Dispatch(ctx))
+	assert.Empty(t, receiver.received())
+}
+
+// failingStore fails to delete the first delivery it is asked to.
+type failingStore struct {
+	*inmemory.InMemoryStore
+	failed bool
+}
+
+func (s *failingStore) DeleteWebhookDelivery(ctx context.Context, id string) error {
+	if !s.failed {
+		s.failed = true
+		return errors.New("some error")
+	}
+	return s.InMemoryStore.DeleteWebhookDelivery(ctx, id)
+}
+
+func TestDispatchAttemptsTheDeliveriesFollowingAFailure(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := &failingStore{InMemoryStore: inmemory.New()}
+	signatureService := signature.New(memoryStore, map[string]signature.KeyGenerator{
+		"ECC": keygen.ECC,
+	}, map[string]crypto.SignerFactory{})
+	webhookService := webhook.New(memoryStore)
+	receiver := &receiver{statuses: []int{http.StatusOK}}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	for range 2 {
+		_, err := webhookService.CreateSubscription(ctx, webhook.NewSubscription{Tenant: tenant, URL: server.URL})
+		require.NoError(t, err)
+	}
+	createDevice(t, signatureService, "some-id")
+
+	err := webhook.NewDispatcher(memoryStore).Dispatch(ctx)
+	assert.ErrorContains(t, err, "some error")
+	assert.Len(t, receiver.received(), 2)
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	signatureService, webhookService, dispatcher, receiver, server, clock := setup(t, http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusNoContent)
+
+	subscription, err := webhookService.CreateSubscription(ctx, webhook.NewSubscription{Tenant: tenant, URL: server.URL})
+	require.NoError(t, err)
+	createDevice(t, signatureService, "some-id")
+
+	steps := []struct{
+		advance time.Duration
+		received int
+	}{
+		{advance: 0, received: 1},
+		{advance: 999 * time.Millisecond, received: 1},
+		{advance: time.Millisecond, received: 2},
+		{advance: time.Second, received: 2},
+		{advance: time.Second, received: 3},
+		{advance: time.Hour, received: 3},
+	}
+	for _, step := range steps {
+		clock.now = clock.now.Add(step.advance)
+		require.NoError(t, dispatcher.Dispatch(ctx))
+		assert.Len(t, receiver.received(), step.received, "after %v", clock.now)
+	}
+
+	received := receiver.received()
+	assert.Equal(t, received[0].body, received[2].body)
+	assert.Equal(t, received[0].header.Get(webhook.IDHeader), received[2].header.Get(webhook.IDHeader))
+	deadLetters, err := webhookService.ListDeadLetters(ctx, tenant, subscription.ID)
+	require.NoError(t, err)
+	assert.Empty(t, deadLetters)
+}
+
+func TestDispatchDeadLettersAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	signatureService, webhookService, dispatcher, receiver, server, clock := setup(t, http.StatusInternalServerError)
+
+	subscription, err := webhookService.CreateSubscription(ctx, webhook.NewSubscription{Tenant: tenant, URL: server.URL})
+	require.NoError(t, err)
+	createDevice(t, signatureService, "some-id")
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, dispatcher.Dispatch(ctx))
+		clock.now = clock.now.Add(time.Hour)
+	}
+
+	assert.Len(t, receiver.received(), 4)
+	deadLetters, err := webhookService.ListDeadLetters(ctx, tenant, subscription.ID)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, signature.EventDeviceCreated, deadLetters[0].EventType)
+	assert.Equal(t, "some-id", deadLetters[0].DeviceID)
+	assert.Equal(t, 4, deadLetters[0].Attempts)
+	assert.Equal(t, "unexpected status 500", deadLetters[0].LastError)
+}
+
+func TestCheckBacklogWarnsWhenTheOutboxFallsBehind(t *testing.T) {
+	ctx := context.Background()
+	signatureService, _, dispatcher, _, _, clock := setup(t, http.StatusOK)
+	assert.NoError(t, dispatcher.CheckBacklog(ctx))
+
+	createDevice(t, signatureService, "some-id")
+	clock.now = time.Now()
+	assert.NoError(t, dispatcher.CheckBacklog(ctx))
+
+	clock.now = clock.now.Add(webhook.DefaultMaxBacklogAge + time.Minute)
+	var warning *health.Warning
+	assert.ErrorAs(t, dispatcher.CheckBacklog(ctx), &warning)
+
+	// the dispatcher catches up
+	require.NoError(t, dispatcher.Dispatch(ctx))
+	assert.NoError(t, dispatcher.CheckBacklog(ctx))
+}
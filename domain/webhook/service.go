@@ -0,0 +1,202 @@
+// Package webhook manages the webhook subscriptions of the tenants and delivers them the events
+// the signature service writes to the store outbox.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/go-playground/validator"
+	"github.com/google/uuid"
+)
+
+// EventTypes are the event types subscriptions can be restricted to.
+var EventTypes = []string{
+	signature.EventDeviceCreated,
+	signature.EventDeviceUpdated,
+	signature.EventDeviceDeleted,
+	signature.EventDeviceKeyRotated,
+	signature.EventSignatureCreated,
+}
+
+type SubscriptionService interface {
+	CreateSubscription(ctx context.Context, newSubscription NewSubscription) (Subscription, error)
+	GetSubscription(ctx context.Context, tenant string, id string) (Subscription, error)
+	// ListSubscriptions returns the subscriptions of tenant, ordered by creation.
+	ListSubscriptions(ctx context.Context, tenant string) ([]Subscription, error)
+	// DeleteSubscription deletes the subscription, dropping its pending deliveries.
+	DeleteSubscription(ctx context.Context, tenant string, id string) error
+	// ListDeadLetters returns the deliveries to the subscription which ran out of attempts.
+	ListDeadLetters(ctx context.Context, tenant string, id string) ([]DeadLetter, error)
+}
+
+type NewSubscription struct {
+	Tenant     string   `validate:"required"`
+	URL        string   `validate:"required,url"`
+	EventTypes []string `validate:"unique,dive,oneof=device.created device.updated device.deleted device.key_rotated signature.created"`
+	// Secret signs the deliveries. It is generated when empty.
+	Secret string `validate:"omitempty,min=16,max=256"`
+}
+
+// Subscription is a webhook subscription. Its Secret is only returned on creation.
+type Subscription struct {
+	ID         string
+	URL        string
+	EventTypes []string
+	Secret     string
+	CreatedAt  time.Time
+}
+
+// DeadLetter is an event which could not be delivered to a subscription.
+type DeadLetter struct {
+	EventID   string
+	EventType string
+	DeviceID  string
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+}
+
+type Service struct {
+	store store.WebhookStore
+}
+
+func New(store store.WebhookStore) *Service {
+	return &Service{
+		store: store,
+	}
+}
+
+func (s *Service) CreateSubscription(ctx context.Context, newSubscription NewSubscription) (Subscription, error) {
+	if err := validator.New().Struct(newSubscription); err != nil {
+		return Subscription{}, invalidInput("invalid webhook subscription", err)
+	}
+	if target, err := url.Parse(newSubscription.URL); err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return Subscription{}, invalidInput("webhook subscription URL must be an http or https URL", err)
+	}
+
+	secret := newSubscription.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateSecret(); err != nil {
+			return Subscription{}, fmt.Errorf("error generating webhook secret: %w", err)
+		}
+	}
+
+	subscription := store.WebhookSubscription{
+		ID:         uuid.NewString(),
+		Tenant:     newSubscription.Tenant,
+		URL:        newSubscription.URL,
+		EventTypes: slices.Clone(newSubscription.EventTypes),
+		Secret:     secret,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := s.store.CreateWebhookSubscription(ctx, subscription); err != nil {
+		return Subscription{}, fmt.Errorf("error creating webhook subscription: %w", err)
+	}
+
+	created := toSubscription(subscription)
+	created.Secret = secret
+	return created, nil
+}
+
+func (s *Service) GetSubscription(ctx context.Context, tenant string, id string) (Subscription, error) {
+	subscription, err := s.store.GetWebhookSubscription(ctx, tenant, id)
+	if err != nil {
+		return Subscription{}, fromStoreError(err, "error getting webhook subscription")
+	}
+
+	return toSubscription(subscription), nil
+}
+
+func (s *Service) ListSubscriptions(ctx context.Context, tenant string) ([]Subscription, error) {
+	subscriptions, err := s.store.ListWebhookSubscriptions(ctx, tenant)
+	if err != nil {
+		return nil, fromStoreError(err, "error listing webhook subscriptions")
+	}
+
+	result := make([]Subscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		result = append(result, toSubscription(subscription))
+	}
+
+	return result, nil
+}
+
+func (s *Service) DeleteSubscription(ctx context.Context, tenant string, id string) error {
+	if err := s.store.DeleteWebhookSubscription(ctx, tenant, id); err != nil {
+		return fromStoreError(err, "error deleting webhook subscription")
+	}
+
+	return nil
+}
+
+func (s *Service) ListDeadLetters(ctx context.Context, tenant string, id string) ([]DeadLetter, error) {
+	// scopes the lookup to the subscriptions of tenant
+	if _, err := s.store.GetWebhookSubscription(ctx, tenant, id); err != nil {
+		return nil, fromStoreError(err, "error getting webhook subscription")
+	}
+
+	deliveries, err := s.store.ListDeadWebhookDeliveries(ctx, id)
+	if err != nil {
+		return nil, fromStoreError(err, "error listing dead webhook deliveries")
+	}
+
+	deadLetters := make([]DeadLetter, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		deadLetters = append(deadLetters, DeadLetter{
+			EventID:   delivery.Event.ID,
+			EventType: delivery.Event.Type,
+			DeviceID:  delivery.Event.DeviceID,
+			Attempts:  delivery.Attempts,
+			LastError: delivery.LastError,
+			CreatedAt: delivery.Event.CreatedAt,
+		})
+	}
+
+	return deadLetters, nil
+}
+
+func toSubscription(subscription store.WebhookSubscription) Subscription {
+	eventTypes := subscription.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	return Subscription{
+		ID:         subscription.ID,
+		URL:        subscription.URL,
+		EventTypes: eventTypes,
+		CreatedAt:  subscription.CreatedAt,
+	}
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// Webhook errors share the codes of the signature domain, so that the APIs translate them the same way.
+func invalidInput(message string, err error) error {
+	return &signature.Error{Code: signature.CodeInvalidInput, Message: message, Err: err}
+}
+
+func fromStoreError(err error, message string) error {
+	if errors.Is(err, store.ErrSubscriptionNotFound) {
+		return &signature.Error{Code: signature.CodeNotFound, Message: "webhook subscription not found", Err: err}
+	}
+
+	return fmt.Errorf("%v: %w", message, err)
+}
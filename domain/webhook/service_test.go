@@ -0,0 +1,69 @@
+package webhook_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/webhook"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSubscriptionValidationErrors(t *testing.T) {
+	tests := []struct{
+		name string
+		newSubscription webhook.NewSubscription
+	}{
+		{name: "missing tenant", newSubscription: webhook.NewSubscription{URL: "https://example.com/hook"}},
+		{name: "missing URL", newSubscription: webhook.NewSubscription{Tenant: tenant}},
+		{name: "not an http URL", newSubscription: webhook.NewSubscription{Tenant: tenant, URL: "ftp://example.com/hook"}},
+		{name: "unknown event type", newSubscription: webhook.NewSubscription{Tenant: tenant, URL: "https://example.com/hook", EventTypes: []string{"device.exploded"}}},
+		{name: "duplicated event type", newSubscription: webhook.NewSubscription{Tenant: tenant, URL: "https://example.com/hook", EventTypes: []string{"device.created", "device.created"}}},
+		{name: "short secret", newSubscription: webhook.NewSubscription{Tenant: tenant, URL: "https://example.com/hook", Secret: "short"}},
+	}
+
+	service := webhook.New(inmemory.New())
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := service.CreateSubscription(context.Background(), tc.newSubscription)
+			assert.ErrorIs(t, err, signature.ErrInvalidInput)
+		})
+	}
+}
+
+func TestSubscriptionSecretIsOnlyReturnedOnCreation(t *testing.T) {
+	ctx := context.Background()
+	service := webhook.New(inmemory.New())
+
+	created, err := service.CreateSubscription(ctx, webhook.NewSubscription{Tenant: tenant, URL: "https://example.com/hook"})
+	require.NoError(t, err)
+	assert.Len(t, created.Secret, 64)
+
+	got, err := service.GetSubscription(ctx, tenant, created.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.Secret)
+	assert.Equal(t, "https://example.com/hook", got.URL)
+
+	listed, err := service.ListSubscriptions(ctx, tenant)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Empty(t, listed[0].Secret)
+}
+
+func TestSubscriptionsAreScopedToTheirTenant(t *testing.T) {
+	ctx := context.Background()
+	service := webhook.New(inmemory.New())
+
+	created, err := service.CreateSubscription(ctx, webhook.NewSubscription{Tenant: tenant, URL: "https://example.com/hook"})
+	require.NoError(t, err)
+
+	_, err = service.GetSubscription(ctx, "other-tenant", created.ID)
+	assert.ErrorIs(t, err, signature.ErrNotFound)
+	assert.ErrorIs(t, service.DeleteSubscription(ctx, "other-tenant", created.ID), signature.ErrNotFound)
+
+	require.NoError(t, service.DeleteSubscription(ctx, tenant, created.ID))
+	_, err = service.GetSubscription(ctx, tenant, created.ID)
+	assert.ErrorIs(t, err, signature.ErrNotFound)
+}
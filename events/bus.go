@@ -0,0 +1,126 @@
+// Package events provides an in-process bus distributing the changes of signature devices to subscribers.
+package events
+
+import "sync"
+
+// subscriberBuffer is how many events a subscriber may lag behind before being dropped.
+const subscriberBuffer = 64
+
+// TypeReset is the type of the event Resume returns in place of events which may have been lost.
+const TypeReset = "reset"
+
+// Event is a change of a signature device. IDs are assigned by the Bus in publication order.
+type Event struct {
+	ID       uint64
+	Type     string
+	DeviceID string
+	Data     any
+}
+
+// Bus keeps the most recent events in a ring buffer, so that subscribers can resume after
+// a disconnection, and forwards new events to the subscribers of their device.
+type Bus struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	next        int
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	deviceID string
+	events   chan Event
+}
+
+// NewBus returns a Bus retaining the last historySize events for resumption.
+func NewBus(historySize int) *Bus {
+	return &Bus{
+		history:     make([]Event, 0, historySize),
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+// Publish assigns the next ID to the event and delivers it. It never blocks: a subscriber whose
+// buffer is full is dropped and its channel closed, and it is up to it to subscribe again.
+func (b *Bus) Publish(deviceID string, eventType string, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{ID: b.lastID, Type: eventType, DeviceID: deviceID, Data: data}
+	if len(b.history) < cap(b.history) {
+		b.history = append(b.history, event)
+	} else if cap(b.history) > 0 {
+		b.history[b.next] = event
+		b.next = (b.next + 1) % cap(b.history)
+	}
+
+	for sub := range b.subscribers {
+		if sub.deviceID != deviceID {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe returns a channel delivering the events of deviceID published from now on,
+// until cancel is called.
+func (b *Bus) Subscribe(deviceID string) (events <-chan Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribe(deviceID)
+}
+
+// Resume is like Subscribe, but first returns the retained events of deviceID published after
+// lastID. When some of them may be lost, as they were evicted from the history or lastID comes
+// from before a restart of the process, it returns a single TypeReset event instead, with the last
+// assigned ID: the subscriber has to read the current state of the device again.
+func (b *Bus) Resume(deviceID string, lastID uint64) (missed []Event, events <-chan Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events, cancel = b.subscribe(deviceID)
+	if lastID > b.lastID || lastID+1 < b.oldestID() {
+		return []Event{{ID: b.lastID, Type: TypeReset, DeviceID: deviceID}}, events, cancel
+	}
+	for i := range b.history {
+		event := b.history[(b.next+i)%len(b.history)]
+		if event.DeviceID == deviceID && event.ID > lastID {
+			missed = append(missed, event)
+		}
+	}
+
+	return missed, events, cancel
+}
+
+// oldestID returns the ID of the oldest event still retained, or the next ID to be assigned when
+// there is none. It must be called with b.mu held.
+func (b *Bus) oldestID() uint64 {
+	if len(b.history) == 0 {
+		return b.lastID + 1
+	}
+	return b.history[b.next%len(b.history)].ID
+}
+
+// subscribe registers a subscriber of deviceID. It must be called with b.mu held.
+func (b *Bus) subscribe(deviceID string) (<-chan Event, func()) {
+	sub := &subscriber{deviceID: deviceID, events: make(chan Event, subscriberBuffer)}
+	b.subscribers[sub] = struct{}{}
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, found := b.subscribers[sub]; found {
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+
+	return sub.events, cancel
+}
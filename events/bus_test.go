@@ -0,0 +1,106 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishDeliversToDeviceSubscribers(t *testing.T) {
+	bus := events.NewBus(10)
+	received, cancel := bus.Subscribe("device-1")
+	defer cancel()
+
+	bus.Publish("device-2", "device.created", nil)
+	bus.Publish("device-1", "device.created", "some-data")
+
+	event := <-received
+	assert.Equal(t, events.Event{ID: 2, Type: "device.created", DeviceID: "device-1", Data: "some-data"}, event)
+	assert.Empty(t, received)
+}
+
+func TestResumeReturnsMissedEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		lastID   uint64
+		expected []uint64
+	}{
+		{name: "right before the oldest event retained", lastID: 2, expected: []uint64{3, 5}},
+		{name: "after the last event seen", lastID: 3, expected: []uint64{5}},
+		{name: "up to date", lastID: 5, expected: nil},
+	}
+
+	bus := events.NewBus(3)
+	bus.Publish("device-1", "device.created", nil)
+	bus.Publish("device-2", "device.created", nil)
+	bus.Publish("device-1", "signature.created", nil)
+	bus.Publish("device-2", "signature.created", nil)
+	bus.Publish("device-1", "signature.created", nil)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			missed, _, cancel := bus.Resume("device-1", tc.lastID)
+			defer cancel()
+
+			var ids []uint64
+			for _, event := range missed {
+				ids = append(ids, event.ID)
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+}
+
+func TestResumeResetsWhenEventsAreLost(t *testing.T) {
+	tests := []struct {
+		name   string
+		lastID uint64
+	}{
+		{name: "evicted from the history", lastID: 1},
+		{name: "from the start", lastID: 0},
+		{name: "from before a restart", lastID: 42},
+	}
+
+	bus := events.NewBus(3)
+	for i := 0; i < 5; i++ {
+		bus.Publish("device-1", "signature.created", nil)
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			missed, _, cancel := bus.Resume("device-1", tc.lastID)
+			defer cancel()
+
+			assert.Equal(t, []events.Event{{ID: 5, Type: events.TypeReset, DeviceID: "device-1"}}, missed)
+		})
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	bus := events.NewBus(0)
+	received, cancel := bus.Subscribe("device-1")
+	defer cancel()
+
+	for i := 0; i < 100; i++ {
+		bus.Publish("device-1", "signature.created", i)
+	}
+
+	count := 0
+	for range received {
+		count++
+	}
+	assert.Equal(t, 64, count)
+}
+
+func TestCancelClosesChannel(t *testing.T) {
+	bus := events.NewBus(10)
+	received, cancel := bus.Subscribe("device-1")
+
+	cancel()
+	cancel()
+	bus.Publish("device-1", "device.created", nil)
+
+	_, open := <-received
+	assert.False(t, open)
+}
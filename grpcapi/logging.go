@@ -0,0 +1,65 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDKey is the metadata key carrying the request ID, as the X-Request-ID header does over HTTP.
+const requestIDKey = "x-request-id"
+
+// withRequestLogger puts a logger tagged with the request ID in ctx, reusing the ID sent by the client if any.
+func (s *Server) withRequestLogger(ctx context.Context) (context.Context, *slog.Logger) {
+	provided := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(requestIDKey)) > 0 {
+		provided = md.Get(requestIDKey)[0]
+	}
+	requestID := logging.RequestID(provided)
+
+	logger := s.logger.With(slog.String("request_id", requestID))
+	return logging.NewContext(ctx, logger), logger
+}
+
+func (s *Server) unaryLogger(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx, logger := s.withRequestLogger(ctx)
+
+	resp, err := handler(ctx, req)
+	logger.LogAttrs(ctx, slog.LevelInfo, "request served",
+		slog.String("method", info.FullMethod),
+		slog.String("code", status.Code(err).String()),
+		slog.Duration("duration", time.Since(start)),
+	)
+
+	return resp, err
+}
+
+func (s *Server) streamLogger(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, logger := s.withRequestLogger(stream.Context())
+
+	err := handler(srv, &loggedStream{ServerStream: stream, ctx: ctx})
+	logger.LogAttrs(ctx, slog.LevelInfo, "stream served",
+		slog.String("method", info.FullMethod),
+		slog.String("code", status.Code(err).String()),
+		slog.Duration("duration", time.Since(start)),
+	)
+
+	return err
+}
+
+// loggedStream overrides the context of a stream to carry the request logger.
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
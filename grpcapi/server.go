@@ -0,0 +1,224 @@
+// Package grpcapi exposes the signature service over gRPC, next to the REST API of package api.
+package grpcapi
+
+//go:generate protoc -I ../proto --go_out=.. --go_opt=module=github.com/fiskaly/coding-challenges/signing-service-challenge --go-grpc_out=.. --go-grpc_opt=module=github.com/fiskaly/coding-challenges/signing-service-challenge signingservice/v0/signing_service.proto
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/grpcapi/signingpb"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements signingpb.SigningServiceServer on top of the signature service.
+type Server struct {
+	signingpb.UnimplementedSigningServiceServer
+
+	listenAddress    string
+	signatureService signature.SignatureDeviceService
+	logger           *slog.Logger
+}
+
+// ServerOption configures optional features of the Server.
+type ServerOption func(*Server)
+
+// WithLogger sets the logger handed down to the services.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// NewServer is a factory to instantiate a new Server.
+func NewServer(listenAddress string, signatureService signature.SignatureDeviceService, opts ...ServerOption) *Server {
+	s := &Server{
+		listenAddress:    listenAddress,
+		signatureService: signatureService,
+		logger:           slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ShutdownTimeout bounds how long Serve waits for the calls in flight once its context is done,
+// before cancelling them.
+const ShutdownTimeout = 10 * time.Second
+
+// Run starts the Server on its own listen address, until ctx is done.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.listenAddress)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves gRPC requests on listener until ctx is done, then stops gracefully.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.unaryLogger),
+		grpc.ChainStreamInterceptor(s.streamLogger),
+	)
+	signingpb.RegisterSigningServiceServer(grpcServer, s)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- grpcServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(ShutdownTimeout):
+		grpcServer.Stop()
+	}
+	return <-served
+}
+
+func (s *Server) CreateDevice(ctx context.Context, request *signingpb.CreateDeviceRequest) (*signingpb.CreateDeviceResponse, error) {
+	id := request.GetId()
+	if id == "" {
+		id = uuid.NewString()
+	}
+
+	signDevice, created, err := s.signatureService.CreateSignatureDevice(ctx, signature.NewSignatureDevice{
+		ID:           id,
+		Tenant:       signature.DefaultTenant,
+		SignatureAlg: request.GetSignatureAlg(),
+		Label:        request.GetLabel(),
+		Metadata:     request.GetMetadata(),
+		Tags:         request.GetTags(),
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &signingpb.CreateDeviceResponse{
+		Device:  toDevice(signDevice),
+		Created: created,
+	}, nil
+}
+
+func (s *Server) GetDevice(ctx context.Context, request *signingpb.GetDeviceRequest) (*signingpb.Device, error) {
+	signDevice, err := s.signatureService.GetSignatureDevice(ctx, request.GetId())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return toDevice(signDevice), nil
+}
+
+func (s *Server) ListDevices(ctx context.Context, request *signingpb.ListDevicesRequest) (*signingpb.ListDevicesResponse, error) {
+	signDevices, err := s.signatureService.ListSignatureDevices(ctx, signature.ListFilter{
+		Tags:     request.GetTags(),
+		Metadata: request.GetMetadata(),
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	devices := make([]*signingpb.Device, 0, len(signDevices))
+	for _, signDevice := range signDevices {
+		devices = append(devices, toDevice(signDevice))
+	}
+
+	return &signingpb.ListDevicesResponse{Devices: devices}, nil
+}
+
+func (s *Server) SignTransaction(ctx context.Context, request *signingpb.SignTransactionRequest) (*signingpb.SignTransactionResponse, error) {
+	signedData, err := s.signatureService.SignData(ctx, request.GetDeviceId(), request.GetDataToBeSigned())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &signingpb.SignTransactionResponse{
+		Signature:  signedData.Signature,
+		SignedData: signedData.SignedData,
+	}, nil
+}
+
+func (s *Server) SignTransactions(stream signingpb.SigningService_SignTransactionsServer) error {
+	for {
+		request, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		response, err := s.SignTransaction(stream.Context(), request)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+}
+
+func toDevice(signDevice signature.SignatureDevice) *signingpb.Device {
+	return &signingpb.Device{
+		Id:               signDevice.ID,
+		SignatureAlg:     signDevice.SignatureAlg,
+		Label:            signDevice.Label,
+		Metadata:         signDevice.Metadata,
+		Tags:             signDevice.Tags,
+		SignatureCounter: int64(signDevice.SignatureCounter),
+		PublicKey:        string(signDevice.PublicKey),
+		Version:          signDevice.Version,
+		Status:           signDevice.Status,
+		KeyVersion:       int64(signDevice.KeyVersion),
+	}
+}
+
+var statusCodes = map[signature.Code]codes.Code{
+	signature.CodeNotFound:             codes.NotFound,
+	signature.CodeInvalidInput:         codes.InvalidArgument,
+	signature.CodeConflict:             codes.Aborted,
+	signature.CodeDeviceInactive:       codes.FailedPrecondition,
+	signature.CodeUnsupportedAlgorithm: codes.InvalidArgument,
+	signature.CodeVersionMismatch:      codes.Aborted,
+}
+
+// toStatus translates domain errors into gRPC status errors, hiding the details of internal errors
+// the same way the REST API does.
+func toStatus(ctx context.Context, err error) error {
+	var domainErr *signature.Error
+	if !errors.As(err, &domainErr) {
+		logging.FromContext(ctx).ErrorContext(ctx, "unexpected error", slog.String("error", err.Error()))
+		return status.Error(codes.Internal, "unexpected error")
+	}
+
+	code, found := statusCodes[domainErr.Code]
+	if !found {
+		logging.FromContext(ctx).ErrorContext(ctx, "unexpected error", slog.String("error", err.Error()))
+		return status.Error(codes.Internal, "unexpected error")
+	}
+
+	return status.Error(code, domainErr.Error())
+}
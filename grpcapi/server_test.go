@@ -0,0 +1,153 @@
+package grpcapi_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/grpcapi"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/grpcapi/signingpb"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newClient(t *testing.T) signingpb.SigningServiceClient {
+	t.Helper()
+
+	service := servicetest.New(t).Signature
+	server := grpcapi.NewServer("", service, grpcapi.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	listener := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ctx, listener) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-served)
+	})
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return signingpb.NewSigningServiceClient(conn)
+}
+
+func TestDevices(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+
+	created, err := client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{
+		Id:           "device-1",
+		SignatureAlg: "ECC",
+		Label:        "till",
+		Tags:         []string{"berlin"},
+	})
+	require.NoError(t, err)
+	assert.True(t, created.Created)
+	assert.Equal(t, "device-1", created.Device.Id)
+	assert.NotEmpty(t, created.Device.PublicKey)
+
+	_, err = client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{SignatureAlg: "RSA"})
+	require.NoError(t, err)
+
+	device, err := client.GetDevice(ctx, &signingpb.GetDeviceRequest{Id: "device-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "till", device.Label)
+	assert.Equal(t, "active", device.Status)
+	assert.Equal(t, int64(1), device.KeyVersion)
+
+	listed, err := client.ListDevices(ctx, &signingpb.ListDevicesRequest{Tags: []string{"berlin"}})
+	require.NoError(t, err)
+	require.Len(t, listed.Devices, 1)
+	assert.Equal(t, "device-1", listed.Devices[0].Id)
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+
+	_, err := client.GetDevice(ctx, &signingpb.GetDeviceRequest{Id: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{SignatureAlg: "DSA"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{Id: "device-1", SignatureAlg: "ECC"})
+	require.NoError(t, err)
+	_, err = client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{Id: "device-1", SignatureAlg: "RSA"})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	_, err = client.SignTransaction(ctx, &signingpb.SignTransactionRequest{DeviceId: "missing", DataToBeSigned: "data"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestSignTransaction(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+
+	_, err := client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{Id: "device-1", SignatureAlg: "ECC"})
+	require.NoError(t, err)
+
+	signed, err := client.SignTransaction(ctx, &signingpb.SignTransactionRequest{DeviceId: "device-1", DataToBeSigned: "data"})
+	require.NoError(t, err)
+	assert.Equal(t, "0_data_"+base64.StdEncoding.EncodeToString([]byte("device-1")), signed.SignedData)
+	assert.NotEmpty(t, signed.Signature)
+}
+
+func TestSignTransactions(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+
+	_, err := client.CreateDevice(ctx, &signingpb.CreateDeviceRequest{Id: "device-1", SignatureAlg: "RSA"})
+	require.NoError(t, err)
+
+	stream, err := client.SignTransactions(ctx)
+	require.NoError(t, err)
+	for _, data := range []string{"first", "second", "third"} {
+		require.NoError(t, stream.Send(&signingpb.SignTransactionRequest{DeviceId: "device-1", DataToBeSigned: data}))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	var signedData []string
+	for {
+		signed, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		signedData = append(signedData, signed.SignedData)
+	}
+	require.Len(t, signedData, 3)
+	assert.Equal(t, "0_first_"+base64.StdEncoding.EncodeToString([]byte("device-1")), signedData[0])
+	assert.Contains(t, signedData[1], "1_second_")
+	assert.Contains(t, signedData[2], "2_third_")
+
+	device, err := client.GetDevice(ctx, &signingpb.GetDeviceRequest{Id: "device-1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), device.SignatureCounter)
+}
+
+func TestSignTransactionsStopsOnError(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+
+	stream, err := client.SignTransactions(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&signingpb.SignTransactionRequest{DeviceId: "missing", DataToBeSigned: "data"}))
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,315 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: signingservice/v0/signing_service.proto
+
+package signingpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	SigningService_CreateDevice_FullMethodName     = "/signingservice.v0.SigningService/CreateDevice"
+	SigningService_GetDevice_FullMethodName        = "/signingservice.v0.SigningService/GetDevice"
+	SigningService_ListDevices_FullMethodName      = "/signingservice.v0.SigningService/ListDevices"
+	SigningService_SignTransaction_FullMethodName  = "/signingservice.v0.SigningService/SignTransaction"
+	SigningService_SignTransactions_FullMethodName = "/signingservice.v0.SigningService/SignTransactions"
+)
+
+// SigningServiceClient is the client API for SigningService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// SigningService manages signature devices and signs transaction data with them.
+// It mirrors the REST API served under /api/v0.
+type SigningServiceClient interface {
+	// CreateDevice creates a signature device with a new key pair. Creating again an
+	// identical device returns the existing one with created set to false.
+	CreateDevice(ctx context.Context, in *CreateDeviceRequest, opts ...grpc.CallOption) (*CreateDeviceResponse, error)
+	// GetDevice returns a signature device.
+	GetDevice(ctx context.Context, in *GetDeviceRequest, opts ...grpc.CallOption) (*Device, error)
+	// ListDevices lists the signature devices ordered by ID.
+	ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error)
+	// SignTransaction signs data with a device and increments its signature counter.
+	SignTransaction(ctx context.Context, in *SignTransactionRequest, opts ...grpc.CallOption) (*SignTransactionResponse, error)
+	// SignTransactions signs every request of the stream in order, answering each with
+	// its signature. The stream is closed with an error status on the first failure.
+	SignTransactions(ctx context.Context, opts ...grpc.CallOption) (SigningService_SignTransactionsClient, error)
+}
+
+type signingServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSigningServiceClient(cc grpc.ClientConnInterface) SigningServiceClient {
+	return &signingServiceClient{cc}
+}
+
+func (c *signingServiceClient) CreateDevice(ctx context.Context, in *CreateDeviceRequest, opts ...grpc.CallOption) (*CreateDeviceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateDeviceResponse)
+	err := c.cc.Invoke(ctx, SigningService_CreateDevice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signingServiceClient) GetDevice(ctx context.Context, in *GetDeviceRequest, opts ...grpc.CallOption) (*Device, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Device)
+	err := c.cc.Invoke(ctx, SigningService_GetDevice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signingServiceClient) ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDevicesResponse)
+	err := c.cc.Invoke(ctx, SigningService_ListDevices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signingServiceClient) SignTransaction(ctx context.Context, in *SignTransactionRequest, opts ...grpc.CallOption) (*SignTransactionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SignTransactionResponse)
+	err := c.cc.Invoke(ctx, SigningService_SignTransaction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signingServiceClient) SignTransactions(ctx context.Context, opts ...grpc.CallOption) (SigningService_SignTransactionsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SigningService_ServiceDesc.Streams[0], SigningService_SignTransactions_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &signingServiceSignTransactionsClient{ClientStream: stream}
+	return x, nil
+}
+
+type SigningService_SignTransactionsClient interface {
+	Send(*SignTransactionRequest) error
+	Recv() (*SignTransactionResponse, error)
+	grpc.ClientStream
+}
+
+type signingServiceSignTransactionsClient struct {
+	grpc.ClientStream
+}
+
+func (x *signingServiceSignTransactionsClient) Send(m *SignTransactionRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *signingServiceSignTransactionsClient) Recv() (*SignTransactionResponse, error) {
+	m := new(SignTransactionResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SigningServiceServer is the server API for SigningService service.
+// All implementations must embed UnimplementedSigningServiceServer
+// for forward compatibility
+//
+// SigningService manages signature devices and signs transaction data with them.
+// It mirrors the REST API served under /api/v0.
+type SigningServiceServer interface {
+	// CreateDevice creates a signature device with a new key pair. Creating again an
+	// identical device returns the existing one with created set to false.
+	CreateDevice(context.Context, *CreateDeviceRequest) (*CreateDeviceResponse, error)
+	// GetDevice returns a signature device.
+	GetDevice(context.Context, *GetDeviceRequest) (*Device, error)
+	// ListDevices lists the signature devices ordered by ID.
+	ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error)
+	// SignTransaction signs data with a device and increments its signature counter.
+	SignTransaction(context.Context, *SignTransactionRequest) (*SignTransactionResponse, error)
+	// SignTransactions signs every request of the stream in order, answering each with
+	// its signature. The stream is closed with an error status on the first failure.
+	SignTransactions(SigningService_SignTransactionsServer) error
+	mustEmbedUnimplementedSigningServiceServer()
+}
+
+// UnimplementedSigningServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedSigningServiceServer struct {
+}
+
+func (UnimplementedSigningServiceServer) CreateDevice(context.Context, *CreateDeviceRequest) (*CreateDeviceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateDevice not implemented")
+}
+func (UnimplementedSigningServiceServer) GetDevice(context.Context, *GetDeviceRequest) (*Device, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDevice not implemented")
+}
+func (UnimplementedSigningServiceServer) ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDevices not implemented")
+}
+func (UnimplementedSigningServiceServer) SignTransaction(context.Context, *SignTransactionRequest) (*SignTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SignTransaction not implemented")
+}
+func (UnimplementedSigningServiceServer) SignTransactions(SigningService_SignTransactionsServer) error {
+	return status.Errorf(codes.Unimplemented, "method SignTransactions not implemented")
+}
+func (UnimplementedSigningServiceServer) mustEmbedUnimplementedSigningServiceServer() {}
+
+// UnsafeSigningServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SigningServiceServer will
+// result in compilation errors.
+type UnsafeSigningServiceServer interface {
+	mustEmbedUnimplementedSigningServiceServer()
+}
+
+func RegisterSigningServiceServer(s grpc.ServiceRegistrar, srv SigningServiceServer) {
+	s.RegisterService(&SigningService_ServiceDesc, srv)
+}
+
+func _SigningService_CreateDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SigningServiceServer).CreateDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SigningService_CreateDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SigningServiceServer).CreateDevice(ctx, req.(*CreateDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SigningService_GetDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SigningServiceServer).GetDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SigningService_GetDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SigningServiceServer).GetDevice(ctx, req.(*GetDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SigningService_ListDevices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDevicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SigningServiceServer).ListDevices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SigningService_ListDevices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SigningServiceServer).ListDevices(ctx, req.(*ListDevicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SigningService_SignTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SigningServiceServer).SignTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SigningService_SignTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SigningServiceServer).SignTransaction(ctx, req.(*SignTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SigningService_SignTransactions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SigningServiceServer).SignTransactions(&signingServiceSignTransactionsServer{ServerStream: stream})
+}
+
+type SigningService_SignTransactionsServer interface {
+	Send(*SignTransactionResponse) error
+	Recv() (*SignTransactionRequest, error)
+	grpc.ServerStream
+}
+
+type signingServiceSignTransactionsServer struct {
+	grpc.ServerStream
+}
+
+func (x *signingServiceSignTransactionsServer) Send(m *SignTransactionResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *signingServiceSignTransactionsServer) Recv() (*SignTransactionRequest, error) {
+	m := new(SignTransactionRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SigningService_ServiceDesc is the grpc.ServiceDesc for SigningService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SigningService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "signingservice.v0.SigningService",
+	HandlerType: (*SigningServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateDevice",
+			Handler:    _SigningService_CreateDevice_Handler,
+		},
+		{
+			MethodName: "GetDevice",
+			Handler:    _SigningService_GetDevice_Handler,
+		},
+		{
+			MethodName: "ListDevices",
+			Handler:    _SigningService_ListDevices_Handler,
+		},
+		{
+			MethodName: "SignTransaction",
+			Handler:    _SigningService_SignTransaction_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SignTransactions",
+			Handler:       _SigningService_SignTransactions_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "signingservice/v0/signing_service.proto",
+}
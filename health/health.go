@@ -0,0 +1,197 @@
+// Package health aggregates dependency checks into a report following the IETF
+// "Health Check Response Format for HTTP APIs" draft (application/health+json).
+package health
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MediaType is the content type of a health report.
+const MediaType = "application/health+json"
+
+// Status values of a check or of the whole report.
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// DefaultTimeout bounds how long a single check may run.
+const DefaultTimeout = 2 * time.Second
+
+// Checker verifies that a dependency is usable. A nil error means pass,
+// an error wrapping a Warning means warn, any other error means fail.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to the Checker interface.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Warning marks a degraded, but still usable, dependency.
+type Warning struct {
+	Err error
+}
+
+func (w *Warning) Error() string {
+	return w.Err.Error()
+}
+
+func (w *Warning) Unwrap() error {
+	return w.Err
+}
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	ComponentType string `json:"componentType,omitempty"`
+	Status        string `json:"status"`
+	Time          string `json:"time"`
+	Output        string `json:"output,omitempty"`
+}
+
+// Report is the aggregated health of the service.
+type Report struct {
+	Status    string                   `json:"status"`
+	Version   string                   `json:"version,omitempty"`
+	ReleaseID string                   `json:"releaseId,omitempty"`
+	ServiceID string                   `json:"serviceId,omitempty"`
+	Checks    map[string][]CheckResult `json:"checks,omitempty"`
+}
+
+type registration struct {
+	name          string
+	componentType string
+	checker       Checker
+}
+
+// Registry holds the checks of every dependency the service needs to be ready.
+type Registry struct {
+	version   string
+	releaseID string
+	serviceID string
+	timeout   time.Duration
+
+	mu     sync.RWMutex
+	checks []registration
+}
+
+// NewRegistry creates an empty Registry reporting the given build version and release.
+func NewRegistry(serviceID string, version string, releaseID string) *Registry {
+	return &Registry{
+		version:   version,
+		releaseID: releaseID,
+		serviceID: serviceID,
+		timeout:   DefaultTimeout,
+	}
+}
+
+// Register adds a check. Following the IETF format, name should be
+// "<componentName>:<measurementName>", e.g. "store:connectivity".
+func (r *Registry) Register(name string, componentType string, checker Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, registration{
+		name:          name,
+		componentType: componentType,
+		checker:       checker,
+	})
+}
+
+// Version returns the build version reported by the registry.
+func (r *Registry) Version() string {
+	return r.version
+}
+
+// Live reports the liveness of the process itself, without running any dependency check.
+func (r *Registry) Live() Report {
+	return Report{
+		Status:    StatusPass,
+		Version:   r.version,
+		ReleaseID: r.releaseID,
+		ServiceID: r.serviceID,
+	}
+}
+
+// Ready runs every registered check concurrently and aggregates their results:
+// the report fails if any check fails and warns if any check warns.
+func (r *Registry) Ready(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]registration(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check registration) {
+			defer wg.Done()
+			results[i] = r.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := r.Live()
+	if len(checks) > 0 {
+		report.Checks = map[string][]CheckResult{}
+	}
+	for i, check := range checks {
+		report.Checks[check.name] = append(report.Checks[check.name], results[i])
+		report.Status = worst(report.Status, results[i].Status)
+	}
+	for _, checkResults := range report.Checks {
+		sort.SliceStable(checkResults, func(i, j int) bool { return checkResults[i].ComponentType < checkResults[j].ComponentType })
+	}
+
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, check registration) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	result := CheckResult{
+		ComponentType: check.componentType,
+		Status:        StatusPass,
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- check.checker.Check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result.Time = time.Now().UTC().Format(time.RFC3339)
+
+	var warning *Warning
+	switch {
+	case err == nil:
+	case errors.As(err, &warning):
+		result.Status = StatusWarn
+		result.Output = err.Error()
+	default:
+		result.Status = StatusFail
+		result.Output = err.Error()
+	}
+
+	return result
+}
+
+func worst(a string, b string) string {
+	rank := map[string]int{StatusPass: 0, StatusWarn: 1, StatusFail: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,86 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadyWithoutChecksPasses(t *testing.T) {
+	registry := health.NewRegistry("some-service", "v1.2.3", "abc123")
+
+	report := registry.Ready(context.Background())
+	assert.Equal(t, health.StatusPass, report.Status)
+	assert.Equal(t, "v1.2.3", report.Version)
+	assert.Equal(t, "abc123", report.ReleaseID)
+	assert.Empty(t, report.Checks)
+}
+
+func TestReadyAggregatesWorstStatus(t *testing.T) {
+	tests := []struct{
+		name string
+		errs []error
+		status string
+	}{
+		{
+			name: "all checks pass",
+			errs: []error{nil, nil},
+			status: health.StatusPass,
+		},
+		{
+			name: "one check warns",
+			errs: []error{nil, &health.Warning{Err: errors.New("degraded")}},
+			status: health.StatusWarn,
+		},
+		{
+			name: "one check fails",
+			errs: []error{&health.Warning{Err: errors.New("degraded")}, errors.New("down")},
+			status: health.StatusFail,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			registry := health.NewRegistry("some-service", "v1", "")
+			for _, err := range tc.errs {
+				err := err
+				registry.Register("store:connectivity", "datastore", health.CheckerFunc(func(ctx context.Context) error {
+					return err
+				}))
+			}
+
+			report := registry.Ready(context.Background())
+			assert.Equal(t, tc.status, report.Status)
+			assert.Len(t, report.Checks["store:connectivity"], len(tc.errs))
+		})
+	}
+}
+
+func TestReadyFailsOnHangingCheck(t *testing.T) {
+	registry := health.NewRegistry("some-service", "v1", "")
+	registry.Register("queue:connectivity", "component", health.CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	report := registry.Ready(ctx)
+	assert.Equal(t, health.StatusFail, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["queue:connectivity"][0].Output)
+}
+
+func TestLiveDoesNotRunChecks(t *testing.T) {
+	registry := health.NewRegistry("some-service", "v1", "")
+	registry.Register("store:connectivity", "datastore", health.CheckerFunc(func(ctx context.Context) error {
+		t.Fatal("liveness must not run dependency checks")
+		return nil
+	}))
+
+	assert.Equal(t, health.StatusPass, registry.Live().Status)
+}
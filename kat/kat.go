@@ -0,0 +1,207 @@
+// Package kat checks the signing service against known answer test vectors: fixed keys and inputs,
+// together with the signed data and signatures they must produce.
+//
+// A vector creates a device with its key pair and signs its transactions in order, through the
+// signature service, so that the formatting and the chaining of the signed data are covered along
+// with the signatures. RSA PKCS#1 v1.5 signatures are deterministic, and so are ECDSA signatures
+// made with cryptotest.DeterministicECCSignerFactory (RFC 6979): both are compared byte for byte.
+// Randomized ECDSA signatures are verified against the public key instead, and the signed data
+// expected to chain from them.
+//
+//	go test ./kat
+//	go test ./kat -update
+package kat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+)
+
+// Vector is a device and the signatures it makes, stored as a JSON file.
+type Vector struct {
+	Name        string `json:"-"`
+	Description string `json:"description"`
+	Algorithm   string `json:"algorithm"`
+	DeviceID    string `json:"device_id"`
+	// PublicKey and PrivateKey are PEM encoded, as the key generator of the algorithm encodes them
+	PublicKey    string        `json:"public_key"`
+	PrivateKey   string        `json:"private_key"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+// Transaction is a single signature of a vector.
+type Transaction struct {
+	DataToBeSigned string `json:"data_to_be_signed"`
+	SignedData     string `json:"signed_data"`
+	// Signature is base64 encoded
+	Signature string `json:"signature"`
+}
+
+// Algorithm is a registered signature algorithm under test.
+type Algorithm struct {
+	Signer   crypto.SignerFactory
+	Verifier crypto.VerifierFactory
+	// Deterministic signers must reproduce the signatures of the vectors byte for byte
+	Deterministic bool
+}
+
+// Load reads the vectors of the JSON files in dir, sorted by file name.
+func Load(dir string) ([]Vector, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	vectors := []Vector{}
+	for _, path := range paths {
+		encoded, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var vector Vector
+		if err := json.Unmarshal(encoded, &vector); err != nil {
+			return nil, fmt.Errorf("error decoding vector '%v': %w", path, err)
+		}
+		vector.Name = filepath.Base(path)
+		vectors = append(vectors, vector)
+	}
+
+	return vectors, nil
+}
+
+// Save writes vector to dir, under its name.
+func Save(dir string, vector Vector) error {
+	encoded, err := json.MarshalIndent(vector, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, vector.Name), append(encoded, '\n'), 0o644)
+}
+
+// CheckAll checks every vector with its algorithm, and that every algorithm has at least one vector.
+// All mismatches are reported at once.
+func CheckAll(ctx context.Context, vectors []Vector, algorithms map[string]Algorithm) error {
+	errs := []error{}
+	covered := map[string]bool{}
+	for _, vector := range vectors {
+		algorithm, found := algorithms[vector.Algorithm]
+		if !found {
+			errs = append(errs, fmt.Errorf("%v: algorithm '%v' is not registered", vector.Name, vector.Algorithm))
+			continue
+		}
+		covered[vector.Algorithm] = true
+		if err := Check(ctx, vector, algorithm); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", vector.Name, err))
+		}
+	}
+
+	names := []string{}
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !covered[name] {
+			errs = append(errs, fmt.Errorf("algorithm '%v' has no vector", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Check signs the transactions of vector, and compares the results with the expected ones.
+func Check(ctx context.Context, vector Vector, algorithm Algorithm) error {
+	actual, err := Sign(ctx, vector, algorithm.Signer)
+	if err != nil {
+		return err
+	}
+	verifier, err := algorithm.Verifier([]byte(vector.PublicKey))
+	if err != nil {
+		return fmt.Errorf("error decoding public key: %w", err)
+	}
+
+	errs := []error{}
+	for i, transaction := range vector.Transactions {
+		expectedSignedData := transaction.SignedData
+		if !algorithm.Deterministic && i > 0 {
+			// a randomized signature changes the signed data of every following transaction
+			expectedSignedData = signature.SecuredData{
+				SignatureCounter: i,
+				Data:             transaction.DataToBeSigned,
+				LastSignature:    actual[i-1].Signature,
+			}.String()
+		}
+		if actual[i].SignedData != expectedSignedData {
+			errs = append(errs, fmt.Errorf("transaction %v: signed data '%v', expected '%v'", i, actual[i].SignedData, expectedSignedData))
+			continue
+		}
+		if err := verify(verifier, transaction); err != nil {
+			errs = append(errs, fmt.Errorf("transaction %v: expected signature: %w", i, err))
+		}
+		if err := verify(verifier, actual[i]); err != nil {
+			errs = append(errs, fmt.Errorf("transaction %v: %w", i, err))
+		}
+		if algorithm.Deterministic && actual[i].Signature != transaction.Signature {
+			errs = append(errs, fmt.Errorf("transaction %v: signature '%v', expected '%v'", i, actual[i].Signature, transaction.Signature))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Sign creates the device of vector with its key pair, and signs its transactions in order.
+func Sign(ctx context.Context, vector Vector, signerFactory crypto.SignerFactory) ([]Transaction, error) {
+	service := signature.New(inmemory.New(), map[string]signature.KeyGenerator{
+		vector.Algorithm: func() ([]byte, []byte, error) {
+			return []byte(vector.PublicKey), []byte(vector.PrivateKey), nil
+		},
+	}, map[string]crypto.SignerFactory{
+		vector.Algorithm: signerFactory,
+	})
+	_, _, err := service.CreateSignatureDevice(ctx, signature.NewSignatureDevice{
+		ID:           vector.DeviceID,
+		Tenant:       "known-answer-tests",
+		SignatureAlg: vector.Algorithm,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating device: %w", err)
+	}
+
+	transactions := []Transaction{}
+	for _, transaction := range vector.Transactions {
+		signed, err := service.SignData(ctx, vector.DeviceID, transaction.DataToBeSigned)
+		if err != nil {
+			return nil, fmt.Errorf("error signing '%v': %w", transaction.DataToBeSigned, err)
+		}
+		transactions = append(transactions, Transaction{
+			DataToBeSigned: transaction.DataToBeSigned,
+			SignedData:     signed.SignedData,
+			Signature:      signed.Signature,
+		})
+	}
+
+	return transactions, nil
+}
+
+func verify(verifier crypto.Verifier, transaction Transaction) error {
+	signature, err := base64.StdEncoding.DecodeString(transaction.Signature)
+	if err != nil {
+		return fmt.Errorf("signature is not base64 encoded: %w", err)
+	}
+	digest := sha256.Sum256([]byte(transaction.SignedData))
+
+	return verifier.Verify(digest[:], signature)
+}
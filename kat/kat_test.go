@@ -0,0 +1,120 @@
+package kat_test
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto/cryptotest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/kat"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the expected signed data and signatures of the vectors")
+
+const vectorsDir = "testdata"
+
+// algorithms are the algorithms the service registers, with deterministic ECDSA.
+var algorithms = registeredAlgorithms()
+
+func registeredAlgorithms() map[string]kat.Algorithm {
+	verifiers := crypto.VerifierFactories()
+	algorithms := map[string]kat.Algorithm{}
+	for name, signer := range crypto.SignerFactories() {
+		if name == "ECC" {
+			signer = cryptotest.DeterministicECCSignerFactory
+		}
+		algorithms[name] = kat.Algorithm{Signer: signer, Verifier: verifiers[name], Deterministic: true}
+	}
+	return algorithms
+}
+
+func newContext() context.Context {
+	return logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func loadVectors(t *testing.T) []kat.Vector {
+	t.Helper()
+
+	vectors, err := kat.Load(vectorsDir)
+	require.NoError(t, err)
+	require.NotEmpty(t, vectors)
+	return vectors
+}
+
+func TestKnownAnswers(t *testing.T) {
+	ctx := newContext()
+	vectors := loadVectors(t)
+
+	if *update {
+		for _, vector := range vectors {
+			transactions, err := kat.Sign(ctx, vector, algorithms[vector.Algorithm].Signer)
+			require.NoError(t, err)
+			vector.Transactions = transactions
+			require.NoError(t, kat.Save(vectorsDir, vector))
+		}
+		vectors = loadVectors(t)
+	}
+
+	assert.NoError(t, kat.CheckAll(ctx, vectors, algorithms))
+}
+
+func TestEveryAlgorithmHasVectors(t *testing.T) {
+	covered := map[string]bool{}
+	for _, vector := range loadVectors(t) {
+		covered[vector.Algorithm] = true
+	}
+	for name, algorithm := range algorithms {
+		assert.NotNil(t, algorithm.Verifier, "algorithm %v has no verifier", name)
+		assert.True(t, covered[name], "algorithm %v has no vector", name)
+	}
+}
+
+func TestRandomizedSignaturesAreVerified(t *testing.T) {
+	randomized := map[string]kat.Algorithm{
+		"ECC": {Signer: crypto.ECCSignerFactory, Verifier: crypto.ECCVerifierFactory},
+	}
+	for _, vector := range loadVectors(t) {
+		if vector.Algorithm == "ECC" {
+			assert.NoError(t, kat.Check(newContext(), vector, randomized["ECC"]))
+		}
+	}
+
+	// byte for byte, randomized signatures do not match
+	randomizedECC := randomized["ECC"]
+	randomizedECC.Deterministic = true
+	for _, vector := range loadVectors(t) {
+		if vector.Algorithm == "ECC" {
+			assert.ErrorContains(t, kat.Check(newContext(), vector, randomizedECC), "signature")
+		}
+	}
+}
+
+func TestCheckReportsMismatches(t *testing.T) {
+	ctx := newContext()
+	vectors := loadVectors(t)
+
+	for _, vector := range vectors {
+		t.Run(vector.Name, func(t *testing.T) {
+			algorithm := algorithms[vector.Algorithm]
+			require.GreaterOrEqual(t, len(vector.Transactions), 2)
+
+			tampered := vector
+			tampered.Transactions = append([]kat.Transaction{}, vector.Transactions...)
+			tampered.Transactions[1].SignedData = "1_tampered_" + vector.Transactions[0].Signature
+			assert.ErrorContains(t, kat.Check(ctx, tampered, algorithm), "transaction 1: signed data")
+
+			tampered.Transactions = append([]kat.Transaction{}, vector.Transactions...)
+			tampered.Transactions[0].Signature = vector.Transactions[1].Signature
+			assert.ErrorContains(t, kat.Check(ctx, tampered, algorithm), "transaction 0: expected signature: invalid signature")
+		})
+	}
+
+	assert.ErrorContains(t, kat.CheckAll(ctx, vectors[:1], algorithms), "has no vector")
+	assert.ErrorContains(t, kat.CheckAll(ctx, vectors, map[string]kat.Algorithm{}), "is not registered")
+}
@@ -0,0 +1,36 @@
+// Package logging carries a structured logger through the request context.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger when there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// validRequestID restricts client provided request IDs to something safe to log and echo back.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID returns the request ID provided by the client when it is valid, a new one otherwise.
+func RequestID(provided string) string {
+	if validRequestID.MatchString(provided) {
+		return provided
+	}
+	return uuid.NewString()
+}
@@ -0,0 +1,37 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContextReturnsCarriedLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil)).With("request_id", "some-request-id")
+
+	ctx := logging.NewContext(context.Background(), logger)
+	logging.FromContext(ctx).Info("some message")
+
+	assert.Contains(t, buf.String(), `"request_id":"some-request-id"`)
+}
+
+func TestFromContextFallsBackToDefault(t *testing.T) {
+	assert.Equal(t, slog.Default(), logging.FromContext(context.Background()))
+}
+
+func TestRequestIDKeepsValidIDs(t *testing.T) {
+	assert.Equal(t, "some-request.id:1", logging.RequestID("some-request.id:1"))
+
+	for _, provided := range []string{"", "some request", strings.Repeat("a", 129)} {
+		requestID := logging.RequestID(provided)
+		assert.NotEqual(t, provided, requestID)
+		assert.NoError(t, uuid.Validate(requestID))
+	}
+}
@@ -1,32 +1,280 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/backup"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/export"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/webhook"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/events"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/grpcapi"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/health"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/keygen"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/dualwrite"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/filelog"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/storetrace"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 const (
 	ListenAddress = ":8080"
+	GRPCListenAddress = ":9090"
+	ServiceName = "signing-service"
+	EventsHistorySize = 1024
+	WebhookDispatchInterval = time.Second
 	// TODO: add further configuration parameters here ...
 )
 
+// Build information, injected at link time:
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.releaseID=$(git rev-parse --short HEAD)"
+var (
+	version = "dev"
+	releaseID = ""
+)
+
+// getEnv returns the value of the environment variable key, or fallback when it is unset.
+func getEnv(key string, fallback string) string {
+	if value, found := os.LookupEnv(key); found {
+		return value
+	}
+	return fallback
+}
+
+// backend stores the devices as well as the webhooks, so that both share the outbox.
+type backend interface {
+	store.Store
+	store.WebhookStore
+}
+
+// openStore persists the devices in STORE_DIR when it is set, and keeps them in memory otherwise.
+func openStore() (backend, func() error, error) {
+	if dir := getEnv("STORE_DIR", ""); dir != "" {
+		fileStore, err := filelog.Open(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return fileStore, fileStore.Close, nil
+	}
+
+	// STORE_JOURNAL mirrors the device events to a file, which cmd/replay turns back into devices
+	if path := getEnv("STORE_JOURNAL", ""); path != "" {
+		// the journal holds the private keys in the clear, and the journals of previous runs are kept
+		journal, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, nil, err
+		}
+		return inmemory.New(inmemory.WithJournal(journal)), journal.Close, nil
+	}
+
+	return inmemory.New(), func() error { return nil }, nil
+}
+
+// exportKey reads the ECC private key signing the audit exports from EXPORT_KEY_FILE. Without it, a
+// key is generated at startup: the exports are then only verifiable until the service restarts.
+func exportKey(logger *slog.Logger) ([]byte, error) {
+	if path := getEnv("EXPORT_KEY_FILE", ""); path != "" {
+		return os.ReadFile(path)
+	}
+
+	logger.Warn("EXPORT_KEY_FILE is not set: audit exports are signed with an ephemeral key")
+	_, privateKey, err := keygen.ECC()
+	return privateKey, err
+}
+
+// backupWrapper reads the key wrapping the private keys of the backups from BACKUP_KEY_FILE: 32
+// random bytes, base64 encoded. Without it, backups are disabled.
+func backupWrapper() (*crypto.KeyWrapper, error) {
+	path := getEnv("BACKUP_KEY_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("backup key is not base64 encoded: %w", err)
+	}
+	return crypto.NewKeyWrapper(key)
+}
+
+// migrateStore migrates the devices to the file store in STORE_MIGRATE_TO when it is set: the
+// devices are copied in the background, while the writes of the service are mirrored to it. Once
+// the migration is verified, the service can be restarted with STORE_DIR pointing to it. The
+// returned function stops the migration and waits for it, before closing the file store.
+func migrateStore(logger *slog.Logger, primary store.Store) (store.Store, func() error, error) {
+	dir := getEnv("STORE_MIGRATE_TO", "")
+	if dir == "" {
+		return primary, func() error { return nil }, nil
+	}
+	secondary, err := filelog.Open(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dual := dualwrite.New(primary, secondary)
+	migrator := backup.NewMigrator(primary, secondary, crypto.VerifierFactories(), backup.WithDeviceLock(dual.LockDevice))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := migrator.Migrate(ctx); err != nil {
+			logger.Error("store migration failed", slog.String("error", err.Error()))
+			return
+		}
+		if _, err := migrator.Verify(ctx); err != nil {
+			logger.Error("store migration verification failed", slog.String("error", err.Error()))
+		}
+	}()
+
+	stop := func() error {
+		cancel()
+		<-done
+		return secondary.Close()
+	}
+	return dual, stop, nil
+}
+
+// countDevices starts the devices gauge from the devices s holds, which the service only counts up
+// and down.
+func countDevices(s store.Store, serviceMetrics *metrics.Metrics) error {
+	counts, err := backup.CountDevices(context.Background(), s)
+	if err != nil {
+		return err
+	}
+	serviceMetrics.SetDevices(counts)
+	return nil
+}
+
 func main() {
-	store := inmemory.New()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	// SIGINT and SIGTERM stop the servers, then the deferred clean ups of run close the stores
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, logger); err != nil {
+		logger.Error("service stopped", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	logger.Info("service stopped")
+}
+
+// run serves the service until ctx is done or a server fails, and returns once everything it
+// started has stopped.
+func run(ctx context.Context, logger *slog.Logger) error {
+	// OTEL_TRACES_EXPORTER selects where spans go: none, stdout or otlp
+	shutdownTracing, err := tracing.Setup(context.Background(), getEnv("OTEL_TRACES_EXPORTER", tracing.ExporterNone), ServiceName)
+	if err != nil {
+		return fmt.Errorf("could not set up tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	serviceMetrics := metrics.New(registry)
+
+	memoryStore, closeStore, err := openStore()
+	if err != nil {
+		return fmt.Errorf("could not open store: %w", err)
+	}
+	defer closeStore()
+	deviceStore, closeMigration, err := migrateStore(logger, memoryStore)
+	if err != nil {
+		return fmt.Errorf("could not open store to migrate to: %w", err)
+	}
+	defer closeMigration()
+	if err := countDevices(deviceStore, serviceMetrics); err != nil {
+		return fmt.Errorf("could not count signature devices: %w", err)
+	}
+	store := storetrace.New(deviceStore)
+	healthRegistry := health.NewRegistry(ServiceName, version, releaseID)
+	healthRegistry.Register("store:connectivity", "datastore", health.CheckerFunc(store.Ping))
+
+	bus := events.NewBus(EventsHistorySize)
 	service := signature.New(store, map[string]signature.KeyGenerator{
 		"RSA": keygen.RSA,
 		"ECC": keygen.ECC,
-	}, map[string]crypto.SignerFactory{
-		"RSA": crypto.RSASignerFactory,
-		"ECC": crypto.ECCSignerFactory,
-	})
-	server := api.NewServer(ListenAddress, service)
+	}, crypto.SignerFactories(), signature.WithMetrics(serviceMetrics), signature.WithPublisher(bus))
 
-	if err := server.Run(); err != nil {
-		log.Fatal("Could not start server on ", ListenAddress)
+	privateExportKey, err := exportKey(logger)
+	if err != nil {
+		return fmt.Errorf("could not read export key: %w", err)
+	}
+	exporter, err := export.New(store, privateExportKey)
+	if err != nil {
+		return fmt.Errorf("could not set up exports: %w", err)
 	}
+	healthRegistry.Register("export:key", "component", health.CheckerFunc(exporter.CheckKey))
+	dispatcher := webhook.NewDispatcher(memoryStore)
+	healthRegistry.Register("webhooks:backlog", "component", health.CheckerFunc(dispatcher.CheckBacklog))
+
+	serverOptions := []api.ServerOption{api.WithMetrics(serviceMetrics), api.WithLogger(logger), api.WithHealth(healthRegistry), api.WithEvents(bus), api.WithWebhooks(webhook.New(memoryStore)), api.WithExports(exporter)}
+	wrapper, err := backupWrapper()
+	if err != nil {
+		return fmt.Errorf("could not read backup key: %w", err)
+	}
+	if wrapper != nil {
+		// the admin routes hand out and overwrite every private key: they are never served unauthenticated
+		adminToken := getEnv("ADMIN_TOKEN", "")
+		if adminToken == "" {
+			return errors.New("BACKUP_KEY_FILE is set without ADMIN_TOKEN, which the backup routes require")
+		}
+		serverOptions = append(serverOptions, api.WithBackups(backup.New(store, wrapper, crypto.VerifierFactories(), backup.WithMetrics(serviceMetrics)), adminToken))
+	} else {
+		logger.Info("BACKUP_KEY_FILE is not set: backups are disabled")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// deliveries run in the background, reading the outbox the service writes along with every change
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		dispatcher.Run(ctx, WebhookDispatchInterval)
+	}()
+
+	// the first server to stop, failing or not, stops the other one
+	served := make(chan error, 2)
+	go func() {
+		if err := grpcapi.NewServer(GRPCListenAddress, service, grpcapi.WithLogger(logger)).Run(ctx); err != nil {
+			served <- fmt.Errorf("could not serve gRPC on %v: %w", GRPCListenAddress, err)
+			return
+		}
+		served <- nil
+	}()
+	go func() {
+		if err := api.NewServer(ListenAddress, service, serverOptions...).Run(ctx); err != nil {
+			served <- fmt.Errorf("could not serve HTTP on %v: %w", ListenAddress, err)
+			return
+		}
+		served <- nil
+	}()
+
+	err = <-served
+	cancel()
+	err = errors.Join(err, <-served)
+	<-dispatched
+	return err
 }
@@ -0,0 +1,150 @@
+// Package metrics exposes the service instrumentation as Prometheus metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "signing_service"
+
+// Metrics collects HTTP and signature domain metrics. It satisfies both
+// signature.Metrics and api.MetricsCollector.
+type Metrics struct {
+	gatherer prometheus.Gatherer
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	devices             *prometheus.GaugeVec
+	keyGenDuration      *prometheus.HistogramVec
+	signatures          *prometheus.CounterVec
+	signConflicts       *prometheus.CounterVec
+	signRetries         *prometheus.HistogramVec
+	signerCacheLookups  *prometheus.CounterVec
+}
+
+// New creates the service metrics and registers them on registry.
+func New(registry *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		gatherer: registry,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		devices: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "signature_devices",
+			Help:      "Number of signature devices by algorithm.",
+		}, []string{"algorithm"}),
+		keyGenDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "key_generation_duration_seconds",
+			Help:      "Key pair generation latency by algorithm.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"algorithm"}),
+		signatures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signatures_total",
+			Help:      "Number of signatures created by algorithm.",
+		}, []string{"algorithm"}),
+		signConflicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sign_optimistic_lock_conflicts_total",
+			Help:      "Number of optimistic lock conflicts hit while signing, by algorithm.",
+		}, []string{"algorithm"}),
+		signRetries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sign_retries",
+			Help:      "Number of retries a successful signature needed, by algorithm.",
+			Buckets:   []float64{0, 1, 2, 3, 5, 8},
+		}, []string{"algorithm"}),
+		signerCacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signer_cache_lookups_total",
+			Help:      "Number of parsed signer lookups while signing, by algorithm and result (hit or miss).",
+		}, []string{"algorithm", "result"}),
+	}
+
+	registry.MustRegister(
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.devices,
+		m.keyGenDuration,
+		m.signatures,
+		m.signConflicts,
+		m.signRetries,
+		m.signerCacheLookups,
+	)
+
+	return m
+}
+
+// Handler returns the HTTP handler serving the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.gatherer, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served HTTP request.
+func (m *Metrics) ObserveRequest(method string, route string, code int, duration time.Duration) {
+	m.httpRequests.WithLabelValues(method, route, strconv.Itoa(code)).Inc()
+	m.httpRequestDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// DeviceCreated records a new signature device.
+func (m *Metrics) DeviceCreated(signatureAlg string) {
+	m.devices.WithLabelValues(signatureAlg).Inc()
+}
+
+// DeviceDeleted records a deleted signature device.
+func (m *Metrics) DeviceDeleted(signatureAlg string) {
+	m.devices.WithLabelValues(signatureAlg).Dec()
+}
+
+// SetDevices sets the number of signature devices by algorithm to those the store holds, at
+// startup and after a restore: DeviceCreated and DeviceDeleted count up and down from there.
+func (m *Metrics) SetDevices(devices map[string]int) {
+	m.devices.Reset()
+	for signatureAlg, count := range devices {
+		m.devices.WithLabelValues(signatureAlg).Set(float64(count))
+	}
+}
+
+// KeyPairGenerated records the duration of a key pair generation.
+func (m *Metrics) KeyPairGenerated(signatureAlg string, duration time.Duration) {
+	m.keyGenDuration.WithLabelValues(signatureAlg).Observe(duration.Seconds())
+}
+
+// SignatureCreated records a new signature.
+func (m *Metrics) SignatureCreated(signatureAlg string) {
+	m.signatures.WithLabelValues(signatureAlg).Inc()
+}
+
+// SignConflict records an optimistic lock conflict while signing.
+func (m *Metrics) SignConflict(signatureAlg string) {
+	m.signConflicts.WithLabelValues(signatureAlg).Inc()
+}
+
+// SignRetries records how many retries a signature needed.
+func (m *Metrics) SignRetries(signatureAlg string, retries int) {
+	m.signRetries.WithLabelValues(signatureAlg).Observe(float64(retries))
+}
+
+// SignerCacheLookup records whether a parsed signer was found in the cache.
+func (m *Metrics) SignerCacheLookup(signatureAlg string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.signerCacheLookups.WithLabelValues(signatureAlg, result).Inc()
+}
@@ -0,0 +1,71 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsAreExposed(t *testing.T) {
+	m := metrics.New(prometheus.NewRegistry())
+
+	m.ObserveRequest(http.MethodPost, "/api/v0/devices/{id}/sign", http.StatusOK, 10*time.Millisecond)
+	m.DeviceCreated("ECC")
+	m.KeyPairGenerated("ECC", time.Millisecond)
+	m.SignatureCreated("ECC")
+	m.SignConflict("ECC")
+	m.SignRetries("ECC", 1)
+	m.SignerCacheLookup("ECC", true)
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, `signing_service_http_requests_total{code="200",method="POST",route="/api/v0/devices/{id}/sign"} 1`)
+	assert.Contains(t, body, `signing_service_signature_devices{algorithm="ECC"} 1`)
+	assert.Contains(t, body, `signing_service_signatures_total{algorithm="ECC"} 1`)
+	assert.Contains(t, body, `signing_service_sign_optimistic_lock_conflicts_total{algorithm="ECC"} 1`)
+	assert.Contains(t, body, `signing_service_key_generation_duration_seconds_count{algorithm="ECC"} 1`)
+	assert.Contains(t, body, `signing_service_signer_cache_lookups_total{algorithm="ECC",result="hit"} 1`)
+}
+
+func TestSignaturesCounterIsPerAlgorithm(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := metrics.New(registry)
+
+	m.SignatureCreated("RSA")
+	m.SignatureCreated("RSA")
+	m.SignatureCreated("ECC")
+
+	expected := `
+# HELP signing_service_signatures_total Number of signatures created by algorithm.
+# TYPE signing_service_signatures_total counter
+signing_service_signatures_total{algorithm="ECC"} 1
+signing_service_signatures_total{algorithm="RSA"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "signing_service_signatures_total"))
+}
+
+func TestDevicesGaugeStartsFromTheStoredDevices(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := metrics.New(registry)
+
+	m.SetDevices(map[string]int{"RSA": 2, "ECC": 3})
+	m.DeviceCreated("RSA")
+	m.DeviceDeleted("ECC")
+
+	expected := `
+# HELP signing_service_signature_devices Number of signature devices by algorithm.
+# TYPE signing_service_signature_devices gauge
+signing_service_signature_devices{algorithm="ECC"} 2
+signing_service_signature_devices{algorithm="RSA"} 3
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "signing_service_signature_devices"))
+}
@@ -0,0 +1,159 @@
+// Package servicetest builds the services of the signing service for tests, on an in-memory store
+// unless told otherwise, and serves them through the API. The optional services are enabled by the
+// options of New, so that the tests do not each wire them.
+package servicetest
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/backup"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/export"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/webhook"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/events"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/keygen"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/stretchr/testify/require"
+)
+
+// AdminToken is the bearer token of the admin routes served when backups are enabled.
+const AdminToken = "some-admin-token"
+
+// EventsHistorySize is the number of events kept by the bus of WithEvents.
+const EventsHistorySize = 16
+
+// Services are the services built by New, the optional ones being nil unless enabled.
+type Services struct {
+	Store     store.Store
+	Signature *signature.Service
+	Events    *events.Bus
+	Webhooks  *webhook.Service
+	Exporter  *export.Service
+	Backup    *backup.Service
+}
+
+type config struct {
+	store            store.Store
+	signatureOptions []signature.Option
+	events           bool
+	webhooks         bool
+	exports          bool
+	backupKey        []byte
+}
+
+type Option func(*config)
+
+// WithStore builds the services on s instead of a new in-memory store.
+func WithStore(s store.Store) Option {
+	return func(c *config) {
+		c.store = s
+	}
+}
+
+// WithSignatureOptions passes opts to the signature service.
+func WithSignatureOptions(opts ...signature.Option) Option {
+	return func(c *config) {
+		c.signatureOptions = append(c.signatureOptions, opts...)
+	}
+}
+
+// WithEvents publishes the changes of the devices on a bus.
+func WithEvents() Option {
+	return func(c *config) {
+		c.events = true
+	}
+}
+
+// WithWebhooks manages the webhook subscriptions in the store, which must be a store.WebhookStore
+// too, as the in-memory one is.
+func WithWebhooks() Option {
+	return func(c *config) {
+		c.webhooks = true
+	}
+}
+
+// WithExports exports the devices with a new ECC export key.
+func WithExports() Option {
+	return func(c *config) {
+		c.exports = true
+	}
+}
+
+// WithBackups backs up the store with backupKey as key encryption key.
+func WithBackups(backupKey []byte) Option {
+	return func(c *config) {
+		c.backupKey = backupKey
+	}
+}
+
+// New builds the signature service, signing with RSA and ECC, and the services enabled by opts.
+func New(tb testing.TB, opts ...Option) Services {
+	tb.Helper()
+
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.store == nil {
+		c.store = inmemory.New()
+	}
+	services := Services{Store: c.store}
+
+	if c.events {
+		services.Events = events.NewBus(EventsHistorySize)
+		c.signatureOptions = append(c.signatureOptions, signature.WithPublisher(services.Events))
+	}
+	services.Signature = signature.New(c.store, map[string]signature.KeyGenerator{
+		"RSA": keygen.RSA,
+		"ECC": keygen.ECC,
+	}, crypto.SignerFactories(), c.signatureOptions...)
+
+	if c.webhooks {
+		webhookStore, ok := c.store.(store.WebhookStore)
+		require.True(tb, ok, "the store does not hold webhooks")
+		services.Webhooks = webhook.New(webhookStore)
+	}
+	if c.exports {
+		_, exportKey, err := keygen.ECC()
+		require.NoError(tb, err)
+		services.Exporter, err = export.New(c.store, exportKey)
+		require.NoError(tb, err)
+	}
+	if c.backupKey != nil {
+		wrapper, err := crypto.NewKeyWrapper(c.backupKey)
+		require.NoError(tb, err)
+		services.Backup = backup.New(c.store, wrapper, crypto.VerifierFactories())
+	}
+
+	return services
+}
+
+// Handler serves the services through the API, with the routes of the optional ones, then opts.
+func (s Services) Handler(opts ...api.ServerOption) http.Handler {
+	serverOptions := []api.ServerOption{}
+	if s.Events != nil {
+		serverOptions = append(serverOptions, api.WithEvents(s.Events))
+	}
+	if s.Webhooks != nil {
+		serverOptions = append(serverOptions, api.WithWebhooks(s.Webhooks))
+	}
+	if s.Exporter != nil {
+		serverOptions = append(serverOptions, api.WithExports(s.Exporter))
+	}
+	if s.Backup != nil {
+		serverOptions = append(serverOptions, api.WithBackups(s.Backup, AdminToken))
+	}
+	return Handler(s.Signature, append(serverOptions, opts...)...)
+}
+
+// Handler serves service through the API, discarding its logs, with opts.
+func Handler(service signature.SignatureDeviceService, opts ...api.ServerOption) http.Handler {
+	serverOptions := []api.ServerOption{api.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}
+	return api.NewServer("", service, append(serverOptions, opts...)...).Handler()
+}
@@ -0,0 +1,71 @@
+package servicetest
+
+import (
+	"context"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+)
+
+// SignatureServiceStub is a signature.SignatureDeviceService whose methods call the function of
+// the same name when it is set, and fail with Err otherwise.
+type SignatureServiceStub struct {
+	Err                        error
+	CreateSignatureDeviceFn    func(ctx context.Context, newSignDev signature.NewSignatureDevice) (signature.SignatureDevice, bool, error)
+	GetSignatureDeviceFn       func(ctx context.Context, id string) (signature.SignatureDevice, error)
+	UpdateSignatureDeviceFn    func(ctx context.Context, id string, update signature.UpdateSignatureDevice, version string) (signature.SignatureDevice, error)
+	RotateSignatureDeviceKeyFn func(ctx context.Context, id string, version string) (signature.SignatureDevice, error)
+	DeleteSignatureDeviceFn    func(ctx context.Context, id string, version string) error
+	ListSignatureDevicesFn     func(ctx context.Context, filter signature.ListFilter) ([]signature.SignatureDevice, error)
+	SignDataFn                 func(ctx context.Context, id string, dataToSign string) (signature.Signature, error)
+}
+
+var _ signature.SignatureDeviceService = &SignatureServiceStub{}
+
+func (s *SignatureServiceStub) CreateSignatureDevice(ctx context.Context, newSignDev signature.NewSignatureDevice) (signature.SignatureDevice, bool, error) {
+	if s.CreateSignatureDeviceFn == nil {
+		return signature.SignatureDevice{}, false, s.Err
+	}
+	return s.CreateSignatureDeviceFn(ctx, newSignDev)
+}
+
+func (s *SignatureServiceStub) GetSignatureDevice(ctx context.Context, id string) (signature.SignatureDevice, error) {
+	if s.GetSignatureDeviceFn == nil {
+		return signature.SignatureDevice{}, s.Err
+	}
+	return s.GetSignatureDeviceFn(ctx, id)
+}
+
+func (s *SignatureServiceStub) UpdateSignatureDevice(ctx context.Context, id string, update signature.UpdateSignatureDevice, version string) (signature.SignatureDevice, error) {
+	if s.UpdateSignatureDeviceFn == nil {
+		return signature.SignatureDevice{}, s.Err
+	}
+	return s.UpdateSignatureDeviceFn(ctx, id, update, version)
+}
+
+func (s *SignatureServiceStub) RotateSignatureDeviceKey(ctx context.Context, id string, version string) (signature.SignatureDevice, error) {
+	if s.RotateSignatureDeviceKeyFn == nil {
+		return signature.SignatureDevice{}, s.Err
+	}
+	return s.RotateSignatureDeviceKeyFn(ctx, id, version)
+}
+
+func (s *SignatureServiceStub) DeleteSignatureDevice(ctx context.Context, id string, version string) error {
+	if s.DeleteSignatureDeviceFn == nil {
+		return s.Err
+	}
+	return s.DeleteSignatureDeviceFn(ctx, id, version)
+}
+
+func (s *SignatureServiceStub) ListSignatureDevices(ctx context.Context, filter signature.ListFilter) ([]signature.SignatureDevice, error) {
+	if s.ListSignatureDevicesFn == nil {
+		return nil, s.Err
+	}
+	return s.ListSignatureDevicesFn(ctx, filter)
+}
+
+func (s *SignatureServiceStub) SignData(ctx context.Context, id string, dataToSign string) (signature.Signature, error) {
+	if s.SignDataFn == nil {
+		return signature.Signature{}, s.Err
+	}
+	return s.SignDataFn(ctx, id, dataToSign)
+}
@@ -0,0 +1,202 @@
+// Package dualwrite decorates a store.Store with a second one, which every write is mirrored to
+// while the devices are migrated from the first to the second, see backup.Migrator.
+//
+// The primary store stays the source of truth: reads are served by it alone, writes fail when it
+// fails, and only it records the outbox events. A write is mirrored to the secondary store only
+// when the secondary holds the device in the state the primary held before the write, so that the
+// secondary never records a history the primary did not. The devices the secondary is behind on
+// are skipped, until the migration brings them up to date. Writes are given their time before being
+// applied, so that both stores record the same history.
+package dualwrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+)
+
+// lockStripes is how many locks the devices share: writes of devices sharing a lock are serialized.
+const lockStripes = 64
+
+// Store writes to the primary store, then mirrors the write to the secondary store.
+type Store struct {
+	primary   store.Store
+	secondary store.Store
+	locks     [lockStripes]sync.Mutex
+}
+
+// LockDevice blocks the writes of the device with the given ID until unlock is called, so that
+// the migration can catch up with the primary store in between two writes.
+func (s *Store) LockDevice(id string) (unlock func()) {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	lock := &s.locks[hash.Sum32()%lockStripes]
+	lock.Lock()
+	return lock.Unlock
+}
+
+func (s *Store) CreateSignatureDevice(ctx context.Context, sigDevice store.SignatureDevice, outbox ...store.OutboxEvent) error {
+	unlock := s.LockDevice(sigDevice.ID)
+	defer unlock()
+
+	if sigDevice.CreatedAt.IsZero() {
+		sigDevice.CreatedAt = time.Now().UTC()
+	}
+	if err := s.primary.CreateSignatureDevice(ctx, sigDevice, outbox...); err != nil {
+		return err
+	}
+	if err := s.secondary.CreateSignatureDevice(ctx, sigDevice); err != nil {
+		mirrorFailed(ctx, sigDevice.ID, "CreateSignatureDevice", err)
+	}
+	return nil
+}
+
+func (s *Store) UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox ...store.OutboxEvent) error {
+	if updateSignDevice.SignedAt.IsZero() {
+		updateSignDevice.SignedAt = time.Now().UTC()
+	}
+	return s.write(ctx, id, "UpdateSignatureDevice", func(target store.Store, version string, outbox ...store.OutboxEvent) error {
+		updateSignDevice.Version = version
+		return target.UpdateSignatureDevice(ctx, id, updateSignDevice, outbox...)
+	}, updateSignDevice.Version, outbox)
+}
+
+func (s *Store) AppendSignatures(ctx context.Context, id string, signatures []store.UpdateSignatureDevice, version string) error {
+	signatures = slices.Clone(signatures)
+	now := time.Now().UTC()
+	for i := range signatures {
+		if signatures[i].SignedAt.IsZero() {
+			signatures[i].SignedAt = now
+		}
+	}
+	return s.write(ctx, id, "AppendSignatures", func(target store.Store, version string, outbox ...store.OutboxEvent) error {
+		return target.AppendSignatures(ctx, id, signatures, version)
+	}, version, nil)
+}
+
+func (s *Store) UpdateSignatureDeviceDetails(ctx context.Context, id string, updateDetails store.UpdateSignatureDeviceDetails, outbox ...store.OutboxEvent) error {
+	return s.write(ctx, id, "UpdateSignatureDeviceDetails", func(target store.Store, version string, outbox ...store.OutboxEvent) error {
+		updateDetails.Version = version
+		return target.UpdateSignatureDeviceDetails(ctx, id, updateDetails, outbox...)
+	}, updateDetails.Version, outbox)
+}
+
+func (s *Store) RotateSignatureDeviceKey(ctx context.Context, id string, rotateKey store.RotateSignatureDeviceKey, outbox ...store.OutboxEvent) error {
+	if rotateKey.RotatedAt.IsZero() {
+		rotateKey.RotatedAt = time.Now().UTC()
+	}
+	return s.write(ctx, id, "RotateSignatureDeviceKey", func(target store.Store, version string, outbox ...store.OutboxEvent) error {
+		rotateKey.Version = version
+		return target.RotateSignatureDeviceKey(ctx, id, rotateKey, outbox...)
+	}, rotateKey.Version, outbox)
+}
+
+func (s *Store) DeleteSignatureDevice(ctx context.Context, id string, version string, outbox ...store.OutboxEvent) error {
+	return s.write(ctx, id, "DeleteSignatureDevice", func(target store.Store, version string, outbox ...store.OutboxEvent) error {
+		return target.DeleteSignatureDevice(ctx, id, version, outbox...)
+	}, version, outbox)
+}
+
+func (s *Store) GetSignatureDevice(ctx context.Context, id string) (store.SignatureDevice, error) {
+	return s.primary.GetSignatureDevice(ctx, id)
+}
+
+func (s *Store) ListSignatureDevices(ctx context.Context, filter store.ListFilter) ([]store.SignatureDevice, error) {
+	return s.primary.ListSignatureDevices(ctx, filter)
+}
+
+func (s *Store) ListPublicKeys(ctx context.Context, id string) ([]store.PublicKeyRecord, error) {
+	return s.primary.ListPublicKeys(ctx, id)
+}
+
+func (s *Store) ScanSignatures(ctx context.Context, id string, fn func(store.SignatureRecord) error) error {
+	return s.primary.ScanSignatures(ctx, id, fn)
+}
+
+// Ping forwards to the primary store when it implements store.Pinger: the secondary store being
+// unreachable fails no request.
+func (s *Store) Ping(ctx context.Context) error {
+	pinger, ok := s.primary.(store.Pinger)
+	if !ok {
+		return nil
+	}
+	return pinger.Ping(ctx)
+}
+
+// write applies a write of an existing device to the primary store with the version of the caller,
+// then to the secondary store with the version the device has there, without the outbox events.
+func (s *Store) write(ctx context.Context, id string, operation string, apply func(target store.Store, version string, outbox ...store.OutboxEvent) error, version string, outbox []store.OutboxEvent) error {
+	unlock := s.LockDevice(id)
+	defer unlock()
+
+	before, err := s.primary.GetSignatureDevice(ctx, id)
+	if err != nil {
+		// the primary store reports the device missing
+		return apply(s.primary, version, outbox...)
+	}
+	if err := apply(s.primary, version, outbox...); err != nil {
+		return err
+	}
+
+	mirrored, err := s.secondary.GetSignatureDevice(ctx, id)
+	if errors.Is(err, store.ErrDeviceNotFound) {
+		logging.FromContext(ctx).DebugContext(ctx, "device not migrated yet: write not mirrored", slog.String("device_id", id), slog.String("operation", operation))
+		return nil
+	}
+	if err != nil {
+		mirrorFailed(ctx, id, operation, err)
+		return nil
+	}
+	if !sameState(before, mirrored) {
+		logging.FromContext(ctx).LogAttrs(ctx, slog.LevelWarn, "device behind in the secondary store: write not mirrored",
+			slog.String("event", "store.mirror_skipped"),
+			slog.String("device_id", id),
+			slog.String("operation", operation),
+		)
+		return nil
+	}
+	if err := apply(s.secondary, mirrored.Version); err != nil {
+		mirrorFailed(ctx, id, operation, err)
+	}
+	return nil
+}
+
+// sameState reports whether both stores hold the device in the same state, whatever its version.
+func sameState(primary store.SignatureDevice, secondary store.SignatureDevice) bool {
+	return primary.SignatureCounter == secondary.SignatureCounter &&
+		primary.LastSignature == secondary.LastSignature &&
+		primary.KeyVersion == secondary.KeyVersion &&
+		bytes.Equal(primary.PublicKey, secondary.PublicKey) &&
+		primary.Label == secondary.Label &&
+		maps.Equal(primary.Metadata, secondary.Metadata) &&
+		slices.Equal(primary.Tags, secondary.Tags) &&
+		primary.Status == secondary.Status
+}
+
+// mirrorFailed logs a write which succeeded in the primary store only: the migration or its
+// verification will report the device.
+func mirrorFailed(ctx context.Context, id string, operation string, err error) {
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelWarn, "error mirroring write to the secondary store",
+		slog.String("event", "store.mirror_failed"),
+		slog.String("device_id", id),
+		slog.String("operation", operation),
+		slog.String("error", err.Error()),
+	)
+}
+
+// New mirrors the writes to primary to secondary.
+func New(primary store.Store, secondary store.Store) *Store {
+	return &Store{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
@@ -0,0 +1,103 @@
+package dualwrite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/dualwrite"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return dualwrite.New(inmemory.New(), inmemory.New())
+	})
+}
+
+func newDevice(id string) store.SignatureDevice {
+	return store.SignatureDevice{ID: id, Tenant: "some-tenant", SignatureAlg: "ECC", PublicKey: []byte("public"), PrivateKey: []byte("private"), LastSignature: "c29tZS1pZA=="}
+}
+
+func TestWritesAreMirroredWithTheVersionsOfTheSecondary(t *testing.T) {
+	ctx := context.Background()
+	primary := inmemory.New()
+	secondary := inmemory.New()
+	s := dualwrite.New(primary, secondary)
+	require.NoError(t, s.CreateSignatureDevice(ctx, newDevice("some-id")))
+	// the versions of the device differ between both stores, not its state
+	empty := ""
+	require.NoError(t, secondary.UpdateSignatureDeviceDetails(ctx, "some-id", store.UpdateSignatureDeviceDetails{Label: &empty, Version: "1"}))
+
+	device, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: 1, LastSignature: "c2lnbmF0dXJl", SignedData: "0_data_c29tZS1pZA==", Version: device.Version}))
+	device, err = s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	require.NoError(t, s.RotateSignatureDeviceKey(ctx, "some-id", store.RotateSignatureDeviceKey{PublicKey: []byte("other-public"), PrivateKey: []byte("other-private"), Version: device.Version}))
+	device, err = s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	label := "some-label"
+	require.NoError(t, s.UpdateSignatureDeviceDetails(ctx, "some-id", store.UpdateSignatureDeviceDetails{Label: &label, Tags: []string{"pos"}, Version: device.Version}))
+
+	fromPrimary, err := primary.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	fromSecondary, err := secondary.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.NotEqual(t, fromPrimary.Version, fromSecondary.Version)
+	fromPrimary.Version, fromSecondary.Version = "", ""
+	assert.Equal(t, fromPrimary, fromSecondary)
+
+	signatures := []store.SignatureRecord{}
+	require.NoError(t, secondary.ScanSignatures(ctx, "some-id", func(record store.SignatureRecord) error {
+		signatures = append(signatures, record)
+		return nil
+	}))
+	require.Len(t, signatures, 1)
+	assert.Equal(t, "0_data_c29tZS1pZA==", signatures[0].SignedData)
+	primarySignatures := []store.SignatureRecord{}
+	require.NoError(t, primary.ScanSignatures(ctx, "some-id", func(record store.SignatureRecord) error {
+		primarySignatures = append(primarySignatures, record)
+		return nil
+	}))
+	assert.Equal(t, primarySignatures, signatures)
+	primaryKeys, err := primary.ListPublicKeys(ctx, "some-id")
+	require.NoError(t, err)
+	secondaryKeys, err := secondary.ListPublicKeys(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, primaryKeys, secondaryKeys)
+
+	device, err = s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteSignatureDevice(ctx, "some-id", device.Version))
+	_, err = secondary.GetSignatureDevice(ctx, "some-id")
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+}
+
+func TestWritesAreNotMirroredToDevicesBehind(t *testing.T) {
+	ctx := context.Background()
+	primary := inmemory.New()
+	secondary := inmemory.New()
+	require.NoError(t, primary.CreateSignatureDevice(ctx, newDevice("some-id")))
+	require.NoError(t, primary.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: 1, LastSignature: "c2lnbmF0dXJl", Version: "1"}))
+	require.NoError(t, secondary.CreateSignatureDevice(ctx, newDevice("some-id")))
+	require.NoError(t, primary.CreateSignatureDevice(ctx, newDevice("unmigrated-id")))
+	s := dualwrite.New(primary, secondary)
+
+	// the secondary store lacks the first signature, which the second signature chains from
+	require.NoError(t, s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: 2, LastSignature: "b3RoZXI=", Version: "2"}))
+	fromSecondary, err := secondary.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, 0, fromSecondary.SignatureCounter)
+
+	require.NoError(t, s.UpdateSignatureDevice(ctx, "unmigrated-id", store.UpdateSignatureDevice{SignatureCounter: 1, LastSignature: "c2lnbmF0dXJl", Version: "1"}))
+	_, err = secondary.GetSignatureDevice(ctx, "unmigrated-id")
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+
+	// failed writes are not mirrored
+	assert.ErrorIs(t, s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: 3, Version: "1"}), store.ErrVersionConflict)
+	assert.ErrorIs(t, s.UpdateSignatureDevice(ctx, "unknown-id", store.UpdateSignatureDevice{SignatureCounter: 1, Version: "1"}), store.ErrDeviceNotFound)
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statuses of a signature device. Suspended devices cannot sign.
+const (
+	StatusActive = "active"
+	StatusSuspended = "suspended"
+)
+
+// Types of the device events.
+const (
+	DeviceCreated = "created"
+	DeviceSigned = "signed"
+	DeviceDetailsUpdated = "details_updated"
+	DeviceKeyRotated = "key_rotated"
+	DeviceSuspended = "suspended"
+	DeviceReactivated = "reactivated"
+	DeviceDeleted = "deleted"
+)
+
+var ErrEventOutOfSequence = errors.New("device event out of sequence")
+
+// DeviceEvent is an entry of the append-only stream of changes of a device, from which the
+// SignatureDevice is projected. Only the fields relevant to Type are set.
+type DeviceEvent struct {
+	DeviceID string
+	Sequence uint64 // position in the stream of the device, starting at 1
+	Type string
+	Time time.Time
+
+	Device *SignatureDevice `json:",omitempty"` // created: the initial state of the device
+	SignatureCounter int `json:",omitempty"` // signed
+	LastSignature string `json:",omitempty"` // signed
+	SignedData string `json:",omitempty"` // signed
+	KeyVersion int `json:",omitempty"` // signed: the key version signing, key_rotated: the new key version
+	Label *string `json:",omitempty"` // details_updated
+	Metadata map[string]string // details_updated, null when unchanged
+	Tags []string // details_updated, null when unchanged
+	PublicKey []byte `json:",omitempty"` // key_rotated
+	PrivateKey []byte `json:",omitempty"` // key_rotated
+}
+
+// DeviceSnapshot is the state of a device after the event with the given Sequence,
+// saving the replay of the events up to it.
+type DeviceSnapshot struct {
+	DeviceID string
+	Sequence uint64
+	Deleted bool
+	Device SignatureDevice
+}
+
+// JournalEntry is a line of a store journal, holding either a device event or a snapshot. Once the
+// events are compacted, the history records they added are kept as entries of their own. The
+// webhook entries record the outbox events, subscriptions and deliveries: added or replaced, or
+// removed by ID.
+type JournalEntry struct {
+	Event *DeviceEvent `json:",omitempty"`
+	Snapshot *DeviceSnapshot `json:",omitempty"`
+	Signature *SignatureRecord `json:",omitempty"`
+	PublicKey *PublicKeyRecord `json:",omitempty"`
+	Outbox *OutboxEvent `json:",omitempty"`
+	OutboxDequeued string `json:",omitempty"`
+	Subscription *WebhookSubscription `json:",omitempty"`
+	SubscriptionDeleted string `json:",omitempty"`
+	Delivery *WebhookDelivery `json:",omitempty"`
+	DeliveryDeleted string `json:",omitempty"`
+}
+
+// ReadJournal calls fn with every entry of the JSON lines journal read from r.
+func ReadJournal(r io.Reader, fn func(entry JournalEntry) error) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var entry JournalEntry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading journal: %w", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// Apply returns the state of sigDevice after event, and whether the device still exists.
+// The Version of a device is the sequence number of its last event.
+func Apply(sigDevice SignatureDevice, event DeviceEvent) (SignatureDevice, bool) {
+	switch event.Type {
+	case DeviceCreated:
+		sigDevice = event.Device.Clone()
+		sigDevice.CreatedAt = event.Time
+		if sigDevice.Status == "" {
+			sigDevice.Status = StatusActive
+		}
+		if sigDevice.KeyVersion == 0 {
+			sigDevice.KeyVersion = 1
+		}
+	case DeviceSigned:
+		sigDevice.SignatureCounter = event.SignatureCounter
+		sigDevice.LastSignature = event.LastSignature
+	case DeviceDetailsUpdated:
+		if event.Label != nil {
+			sigDevice.Label = *event.Label
+		}
+		if event.Metadata != nil {
+			sigDevice.Metadata = maps.Clone(event.Metadata)
+		}
+		if event.Tags != nil {
+			sigDevice.Tags = slices.Clone(event.Tags)
+		}
+	case DeviceKeyRotated:
+		sigDevice.PublicKey = slices.Clone(event.PublicKey)
+		sigDevice.PrivateKey = slices.Clone(event.PrivateKey)
+		sigDevice.KeyVersion++
+	case DeviceSuspended:
+		sigDevice.Status = StatusSuspended
+	case DeviceReactivated:
+		sigDevice.Status = StatusActive
+	case DeviceDeleted:
+		return SignatureDevice{}, false
+	}
+	sigDevice.Version = strconv.FormatUint(event.Sequence, 10)
+
+	return sigDevice, true
+}
+
+// History returns what event adds to the history of its device: the signature of a signed event,
+// the public key of a created or key_rotated one.
+func History(event DeviceEvent) (*SignatureRecord, *PublicKeyRecord) {
+	switch event.Type {
+	case DeviceSigned:
+		return &SignatureRecord{
+			DeviceID: event.DeviceID,
+			SignatureCounter: event.SignatureCounter - 1,
+			KeyVersion: event.KeyVersion,
+			SignedData: event.SignedData,
+			Signature: event.LastSignature,
+			CreatedAt: event.Time,
+		}, nil
+	case DeviceCreated:
+		keyVersion := event.Device.KeyVersion
+		if keyVersion == 0 {
+			keyVersion = 1
+		}
+		return nil, &PublicKeyRecord{DeviceID: event.DeviceID, KeyVersion: keyVersion, PublicKey: slices.Clone(event.Device.PublicKey), CreatedAt: event.Time}
+	case DeviceKeyRotated:
+		return nil, &PublicKeyRecord{DeviceID: event.DeviceID, KeyVersion: event.KeyVersion, PublicKey: slices.Clone(event.PublicKey), CreatedAt: event.Time}
+	}
+
+	return nil, nil
+}
+
+// Projection rebuilds the devices from their snapshots and events, which must be fed in
+// sequence order per device. Events already covered by a snapshot are skipped.
+type Projection struct {
+	devices map[string]DeviceSnapshot
+}
+
+func NewProjection() *Projection {
+	return &Projection{
+		devices: map[string]DeviceSnapshot{},
+	}
+}
+
+// ApplySnapshot replaces the state of a device with snapshot, unless it is older than the current state.
+func (p *Projection) ApplySnapshot(snapshot DeviceSnapshot) {
+	if current, found := p.devices[snapshot.DeviceID]; found && current.Sequence >= snapshot.Sequence {
+		return
+	}
+	snapshot.Device = snapshot.Device.Clone()
+	p.devices[snapshot.DeviceID] = snapshot
+}
+
+// Apply applies event to its device. It fails when events of the device are missing.
+func (p *Projection) Apply(event DeviceEvent) error {
+	current := p.devices[event.DeviceID]
+	if event.Sequence <= current.Sequence {
+		return nil
+	}
+	if event.Sequence != current.Sequence+1 {
+		return fmt.Errorf("%w: device '%v' expected event %v, got %v", ErrEventOutOfSequence, event.DeviceID, current.Sequence+1, event.Sequence)
+	}
+
+	sigDevice, exists := Apply(current.Device, event)
+	p.devices[event.DeviceID] = DeviceSnapshot{
+		DeviceID: event.DeviceID,
+		Sequence: event.Sequence,
+		Deleted: !exists,
+		Device: sigDevice,
+	}
+	return nil
+}
+
+// Snapshot returns the current state of a device, and whether the projection knows the device at all.
+func (p *Projection) Snapshot(id string) (DeviceSnapshot, bool) {
+	snapshot, found := p.devices[id]
+	snapshot.Device = snapshot.Device.Clone()
+	return snapshot, found
+}
+
+// Devices returns the existing devices ordered by ID.
+func (p *Projection) Devices() []SignatureDevice {
+	sigDevices := []SignatureDevice{}
+	for _, snapshot := range p.devices {
+		if !snapshot.Deleted {
+			sigDevices = append(sigDevices, snapshot.Device.Clone())
+		}
+	}
+	slices.SortFunc(sigDevices, func(a, b SignatureDevice) int { return strings.Compare(a.ID, b.ID) })
+
+	return sigDevices
+}
@@ -0,0 +1,322 @@
+// Package filelog is a store.Store persisting the devices in a directory, for single node deployments
+// without a database.
+//
+// The devices are kept in memory, as the inmemory store does. Every change is first appended to a
+// write-ahead log and synced to disk, and only applied once it is durable. On startup, the state is
+// rebuilt from the last snapshot and the log following it. A record which was not completely written
+// before a crash is detected by its checksum and dropped: it can only be the last one. A corrupted
+// record followed by others fails the opening instead, as dropping it would drop the acknowledged
+// changes after it.
+//
+// Once the log grows past the compaction threshold, the state and history of every device and the
+// webhooks are written to a new snapshot, as a sequence of records like the log, and the log is
+// emptied.
+//
+// The webhook subscriptions, deliveries and pending outbox events are logged and snapshotted the same
+// way, the outbox events in the same record as the device change which emitted them.
+package filelog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+)
+
+const (
+	walFile      = "wal.log"
+	snapshotFile = "snapshot.log"
+
+	// DefaultCompactionThreshold is the size of the write-ahead log triggering a compaction.
+	DefaultCompactionThreshold = 64 << 20
+
+	// snapshotRecordSize is the size the records of a snapshot are filled up to.
+	snapshotRecordSize = 4 << 20
+)
+
+// Store is an inmemory.InMemoryStore whose changes are persisted in a directory.
+type Store struct {
+	*inmemory.InMemoryStore
+
+	// mu serializes the writes, so that a compaction sees every change either in the
+	// snapshot or in the log
+	mu                  sync.Mutex
+	dir                 string
+	wal                 *wal
+	compactionThreshold int64
+	compactionErr       error
+}
+
+type Option func(*Store)
+
+// WithCompactionThreshold sets the size in bytes of the write-ahead log triggering a compaction.
+// Zero disables the compactions.
+func WithCompactionThreshold(size int64) Option {
+	return func(s *Store) {
+		s.compactionThreshold = size
+	}
+}
+
+// Open restores the store persisted in dir, creating dir when it does not exist.
+func Open(dir string, opts ...Option) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating store directory: %w", err)
+	}
+
+	entries := []store.JournalEntry{}
+	collect := func(recordEntries []store.JournalEntry) {
+		entries = append(entries, recordEntries...)
+	}
+
+	snapshot, err := os.Open(filepath.Join(dir, snapshotFile))
+	if err == nil {
+		_, err = readRecords(snapshot, collect)
+		snapshot.Close()
+		if err != nil {
+			// snapshots are renamed into place once complete: they cannot be torn
+			return nil, fmt.Errorf("error reading snapshot: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error opening snapshot: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, walFile), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening write-ahead log: %w", err)
+	}
+	w := &wal{file: file}
+	size, err := readRecords(file, collect)
+	if errors.Is(err, errTornRecord) {
+		// the change was never acknowledged, as the record had to be synced first; a corrupted record
+		// in the middle of the log is left for an operator to look into
+		err = w.truncate(size)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error reading write-ahead log: %w", err)
+	}
+	w.size = size
+
+	s := &Store{
+		InMemoryStore:       inmemory.New(inmemory.WithLog(w)),
+		dir:                 dir,
+		wal:                 w,
+		compactionThreshold: DefaultCompactionThreshold,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.Restore(entries); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error restoring devices: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *Store) CreateSignatureDevice(ctx context.Context, sigDevice store.SignatureDevice, outbox ...store.OutboxEvent) error {
+	return s.write(func() error {
+		return s.InMemoryStore.CreateSignatureDevice(ctx, sigDevice, outbox...)
+	})
+}
+
+func (s *Store) UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox ...store.OutboxEvent) error {
+	return s.write(func() error {
+		return s.InMemoryStore.UpdateSignatureDevice(ctx, id, updateSignDevice, outbox...)
+	})
+}
+
+func (s *Store) AppendSignatures(ctx context.Context, id string, signatures []store.UpdateSignatureDevice, version string) error {
+	return s.write(func() error {
+		return s.InMemoryStore.AppendSignatures(ctx, id, signatures, version)
+	})
+}
+
+func (s *Store) UpdateSignatureDeviceDetails(ctx context.Context, id string, updateDetails store.UpdateSignatureDeviceDetails, outbox ...store.OutboxEvent) error {
+	return s.write(func() error {
+		return s.InMemoryStore.UpdateSignatureDeviceDetails(ctx, id, updateDetails, outbox...)
+	})
+}
+
+func (s *Store) RotateSignatureDeviceKey(ctx context.Context, id string, rotateKey store.RotateSignatureDeviceKey, outbox ...store.OutboxEvent) error {
+	return s.write(func() error {
+		return s.InMemoryStore.RotateSignatureDeviceKey(ctx, id, rotateKey, outbox...)
+	})
+}
+
+func (s *Store) DeleteSignatureDevice(ctx context.Context, id string, version string, outbox ...store.OutboxEvent) error {
+	return s.write(func() error {
+		return s.InMemoryStore.DeleteSignatureDevice(ctx, id, version, outbox...)
+	})
+}
+
+func (s *Store) CreateWebhookSubscription(ctx context.Context, subscription store.WebhookSubscription) error {
+	return s.write(func() error {
+		return s.InMemoryStore.CreateWebhookSubscription(ctx, subscription)
+	})
+}
+
+func (s *Store) DeleteWebhookSubscription(ctx context.Context, tenant string, id string) error {
+	return s.write(func() error {
+		return s.InMemoryStore.DeleteWebhookSubscription(ctx, tenant, id)
+	})
+}
+
+func (s *Store) EnqueueWebhookDeliveries(ctx context.Context, outboxIDs []string, deliveries []store.WebhookDelivery) error {
+	return s.write(func() error {
+		return s.InMemoryStore.EnqueueWebhookDeliveries(ctx, outboxIDs, deliveries)
+	})
+}
+
+func (s *Store) UpdateWebhookDelivery(ctx context.Context, delivery store.WebhookDelivery) error {
+	return s.write(func() error {
+		return s.InMemoryStore.UpdateWebhookDelivery(ctx, delivery)
+	})
+}
+
+func (s *Store) DeleteWebhookDelivery(ctx context.Context, id string) error {
+	return s.write(func() error {
+		return s.InMemoryStore.DeleteWebhookDelivery(ctx, id)
+	})
+}
+
+// Ping fails when the write-ahead log cannot be appended to anymore, or the last compaction failed.
+func (s *Store) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal.err != nil {
+		return s.wal.err
+	}
+	return s.compactionErr
+}
+
+// Compact writes the state of every device and the webhooks to a new snapshot, and empties the write-ahead log.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compact()
+}
+
+// Close closes the write-ahead log. The store must not be used afterwards.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.wal.file.Close()
+}
+
+func (s *Store) write(change func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := change(); err != nil {
+		return err
+	}
+
+	if s.compactionThreshold > 0 && s.wal.size >= s.compactionThreshold {
+		// the change is durable already: a failed compaction only leaves a longer log behind
+		s.compactionErr = s.compact()
+	}
+	return nil
+}
+
+// compact must be called with the store mutex held. A crash at any point leaves either the previous
+// snapshot and the complete log, or the new snapshot and a log whose events it already covers.
+func (s *Store) compact() error {
+	entries := []store.JournalEntry{}
+	for _, snapshot := range s.InMemoryStore.Compact() {
+		entries = append(entries, store.JournalEntry{Snapshot: &snapshot})
+	}
+	entries = append(entries, s.InMemoryStore.History()...)
+	entries = append(entries, s.InMemoryStore.Webhooks()...)
+
+	path := filepath.Join(s.dir, snapshotFile)
+	if err := writeSnapshot(path+".tmp", entries); err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	if err := syncDir(s.dir); err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	if err := s.wal.truncate(0); err != nil {
+		return fmt.Errorf("error truncating write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// writeSnapshot writes entries to path as a stream of records of up to snapshotRecordSize bytes
+// each, since the history of the devices grows without bound.
+func writeSnapshot(path string, entries []store.JournalEntry) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	chunk := []json.RawMessage{}
+	size := 0
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		payload, err := json.Marshal(chunk)
+		if err != nil {
+			return fmt.Errorf("error encoding record: %w", err)
+		}
+		record, err := frameRecord(payload)
+		if err != nil {
+			return err
+		}
+		chunk, size = chunk[:0], 0
+		_, err = w.Write(record)
+		return err
+	}
+	for _, entry := range entries {
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("error encoding record: %w", err)
+		}
+		if size+len(encoded) > snapshotRecordSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		chunk = append(chunk, encoded)
+		size += len(encoded) + 1
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.Sync()
+}
@@ -0,0 +1,353 @@
+package filelog_test
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/filelog"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkpoint is the size of the write-ahead log after a change, and the devices it leaves behind.
+type checkpoint struct {
+	size    int64
+	devices []store.SignatureDevice
+}
+
+// applyChanges makes a few changes of every kind, and returns the checkpoints following each of them.
+func applyChanges(t *testing.T, dir string, s *filelog.Store) []checkpoint {
+	t.Helper()
+	ctx := context.Background()
+
+	checkpoints := []checkpoint{{size: 0, devices: []store.SignatureDevice{}}}
+	record := func(err error) {
+		t.Helper()
+		require.NoError(t, err)
+
+		info, err := os.Stat(filepath.Join(dir, "wal.log"))
+		require.NoError(t, err)
+		devices, err := s.ListSignatureDevices(ctx, store.ListFilter{})
+		require.NoError(t, err)
+		checkpoints = append(checkpoints, checkpoint{size: info.Size(), devices: devices})
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		record(s.CreateSignatureDevice(ctx, store.SignatureDevice{
+			ID:           id,
+			Tenant:       "some-tenant",
+			SignatureAlg: "ECC",
+			Metadata:     map[string]string{"store": "berlin"},
+			PublicKey:    []byte("public-" + id),
+			PrivateKey:   []byte("private-" + id),
+		}))
+	}
+	for counter := 1; counter <= 5; counter++ {
+		record(s.UpdateSignatureDevice(ctx, "a", store.UpdateSignatureDevice{SignatureCounter: counter, LastSignature: "signature-" + strconv.Itoa(counter), Version: strconv.Itoa(counter)}))
+	}
+	label := "some-label"
+	suspended := store.StatusSuspended
+	record(s.UpdateSignatureDeviceDetails(ctx, "b", store.UpdateSignatureDeviceDetails{Label: &label, Tags: []string{"pos"}, Status: &suspended, Version: "1"}))
+	record(s.RotateSignatureDeviceKey(ctx, "a", store.RotateSignatureDeviceKey{PublicKey: []byte("other-public"), PrivateKey: []byte("other-private"), Version: "6"}))
+	record(s.DeleteSignatureDevice(ctx, "c", "1"))
+
+	return checkpoints
+}
+
+func listDevices(t *testing.T, s *filelog.Store) []store.SignatureDevice {
+	t.Helper()
+
+	devices, err := s.ListSignatureDevices(context.Background(), store.ListFilter{})
+	require.NoError(t, err)
+	return devices
+}
+
+// signatureCounters returns the counters of the signatures in the history of a device.
+func signatureCounters(t *testing.T, s *filelog.Store, id string) []int {
+	t.Helper()
+
+	counters := []int{}
+	require.NoError(t, s.ScanSignatures(context.Background(), id, func(signature store.SignatureRecord) error {
+		counters = append(counters, signature.SignatureCounter)
+		return nil
+	}))
+	return counters
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := filelog.Open(t.TempDir())
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestRestoresAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := filelog.Open(dir)
+	require.NoError(t, err)
+	checkpoints := applyChanges(t, dir, s)
+	require.NoError(t, s.Close())
+
+	reopened, err := filelog.Open(dir)
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, checkpoints[len(checkpoints)-1].devices, listDevices(t, reopened))
+
+	// versions carry on, so that ETags given out before the restart still match
+	assert.NoError(t, reopened.UpdateSignatureDevice(context.Background(), "a", store.UpdateSignatureDevice{SignatureCounter: 6, Version: "7"}))
+}
+
+func TestRecoversFromTornWrites(t *testing.T) {
+	dir := t.TempDir()
+	s, err := filelog.Open(dir)
+	require.NoError(t, err)
+	checkpoints := applyChanges(t, dir, s)
+	require.NoError(t, s.Close())
+
+	wal, err := os.ReadFile(filepath.Join(dir, "wal.log"))
+	require.NoError(t, err)
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		offset := random.Int63n(int64(len(wal)) + 1)
+		t.Run(strconv.FormatInt(offset, 10), func(t *testing.T) {
+			crashed := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(crashed, "wal.log"), wal[:offset], 0o600))
+
+			// the last change completely written before the crash survives, the torn one is lost
+			expected := checkpoints[0]
+			for _, c := range checkpoints {
+				if c.size <= offset {
+					expected = c
+				}
+			}
+
+			recovered, err := filelog.Open(crashed)
+			require.NoError(t, err)
+			defer recovered.Close()
+			assert.Equal(t, expected.devices, listDevices(t, recovered))
+
+			info, err := os.Stat(filepath.Join(crashed, "wal.log"))
+			require.NoError(t, err)
+			assert.Equal(t, expected.size, info.Size())
+
+			require.NoError(t, recovered.CreateSignatureDevice(context.Background(), store.SignatureDevice{ID: "d", SignatureAlg: "RSA"}))
+			require.NoError(t, recovered.Close())
+			reopened, err := filelog.Open(crashed)
+			require.NoError(t, err)
+			defer reopened.Close()
+			assert.Len(t, listDevices(t, reopened), len(expected.devices)+1)
+		})
+	}
+}
+
+func TestDropsCorruptedRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, err := filelog.Open(dir)
+	require.NoError(t, err)
+	checkpoints := applyChanges(t, dir, s)
+	require.NoError(t, s.Close())
+
+	path := filepath.Join(dir, "wal.log")
+	wal, err := os.ReadFile(path)
+	require.NoError(t, err)
+	wal[len(wal)-2] ^= 0xff
+	require.NoError(t, os.WriteFile(path, wal, 0o600))
+
+	recovered, err := filelog.Open(dir)
+	require.NoError(t, err)
+	defer recovered.Close()
+	assert.Equal(t, checkpoints[len(checkpoints)-2].devices, listDevices(t, recovered))
+}
+
+func TestRefusesCorruptionInTheMiddleOfTheLog(t *testing.T) {
+	dir := t.TempDir()
+	s, err := filelog.Open(dir)
+	require.NoError(t, err)
+	checkpoints := applyChanges(t, dir, s)
+	require.NoError(t, s.Close())
+
+	path := filepath.Join(dir, "wal.log")
+	wal, err := os.ReadFile(path)
+	require.NoError(t, err)
+	// a payload byte of the third record, acknowledged like every record after it
+	wal[checkpoints[2].size+10] ^= 0xff
+	require.NoError(t, os.WriteFile(path, wal, 0o600))
+
+	_, err = filelog.Open(dir)
+	assert.ErrorContains(t, err, "corrupted record at offset "+strconv.FormatInt(checkpoints[2].size, 10))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(wal)), info.Size())
+}
+
+func TestCompaction(t *testing.T) {
+	dir := t.TempDir()
+	s, err := filelog.Open(dir, filelog.WithCompactionThreshold(2048))
+	require.NoError(t, err)
+	checkpoints := applyChanges(t, dir, s)
+	require.NoError(t, s.Close())
+
+	_, err = os.Stat(filepath.Join(dir, "snapshot.log"))
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dir, "wal.log"))
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), int64(2048))
+
+	reopened, err := filelog.Open(dir)
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, checkpoints[len(checkpoints)-1].devices, listDevices(t, reopened))
+	assert.NoError(t, reopened.UpdateSignatureDevice(context.Background(), "a", store.UpdateSignatureDevice{SignatureCounter: 6, Version: "7"}))
+}
+
+func TestRecoversFromCrashDuringCompaction(t *testing.T) {
+	dir := t.TempDir()
+	s, err := filelog.Open(dir, filelog.WithCompactionThreshold(0))
+	require.NoError(t, err)
+	checkpoints := applyChanges(t, dir, s)
+
+	path := filepath.Join(dir, "wal.log")
+	wal, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Compact())
+	require.NoError(t, s.Close())
+
+	// the snapshot got renamed into place, but the log was not truncated yet
+	require.NoError(t, os.WriteFile(path, wal, 0o600))
+
+	recovered, err := filelog.Open(dir)
+	require.NoError(t, err)
+	defer recovered.Close()
+	assert.Equal(t, checkpoints[len(checkpoints)-1].devices, listDevices(t, recovered))
+	// the events of the log already covered by the snapshot do not add to the history again
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, signatureCounters(t, recovered, "a"))
+	assert.NoError(t, recovered.UpdateSignatureDevice(context.Background(), "a", store.UpdateSignatureDevice{SignatureCounter: 6, Version: "7"}))
+}
+
+func TestHistorySurvivesCompaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := filelog.Open(dir, filelog.WithCompactionThreshold(0))
+	require.NoError(t, err)
+	applyChanges(t, dir, s)
+	require.NoError(t, s.Compact())
+	require.NoError(t, s.UpdateSignatureDevice(ctx, "a", store.UpdateSignatureDevice{SignatureCounter: 6, LastSignature: "signature-6", SignedData: "data-6", Version: "7"}))
+	require.NoError(t, s.Close())
+
+	reopened, err := filelog.Open(dir)
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, signatureCounters(t, reopened, "a"))
+	publicKeys, err := reopened.ListPublicKeys(ctx, "a")
+	require.NoError(t, err)
+	require.Len(t, publicKeys, 2)
+	assert.Equal(t, []byte("public-a"), publicKeys[0].PublicKey)
+	assert.Equal(t, []byte("other-public"), publicKeys[1].PublicKey)
+	assert.Equal(t, 2, publicKeys[1].KeyVersion)
+
+	_, err = reopened.ListPublicKeys(ctx, "c")
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+}
+
+func TestWebhooksSurviveRestart(t *testing.T) {
+	tests := []struct {
+		name    string
+		compact bool
+		// replayLog writes the log back after the compaction, as a crash before its truncation leaves it
+		replayLog bool
+	}{
+		{name: "from the log"},
+		{name: "from the snapshot", compact: true},
+		{name: "from the snapshot and the log it covers", compact: true, replayLog: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			s, err := filelog.Open(dir, filelog.WithCompactionThreshold(0))
+			require.NoError(t, err)
+
+			subscription := store.WebhookSubscription{ID: "subscription", Tenant: "some-tenant", URL: "https://example.com/hook", EventTypes: []string{"device.created"}, Secret: "secret", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			require.NoError(t, s.CreateWebhookSubscription(ctx, subscription))
+			require.NoError(t, s.CreateWebhookSubscription(ctx, store.WebhookSubscription{ID: "deleted", Tenant: "some-tenant", URL: "https://example.com/other"}))
+			delivered := store.OutboxEvent{ID: "delivered", Tenant: "some-tenant", Type: "device.created", DeviceID: "a", Payload: []byte(`{}`), CreatedAt: subscription.CreatedAt}
+			pending := store.OutboxEvent{ID: "pending", Tenant: "some-tenant", Type: "device.created", DeviceID: "b", Payload: []byte(`{}`), CreatedAt: subscription.CreatedAt}
+			require.NoError(t, s.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "a", Tenant: "some-tenant", SignatureAlg: "ECC"}, delivered))
+			require.NoError(t, s.EnqueueWebhookDeliveries(ctx, []string{"delivered"}, []store.WebhookDelivery{
+				{ID: "delivery", SubscriptionID: "subscription", Event: delivered, NextAttemptAt: subscription.CreatedAt},
+				{ID: "deleted-delivery", SubscriptionID: "deleted", Event: delivered, NextAttemptAt: subscription.CreatedAt},
+				{ID: "done", SubscriptionID: "subscription", Event: delivered, NextAttemptAt: subscription.CreatedAt},
+			}))
+			delivery := store.WebhookDelivery{ID: "delivery", SubscriptionID: "subscription", Event: delivered, Attempts: 3, NextAttemptAt: subscription.CreatedAt, LastError: "some error", Dead: true}
+			require.NoError(t, s.UpdateWebhookDelivery(ctx, delivery))
+			require.NoError(t, s.DeleteWebhookDelivery(ctx, "done"))
+			require.NoError(t, s.DeleteWebhookSubscription(ctx, "some-tenant", "deleted"))
+			require.NoError(t, s.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "b", Tenant: "some-tenant", SignatureAlg: "ECC"}, pending))
+
+			path := filepath.Join(dir, "wal.log")
+			wal, err := os.ReadFile(path)
+			require.NoError(t, err)
+			if tc.compact {
+				require.NoError(t, s.Compact())
+			}
+			require.NoError(t, s.Close())
+			if tc.replayLog {
+				require.NoError(t, os.WriteFile(path, wal, 0o600))
+			}
+
+			reopened, err := filelog.Open(dir)
+			require.NoError(t, err)
+			defer reopened.Close()
+
+			outbox, err := reopened.ListOutboxEvents(ctx, 10)
+			require.NoError(t, err)
+			assert.Equal(t, []store.OutboxEvent{pending}, outbox)
+			subscriptions, err := reopened.ListWebhookSubscriptions(ctx, "some-tenant")
+			require.NoError(t, err)
+			assert.Equal(t, []store.WebhookSubscription{subscription}, subscriptions)
+			dead, err := reopened.ListDeadWebhookDeliveries(ctx, "subscription")
+			require.NoError(t, err)
+			assert.Equal(t, []store.WebhookDelivery{delivery}, dead)
+			due, err := reopened.ListDueWebhookDeliveries(ctx, subscription.CreatedAt, 10)
+			require.NoError(t, err)
+			assert.Empty(t, due)
+		})
+	}
+}
+
+func TestCompactsHistoryLargerThanARecord(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes more than 64 MiB of history")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := filelog.Open(dir, filelog.WithCompactionThreshold(0))
+	require.NoError(t, err)
+	require.NoError(t, s.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "a", SignatureAlg: "ECC", PublicKey: []byte("public-a"), PrivateKey: []byte("private-a")}))
+	signedData := strings.Repeat("x", 1<<20)
+	for counter := 1; counter <= 70; counter++ {
+		require.NoError(t, s.UpdateSignatureDevice(ctx, "a", store.UpdateSignatureDevice{SignatureCounter: counter, LastSignature: "signature-" + strconv.Itoa(counter), SignedData: signedData, Version: strconv.Itoa(counter)}))
+	}
+
+	require.NoError(t, s.Compact())
+	require.NoError(t, s.Ping(ctx))
+	require.NoError(t, s.Close())
+
+	reopened, err := filelog.Open(dir)
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.Len(t, signatureCounters(t, reopened, "a"), 70)
+	assert.NoError(t, reopened.UpdateSignatureDevice(ctx, "a", store.UpdateSignatureDevice{SignatureCounter: 71, Version: "71"}))
+}
@@ -0,0 +1,150 @@
+package filelog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+)
+
+// A record is an 8 bytes header followed by its payload, the JSON array of the entries of one change:
+//
+//	| length (uint32, big endian) | CRC-32C of the payload (uint32, big endian) | payload |
+const headerSize = 8
+
+// maxRecordSize bounds the length read from a header, so that a torn header is not taken for a huge record.
+const maxRecordSize = 64 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// errTornRecord reports a last record which was not completely written, or got corrupted since.
+	errTornRecord = errors.New("torn record")
+	// errCorruptedRecord reports a corrupted record followed by others, which were acknowledged.
+	errCorruptedRecord = errors.New("corrupted record")
+)
+
+// encodeRecord frames entries as a record.
+func encodeRecord(entries []store.JournalEntry) ([]byte, error) {
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding record: %w", err)
+	}
+	return frameRecord(payload)
+}
+
+// frameRecord prefixes payload, a JSON array of entries, with its header.
+func frameRecord(payload []byte) ([]byte, error) {
+	if len(payload) > maxRecordSize {
+		return nil, fmt.Errorf("record of %v bytes exceeds the maximum of %v bytes", len(payload), maxRecordSize)
+	}
+
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	copy(record[headerSize:], payload)
+	return record, nil
+}
+
+// readRecords calls fn with the entries of every record read from r, and returns the offset
+// following the last complete record. Reading stops without error at the end of r, or at the first
+// incomplete or corrupted record: with errTornRecord when the record runs to the end of r, as the
+// last write interrupted by a crash does, and with errCorruptedRecord when records follow it.
+func readRecords(r io.Reader, fn func(entries []store.JournalEntry)) (int64, error) {
+	reader := bufio.NewReader(r)
+	var offset int64
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(reader, header); errors.Is(err, io.EOF) {
+			return offset, nil
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			return offset, errTornRecord
+		} else if err != nil {
+			return offset, err
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		if length > maxRecordSize {
+			// no record is that long: the header is torn when it claims more than is left
+			if _, err := io.CopyN(io.Discard, reader, int64(length)); errors.Is(err, io.EOF) {
+				return offset, errTornRecord
+			} else if err != nil {
+				return offset, err
+			}
+			return offset, fmt.Errorf("%w at offset %v", errCorruptedRecord, offset)
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return offset, errTornRecord
+		} else if err != nil {
+			return offset, err
+		}
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+			if _, err := reader.Peek(1); errors.Is(err, io.EOF) {
+				return offset, errTornRecord
+			}
+			return offset, fmt.Errorf("%w at offset %v", errCorruptedRecord, offset)
+		}
+
+		var entries []store.JournalEntry
+		if err := json.Unmarshal(payload, &entries); err != nil {
+			// the checksum matched: this is not a torn write but a record this version cannot read
+			return offset, fmt.Errorf("error decoding record at offset %v: %w", offset, err)
+		}
+		fn(entries)
+		offset += headerSize + int64(length)
+	}
+}
+
+// wal is the write-ahead log of the store: every change is appended to it, and synced to disk,
+// before being applied.
+type wal struct {
+	file *os.File
+	size int64
+	// err is set once a failed append could not be rolled back: the log cannot be appended to anymore.
+	err error
+}
+
+func (w *wal) Append(entries []store.JournalEntry) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	record, err := encodeRecord(entries)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.file.Write(record)
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		// a partial record would hide the following ones from the recovery
+		if truncateErr := w.truncate(w.size); truncateErr != nil {
+			w.err = fmt.Errorf("write-ahead log unusable after a failed write: %w", truncateErr)
+		}
+		return fmt.Errorf("error writing write-ahead log: %w", err)
+	}
+
+	w.size += int64(len(record))
+	return nil
+}
+
+func (w *wal) truncate(size int64) error {
+	if err := w.file.Truncate(size); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+
+	w.size = size
+	return nil
+}
@@ -2,51 +2,483 @@ package inmemory
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
-	"github.com/google/uuid"
 )
 
+// defaultSnapshotInterval is how many events of a device are recorded between two snapshots.
+const defaultSnapshotInterval = 100
 
-
+// InMemoryStore records the changes of every device as an append-only stream of events, and keeps
+// the devices projected from them in DB. Every snapshotInterval events, the state of a device is
+// snapshotted in Snapshots, so that Rebuild only needs the events after it. The history of the
+// devices is kept in Signatures and PublicKeys, which compactions do not drop.
 type InMemoryStore struct {
+	mu sync.RWMutex
 	DB map[string]store.SignatureDevice
+	Streams map[string][]store.DeviceEvent
+	Snapshots map[string]store.DeviceSnapshot
+	Signatures map[string][]store.SignatureRecord
+	PublicKeys map[string][]store.PublicKeyRecord
+	Outbox []store.OutboxEvent
+	Subscriptions map[string]store.WebhookSubscription
+	Deliveries map[string]store.WebhookDelivery
+
+	snapshotInterval int
+	log Log
 }
 
-func (ims *InMemoryStore) CreateSignatureDevice(ctx context.Context, sigDevice store.SignatureDevice) error {
-	sigDevice.Version = uuid.NewString() // this should be handled in the DB store on the stored data, it's just there to show an optimistic lock use
-	ims.DB[sigDevice.ID] = sigDevice
+// Log persists the changes of the store before they are applied. Append receives the events of
+// one change together with the snapshots and outbox events it triggers, or the entries of one
+// webhook change, and must write all of them or none: when it fails, the change is not applied.
+type Log interface {
+	Append(entries []store.JournalEntry) error
+}
+
+// jsonLog writes the entries as JSON lines.
+type jsonLog struct {
+	encoder *json.Encoder
+}
+
+func (l jsonLog) Append(entries []store.JournalEntry) error {
+	for _, entry := range entries {
+		if err := l.encoder.Encode(entry); err != nil {
+			return fmt.Errorf("error writing journal: %w", err)
+		}
+	}
+
 	return nil
 }
 
+type Option func(*InMemoryStore)
+
+// WithSnapshotInterval sets how many events of a device are recorded between two snapshots.
+func WithSnapshotInterval(interval int) Option {
+	return func(ims *InMemoryStore) {
+		ims.snapshotInterval = interval
+	}
+}
+
+// WithJournal mirrors every event, snapshot and webhook change to w, as JSON lines of
+// store.JournalEntry. Events carry the private keys of the devices, subscriptions their secrets.
+func WithJournal(w io.Writer) Option {
+	return WithLog(jsonLog{encoder: json.NewEncoder(w)})
+}
+
+// WithLog persists every change to log before applying it.
+func WithLog(log Log) Option {
+	return func(ims *InMemoryStore) {
+		ims.log = log
+	}
+}
+
+func (ims *InMemoryStore) CreateSignatureDevice(ctx context.Context, sigDevice store.SignatureDevice, outbox ...store.OutboxEvent) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	if _, found := ims.DB[sigDevice.ID]; found {
+		return store.ErrDeviceExists
+	}
+
+	initial := sigDevice.Clone()
+	initial.Version = ""
+	return ims.append(sigDevice.ID, []store.DeviceEvent{{Type: store.DeviceCreated, Device: &initial, Time: sigDevice.CreatedAt}}, outbox)
+}
+
 func (ims *InMemoryStore) GetSignatureDevice(ctx context.Context, id string) (store.SignatureDevice, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
 	if signDevice, found := ims.DB[id]; found {
-		return signDevice, nil
+		return signDevice.Clone(), nil
 	}
 
 	return store.SignatureDevice{}, store.ErrDeviceNotFound
 }
 
-func (ims *InMemoryStore) UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice) error {
+func (ims *InMemoryStore) UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox ...store.OutboxEvent) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	// that function would be executed with an optimistic lock and atomically on the DB
+	// here the store mutex makes the compare-and-swap atomic
+	if err := ims.checkVersion(id, updateSignDevice.Version); err != nil {
+		return err
+	}
+
+	return ims.append(id, []store.DeviceEvent{{
+		Type: store.DeviceSigned,
+		SignatureCounter: updateSignDevice.SignatureCounter,
+		LastSignature: updateSignDevice.LastSignature,
+		SignedData: updateSignDevice.SignedData,
+		KeyVersion: ims.DB[id].KeyVersion,
+		Time: updateSignDevice.SignedAt,
+	}}, outbox)
+}
+
+func (ims *InMemoryStore) AppendSignatures(ctx context.Context, id string, signatures []store.UpdateSignatureDevice, version string) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	if err := ims.checkVersion(id, version); err != nil {
+		return err
+	}
+	if len(signatures) == 0 {
+		return nil
+	}
+
+	events := make([]store.DeviceEvent, 0, len(signatures))
+	for _, signature := range signatures {
+		events = append(events, store.DeviceEvent{
+			Type: store.DeviceSigned,
+			SignatureCounter: signature.SignatureCounter,
+			LastSignature: signature.LastSignature,
+			SignedData: signature.SignedData,
+			KeyVersion: ims.DB[id].KeyVersion,
+			Time: signature.SignedAt,
+		})
+	}
+	return ims.append(id, events, nil)
+}
+
+func (ims *InMemoryStore) UpdateSignatureDeviceDetails(ctx context.Context, id string, updateDetails store.UpdateSignatureDeviceDetails, outbox ...store.OutboxEvent) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	if err := ims.checkVersion(id, updateDetails.Version); err != nil {
+		return err
+	}
+
+	events := []store.DeviceEvent{}
+	if updateDetails.Label != nil || updateDetails.Metadata != nil || updateDetails.Tags != nil {
+		events = append(events, store.DeviceEvent{
+			Type: store.DeviceDetailsUpdated,
+			Label: updateDetails.Label,
+			Metadata: maps.Clone(updateDetails.Metadata),
+			Tags: slices.Clone(updateDetails.Tags),
+		})
+	}
+	if updateDetails.Status != nil && *updateDetails.Status != ims.DB[id].Status {
+		eventType := store.DeviceReactivated
+		if *updateDetails.Status == store.StatusSuspended {
+			eventType = store.DeviceSuspended
+		}
+		events = append(events, store.DeviceEvent{Type: eventType})
+	}
+
+	return ims.append(id, events, outbox)
+}
+
+func (ims *InMemoryStore) RotateSignatureDeviceKey(ctx context.Context, id string, rotateKey store.RotateSignatureDeviceKey, outbox ...store.OutboxEvent) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	if err := ims.checkVersion(id, rotateKey.Version); err != nil {
+		return err
+	}
+
+	return ims.append(id, []store.DeviceEvent{{
+		Type: store.DeviceKeyRotated,
+		PublicKey: slices.Clone(rotateKey.PublicKey),
+		PrivateKey: slices.Clone(rotateKey.PrivateKey),
+		KeyVersion: ims.DB[id].KeyVersion + 1,
+		Time: rotateKey.RotatedAt,
+	}}, outbox)
+}
+
+func (ims *InMemoryStore) ListSignatureDevices(ctx context.Context, filter store.ListFilter) ([]store.SignatureDevice, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	signDevices := []store.SignatureDevice{}
+	for _, signDevice := range ims.DB {
+		if filter.Matches(signDevice) {
+			signDevices = append(signDevices, signDevice.Clone())
+		}
+	}
+	sort.Slice(signDevices, func(i, j int) bool { return signDevices[i].ID < signDevices[j].ID })
+
+	return signDevices, nil
+}
+
+func (ims *InMemoryStore) ListPublicKeys(ctx context.Context, id string) ([]store.PublicKeyRecord, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	if _, found := ims.DB[id]; !found {
+		return nil, store.ErrDeviceNotFound
+	}
+
+	publicKeys := []store.PublicKeyRecord{}
+	for _, publicKey := range ims.PublicKeys[id] {
+		publicKey.PublicKey = slices.Clone(publicKey.PublicKey)
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return publicKeys, nil
+}
+
+func (ims *InMemoryStore) ScanSignatures(ctx context.Context, id string, fn func(store.SignatureRecord) error) error {
+	ims.mu.RLock()
+	if _, found := ims.DB[id]; !found {
+		ims.mu.RUnlock()
+		return store.ErrDeviceNotFound
+	}
+	// records are only ever appended: the ones already there can be read without the lock,
+	// so that slow readers do not block the signing
+	signatures := ims.Signatures[id]
+	ims.mu.RUnlock()
+
+	for _, signature := range signatures {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(signature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ims *InMemoryStore) DeleteSignatureDevice(ctx context.Context, id string, version string, outbox ...store.OutboxEvent) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	if err := ims.checkVersion(id, version); err != nil {
+		return err
+	}
+
+	return ims.append(id, []store.DeviceEvent{{Type: store.DeviceDeleted}}, outbox)
+}
+
+// Ping always succeeds: the in-memory store has no backend to reach.
+func (ims *InMemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Rebuild projects DB again from the snapshots and the events recorded after them.
+func (ims *InMemoryStore) Rebuild() error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	projection := store.NewProjection()
+	for _, snapshot := range ims.Snapshots {
+		projection.ApplySnapshot(snapshot)
+	}
+	for _, stream := range ims.Streams {
+		for _, event := range stream {
+			if err := projection.Apply(event); err != nil {
+				return err
+			}
+		}
+	}
+
+	ims.DB = map[string]store.SignatureDevice{}
+	for _, signDevice := range projection.Devices() {
+		ims.DB[signDevice.ID] = signDevice
+	}
+	return nil
+}
+
+func (ims *InMemoryStore) checkVersion(id string, version string) error {
 	signDevice, found := ims.DB[id]
 	if !found {
 		return store.ErrDeviceNotFound
 	}
+	if signDevice.Version != version {
+		return store.ErrVersionConflict
+	}
 
-	// that function would be executed with an optimistic lock and atomically on the DB
-	// here I'm just pretending that it's happening atomically
-	if signDevice.Version == updateSignDevice.Version {
-		signDevice.SignatureCounter = updateSignDevice.SignatureCounter
-		signDevice.LastSignature = updateSignDevice.LastSignature
-		signDevice.Version = uuid.NewString()
+	return nil
+}
+
+// append records events at the end of the stream of the device and projects them, together
+// with the outbox events. Events without a time are given the current one. It must be called with the store mutex held.
+func (ims *InMemoryStore) append(id string, events []store.DeviceEvent, outbox []store.OutboxEvent) error {
+	sequence := ims.lastSequence(id)
+	now := time.Now().UTC()
+	entries := []store.JournalEntry{}
+	snapshots := []store.DeviceSnapshot{}
+	signDevice, exists := ims.DB[id]
+	for i := range events {
+		sequence++
+		events[i].DeviceID = id
+		events[i].Sequence = sequence
+		if events[i].Time.IsZero() {
+			events[i].Time = now
+		}
+		entries = append(entries, store.JournalEntry{Event: &events[i]})
+
+		signDevice, exists = store.Apply(signDevice, events[i])
+		if ims.snapshotInterval > 0 && sequence%uint64(ims.snapshotInterval) == 0 {
+			snapshot := store.DeviceSnapshot{DeviceID: id, Sequence: sequence, Deleted: !exists, Device: signDevice.Clone()}
+			snapshots = append(snapshots, snapshot)
+			entries = append(entries, store.JournalEntry{Snapshot: &snapshot})
+		}
+	}
+	for i := range outbox {
+		entries = append(entries, store.JournalEntry{Outbox: &outbox[i]})
+	}
+
+	// a change which cannot be logged is not applied
+	if ims.log != nil {
+		if err := ims.log.Append(entries); err != nil {
+			return err
+		}
+	}
+
+	ims.Streams[id] = append(ims.Streams[id], events...)
+	for _, event := range events {
+		ims.record(event)
+	}
+	for _, snapshot := range snapshots {
+		ims.Snapshots[id] = snapshot
+	}
+	if exists {
 		ims.DB[id] = signDevice
+	} else {
+		delete(ims.DB, id)
 	}
+	ims.Outbox = append(ims.Outbox, outbox...)
 
 	return nil
 }
 
-func New() *InMemoryStore {
-	return &InMemoryStore{
+// record adds what event changes to the history of its device. It must be called with the store
+// mutex held.
+func (ims *InMemoryStore) record(event store.DeviceEvent) {
+	if event.Type == store.DeviceDeleted {
+		delete(ims.Signatures, event.DeviceID)
+		delete(ims.PublicKeys, event.DeviceID)
+		return
+	}
+
+	signature, publicKey := store.History(event)
+	if signature != nil {
+		ims.Signatures[event.DeviceID] = append(ims.Signatures[event.DeviceID], *signature)
+	}
+	if publicKey != nil {
+		ims.PublicKeys[event.DeviceID] = append(ims.PublicKeys[event.DeviceID], *publicKey)
+	}
+}
+
+// lastSequence returns the sequence number of the last event of a device, which may only be
+// covered by its snapshot once the stream has been compacted.
+func (ims *InMemoryStore) lastSequence(id string) uint64 {
+	if stream := ims.Streams[id]; len(stream) > 0 {
+		return stream[len(stream)-1].Sequence
+	}
+
+	return ims.Snapshots[id].Sequence
+}
+
+// Restore loads the snapshots, events, history records and webhook changes of entries, as
+// previously given to the Log or returned by History and Webhooks, and projects DB again. Entries
+// are not logged again.
+func (ims *InMemoryStore) Restore(entries []store.JournalEntry) error {
+	ims.mu.Lock()
+	for _, entry := range entries {
+		if snapshot := entry.Snapshot; snapshot != nil && snapshot.Sequence > ims.Snapshots[snapshot.DeviceID].Sequence {
+			ims.Snapshots[snapshot.DeviceID] = *snapshot
+		}
+		if event := entry.Event; event != nil && event.Sequence > ims.lastSequence(event.DeviceID) {
+			ims.Streams[event.DeviceID] = append(ims.Streams[event.DeviceID], *event)
+			ims.record(*event)
+		}
+		if signature := entry.Signature; signature != nil {
+			ims.Signatures[signature.DeviceID] = append(ims.Signatures[signature.DeviceID], *signature)
+		}
+		if publicKey := entry.PublicKey; publicKey != nil {
+			ims.PublicKeys[publicKey.DeviceID] = append(ims.PublicKeys[publicKey.DeviceID], *publicKey)
+		}
+		ims.restoreWebhooks(entry)
+	}
+	ims.mu.Unlock()
+
+	return ims.Rebuild()
+}
+
+// Compact snapshots every device at its last event, including the deleted ones, and drops the
+// events covered by the snapshots. It returns the snapshots, ordered by device ID.
+func (ims *InMemoryStore) Compact() []store.DeviceSnapshot {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	ids := []string{}
+	for id := range ims.Streams {
+		ids = append(ids, id)
+	}
+	for id := range ims.Snapshots {
+		if _, found := ims.Streams[id]; !found {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	snapshots := []store.DeviceSnapshot{}
+	for _, id := range ids {
+		signDevice, found := ims.DB[id]
+		snapshot := store.DeviceSnapshot{DeviceID: id, Sequence: ims.lastSequence(id), Deleted: !found, Device: signDevice.Clone()}
+		ims.Snapshots[id] = snapshot
+		delete(ims.Streams, id)
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots
+}
+
+// History returns the history of every device as journal entries, ordered by device ID, the public
+// keys of a device before its signatures. Together with the snapshots of Compact, they let Restore
+// rebuild the store without the events.
+func (ims *InMemoryStore) History() []store.JournalEntry {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	ids := []string{}
+	for id := range ims.PublicKeys {
+		ids = append(ids, id)
+	}
+	for id := range ims.Signatures {
+		if _, found := ims.PublicKeys[id]; !found {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	entries := []store.JournalEntry{}
+	for _, id := range ids {
+		for _, publicKey := range ims.PublicKeys[id] {
+			entries = append(entries, store.JournalEntry{PublicKey: &publicKey})
+		}
+		for _, signature := range ims.Signatures[id] {
+			entries = append(entries, store.JournalEntry{Signature: &signature})
+		}
+	}
+
+	return entries
+}
+
+func New(opts ...Option) *InMemoryStore {
+	ims := &InMemoryStore{
 		DB: map[string]store.SignatureDevice{},
+		Streams: map[string][]store.DeviceEvent{},
+		Snapshots: map[string]store.DeviceSnapshot{},
+		Signatures: map[string][]store.SignatureRecord{},
+		PublicKeys: map[string][]store.PublicKeyRecord{},
+		Subscriptions: map[string]store.WebhookSubscription{},
+		Deliveries: map[string]store.WebhookDelivery{},
+		snapshotInterval: defaultSnapshotInterval,
+	}
+	for _, opt := range opts {
+		opt(ims)
 	}
-}
\ No newline at end of file
+
+	return ims
+}
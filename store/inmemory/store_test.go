@@ -1,3 +1,136 @@
 package inmemory_test
 
-// TODO: add tests
\ No newline at end of file
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return inmemory.New()
+	})
+}
+
+func TestChangesAreRecordedAsEvents(t *testing.T) {
+	ctx := context.Background()
+	ims := inmemory.New()
+
+	require.NoError(t, ims.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "some-id", SignatureAlg: "ECC", PublicKey: []byte("public"), PrivateKey: []byte("private")}))
+	require.NoError(t, ims.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: 1, LastSignature: "c2lnbmF0dXJl", Version: "1"}))
+	suspended := store.StatusSuspended
+	require.NoError(t, ims.UpdateSignatureDeviceDetails(ctx, "some-id", store.UpdateSignatureDeviceDetails{Status: &suspended, Version: "2"}))
+	require.NoError(t, ims.RotateSignatureDeviceKey(ctx, "some-id", store.RotateSignatureDeviceKey{PublicKey: []byte("other-public"), PrivateKey: []byte("other-private"), Version: "3"}))
+	assert.ErrorIs(t, ims.RotateSignatureDeviceKey(ctx, "some-id", store.RotateSignatureDeviceKey{Version: "3"}), store.ErrVersionConflict)
+
+	types := []string{}
+	for _, event := range ims.Streams["some-id"] {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{store.DeviceCreated, store.DeviceSigned, store.DeviceSuspended, store.DeviceKeyRotated}, types)
+
+	signDevice, err := ims.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, "4", signDevice.Version)
+	assert.Equal(t, 1, signDevice.SignatureCounter)
+	assert.Equal(t, store.StatusSuspended, signDevice.Status)
+	assert.Equal(t, 2, signDevice.KeyVersion)
+	assert.Equal(t, []byte("other-private"), signDevice.PrivateKey)
+
+	require.NoError(t, ims.DeleteSignatureDevice(ctx, "some-id", "4"))
+	_, err = ims.GetSignatureDevice(ctx, "some-id")
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+	assert.Len(t, ims.Streams["some-id"], 5)
+}
+
+func TestRebuildFromSnapshotsAndEvents(t *testing.T) {
+	ctx := context.Background()
+	ims := inmemory.New(inmemory.WithSnapshotInterval(3))
+
+	require.NoError(t, ims.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "some-id", SignatureAlg: "ECC", Metadata: map[string]string{"store": "berlin"}}))
+	for counter := 1; counter <= 4; counter++ {
+		require.NoError(t, ims.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: counter, Version: strconv.Itoa(counter)}))
+	}
+	require.NoError(t, ims.UpdateSignatureDeviceDetails(ctx, "some-id", store.UpdateSignatureDeviceDetails{Metadata: map[string]string{}, Version: "5"}))
+	expected, err := ims.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+
+	snapshot := ims.Snapshots["some-id"]
+	assert.Equal(t, uint64(6), snapshot.Sequence)
+	assert.Equal(t, 4, snapshot.Device.SignatureCounter)
+
+	// events covered by the snapshot are not needed anymore
+	ims.Streams["some-id"] = ims.Streams["some-id"][5:]
+	ims.DB = map[string]store.SignatureDevice{}
+	require.NoError(t, ims.Rebuild())
+
+	rebuilt, err := ims.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, expected, rebuilt)
+	assert.Empty(t, rebuilt.Metadata)
+}
+
+func TestRebuildFailsOnMissingEvents(t *testing.T) {
+	ctx := context.Background()
+	ims := inmemory.New()
+
+	require.NoError(t, ims.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "some-id", SignatureAlg: "ECC"}))
+	require.NoError(t, ims.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: 1, Version: "1"}))
+	ims.Streams["some-id"] = ims.Streams["some-id"][1:]
+
+	assert.ErrorIs(t, ims.Rebuild(), store.ErrEventOutOfSequence)
+}
+
+func TestJournalReplaysToTheSameDevices(t *testing.T) {
+	ctx := context.Background()
+	journal := &bytes.Buffer{}
+	ims := inmemory.New(inmemory.WithJournal(journal), inmemory.WithSnapshotInterval(2))
+
+	label := "some-label"
+	require.NoError(t, ims.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "some-id", SignatureAlg: "ECC"}))
+	require.NoError(t, ims.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "other-id", SignatureAlg: "RSA", Tags: []string{"pos"}}))
+	require.NoError(t, ims.UpdateSignatureDeviceDetails(ctx, "some-id", store.UpdateSignatureDeviceDetails{Label: &label, Tags: []string{}, Version: "1"}))
+	require.NoError(t, ims.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: 1, LastSignature: "c2lnbmF0dXJl", Version: "2"}))
+	require.NoError(t, ims.DeleteSignatureDevice(ctx, "other-id", "1"))
+
+	projection := store.NewProjection()
+	err := store.ReadJournal(journal, func(entry store.JournalEntry) error {
+		if entry.Snapshot != nil {
+			projection.ApplySnapshot(*entry.Snapshot)
+			return nil
+		}
+		return projection.Apply(*entry.Event)
+	})
+	require.NoError(t, err)
+
+	expected, err := ims.ListSignatureDevices(ctx, store.ListFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, expected, projection.Devices())
+}
+
+func TestChangeIsNotAppliedWhenJournalFails(t *testing.T) {
+	ctx := context.Background()
+	ims := inmemory.New(inmemory.WithJournal(failingWriter{}))
+
+	err := ims.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "some-id", SignatureAlg: "ECC"}, store.OutboxEvent{ID: "some-event"})
+	assert.Error(t, err)
+
+	_, err = ims.GetSignatureDevice(ctx, "some-id")
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+	assert.Empty(t, ims.Streams["some-id"])
+	assert.Empty(t, ims.Outbox)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
@@ -0,0 +1,247 @@
+package inmemory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+)
+
+func (ims *InMemoryStore) CreateWebhookSubscription(ctx context.Context, subscription store.WebhookSubscription) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	subscription.EventTypes = slices.Clone(subscription.EventTypes)
+	if err := ims.logWebhooks(store.JournalEntry{Subscription: &subscription}); err != nil {
+		return err
+	}
+	ims.Subscriptions[subscription.ID] = subscription
+	return nil
+}
+
+func (ims *InMemoryStore) GetWebhookSubscription(ctx context.Context, tenant string, id string) (store.WebhookSubscription, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	subscription, found := ims.Subscriptions[id]
+	if !found || subscription.Tenant != tenant {
+		return store.WebhookSubscription{}, store.ErrSubscriptionNotFound
+	}
+
+	subscription.EventTypes = slices.Clone(subscription.EventTypes)
+	return subscription, nil
+}
+
+func (ims *InMemoryStore) ListWebhookSubscriptions(ctx context.Context, tenant string) ([]store.WebhookSubscription, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	subscriptions := []store.WebhookSubscription{}
+	for _, subscription := range ims.Subscriptions {
+		if subscription.Tenant == tenant {
+			subscription.EventTypes = slices.Clone(subscription.EventTypes)
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if !subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+		}
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+
+	return subscriptions, nil
+}
+
+func (ims *InMemoryStore) DeleteWebhookSubscription(ctx context.Context, tenant string, id string) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	subscription, found := ims.Subscriptions[id]
+	if !found || subscription.Tenant != tenant {
+		return store.ErrSubscriptionNotFound
+	}
+
+	if err := ims.logWebhooks(store.JournalEntry{SubscriptionDeleted: id}); err != nil {
+		return err
+	}
+	ims.deleteSubscription(id)
+	return nil
+}
+
+// deleteSubscription deletes a subscription together with its deliveries. It must be called with
+// the store mutex held.
+func (ims *InMemoryStore) deleteSubscription(id string) {
+	delete(ims.Subscriptions, id)
+	for deliveryID, delivery := range ims.Deliveries {
+		if delivery.SubscriptionID == id {
+			delete(ims.Deliveries, deliveryID)
+		}
+	}
+}
+
+func (ims *InMemoryStore) ListOutboxEvents(ctx context.Context, limit int) ([]store.OutboxEvent, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	return slices.Clone(ims.Outbox[:min(limit, len(ims.Outbox))]), nil
+}
+
+func (ims *InMemoryStore) EnqueueWebhookDeliveries(ctx context.Context, outboxIDs []string, deliveries []store.WebhookDelivery) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	entries := []store.JournalEntry{}
+	for _, id := range outboxIDs {
+		entries = append(entries, store.JournalEntry{OutboxDequeued: id})
+	}
+	for i := range deliveries {
+		entries = append(entries, store.JournalEntry{Delivery: &deliveries[i]})
+	}
+	if err := ims.logWebhooks(entries...); err != nil {
+		return err
+	}
+
+	ims.Outbox = slices.DeleteFunc(ims.Outbox, func(event store.OutboxEvent) bool {
+		return slices.Contains(outboxIDs, event.ID)
+	})
+	for _, delivery := range deliveries {
+		ims.Deliveries[delivery.ID] = delivery
+	}
+
+	return nil
+}
+
+func (ims *InMemoryStore) ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]store.WebhookDelivery, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	deliveries := []store.WebhookDelivery{}
+	for _, delivery := range ims.Deliveries {
+		if !delivery.Dead && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sortDeliveries(deliveries, func(delivery store.WebhookDelivery) time.Time { return delivery.NextAttemptAt })
+
+	return deliveries[:min(limit, len(deliveries))], nil
+}
+
+func (ims *InMemoryStore) UpdateWebhookDelivery(ctx context.Context, delivery store.WebhookDelivery) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	// the subscription may have been deleted in the meantime, taking its deliveries along
+	if _, found := ims.Deliveries[delivery.ID]; !found {
+		return nil
+	}
+	if err := ims.logWebhooks(store.JournalEntry{Delivery: &delivery}); err != nil {
+		return err
+	}
+	ims.Deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (ims *InMemoryStore) DeleteWebhookDelivery(ctx context.Context, id string) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	if err := ims.logWebhooks(store.JournalEntry{DeliveryDeleted: id}); err != nil {
+		return err
+	}
+	delete(ims.Deliveries, id)
+	return nil
+}
+
+func (ims *InMemoryStore) ListDeadWebhookDeliveries(ctx context.Context, subscriptionID string) ([]store.WebhookDelivery, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	deliveries := []store.WebhookDelivery{}
+	for _, delivery := range ims.Deliveries {
+		if delivery.Dead && delivery.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sortDeliveries(deliveries, func(delivery store.WebhookDelivery) time.Time { return delivery.Event.CreatedAt })
+
+	return deliveries, nil
+}
+
+// sortDeliveries sorts deliveries by the given time, then by ID to keep the order stable.
+func sortDeliveries(deliveries []store.WebhookDelivery, by func(store.WebhookDelivery) time.Time) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !by(deliveries[i]).Equal(by(deliveries[j])) {
+			return by(deliveries[i]).Before(by(deliveries[j]))
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+}
+
+// logWebhooks persists the entries of a webhook change before it is applied. It must be called with
+// the store mutex held.
+func (ims *InMemoryStore) logWebhooks(entries ...store.JournalEntry) error {
+	if ims.log == nil || len(entries) == 0 {
+		return nil
+	}
+	return ims.log.Append(entries)
+}
+
+// restoreWebhooks applies the webhook change of entry. The changes are idempotent, as the log
+// replayed over a snapshot may repeat the changes it covers. It must be called with the store mutex
+// held.
+func (ims *InMemoryStore) restoreWebhooks(entry store.JournalEntry) {
+	if event := entry.Outbox; event != nil && !slices.ContainsFunc(ims.Outbox, func(queued store.OutboxEvent) bool { return queued.ID == event.ID }) {
+		ims.Outbox = append(ims.Outbox, *event)
+	}
+	if id := entry.OutboxDequeued; id != "" {
+		ims.Outbox = slices.DeleteFunc(ims.Outbox, func(queued store.OutboxEvent) bool { return queued.ID == id })
+	}
+	if subscription := entry.Subscription; subscription != nil {
+		ims.Subscriptions[subscription.ID] = *subscription
+	}
+	if id := entry.SubscriptionDeleted; id != "" {
+		ims.deleteSubscription(id)
+	}
+	if delivery := entry.Delivery; delivery != nil {
+		ims.Deliveries[delivery.ID] = *delivery
+	}
+	if id := entry.DeliveryDeleted; id != "" {
+		delete(ims.Deliveries, id)
+	}
+}
+
+// Webhooks returns the subscriptions, the deliveries and the pending outbox events as journal
+// entries, the subscriptions and deliveries ordered by ID and the outbox events in queue order.
+// Together with the snapshots of Compact and History, they let Restore rebuild the store.
+func (ims *InMemoryStore) Webhooks() []store.JournalEntry {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	entries := []store.JournalEntry{}
+	for _, id := range sortedKeys(ims.Subscriptions) {
+		subscription := ims.Subscriptions[id]
+		entries = append(entries, store.JournalEntry{Subscription: &subscription})
+	}
+	for _, id := range sortedKeys(ims.Deliveries) {
+		delivery := ims.Deliveries[id]
+		entries = append(entries, store.JournalEntry{Delivery: &delivery})
+	}
+	for i := range ims.Outbox {
+		event := ims.Outbox[i]
+		entries = append(entries, store.JournalEntry{Outbox: &event})
+	}
+
+	return entries
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -3,10 +3,16 @@ package store
 import (
 	"context"
 	"errors"
+	"maps"
+	"slices"
+	"time"
 )
 
 var (
 	ErrDeviceNotFound = errors.New("device not found")
+	ErrVersionConflict = errors.New("device version conflict")
+	ErrDeviceExists = errors.New("device already exists")
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
 )
 
 type SignatureDevice struct {
@@ -14,21 +20,173 @@ type SignatureDevice struct {
 	Tenant string
 	SignatureAlg string
 	Label string
+	Metadata map[string]string
+	Tags []string
 	PublicKey []byte
 	PrivateKey []byte
 	SignatureCounter int
 	LastSignature string
+	Status string
+	KeyVersion int // incremented by every key rotation, starting at 1
+	CreatedAt time.Time // set by the store on creation unless given, as devices imported with their history are
 	Version string // this field should belong to the stored data, but I'm using this I/O struct also as stored data for simplicity
 }
 
 type UpdateSignatureDevice struct {
 	SignatureCounter int
 	LastSignature string
+	SignedData string // what LastSignature was computed over, kept in the signature history
+	SignedAt time.Time // when LastSignature was made, for imported signatures; the time of the update when zero
 	Version string
 }
 
+// UpdateSignatureDeviceDetails holds the user editable fields of a device; nil fields are left untouched,
+// while non nil Metadata and Tags replace the stored ones.
+type UpdateSignatureDeviceDetails struct {
+	Label *string
+	Metadata map[string]string
+	Tags []string
+	Status *string
+	Version string
+}
+
+type RotateSignatureDeviceKey struct {
+	PublicKey []byte
+	PrivateKey []byte
+	RotatedAt time.Time // when the key was created, for imported keys; the time of the rotation when zero
+	Version string
+}
+
+// SignatureRecord is a signature made by a device, kept in its history for audit exports.
+type SignatureRecord struct {
+	DeviceID string
+	SignatureCounter int // the counter the signature was made with, starting at 0
+	KeyVersion int
+	SignedData string
+	Signature string
+	CreatedAt time.Time
+}
+
+// PublicKeyRecord is a public key of a device, kept in its history for audit exports.
+type PublicKeyRecord struct {
+	DeviceID string
+	KeyVersion int
+	PublicKey []byte
+	CreatedAt time.Time
+}
+
+// ListFilter selects devices carrying all the given tags and metadata entries.
+type ListFilter struct {
+	Tags []string
+	Metadata map[string]string
+}
+
+// OutboxEvent is a change to be delivered to webhook subscribers. Store writes accept outbox events
+// which are persisted in the same transaction as the change they describe, so that no change is
+// lost nor announced without having happened.
+type OutboxEvent struct {
+	ID string
+	Tenant string
+	Type string
+	DeviceID string
+	Payload []byte // JSON document describing the change
+	CreatedAt time.Time
+}
+
+// Store persists signature devices. Every write persists the given outbox events atomically with it.
 type Store interface {
-	CreateSignatureDevice(ctx context.Context, sigDevice SignatureDevice) error
-	UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice UpdateSignatureDevice) error
+	CreateSignatureDevice(ctx context.Context, sigDevice SignatureDevice, outbox ...OutboxEvent) error
+	UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice UpdateSignatureDevice, outbox ...OutboxEvent) error
+	// AppendSignatures records signatures made elsewhere, each as UpdateSignatureDevice would, in a single
+	// write: all of them or none. version is the one of the device before the first of them, whose own
+	// Version is ignored.
+	AppendSignatures(ctx context.Context, id string, signatures []UpdateSignatureDevice, version string) error
+	UpdateSignatureDeviceDetails(ctx context.Context, id string, updateDetails UpdateSignatureDeviceDetails, outbox ...OutboxEvent) error
+	RotateSignatureDeviceKey(ctx context.Context, id string, rotateKey RotateSignatureDeviceKey, outbox ...OutboxEvent) error
+	DeleteSignatureDevice(ctx context.Context, id string, version string, outbox ...OutboxEvent) error
 	GetSignatureDevice(ctx context.Context, id string) (SignatureDevice, error)
+	// ListSignatureDevices returns the devices matching filter, ordered by ID.
+	ListSignatureDevices(ctx context.Context, filter ListFilter) ([]SignatureDevice, error)
+
+	// The history of a device is kept until the device is deleted: every public key it had,
+	// and every signature it made, recorded atomically with the change making them.
+
+	// ListPublicKeys returns the public keys of the device, ordered by key version.
+	ListPublicKeys(ctx context.Context, id string) ([]PublicKeyRecord, error)
+	// ScanSignatures calls fn with the signatures of the device ordered by signature counter,
+	// without loading them all at once, and stops at the first error fn returns.
+	ScanSignatures(ctx context.Context, id string, fn func(SignatureRecord) error) error
+}
+
+// WebhookSubscription is a receiver of the outbox events of a tenant.
+type WebhookSubscription struct {
+	ID string
+	Tenant string
+	URL string
+	EventTypes []string // empty means every event type
+	Secret string
+	CreatedAt time.Time
+}
+
+// WebhookDelivery is an outbox event to be delivered to one subscription.
+type WebhookDelivery struct {
+	ID string
+	SubscriptionID string
+	Event OutboxEvent
+	Attempts int
+	NextAttemptAt time.Time
+	LastError string
+	Dead bool // dead deliveries are not attempted anymore
+}
+
+// WebhookStore persists webhook subscriptions and the deliveries of the outbox events to them.
+type WebhookStore interface {
+	CreateWebhookSubscription(ctx context.Context, subscription WebhookSubscription) error
+	GetWebhookSubscription(ctx context.Context, tenant string, id string) (WebhookSubscription, error)
+	// ListWebhookSubscriptions returns the subscriptions of tenant, ordered by creation.
+	ListWebhookSubscriptions(ctx context.Context, tenant string) ([]WebhookSubscription, error)
+	// DeleteWebhookSubscription deletes the subscription together with its deliveries.
+	DeleteWebhookSubscription(ctx context.Context, tenant string, id string) error
+
+	// ListOutboxEvents returns up to limit outbox events, oldest first.
+	ListOutboxEvents(ctx context.Context, limit int) ([]OutboxEvent, error)
+	// EnqueueWebhookDeliveries atomically removes the outbox events with the given IDs and stores deliveries.
+	EnqueueWebhookDeliveries(ctx context.Context, outboxIDs []string, deliveries []WebhookDelivery) error
+	// ListDueWebhookDeliveries returns up to limit live deliveries due at now, most overdue first.
+	ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error
+	DeleteWebhookDelivery(ctx context.Context, id string) error
+	// ListDeadWebhookDeliveries returns the dead deliveries of a subscription, oldest event first.
+	ListDeadWebhookDeliveries(ctx context.Context, subscriptionID string) ([]WebhookDelivery, error)
+}
+
+// Pinger is implemented by stores able to tell whether their backend is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Matches reports whether sigDevice carries every tag and metadata entry of the filter.
+func (f ListFilter) Matches(sigDevice SignatureDevice) bool {
+	for key, value := range f.Metadata {
+		if found, ok := sigDevice.Metadata[key]; !ok || found != value {
+			return false
+		}
+	}
+
+	for _, tag := range f.Tags {
+		if !slices.Contains(sigDevice.Tags, tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Clone returns a deep copy of sigDevice, so that stores never share maps or slices with callers.
+func (d SignatureDevice) Clone() SignatureDevice {
+	d.Metadata = maps.Clone(d.Metadata)
+	d.Tags = slices.Clone(d.Tags)
+	d.PublicKey = slices.Clone(d.PublicKey)
+	d.PrivateKey = slices.Clone(d.PrivateKey)
+	return d
 }
\ No newline at end of file
@@ -10,13 +10,27 @@ type Store struct {
 	CreateSignatureDeviceFn CreateSignatureDeviceFn
 	GetSignatureDeviceFn GetSignatureDeviceFn
 	UpdateSignatureDeviceFn UpdateSignatureDeviceFn
+	AppendSignaturesFn AppendSignaturesFn
+	UpdateSignatureDeviceDetailsFn UpdateSignatureDeviceDetailsFn
+	RotateSignatureDeviceKeyFn RotateSignatureDeviceKeyFn
+	DeleteSignatureDeviceFn DeleteSignatureDeviceFn
+	ListSignatureDevicesFn ListSignatureDevicesFn
+	ListPublicKeysFn ListPublicKeysFn
+	ScanSignaturesFn ScanSignaturesFn
 }
 
-type CreateSignatureDeviceFn func (ctx context.Context, sigDevice store.SignatureDevice) error
+type CreateSignatureDeviceFn func(ctx context.Context, sigDevice store.SignatureDevice, outbox []store.OutboxEvent) error
 type GetSignatureDeviceFn func(ctx context.Context, id string) (store.SignatureDevice, error)
-type UpdateSignatureDeviceFn func(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice) error
+type UpdateSignatureDeviceFn func(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox []store.OutboxEvent) error
+type AppendSignaturesFn func(ctx context.Context, id string, signatures []store.UpdateSignatureDevice, version string) error
+type UpdateSignatureDeviceDetailsFn func(ctx context.Context, id string, updateDetails store.UpdateSignatureDeviceDetails, outbox []store.OutboxEvent) error
+type RotateSignatureDeviceKeyFn func(ctx context.Context, id string, rotateKey store.RotateSignatureDeviceKey, outbox []store.OutboxEvent) error
+type DeleteSignatureDeviceFn func(ctx context.Context, id string, version string, outbox []store.OutboxEvent) error
+type ListSignatureDevicesFn func(ctx context.Context, filter store.ListFilter) ([]store.SignatureDevice, error)
+type ListPublicKeysFn func(ctx context.Context, id string) ([]store.PublicKeyRecord, error)
+type ScanSignaturesFn func(ctx context.Context, id string, fn func(store.SignatureRecord) error) error
 
-var defaultCreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice) error {
+var defaultCreateSignatureDeviceFn = func(ctx context.Context, sigDevice store.SignatureDevice, outbox []store.OutboxEvent) error {
 	panic("not implemented")
 }
 
@@ -24,20 +38,76 @@ var defaultGetSignatureDeviceFn = func(ctx context.Context, id string) (store.Si
 	panic("not implemented")
 }
 
-var defaultUpdateSignatureDeviceFn = func(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice) error {
+var defaultUpdateSignatureDeviceFn = func(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox []store.OutboxEvent) error {
 	panic("not implemented")
 }
 
-func (s *Store) CreateSignatureDevice(ctx context.Context, sigDevice store.SignatureDevice) error {
-	return s.CreateSignatureDeviceFn(ctx, sigDevice)
+var defaultAppendSignaturesFn = func(ctx context.Context, id string, signatures []store.UpdateSignatureDevice, version string) error {
+	panic("not implemented")
+}
+
+var defaultUpdateSignatureDeviceDetailsFn = func(ctx context.Context, id string, updateDetails store.UpdateSignatureDeviceDetails, outbox []store.OutboxEvent) error {
+	panic("not implemented")
+}
+
+var defaultRotateSignatureDeviceKeyFn = func(ctx context.Context, id string, rotateKey store.RotateSignatureDeviceKey, outbox []store.OutboxEvent) error {
+	panic("not implemented")
+}
+
+var defaultDeleteSignatureDeviceFn = func(ctx context.Context, id string, version string, outbox []store.OutboxEvent) error {
+	panic("not implemented")
+}
+
+var defaultListSignatureDevicesFn = func(ctx context.Context, filter store.ListFilter) ([]store.SignatureDevice, error) {
+	panic("not implemented")
+}
+
+var defaultListPublicKeysFn = func(ctx context.Context, id string) ([]store.PublicKeyRecord, error) {
+	panic("not implemented")
+}
+
+var defaultScanSignaturesFn = func(ctx context.Context, id string, fn func(store.SignatureRecord) error) error {
+	panic("not implemented")
+}
+
+func (s *Store) CreateSignatureDevice(ctx context.Context, sigDevice store.SignatureDevice, outbox ...store.OutboxEvent) error {
+	return s.CreateSignatureDeviceFn(ctx, sigDevice, outbox)
 }
 
 func (s *Store) GetSignatureDevice(ctx context.Context, id string) (store.SignatureDevice, error) {
 	return s.GetSignatureDeviceFn(ctx, id)
 }
 
-func (s *Store) UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice) error {
-	return s.UpdateSignatureDeviceFn(ctx, id, updateSignDevice)
+func (s *Store) UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox ...store.OutboxEvent) error {
+	return s.UpdateSignatureDeviceFn(ctx, id, updateSignDevice, outbox)
+}
+
+func (s *Store) AppendSignatures(ctx context.Context, id string, signatures []store.UpdateSignatureDevice, version string) error {
+	return s.AppendSignaturesFn(ctx, id, signatures, version)
+}
+
+func (s *Store) UpdateSignatureDeviceDetails(ctx context.Context, id string, updateDetails store.UpdateSignatureDeviceDetails, outbox ...store.OutboxEvent) error {
+	return s.UpdateSignatureDeviceDetailsFn(ctx, id, updateDetails, outbox)
+}
+
+func (s *Store) RotateSignatureDeviceKey(ctx context.Context, id string, rotateKey store.RotateSignatureDeviceKey, outbox ...store.OutboxEvent) error {
+	return s.RotateSignatureDeviceKeyFn(ctx, id, rotateKey, outbox)
+}
+
+func (s *Store) DeleteSignatureDevice(ctx context.Context, id string, version string, outbox ...store.OutboxEvent) error {
+	return s.DeleteSignatureDeviceFn(ctx, id, version, outbox)
+}
+
+func (s *Store) ListSignatureDevices(ctx context.Context, filter store.ListFilter) ([]store.SignatureDevice, error) {
+	return s.ListSignatureDevicesFn(ctx, filter)
+}
+
+func (s *Store) ListPublicKeys(ctx context.Context, id string) ([]store.PublicKeyRecord, error) {
+	return s.ListPublicKeysFn(ctx, id)
+}
+
+func (s *Store) ScanSignatures(ctx context.Context, id string, fn func(store.SignatureRecord) error) error {
+	return s.ScanSignaturesFn(ctx, id, fn)
 }
 
 func New() *Store {
@@ -45,5 +115,12 @@ func New() *Store {
 		CreateSignatureDeviceFn: defaultCreateSignatureDeviceFn,
 		GetSignatureDeviceFn: defaultGetSignatureDeviceFn,
 		UpdateSignatureDeviceFn: defaultUpdateSignatureDeviceFn,
+		AppendSignaturesFn: defaultAppendSignaturesFn,
+		UpdateSignatureDeviceDetailsFn: defaultUpdateSignatureDeviceDetailsFn,
+		RotateSignatureDeviceKeyFn: defaultRotateSignatureDeviceKeyFn,
+		DeleteSignatureDeviceFn: defaultDeleteSignatureDeviceFn,
+		ListSignatureDevicesFn: defaultListSignatureDevicesFn,
+		ListPublicKeysFn: defaultListPublicKeysFn,
+		ScanSignaturesFn: defaultScanSignaturesFn,
 	}
 }
\ No newline at end of file
@@ -0,0 +1,560 @@
+// Package storetest is the conformance suite of store.Store: every implementation is expected to
+// pass it, so that the service behaves the same whichever store backs it.
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.Store {
+//			return mystore.New()
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewStore returns an empty store, which is used by a single test.
+type NewStore func(t *testing.T) store.Store
+
+// Run runs every conformance test against stores built by newStore.
+func Run(t *testing.T, newStore NewStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s store.Store)
+	}{
+		{name: "create and get", test: testCreateAndGet},
+		{name: "get unknown device", test: testGetUnknownDevice},
+		{name: "create duplicate", test: testCreateDuplicate},
+		{name: "returned devices are copies", test: testReturnedDevicesAreCopies},
+		{name: "update", test: testUpdate},
+		{name: "update details", test: testUpdateDetails},
+		{name: "rotate key", test: testRotateKey},
+		{name: "delete", test: testDelete},
+		{name: "optimistic conflicts", test: testOptimisticConflicts},
+		{name: "unknown device writes", test: testUnknownDeviceWrites},
+		{name: "concurrent updates", test: testConcurrentUpdates},
+		{name: "list order", test: testListOrder},
+		{name: "list filter", test: testListFilter},
+		{name: "history", test: testHistory},
+		{name: "history of unknown device", test: testHistoryOfUnknownDevice},
+		{name: "imported history keeps its times", test: testImportedHistoryKeepsItsTimes},
+		{name: "append signatures", test: testAppendSignatures},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newStore(t))
+		})
+	}
+}
+
+func newDevice(id string) store.SignatureDevice {
+	return store.SignatureDevice{
+		ID:           id,
+		Tenant:       "some-tenant",
+		SignatureAlg: "ECC",
+		Label:        "some-label",
+		Metadata:     map[string]string{"store": "berlin"},
+		Tags:         []string{"pos"},
+		PublicKey:    []byte("public-" + id),
+		PrivateKey:   []byte("private-" + id),
+		Status:       store.StatusActive,
+		KeyVersion:   1,
+	}
+}
+
+func create(t *testing.T, s store.Store, sigDevice store.SignatureDevice) store.SignatureDevice {
+	t.Helper()
+
+	require.NoError(t, s.CreateSignatureDevice(context.Background(), sigDevice))
+	created, err := s.GetSignatureDevice(context.Background(), sigDevice.ID)
+	require.NoError(t, err)
+	return created
+}
+
+func testCreateAndGet(t *testing.T, s store.Store) {
+	expected := newDevice("some-id")
+	got := create(t, s, expected)
+
+	assert.NotEmpty(t, got.Version)
+	assert.False(t, got.CreatedAt.IsZero())
+	expected.Version = got.Version
+	expected.CreatedAt = got.CreatedAt
+	assert.Equal(t, expected, got)
+}
+
+func testGetUnknownDevice(t *testing.T, s store.Store) {
+	_, err := s.GetSignatureDevice(context.Background(), "unknown-id")
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+}
+
+func testCreateDuplicate(t *testing.T, s store.Store) {
+	original := create(t, s, newDevice("some-id"))
+
+	duplicate := newDevice("some-id")
+	duplicate.Label = "other-label"
+	assert.ErrorIs(t, s.CreateSignatureDevice(context.Background(), duplicate), store.ErrDeviceExists)
+
+	got, err := s.GetSignatureDevice(context.Background(), "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, original, got)
+}
+
+func testReturnedDevicesAreCopies(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	sigDevice := newDevice("some-id")
+	require.NoError(t, s.CreateSignatureDevice(ctx, sigDevice))
+	sigDevice.Metadata["store"] = "munich"
+	sigDevice.PrivateKey[0] = 'x'
+
+	got, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	got.Metadata["store"] = "hamburg"
+	got.Tags[0] = "other-tag"
+
+	listed, err := s.ListSignatureDevices(ctx, store.ListFilter{})
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, map[string]string{"store": "berlin"}, listed[0].Metadata)
+	assert.Equal(t, []string{"pos"}, listed[0].Tags)
+	assert.Equal(t, []byte("private-some-id"), listed[0].PrivateKey)
+}
+
+func testUpdate(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	created := create(t, s, newDevice("some-id"))
+
+	require.NoError(t, s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{
+		SignatureCounter: 1,
+		LastSignature:    "some-signature",
+		Version:          created.Version,
+	}))
+
+	got, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.SignatureCounter)
+	assert.Equal(t, "some-signature", got.LastSignature)
+	assert.NotEqual(t, created.Version, got.Version)
+	assert.Equal(t, created.PrivateKey, got.PrivateKey)
+	assert.Equal(t, created.Label, got.Label)
+}
+
+func testUpdateDetails(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	created := create(t, s, newDevice("some-id"))
+
+	label := "other-label"
+	require.NoError(t, s.UpdateSignatureDeviceDetails(ctx, "some-id", store.UpdateSignatureDeviceDetails{
+		Label:   &label,
+		Version: created.Version,
+	}))
+	labelled, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, "other-label", labelled.Label)
+	assert.Equal(t, created.Metadata, labelled.Metadata)
+	assert.Equal(t, created.Tags, labelled.Tags)
+	assert.NotEqual(t, created.Version, labelled.Version)
+
+	suspended := store.StatusSuspended
+	require.NoError(t, s.UpdateSignatureDeviceDetails(ctx, "some-id", store.UpdateSignatureDeviceDetails{
+		Metadata: map[string]string{},
+		Tags:     []string{"test"},
+		Status:   &suspended,
+		Version:  labelled.Version,
+	}))
+	got, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, "other-label", got.Label)
+	assert.Empty(t, got.Metadata)
+	assert.Equal(t, []string{"test"}, got.Tags)
+	assert.Equal(t, store.StatusSuspended, got.Status)
+}
+
+func testRotateKey(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	created := create(t, s, newDevice("some-id"))
+	require.NoError(t, s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: 1, LastSignature: "some-signature", Version: created.Version}))
+	signed, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+
+	require.NoError(t, s.RotateSignatureDeviceKey(ctx, "some-id", store.RotateSignatureDeviceKey{
+		PublicKey:  []byte("other-public"),
+		PrivateKey: []byte("other-private"),
+		Version:    signed.Version,
+	}))
+
+	got, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("other-public"), got.PublicKey)
+	assert.Equal(t, []byte("other-private"), got.PrivateKey)
+	assert.Equal(t, 2, got.KeyVersion)
+	assert.Equal(t, 1, got.SignatureCounter)
+	assert.Equal(t, "some-signature", got.LastSignature)
+	assert.NotEqual(t, signed.Version, got.Version)
+}
+
+func testDelete(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	created := create(t, s, newDevice("some-id"))
+	create(t, s, newDevice("other-id"))
+
+	require.NoError(t, s.DeleteSignatureDevice(ctx, "some-id", created.Version))
+
+	_, err := s.GetSignatureDevice(ctx, "some-id")
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+	listed, err := s.ListSignatureDevices(ctx, store.ListFilter{})
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, "other-id", listed[0].ID)
+
+	// the ID is free again
+	recreated := create(t, s, newDevice("some-id"))
+	assert.Equal(t, 0, recreated.SignatureCounter)
+	assert.Equal(t, 1, recreated.KeyVersion)
+}
+
+func testOptimisticConflicts(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	created := create(t, s, newDevice("some-id"))
+	require.NoError(t, s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: 1, Version: created.Version}))
+	current, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+
+	label := "other-label"
+	writes := []struct {
+		name  string
+		write func(version string) error
+	}{
+		{name: "update", write: func(version string) error {
+			return s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{SignatureCounter: 2, Version: version})
+		}},
+		{name: "append signatures", write: func(version string) error {
+			return s.AppendSignatures(ctx, "some-id", []store.UpdateSignatureDevice{{SignatureCounter: 2}}, version)
+		}},
+		{name: "update details", write: func(version string) error {
+			return s.UpdateSignatureDeviceDetails(ctx, "some-id", store.UpdateSignatureDeviceDetails{Label: &label, Version: version})
+		}},
+		{name: "rotate key", write: func(version string) error {
+			return s.RotateSignatureDeviceKey(ctx, "some-id", store.RotateSignatureDeviceKey{PublicKey: []byte("other-public"), PrivateKey: []byte("other-private"), Version: version})
+		}},
+		{name: "delete", write: func(version string) error {
+			return s.DeleteSignatureDevice(ctx, "some-id", version)
+		}},
+	}
+
+	for _, write := range writes {
+		assert.ErrorIs(t, write.write(created.Version), store.ErrVersionConflict, write.name)
+	}
+
+	got, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, current, got, "a conflicting write must not change the device")
+}
+
+func testUnknownDeviceWrites(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	label := "other-label"
+
+	assert.ErrorIs(t, s.UpdateSignatureDevice(ctx, "unknown-id", store.UpdateSignatureDevice{SignatureCounter: 1, Version: "1"}), store.ErrDeviceNotFound)
+	assert.ErrorIs(t, s.AppendSignatures(ctx, "unknown-id", []store.UpdateSignatureDevice{{SignatureCounter: 1}}, "1"), store.ErrDeviceNotFound)
+	assert.ErrorIs(t, s.UpdateSignatureDeviceDetails(ctx, "unknown-id", store.UpdateSignatureDeviceDetails{Label: &label, Version: "1"}), store.ErrDeviceNotFound)
+	assert.ErrorIs(t, s.RotateSignatureDeviceKey(ctx, "unknown-id", store.RotateSignatureDeviceKey{Version: "1"}), store.ErrDeviceNotFound)
+	assert.ErrorIs(t, s.DeleteSignatureDevice(ctx, "unknown-id", "1"), store.ErrDeviceNotFound)
+}
+
+// testConcurrentUpdates increments the counter from several goroutines, retrying on conflicts as the
+// service does: no increment may be lost.
+func testConcurrentUpdates(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	create(t, s, newDevice("some-id"))
+
+	const workers = 8
+	const increments = 25
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; {
+				current, err := s.GetSignatureDevice(ctx, "some-id")
+				if err != nil {
+					errs <- err
+					return
+				}
+				err = s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{
+					SignatureCounter: current.SignatureCounter + 1,
+					LastSignature:    fmt.Sprintf("signature-%v", current.SignatureCounter+1),
+					Version:          current.Version,
+				})
+				if err == nil {
+					i++
+				} else if !errors.Is(err, store.ErrVersionConflict) {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	got, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, workers*increments, got.SignatureCounter)
+	assert.Equal(t, fmt.Sprintf("signature-%v", workers*increments), got.LastSignature)
+}
+
+func testListOrder(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	for _, id := range []string{"c", "a", "d", "b"} {
+		create(t, s, newDevice(id))
+	}
+
+	listed, err := s.ListSignatureDevices(ctx, store.ListFilter{})
+	require.NoError(t, err)
+	ids := []string{}
+	for _, sigDevice := range listed {
+		ids = append(ids, sigDevice.ID)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, ids)
+}
+
+func testListFilter(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	empty, err := s.ListSignatureDevices(ctx, store.ListFilter{})
+	require.NoError(t, err)
+	assert.NotNil(t, empty)
+	assert.Empty(t, empty)
+
+	devices := []struct {
+		id       string
+		metadata map[string]string
+		tags     []string
+	}{
+		{id: "a", metadata: map[string]string{"store": "berlin", "register": "1"}, tags: []string{"pos", "test"}},
+		{id: "b", metadata: map[string]string{"store": "berlin", "register": "2"}, tags: []string{"pos"}},
+		{id: "c", metadata: map[string]string{"store": "munich", "register": "1"}, tags: nil},
+	}
+	for _, d := range devices {
+		sigDevice := newDevice(d.id)
+		sigDevice.Metadata = d.metadata
+		sigDevice.Tags = d.tags
+		create(t, s, sigDevice)
+	}
+
+	tests := []struct {
+		filter   store.ListFilter
+		expected []string
+	}{
+		{filter: store.ListFilter{}, expected: []string{"a", "b", "c"}},
+		{filter: store.ListFilter{Tags: []string{"pos"}}, expected: []string{"a", "b"}},
+		{filter: store.ListFilter{Tags: []string{"pos", "test"}}, expected: []string{"a"}},
+		{filter: store.ListFilter{Metadata: map[string]string{"store": "berlin"}}, expected: []string{"a", "b"}},
+		{filter: store.ListFilter{Metadata: map[string]string{"register": "1"}, Tags: []string{"pos"}}, expected: []string{"a"}},
+		{filter: store.ListFilter{Metadata: map[string]string{"store": "hamburg"}}, expected: []string{}},
+	}
+
+	for _, tc := range tests {
+		listed, err := s.ListSignatureDevices(ctx, tc.filter)
+		require.NoError(t, err)
+		ids := []string{}
+		for _, sigDevice := range listed {
+			ids = append(ids, sigDevice.ID)
+		}
+		assert.Equal(t, tc.expected, ids, "filter %+v", tc.filter)
+	}
+}
+
+// signatures collects the signatures of a device.
+func signatures(t *testing.T, s store.Store, id string) []store.SignatureRecord {
+	t.Helper()
+
+	collected := []store.SignatureRecord{}
+	require.NoError(t, s.ScanSignatures(context.Background(), id, func(signature store.SignatureRecord) error {
+		collected = append(collected, signature)
+		return nil
+	}))
+	return collected
+}
+
+func testHistory(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	created := create(t, s, newDevice("some-id"))
+
+	version := created.Version
+	sign := func(counter int) {
+		t.Helper()
+		require.NoError(t, s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{
+			SignatureCounter: counter + 1,
+			LastSignature:    fmt.Sprintf("signature-%v", counter),
+			SignedData:       fmt.Sprintf("data-%v", counter),
+			Version:          version,
+		}))
+		got, err := s.GetSignatureDevice(ctx, "some-id")
+		require.NoError(t, err)
+		version = got.Version
+	}
+	sign(0)
+	sign(1)
+	require.NoError(t, s.RotateSignatureDeviceKey(ctx, "some-id", store.RotateSignatureDeviceKey{
+		PublicKey:  []byte("other-public"),
+		PrivateKey: []byte("other-private"),
+		Version:    version,
+	}))
+	rotated, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	version = rotated.Version
+	sign(2)
+
+	publicKeys, err := s.ListPublicKeys(ctx, "some-id")
+	require.NoError(t, err)
+	require.Len(t, publicKeys, 2)
+	assert.Equal(t, 1, publicKeys[0].KeyVersion)
+	assert.Equal(t, created.PublicKey, publicKeys[0].PublicKey)
+	assert.Equal(t, 2, publicKeys[1].KeyVersion)
+	assert.Equal(t, []byte("other-public"), publicKeys[1].PublicKey)
+	assert.False(t, publicKeys[1].CreatedAt.IsZero())
+
+	collected := signatures(t, s, "some-id")
+	require.Len(t, collected, 3)
+	for i, signature := range collected {
+		assert.Equal(t, "some-id", signature.DeviceID)
+		assert.Equal(t, i, signature.SignatureCounter)
+		assert.Equal(t, fmt.Sprintf("signature-%v", i), signature.Signature)
+		assert.Equal(t, fmt.Sprintf("data-%v", i), signature.SignedData)
+		assert.False(t, signature.CreatedAt.IsZero())
+	}
+	assert.Equal(t, []int{1, 1, 2}, []int{collected[0].KeyVersion, collected[1].KeyVersion, collected[2].KeyVersion})
+
+	// the scan stops at the first error
+	stop := errors.New("stop")
+	scanned := 0
+	err = s.ScanSignatures(ctx, "some-id", func(store.SignatureRecord) error {
+		scanned++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, scanned)
+
+	// returned public keys are copies
+	publicKeys[0].PublicKey[0] = 'x'
+	again, err := s.ListPublicKeys(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, created.PublicKey, again[0].PublicKey)
+
+	// the history is dropped with the device
+	require.NoError(t, s.DeleteSignatureDevice(ctx, "some-id", version))
+	recreated := create(t, s, newDevice("some-id"))
+	assert.Empty(t, signatures(t, s, "some-id"))
+	publicKeys, err = s.ListPublicKeys(ctx, "some-id")
+	require.NoError(t, err)
+	require.Len(t, publicKeys, 1)
+	assert.Equal(t, 1, publicKeys[0].KeyVersion)
+	assert.Equal(t, recreated.PublicKey, publicKeys[0].PublicKey)
+}
+
+func testHistoryOfUnknownDevice(t *testing.T, s store.Store) {
+	_, err := s.ListPublicKeys(context.Background(), "unknown-id")
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+	err = s.ScanSignatures(context.Background(), "unknown-id", func(store.SignatureRecord) error { return nil })
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+}
+
+func testImportedHistoryKeepsItsTimes(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	signedAt := createdAt.Add(time.Hour)
+	rotatedAt := createdAt.Add(2 * time.Hour)
+
+	sigDevice := newDevice("some-id")
+	sigDevice.CreatedAt = createdAt
+	created := create(t, s, sigDevice)
+	assert.True(t, createdAt.Equal(created.CreatedAt), created.CreatedAt)
+	require.NoError(t, s.UpdateSignatureDevice(ctx, "some-id", store.UpdateSignatureDevice{
+		SignatureCounter: 1,
+		LastSignature:    "signature-0",
+		SignedData:       "data-0",
+		SignedAt:         signedAt,
+		Version:          created.Version,
+	}))
+	signed, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	require.NoError(t, s.RotateSignatureDeviceKey(ctx, "some-id", store.RotateSignatureDeviceKey{
+		PublicKey:  []byte("other-public"),
+		PrivateKey: []byte("other-private"),
+		RotatedAt:  rotatedAt,
+		Version:    signed.Version,
+	}))
+
+	publicKeys, err := s.ListPublicKeys(ctx, "some-id")
+	require.NoError(t, err)
+	require.Len(t, publicKeys, 2)
+	assert.True(t, createdAt.Equal(publicKeys[0].CreatedAt), publicKeys[0].CreatedAt)
+	assert.True(t, rotatedAt.Equal(publicKeys[1].CreatedAt), publicKeys[1].CreatedAt)
+	collected := signatures(t, s, "some-id")
+	require.Len(t, collected, 1)
+	assert.True(t, signedAt.Equal(collected[0].CreatedAt), collected[0].CreatedAt)
+}
+
+func testAppendSignatures(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	signedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	created := create(t, s, newDevice("some-id"))
+
+	// nothing to append is no change
+	require.NoError(t, s.AppendSignatures(ctx, "some-id", nil, created.Version))
+	unchanged, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, created, unchanged)
+
+	appended := []store.UpdateSignatureDevice{}
+	for i := 0; i < 3; i++ {
+		appended = append(appended, store.UpdateSignatureDevice{
+			SignatureCounter: i + 1,
+			LastSignature:    fmt.Sprintf("signature-%v", i),
+			SignedData:       fmt.Sprintf("data-%v", i),
+			SignedAt:         signedAt.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	require.NoError(t, s.AppendSignatures(ctx, "some-id", appended, created.Version))
+
+	got, err := s.GetSignatureDevice(ctx, "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.SignatureCounter)
+	assert.Equal(t, "signature-2", got.LastSignature)
+	assert.NotEqual(t, created.Version, got.Version)
+
+	collected := signatures(t, s, "some-id")
+	require.Len(t, collected, 3)
+	for i, signature := range collected {
+		assert.Equal(t, i, signature.SignatureCounter)
+		assert.Equal(t, fmt.Sprintf("signature-%v", i), signature.Signature)
+		assert.Equal(t, fmt.Sprintf("data-%v", i), signature.SignedData)
+		assert.Equal(t, 1, signature.KeyVersion)
+		assert.True(t, appended[i].SignedAt.Equal(signature.CreatedAt), signature.CreatedAt)
+	}
+
+	// the signatures are appended after the ones already recorded
+	require.NoError(t, s.AppendSignatures(ctx, "some-id", []store.UpdateSignatureDevice{{
+		SignatureCounter: 4,
+		LastSignature:    "signature-3",
+		SignedData:       "data-3",
+	}}, got.Version))
+	collected = signatures(t, s, "some-id")
+	require.Len(t, collected, 4)
+	assert.Equal(t, "signature-3", collected[3].Signature)
+	assert.False(t, collected[3].CreatedAt.IsZero())
+}
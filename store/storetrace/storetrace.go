@@ -0,0 +1,134 @@
+// Package storetrace decorates a store.Store with OpenTelemetry spans.
+package storetrace
+
+import (
+	"context"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/fiskaly/coding-challenges/signing-service-challenge/store")
+
+// Store wraps another store.Store and records a span for every call.
+type Store struct {
+	next store.Store
+}
+
+func (s *Store) CreateSignatureDevice(ctx context.Context, sigDevice store.SignatureDevice, outbox ...store.OutboxEvent) error {
+	ctx, span := start(ctx, "store.CreateSignatureDevice", sigDevice.ID)
+	defer span.End()
+
+	return record(span, s.next.CreateSignatureDevice(ctx, sigDevice, outbox...))
+}
+
+func (s *Store) GetSignatureDevice(ctx context.Context, id string) (store.SignatureDevice, error) {
+	ctx, span := start(ctx, "store.GetSignatureDevice", id)
+	defer span.End()
+
+	signDevice, err := s.next.GetSignatureDevice(ctx, id)
+	return signDevice, record(span, err)
+}
+
+func (s *Store) UpdateSignatureDevice(ctx context.Context, id string, updateSignDevice store.UpdateSignatureDevice, outbox ...store.OutboxEvent) error {
+	ctx, span := start(ctx, "store.UpdateSignatureDevice", id)
+	defer span.End()
+
+	return record(span, s.next.UpdateSignatureDevice(ctx, id, updateSignDevice, outbox...))
+}
+
+func (s *Store) AppendSignatures(ctx context.Context, id string, signatures []store.UpdateSignatureDevice, version string) error {
+	ctx, span := start(ctx, "store.AppendSignatures", id)
+	defer span.End()
+
+	return record(span, s.next.AppendSignatures(ctx, id, signatures, version))
+}
+
+func (s *Store) UpdateSignatureDeviceDetails(ctx context.Context, id string, updateDetails store.UpdateSignatureDeviceDetails, outbox ...store.OutboxEvent) error {
+	ctx, span := start(ctx, "store.UpdateSignatureDeviceDetails", id)
+	defer span.End()
+
+	return record(span, s.next.UpdateSignatureDeviceDetails(ctx, id, updateDetails, outbox...))
+}
+
+func (s *Store) RotateSignatureDeviceKey(ctx context.Context, id string, rotateKey store.RotateSignatureDeviceKey, outbox ...store.OutboxEvent) error {
+	ctx, span := start(ctx, "store.RotateSignatureDeviceKey", id)
+	defer span.End()
+
+	return record(span, s.next.RotateSignatureDeviceKey(ctx, id, rotateKey, outbox...))
+}
+
+func (s *Store) ListSignatureDevices(ctx context.Context, filter store.ListFilter) ([]store.SignatureDevice, error) {
+	ctx, span := tracer.Start(ctx, "store.ListSignatureDevices", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	signDevices, err := s.next.ListSignatureDevices(ctx, filter)
+	span.SetAttributes(attribute.Int("devices.count", len(signDevices)))
+	return signDevices, record(span, err)
+}
+
+func (s *Store) ListPublicKeys(ctx context.Context, id string) ([]store.PublicKeyRecord, error) {
+	ctx, span := start(ctx, "store.ListPublicKeys", id)
+	defer span.End()
+
+	publicKeys, err := s.next.ListPublicKeys(ctx, id)
+	return publicKeys, record(span, err)
+}
+
+func (s *Store) ScanSignatures(ctx context.Context, id string, fn func(store.SignatureRecord) error) error {
+	ctx, span := start(ctx, "store.ScanSignatures", id)
+	defer span.End()
+
+	signatures := 0
+	err := s.next.ScanSignatures(ctx, id, func(signature store.SignatureRecord) error {
+		signatures++
+		return fn(signature)
+	})
+	span.SetAttributes(attribute.Int("signatures.count", signatures))
+	return record(span, err)
+}
+
+func (s *Store) DeleteSignatureDevice(ctx context.Context, id string, version string, outbox ...store.OutboxEvent) error {
+	ctx, span := start(ctx, "store.DeleteSignatureDevice", id)
+	defer span.End()
+
+	return record(span, s.next.DeleteSignatureDevice(ctx, id, version, outbox...))
+}
+
+// Ping forwards to the wrapped store when it implements store.Pinger.
+func (s *Store) Ping(ctx context.Context) error {
+	pinger, ok := s.next.(store.Pinger)
+	if !ok {
+		return nil
+	}
+
+	ctx, span := tracer.Start(ctx, "store.Ping", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	return record(span, pinger.Ping(ctx))
+}
+
+func start(ctx context.Context, name string, deviceID string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("device.id", deviceID)),
+	)
+}
+
+func record(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// New wraps next with tracing.
+func New(next store.Store) *Store {
+	return &Store{
+		next: next,
+	}
+}
@@ -0,0 +1,36 @@
+package storetrace_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/storetrace"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStoreCallsAreTraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(sdktrace.NewTracerProvider()) })
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	s := storetrace.New(inmemory.New())
+	assert.NoError(t, s.CreateSignatureDevice(ctx, store.SignatureDevice{ID: "some-id"}))
+	_, err := s.GetSignatureDevice(ctx, "missing-id")
+	assert.ErrorIs(t, err, store.ErrDeviceNotFound)
+	parent.End()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	assert.Equal(t, "store.CreateSignatureDevice", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, "store.GetSignatureDevice", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
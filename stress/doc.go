@@ -0,0 +1,8 @@
+// Package stress holds the concurrency stress tests of the signing service: many clients sign
+// with a few devices at once, against every store backend, and the resulting signature chains
+// are checked to be gap-free and valid end to end.
+//
+//	go test -race ./stress
+//	go test ./stress -stress.signatures=20000 -stress.clients=256
+//	go test ./stress -run xxx -bench .
+package stress
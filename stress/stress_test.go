@@ -0,0 +1,179 @@
+package stress_test
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto/cryptotest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/logging"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/servicetest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/dualwrite"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/filelog"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/store/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	signatures = flag.Int("stress.signatures", 2000, "number of signatures requested by every stress test, a tenth of it in short mode")
+	devices    = flag.Int("stress.devices", 4, "number of devices the signatures are spread over")
+	clients    = flag.Int("stress.clients", 64, "number of concurrent clients")
+)
+
+// backends are the stores every stress test runs against.
+var backends = []struct {
+	name     string
+	newStore func(tb testing.TB) store.Store
+}{
+	{name: "inmemory", newStore: func(tb testing.TB) store.Store {
+		return inmemory.New()
+	}},
+	{name: "filelog", newStore: func(tb testing.TB) store.Store {
+		s, err := filelog.Open(tb.TempDir())
+		require.NoError(tb, err)
+		tb.Cleanup(func() { s.Close() })
+		return s
+	}},
+	{name: "dualwrite", newStore: func(tb testing.TB) store.Store {
+		return dualwrite.New(inmemory.New(), inmemory.New())
+	}},
+}
+
+// quietContext drops the audit entries, which would otherwise flood the test output.
+func quietContext() context.Context {
+	return logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// createDevices creates devices alternating between the algorithms.
+func createDevices(tb testing.TB, service *signature.Service, count int) []signature.SignatureDevice {
+	tb.Helper()
+
+	created := []signature.SignatureDevice{}
+	for i := 0; i < count; i++ {
+		signatureAlg := []string{"ECC", "RSA"}[i%2]
+		device, _, err := service.CreateSignatureDevice(quietContext(), signature.NewSignatureDevice{
+			ID:           fmt.Sprintf("device-%v", i),
+			Tenant:       "stress",
+			SignatureAlg: signatureAlg,
+		})
+		require.NoError(tb, err)
+		created = append(created, device)
+	}
+
+	return created
+}
+
+func TestConcurrentSignaturesAreGapFree(t *testing.T) {
+	total := *signatures
+	if testing.Short() {
+		total /= 10
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := quietContext()
+			service := servicetest.New(t, servicetest.WithStore(backend.newStore(t))).Signature
+			devices := createDevices(t, service, *devices)
+
+			var mu sync.Mutex
+			signed := map[string][]signature.Signature{}
+			var gaveUp atomic.Int64
+			var next atomic.Int64
+			var wg sync.WaitGroup
+			for client := 0; client < *clients; client++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						request := next.Add(1) - 1
+						if request >= int64(total) {
+							return
+						}
+						device := devices[request%int64(len(devices))]
+
+						result, err := service.SignData(ctx, device.ID, fmt.Sprintf("transaction-%v", request))
+						if signature.ErrorCode(err) == signature.CodeConflict {
+							// the signatures of the service are serialized: none may lose the optimistic lock
+							gaveUp.Add(1)
+							continue
+						}
+						if !assert.NoError(t, err) {
+							return
+						}
+
+						mu.Lock()
+						signed[device.ID] = append(signed[device.ID], result)
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			succeeded := 0
+			for _, device := range devices {
+				verifyChain(t, device, signed[device.ID])
+				current, err := service.GetSignatureDevice(ctx, device.ID)
+				require.NoError(t, err)
+				assert.Equal(t, len(signed[device.ID]), current.SignatureCounter, "device %v", device.ID)
+				succeeded += len(signed[device.ID])
+			}
+			assert.Zero(t, gaveUp.Load(), "requests gave up after repeated conflicts")
+			assert.Equal(t, total, succeeded)
+		})
+	}
+}
+
+// verifyChain checks that the signatures of device use every counter from 0 exactly once, that each one
+// chains from the previous signature, or from the encoded device ID for the first, and that all are valid.
+func verifyChain(t *testing.T, device signature.SignatureDevice, signatures []signature.Signature) {
+	t.Helper()
+
+	byCounter := make([]*signature.Signature, len(signatures))
+	for i := range signatures {
+		counter, err := strconv.Atoi(strings.SplitN(signatures[i].SignedData, "_", 2)[0])
+		require.NoError(t, err)
+		require.Less(t, counter, len(signatures), "device %v: counter %v leaves a gap", device.ID, counter)
+		require.Nil(t, byCounter[counter], "device %v: counter %v used twice", device.ID, counter)
+		byCounter[counter] = &signatures[i]
+	}
+
+	lastSignature := base64.StdEncoding.EncodeToString([]byte(device.ID))
+	for counter, signed := range byCounter {
+		assert.True(t, strings.HasSuffix(signed.SignedData, "_"+lastSignature), "device %v: counter %v does not chain from the previous signature", device.ID, counter)
+		cryptotest.VerifySignature(t, device.SignatureAlg, string(device.PublicKey), signed.SignedData, signed.Signature, "device %v: counter %v has an invalid signature", device.ID, counter)
+		lastSignature = signed.Signature
+	}
+}
+
+func BenchmarkConcurrentSignData(b *testing.B) {
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			ctx := quietContext()
+			service := servicetest.New(b, servicetest.WithStore(backend.newStore(b))).Signature
+			devices := createDevices(b, service, *devices)
+
+			var next atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					device := devices[next.Add(1)%int64(len(devices))]
+					_, err := service.SignData(ctx, device.ID, "transaction")
+					if err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}